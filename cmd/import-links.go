@@ -0,0 +1,127 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/amieldelatorre/shurl/internal"
+	"github.com/amieldelatorre/shurl/internal/config"
+	"github.com/amieldelatorre/shurl/internal/handlers"
+	"github.com/amieldelatorre/shurl/internal/utils"
+	"github.com/google/uuid"
+	"github.com/spf13/cobra"
+)
+
+var (
+	importLinksCmdEmailInput          string
+	importLinksCmdFileInput           string
+	importLinksCmdFormatInput         string
+	importLinksCmdIdempotencyKeyInput string
+	importLinksCmdDryRun              bool
+)
+
+// importLinksCmd represents the importLinks command
+var importLinksCmd = &cobra.Command{
+	Use:   "import-links",
+	Short: "Import short urls for a user from a csv, json or ndjson file",
+	Long: `Import short urls for a user from a csv, json or ndjson file, keeping their slugs.
+The csv header can use the column names of our own export or of other shorteners, e.g. long_url, keyword or slashtag.
+Use --dry-run first to see which rows would fail, including slugs that are already taken.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		tempLogger := utils.NewCustomJsonLogger(os.Stdout, slog.LevelDebug)
+		ctx, cancel := context.WithTimeout(context.Background(), time.Duration(5)*time.Minute)
+		defer cancel()
+		ctx = context.WithValue(ctx, utils.RequestIdName, "import-links")
+
+		importLinksCmdEmailInput = strings.TrimSpace(importLinksCmdEmailInput)
+		importLinksCmdFileInput = strings.TrimSpace(importLinksCmdFileInput)
+		importLinksCmdFormatInput = strings.ToLower(strings.TrimSpace(importLinksCmdFormatInput))
+		if importLinksCmdFormatInput == "" {
+			importLinksCmdFormatInput = strings.TrimPrefix(strings.ToLower(filepath.Ext(importLinksCmdFileInput)), ".")
+		}
+
+		// a fixed idempotency key makes it safe to run the same import again after a failure
+		idempotencyKey, err := uuid.NewV7()
+		if err != nil {
+			tempLogger.ErrorExit(ctx, err.Error())
+		}
+		if importLinksCmdIdempotencyKeyInput != "" {
+			idempotencyKey, err = uuid.Parse(strings.TrimSpace(importLinksCmdIdempotencyKeyInput))
+			if err != nil {
+				tempLogger.ErrorExit(ctx, "--idempotency-key is not a valid uuid")
+			}
+		}
+
+		var file io.ReadCloser = os.Stdin
+		if importLinksCmdFileInput != "-" {
+			file, err = os.Open(importLinksCmdFileInput)
+			if err != nil {
+				tempLogger.ErrorExit(ctx, err.Error())
+			}
+		}
+		rows, err := handlers.ParseShortUrlImport(file, importLinksCmdFormatInput)
+		closeErr := file.Close()
+		if err != nil {
+			tempLogger.ErrorExit(ctx, err.Error())
+		}
+		if closeErr != nil {
+			tempLogger.ErrorExit(ctx, closeErr.Error())
+		}
+
+		configFilePath = strings.TrimSpace(configFilePath)
+		config, err := config.LoadConfig(configFilePath)
+		if err != nil {
+			tempLogger.ErrorExit(ctx, err.Error())
+		}
+
+		app := internal.NewApp(ctx, config)
+
+		user, err := app.DbContext.GetUserByEmail(ctx, importLinksCmdEmailInput)
+		if err != nil {
+			tempLogger.ErrorExit(ctx, err.Error())
+		}
+		if user == nil {
+			tempLogger.ErrorExit(ctx, fmt.Sprintf("there is no user with the email `%s`", importLinksCmdEmailInput))
+		}
+
+		report, err := app.ApiShortUrlHandler.ImportShortUrls(ctx, user.Id, rows, idempotencyKey, importLinksCmdDryRun)
+		if err != nil {
+			tempLogger.ErrorExit(ctx, err.Error())
+		}
+
+		for _, item := range report.Items {
+			if item.StatusCode != http.StatusOK && item.StatusCode != http.StatusCreated {
+				fmt.Printf("item %d: %d %s\n", item.Index, item.StatusCode, strings.Join(item.Errors, "; "))
+			}
+		}
+		if importLinksCmdDryRun {
+			fmt.Printf("Dry run, %d short urls would be created and %d failed\n", *report.Created, *report.Failed)
+			return
+		}
+		fmt.Printf("%d short urls were created and %d failed for `%s`, the idempotency key was %s\n", *report.Created, *report.Failed, user.Email, idempotencyKey)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(importLinksCmd)
+	importLinksCmd.Flags().StringVar(&importLinksCmdEmailInput, "email", "", "Email of the user the short urls will belong to")
+	err := importLinksCmd.MarkFlagRequired("email")
+	if err != nil {
+		panic(err)
+	}
+	importLinksCmd.Flags().StringVar(&importLinksCmdFileInput, "file", "", "The file to import, use - to read from stdin")
+	err = importLinksCmd.MarkFlagRequired("file")
+	if err != nil {
+		panic(err)
+	}
+	importLinksCmd.Flags().StringVar(&importLinksCmdFormatInput, "format", "", "One of csv, json or ndjson. Defaults to the extension of the file")
+	importLinksCmd.Flags().StringVar(&importLinksCmdIdempotencyKeyInput, "idempotency-key", "", "Reuse the idempotency key printed by an earlier run to repeat it without creating anything twice")
+	importLinksCmd.Flags().BoolVar(&importLinksCmdDryRun, "dry-run", false, "Check every row without creating anything")
+}
@@ -14,18 +14,22 @@ import (
 	"github.com/amieldelatorre/shurl/internal/config"
 	"github.com/amieldelatorre/shurl/internal/db"
 	"github.com/amieldelatorre/shurl/internal/db/valkey_cache"
+	"github.com/amieldelatorre/shurl/internal/events"
 	"github.com/amieldelatorre/shurl/internal/handlers"
 	"github.com/amieldelatorre/shurl/internal/utils"
 	"github.com/amieldelatorre/shurl/internal/workers"
 )
 
 type App struct {
-	Server       *http.Server
-	Logger       utils.CustomJsonLogger
-	Config       *config.Config
-	DbContext    db.DbContext
-	CacheContext *db.DbContext
-	baseUrl      string
+	Server          *http.Server
+	Logger          utils.CustomJsonLogger
+	Config          *config.Config
+	DbContext       db.DbContext
+	CacheContext    *db.DbContext
+	ClickEventQueue *events.ClickEventQueue
+	// ApiShortUrlHandler goes through the cache like the api does, for commands that create short urls
+	ApiShortUrlHandler handlers.ApiShortUrlHandler
+	baseUrl            string
 }
 
 func NewApp(ctx context.Context, config *config.Config) App {
@@ -45,21 +49,25 @@ func NewApp(ctx context.Context, config *config.Config) App {
 		dbContext = cacheContext
 	}
 
+	clickEventQueue := events.NewClickEventQueue(config.ClickEventWorker.QueueSize)
+
 	mux := http.NewServeMux()
 
 	middleware := handlers.NewMiddleware(logger, config)
-	apiShortUrlHandler := handlers.NewApiShortUrlHandler(logger, dbContext, baseUrl)
+	apiShortUrlHandler := handlers.NewApiShortUrlHandler(logger, config, dbContext, baseUrl)
 	apiUserHandler := handlers.NewApiUserHandler(logger, dbContext)
 	apiAuthHandler, err := handlers.NewApiAuthHandler(logger, config, dbContext)
-	apiHealthHandler := handlers.NewApiHealthHandler(logger, config, actualDbContext, cacheContext)
+	apiHealthHandler := handlers.NewApiHealthHandler(logger, config, actualDbContext, cacheContext, clickEventQueue)
+	apiTagHandler := handlers.NewApiTagHandler(logger, dbContext)
+	apiPreferencesHandler := handlers.NewApiPreferencesHandler(logger, config, dbContext)
 	if err != nil {
 		logger.ErrorExit(ctx, err.Error())
 	}
 
-	redirectionHandler := handlers.NewRedirectionHandler(logger, dbContext)
+	redirectionHandler := handlers.NewRedirectionHandler(logger, config, dbContext, clickEventQueue, baseUrl)
 	templateHandler := handlers.NewTemplateHandler(logger, baseUrl, config)
 
-	RegisterRoutes(logger, ctx, mux, middleware, apiShortUrlHandler, apiUserHandler, apiAuthHandler, apiHealthHandler, redirectionHandler, templateHandler)
+	RegisterRoutes(logger, ctx, mux, middleware, apiShortUrlHandler, apiUserHandler, apiAuthHandler, apiHealthHandler, apiTagHandler, apiPreferencesHandler, redirectionHandler, templateHandler)
 
 	app := App{
 		Config: config,
@@ -68,9 +76,11 @@ func NewApp(ctx context.Context, config *config.Config) App {
 			Addr:    ":" + config.Server.Port,
 			Handler: mux,
 		},
-		DbContext:    actualDbContext,
-		CacheContext: &cacheContext,
-		baseUrl:      baseUrl,
+		DbContext:          actualDbContext,
+		CacheContext:       &cacheContext,
+		ClickEventQueue:    clickEventQueue,
+		ApiShortUrlHandler: apiShortUrlHandler,
+		baseUrl:            baseUrl,
 	}
 	return app
 }
@@ -84,6 +94,15 @@ func (a *App) Exit(ctx context.Context) {
 		a.Logger.ErrorExit(ctx, "Error shutting down server", "error", err)
 	}
 
+	// The server is no longer accepting redirects, so nothing else can be added to the queue
+	a.Logger.Info(ctx, "Draining click event queue")
+	a.ClickEventQueue.Close()
+	select {
+	case <-a.ClickEventQueue.Drained():
+	case <-ctx.Done():
+		a.Logger.Error(ctx, "Timed out draining click event queue", "remaining", a.ClickEventQueue.Len())
+	}
+
 	a.Logger.Info(ctx, "Application has been shutdown, bye bye !")
 }
 
@@ -106,7 +125,15 @@ func (a *App) Run() {
 	})
 
 	wg.Go(func() {
-		workers.ShortUrlCleanupWorker(ctx, a.Logger, a.Config.ShortUrlCleanupWorker.IntervalSeconds, a.DbContext, a.Config.ShortUrlCleanupWorker.ErrorsFatal)
+		workers.ShortUrlCleanupWorker(ctx, a.Logger, a.Config.ShortUrlCleanupWorker.IntervalSeconds, a.Config.ShortUrlCleanupWorker.ExhaustedGraceSeconds, a.DbContext, a.Config.ShortUrlCleanupWorker.ErrorsFatal)
+	})
+
+	wg.Go(func() {
+		workers.TrashCleanupWorker(ctx, a.Logger, a.Config.TrashCleanupWorker.IntervalSeconds, a.Config.TrashCleanupWorker.RetentionSeconds, a.DbContext, a.Config.TrashCleanupWorker.ErrorsFatal)
+	})
+
+	wg.Go(func() {
+		workers.ClickEventWorker(ctx, a.Logger, a.ClickEventQueue, a.DbContext, a.Config.ClickEventWorker.BatchSize, a.Config.ClickEventWorker.FlushIntervalMs)
 	})
 
 	select {
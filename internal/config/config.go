@@ -18,9 +18,12 @@ import (
 
 type Config struct {
 	Server                      ServerConfig                `mapstructure:"server"`
+	ShortUrlTtl                 ShortUrlTtlConfig           `mapstructure:"short_url_ttl"`
 	Database                    DatabaseConfig              `mapstructure:"database"`
 	IdempotencyKeyCleanupWorker IdempotencyKeyCleanupWorker `mapstructure:"idempotency_key_cleanup_worker"`
 	ShortUrlCleanupWorker       ShortUrlCleanupWorker       `mapstructure:"short_url_cleanup_worker"`
+	TrashCleanupWorker          TrashCleanupWorker          `mapstructure:"trash_cleanup_worker"`
+	ClickEventWorker            ClickEventWorker            `mapstructure:"click_event_worker"`
 	Cache                       CacheConfig                 `mapstructure:"cache"`
 	Log                         LogConfig                   `mapstructure:"log"`
 }
@@ -34,6 +37,13 @@ type ServerConfig struct {
 	AllowLogin        bool   `mapstructure:"allow_login"`        // Allow login, by default only authenticated users are allowed to create urls
 	AllowRegistration bool   `mapstructure:"allow_registration"` // Allow user registration, this also needs `server.allow_login` to be true in order to take effect
 	AllowAnonymous    bool   `mapstructure:"allow_anonymous"`    // Allow anonymous link creation
+	ComingSoonPage    bool   `mapstructure:"coming_soon_page"`   // Show a coming soon page for short urls that have not activated yet, instead of a 404
+	ForcePreview      bool   `mapstructure:"force_preview"`      // Show the preview page on every visit to every short url, instead of redirecting straight away
+
+	// Status code used for short urls that don't set their own redirect type
+	RedirectType int `mapstructure:"redirect_type" validate:"required,oneof=301 302 307 308"`
+	// For short urls with query passthrough, query parameters on the short url replace the destination's parameters of the same name. By default the destination's win
+	QueryPassthroughOverride bool `mapstructure:"query_passthrough_override"`
 
 	// TODO: Make this required only if allow login is true. For now, it is always required
 	Auth AuthConfig `mapstructure:"auth"`
@@ -48,14 +58,36 @@ type AuthConfig struct {
 	JwtEcdsaParsedKey *ecdsa.PrivateKey `mapstructure:"-" validate:"-"`
 }
 
+// All in seconds. A ttl is counted from when the short url activates. Changing the expiry of an existing short url is limited by the authenticated maximum
+type ShortUrlTtlConfig struct {
+	AnonymousDefaultSeconds     int  `mapstructure:"anonymous_default_seconds" validate:"required,min=900,ltefield=AnonymousMaxSeconds"`
+	AnonymousMaxSeconds         int  `mapstructure:"anonymous_max_seconds" validate:"required,min=900,max=31556952"`
+	AuthenticatedDefaultSeconds int  `mapstructure:"authenticated_default_seconds" validate:"required,min=900,ltefield=AuthenticatedMaxSeconds"`
+	AuthenticatedMaxSeconds     int  `mapstructure:"authenticated_max_seconds" validate:"required,min=900,max=31556952"` // 15 minutes to 1 year
+	AllowNonExpiring            bool `mapstructure:"allow_non_expiring"`                                                 // Allow logged in users to create short urls that never expire, anonymous short urls always expire
+}
+
 type IdempotencyKeyCleanupWorker struct {
 	IntervalSeconds int  `mapstructure:"interval_seconds" validate:"required,min=300,max=21600"`
 	ErrorsFatal     bool `mapstructure:"errors_fatal" validate:"required"`
 }
 
 type ShortUrlCleanupWorker struct {
-	IntervalSeconds int  `mapstructure:"interval_seconds" validate:"required,min=300,max=21600"`
-	ErrorsFatal     bool `mapstructure:"errors_fatal" validate:"required"`
+	IntervalSeconds       int  `mapstructure:"interval_seconds" validate:"required,min=300,max=21600"`
+	ExhaustedGraceSeconds int  `mapstructure:"exhausted_grace_seconds" validate:"required,min=3600,max=31556952"` // How long short urls with no clicks left answer with 410 Gone before they are deleted, 1 hour to 1 year
+	ErrorsFatal           bool `mapstructure:"errors_fatal" validate:"required"`
+}
+
+type TrashCleanupWorker struct {
+	IntervalSeconds  int  `mapstructure:"interval_seconds" validate:"required,min=300,max=21600"`
+	RetentionSeconds int  `mapstructure:"retention_seconds" validate:"required,min=3600,max=31556952"` // How long deleted short urls stay in the trash before they are purged, 1 hour to 1 year
+	ErrorsFatal      bool `mapstructure:"errors_fatal" validate:"required"`
+}
+
+type ClickEventWorker struct {
+	QueueSize       int `mapstructure:"queue_size" validate:"required,min=100,max=1000000"`      // Click events are dropped once the queue is full
+	BatchSize       int `mapstructure:"batch_size" validate:"required,min=1,max=10000"`          // Number of click events that triggers a flush
+	FlushIntervalMs int `mapstructure:"flush_interval_ms" validate:"required,min=100,max=60000"` // Maximum time a click event waits in a partial batch
 }
 
 type DatabaseConfig struct {
@@ -97,15 +129,34 @@ func SetDefaults(v *viper.Viper) {
 	v.SetDefault("server.allow_login", false)
 	v.SetDefault("server.allow_registration", false)
 	v.SetDefault("server.allow_anonymous", false)
+	v.SetDefault("server.coming_soon_page", false)
+	v.SetDefault("server.force_preview", false)
+	v.SetDefault("server.redirect_type", 307)
+	v.SetDefault("server.query_passthrough_override", false)
 	v.SetDefault("server.auth.jwt_signing_method", "ES512")
 	v.SetDefault("server.auth.jwt_issuer", "shurl")
 
+	v.SetDefault("short_url_ttl.anonymous_default_seconds", 259200)     // 3 days
+	v.SetDefault("short_url_ttl.anonymous_max_seconds", 604800)         // 7 days
+	v.SetDefault("short_url_ttl.authenticated_default_seconds", 604800) // 7 days
+	v.SetDefault("short_url_ttl.authenticated_max_seconds", 2629746)    // 1 month
+	v.SetDefault("short_url_ttl.allow_non_expiring", false)
+
 	v.SetDefault("idempotency_key_cleanup_worker.interval_seconds", 600)
 	v.SetDefault("idempotency_key_cleanup_worker.errors_fatal", true)
 
 	v.SetDefault("short_url_cleanup_worker.interval_seconds", 600)
+	v.SetDefault("short_url_cleanup_worker.exhausted_grace_seconds", 2592000) // 30 days
 	v.SetDefault("short_url_cleanup_worker.errors_fatal", true)
 
+	v.SetDefault("trash_cleanup_worker.interval_seconds", 3600)
+	v.SetDefault("trash_cleanup_worker.retention_seconds", 2592000) // 30 days
+	v.SetDefault("trash_cleanup_worker.errors_fatal", true)
+
+	v.SetDefault("click_event_worker.queue_size", 10000)
+	v.SetDefault("click_event_worker.batch_size", 500)
+	v.SetDefault("click_event_worker.flush_interval_ms", 1000)
+
 	v.SetDefault("database.run_migrations", true)
 	v.SetDefault("database.driver", "postgres")
 	v.SetDefault("database.port", "5432")
@@ -195,6 +246,10 @@ func LoadConfig(configFilePath string) (*Config, error) {
 		return nil, err
 	}
 
+	if config.ShortUrlTtl.AnonymousMaxSeconds > config.ShortUrlTtl.AuthenticatedMaxSeconds {
+		return nil, errors.New("short_url_ttl.anonymous_max_seconds cannot be more than short_url_ttl.authenticated_max_seconds")
+	}
+
 	keyBlock, _ := pem.Decode([]byte(config.Server.Auth.JwtKey))
 	if keyBlock == nil {
 		return nil, errors.New("could not parse ecdsa private key")
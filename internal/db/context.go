@@ -2,6 +2,7 @@ package db
 
 import (
 	"context"
+	"time"
 
 	"github.com/amieldelatorre/shurl/internal/types"
 	"github.com/google/uuid"
@@ -11,15 +12,39 @@ type DbContext interface {
 	Ping(ctx context.Context) error
 	GetDatabaseVersion(ctx context.Context) (int64, error)
 	CreateShortUrl(ctx context.Context, req types.CreateShortUrl, idempotencyKey uuid.UUID, request_hash string) (*types.ShortUrl, error)
-	GetShortUrlsByUserId(ctx context.Context, userId uuid.UUID, size int, offset int) (types.GetShortUrlsResult, error)
+	CreateShortUrlBatch(ctx context.Context, req types.CreateShortUrlBatch, idempotencyKey uuid.UUID, requestHash string) ([]types.CreateShortUrlBatchResult, error)
+	GetShortUrlsByUserId(ctx context.Context, userId uuid.UUID, filter types.ShortUrlFilter, page types.ShortUrlPage) (types.GetShortUrlsResult, error)
+	ExportShortUrlsByUserId(ctx context.Context, userId uuid.UUID, opts types.ShortUrlExportOptions, each func(types.ExportedShortUrl) error) error
 	GetShortUrlById(ctx context.Context, id uuid.UUID, excludeExpired bool) (*types.ShortUrl, error)
 	GetShortUrlBySlug(ctx context.Context, slug string, excludeExpired bool) (*types.ShortUrl, error)
+	GetTakenSlugs(ctx context.Context, slugs []string) ([]string, error)
+	UpdateShortUrl(ctx context.Context, userId uuid.UUID, shortUrlId uuid.UUID, req types.UpdateShortUrl) (*types.ShortUrl, error)
 	DeleteShortUrlById(ctx context.Context, userId uuid.UUID, shortUrlId uuid.UUID) (types.DeleteShortUrlResult, error)
+	DeleteShortUrls(ctx context.Context, userId uuid.UUID, selection types.ShortUrlSelection) (types.ChangeShortUrlsResult, error)
+	GetDeletedShortUrlsByUserId(ctx context.Context, userId uuid.UUID, page types.ShortUrlPage) (types.GetShortUrlsResult, error)
+	RestoreShortUrl(ctx context.Context, userId uuid.UUID, shortUrlId uuid.UUID) (*types.ShortUrl, error)
+	RenewShortUrl(ctx context.Context, userId uuid.UUID, shortUrlId uuid.UUID, ttl time.Duration) (*types.ShortUrl, error)
+	SetShortUrlNeverExpires(ctx context.Context, userId uuid.UUID, shortUrlId uuid.UUID) (*types.ShortUrl, error)
+	SlideShortUrlExpiry(ctx context.Context, shortUrlId uuid.UUID) (*types.ShortUrl, error)
+	SetShortUrlsExpiry(ctx context.Context, userId uuid.UUID, selection types.ShortUrlSelection, expiresAt time.Time) (types.ChangeShortUrlsResult, error)
+	ConsumeShortUrlClick(ctx context.Context, shortUrlId uuid.UUID) (bool, error)
+	CreateClickEvents(ctx context.Context, events []types.ClickEvent) (int, error)
+	GetShortUrlClickStats(ctx context.Context, userId uuid.UUID, shortUrlId uuid.UUID, since time.Time, timezone string) (*types.ShortUrlClickStats, error)
+	CreateTag(ctx context.Context, req types.CreateTag) (*types.Tag, error)
+	GetTagsByUserId(ctx context.Context, userId uuid.UUID) ([]types.Tag, error)
+	DeleteTag(ctx context.Context, userId uuid.UUID, tagId uuid.UUID) (types.DeleteTagResult, error)
+	AddShortUrlTag(ctx context.Context, userId uuid.UUID, shortUrlId uuid.UUID, tagId uuid.UUID) (bool, error)
+	RemoveShortUrlTag(ctx context.Context, userId uuid.UUID, shortUrlId uuid.UUID, tagId uuid.UUID) (bool, error)
 	CreateUser(ctx context.Context, idempotencyKey uuid.UUID, requestHash string, req types.CreateUserRequest) (*types.User, error)
+	GetUserById(ctx context.Context, userId uuid.UUID) (*types.User, error)
 	GetUserByEmail(ctx context.Context, email string) (*types.User, error)
+	GetUserPreferences(ctx context.Context, userId uuid.UUID) (types.UserPreferences, error)
+	UpdateUserPreferences(ctx context.Context, userId uuid.UUID, req types.UpdateUserPreferences) (types.UserPreferences, error)
 	DeleteExpiredIdempotencyKeys(ctx context.Context) (int, error)
 	DeleteExpiredIdempotencyKeysBatched(ctx context.Context, batchSize int) (int, error)
 	DeleteExpiredShortUrls(ctx context.Context) (int, error)
 	DeleteExpiredShortUrlsBatched(ctx context.Context, batchSize int) (int, error)
+	DeleteExhaustedShortUrls(ctx context.Context, exhaustedBefore time.Time) (int, error)
+	PurgeDeletedShortUrls(ctx context.Context, deletedBefore time.Time) (int, error)
 	Close()
 }
@@ -3,7 +3,13 @@ package db
 import (
 	"crypto/sha256"
 	"encoding/hex"
+	"encoding/json"
 	"fmt"
+	"strings"
+	"time"
+
+	"github.com/amieldelatorre/shurl/internal/types"
+	"github.com/google/uuid"
 )
 
 func doHash(canonicalJson string) string {
@@ -11,8 +17,83 @@ func doHash(canonicalJson string) string {
 	return hex.EncodeToString(hash[:]) // [:] converts the array to a slice
 }
 
-func HashCreateShortUrlRequest(destinationUrl string) string {
-	canonicalJson := fmt.Sprintf(`{"destination_url":"%s"}`, destinationUrl)
+// createShortUrlHashFields is the canonical json of HashCreateShortUrlRequest, every optional field is left out when it isn't set.
+// The fields are in the order they were added to the hash so that hashes of requests without the newer ones stay the same
+type createShortUrlHashFields struct {
+	DestinationUrl    string                    `json:"destination_url"`
+	Slug              string                    `json:"slug,omitempty"`
+	PasswordProtected bool                      `json:"password_protected,omitempty"`
+	MaxClicks         *int                      `json:"max_clicks,omitempty"`
+	ActivatesAt       string                    `json:"activates_at,omitempty"`
+	ForcePreview      bool                      `json:"force_preview,omitempty"`
+	RedirectType      *int                      `json:"redirect_type,omitempty"`
+	QueryPassthrough  bool                      `json:"query_passthrough,omitempty"`
+	PathPassthrough   bool                      `json:"path_passthrough,omitempty"`
+	UtmSource         *string                   `json:"utm_source,omitempty"`
+	UtmMedium         *string                   `json:"utm_medium,omitempty"`
+	UtmCampaign       *string                   `json:"utm_campaign,omitempty"`
+	RoutingRules      []types.RoutingRule       `json:"routing_rules,omitempty"`
+	Variants          []createVariantHashFields `json:"variants,omitempty"`
+	StickyVariants    bool                      `json:"sticky_variants,omitempty"`
+	SlidingTtl        *int                      `json:"sliding_ttl,omitempty"`
+	TagIds            []uuid.UUID               `json:"tag_ids,omitempty"`
+	NeverExpires      bool                      `json:"never_expires,omitempty"`
+}
+
+// createVariantHashFields leaves out the variant id, it is generated for every request
+type createVariantHashFields struct {
+	DestinationUrl string `json:"destination_url"`
+	Weight         int    `json:"weight"`
+}
+
+// HashCreateShortUrlRequest only adds optional fields when they are set, so hashes of requests without them stay the same.
+// The slug is the one the caller asked for, empty when it was generated. The password itself is never part of the hash, only whether there is one.
+// The values are json encoded, a value that looks like another field can't make two different requests hash the same
+func HashCreateShortUrlRequest(requestedSlug string, req types.CreateShortUrl) string {
+	fields := createShortUrlHashFields{
+		DestinationUrl:    req.DestinationUrl,
+		Slug:              requestedSlug,
+		PasswordProtected: req.PasswordHash != nil,
+		MaxClicks:         req.MaxClicks,
+		ForcePreview:      req.ForcePreview,
+		RedirectType:      req.RedirectType,
+		QueryPassthrough:  req.QueryPassthrough,
+		PathPassthrough:   req.PathPassthrough,
+		UtmSource:         req.UtmSource,
+		UtmMedium:         req.UtmMedium,
+		UtmCampaign:       req.UtmCampaign,
+		RoutingRules:      req.RoutingRules,
+		StickyVariants:    req.StickyVariants,
+		SlidingTtl:        req.SlidingTtl,
+		TagIds:            req.TagIds,
+		NeverExpires:      req.ExpiresAt.Equal(types.NeverExpires),
+	}
+	if req.ActivatesAt != nil {
+		fields.ActivatesAt = req.ActivatesAt.UTC().Format(time.RFC3339Nano)
+	}
+	for _, v := range req.Variants {
+		fields.Variants = append(fields.Variants, createVariantHashFields{DestinationUrl: v.DestinationUrl, Weight: v.Weight})
+	}
+
+	// urls are kept as they are instead of having & escaped, like the hashes from before they were encoded.
+	// The fields are all plain values, this can't fail
+	var canonicalJson strings.Builder
+	encoder := json.NewEncoder(&canonicalJson)
+	encoder.SetEscapeHTML(false)
+	_ = encoder.Encode(fields)
+	return doHash(strings.TrimSuffix(canonicalJson.String(), "\n"))
+}
+
+// HashCreateShortUrlBatchRequest combines the HashCreateShortUrlRequest of every valid item with its position, an invalid item is an empty string
+func HashCreateShortUrlBatchRequest(itemHashes []string) string {
+	canonicalJson := `{"items":[`
+	for i, h := range itemHashes {
+		if i > 0 {
+			canonicalJson += ","
+		}
+		canonicalJson += fmt.Sprintf(`"%s"`, h)
+	}
+	canonicalJson += "]}"
 	return doHash(canonicalJson)
 }
 
@@ -6,6 +6,8 @@ import (
 	"math"
 	"math/rand"
 	"net"
+	"strconv"
+	"strings"
 	"syscall"
 	"time"
 
@@ -17,6 +19,15 @@ import (
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
+// shortUrlIsActive filters out short urls that have been scheduled to activate later
+const shortUrlIsActive = `(activates_at IS NULL OR activates_at <= NOW())`
+
+// shortUrlNotDeleted filters out short urls that are in the trash, they only show up in the trash listing until they are restored or purged
+const shortUrlNotDeleted = `deleted_at IS NULL`
+
+// shortUrlColumns is the column list that scanShortUrl expects, in order
+const shortUrlColumns = `id, destination_url, slug, created_at, user_id, expires_at, password_hash, max_clicks, remaining_clicks, activates_at, force_preview, redirect_type, query_passthrough, path_passthrough, utm_source, utm_medium, utm_campaign, routing_rules, sticky_variants, sliding_ttl, deleted_at`
+
 type PostgreSQLContext struct {
 	logger utils.CustomJsonLogger
 	dbPool *pgxpool.Pool
@@ -51,19 +62,23 @@ func (p *PostgreSQLContext) GetShortUrlById(ctx context.Context, id uuid.UUID, e
 
 func (p *PostgreSQLContext) getShortUrlByIdWithTx(ctx context.Context, tx pgx.Tx, id uuid.UUID, excludeExpired bool) (*types.ShortUrl, error) {
 	var shortUrl types.ShortUrl
-	query := `SELECT id, destination_url, slug, created_at FROM short_urls WHERE id = $1`
+	query := `SELECT ` + shortUrlColumns + ` FROM short_urls WHERE id = $1 AND ` + shortUrlNotDeleted
 	if excludeExpired {
-		query += ` AND expires_at > NOW()`
+		query += ` AND expires_at > NOW() AND ` + shortUrlIsActive
 	}
 
-	// slug should be unique
-	err := tx.QueryRow(ctx, query, id).Scan(
-		&shortUrl.Id, &shortUrl.DestinationUrl, &shortUrl.Slug, &shortUrl.CreatedAt,
-	)
+	err := scanShortUrl(tx.QueryRow(ctx, query, id), &shortUrl)
 	if err != nil && errors.Is(err, pgx.ErrNoRows) {
 		return nil, nil
 	}
-	return &shortUrl, err
+	if err != nil {
+		return nil, err
+	}
+	err = loadShortUrlVariants(ctx, tx, &shortUrl)
+	if err != nil {
+		return nil, err
+	}
+	return &shortUrl, loadShortUrlTags(ctx, tx, &shortUrl)
 }
 
 func (p *PostgreSQLContext) CreateShortUrl(ctx context.Context, req types.CreateShortUrl, idempotencyKey uuid.UUID, requestHash string) (*types.ShortUrl, error) {
@@ -77,46 +92,186 @@ func (p *PostgreSQLContext) CreateShortUrl(ctx context.Context, req types.Create
 
 		// if the idempotency key was not inserted (meaning that it was already used)
 		if !idempotencyKeyInserted {
-			// if the request hash matches the stored hash AND the reference ids match, return the existing object
+			// if the request hash matches the stored hash AND the reference ids match, return the existing object.
+			// A scheduled or expired short url is still the one that was created, only one in the trash returns nil
 			if requestHash == storedRequestHash {
-				return p.getShortUrlByIdWithTx(ctx, tx, storedReferenceId, true)
+				return p.getShortUrlByIdWithTx(ctx, tx, storedReferenceId, false)
 			}
 
 			// if the request hash doesn't match the stored hash OR the reference ids don't match, return error
 			return nil, &types.DuplicateIdempotencyKeyError{}
 		}
 
-		err = tx.QueryRow(ctx,
-			`INSERT INTO short_urls (id, destination_url, slug, created_at, user_id, expires_at)
-			 VALUES ($1, $2, $3, NOW(), $4, $5)
+		err = scanShortUrl(tx.QueryRow(ctx,
+			`INSERT INTO short_urls (id, destination_url, slug, created_at, user_id, expires_at, password_hash, max_clicks, remaining_clicks, activates_at, force_preview, redirect_type, query_passthrough, path_passthrough, utm_source, utm_medium, utm_campaign, routing_rules, sticky_variants, sliding_ttl)
+			 VALUES ($1, $2, $3, NOW(), $4, $5, $6, $7, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18)
 			 ON CONFLICT (id) DO UPDATE set id = EXCLUDED.id
-			 RETURNING id, destination_url, slug, created_at, user_id, expires_at`,
-			req.Id, req.DestinationUrl, req.Slug, req.UserId, req.ExpiresAt).Scan(
-			&newShortUrl.Id, &newShortUrl.DestinationUrl, &newShortUrl.Slug, &newShortUrl.CreatedAt, &newShortUrl.UserId, &newShortUrl.ExpiresAt,
-		)
+			 RETURNING `+shortUrlColumns,
+			req.Id, req.DestinationUrl, req.Slug, req.UserId, req.ExpiresAt, req.PasswordHash, req.MaxClicks, req.ActivatesAt, req.ForcePreview, req.RedirectType, req.QueryPassthrough, req.PathPassthrough, req.UtmSource, req.UtmMedium, req.UtmCampaign, routingRulesParam(req.RoutingRules), req.StickyVariants, req.SlidingTtl), &newShortUrl)
+		if err != nil {
+			var pgErr *pgconn.PgError
+			if errors.As(err, &pgErr) {
+				// conflicts on id are handled above, so this can only be the slug
+				if pgErr.Code == "23505" { // unique constraint violation error code
+					return nil, &types.SlugExistsError{}
+				}
+			}
+			return nil, err
+		}
+
+		err = insertShortUrlVariants(ctx, tx, newShortUrl.Id, req.Variants)
 		if err != nil {
 			return nil, err
 		}
-		return &newShortUrl, nil
+		err = insertShortUrlTags(ctx, tx, newShortUrl.Id, req.UserId, req.TagIds)
+		if err != nil {
+			return nil, err
+		}
+		err = loadShortUrlVariants(ctx, tx, &newShortUrl)
+		if err != nil {
+			return nil, err
+		}
+		return &newShortUrl, loadShortUrlTags(ctx, tx, &newShortUrl)
 	})
 }
 
+// CreateShortUrlBatch creates every item in one transaction, an item whose slug is taken is skipped instead of failing the batch.
+// A replayed request returns the short urls its batch created, an item that was moved to the trash since looks the same as one whose slug was taken.
+func (p *PostgreSQLContext) CreateShortUrlBatch(ctx context.Context, req types.CreateShortUrlBatch, idempotencyKey uuid.UUID, requestHash string) ([]types.CreateShortUrlBatchResult, error) {
+	return ExecWithRetry(ctx, p.logger, p.dbPool, func(tx pgx.Tx) ([]types.CreateShortUrlBatchResult, error) {
+		idempotencyKeyInserted, storedRequestHash, storedReferenceId, err := storeIdempotencyKey(ctx, tx, idempotencyKey, requestHash, req.Id)
+		if err != nil {
+			return nil, err
+		}
+
+		if !idempotencyKeyInserted {
+			if requestHash == storedRequestHash {
+				return p.getShortUrlBatchWithTx(ctx, tx, storedReferenceId, req.Items)
+			}
+			return nil, &types.DuplicateIdempotencyKeyError{}
+		}
+
+		results := make([]types.CreateShortUrlBatchResult, 0, len(req.Items))
+		created := []*types.ShortUrl{}
+		for _, item := range req.Items {
+			var newShortUrl types.ShortUrl
+			r := item.ShortUrl
+			err = scanShortUrl(tx.QueryRow(ctx,
+				`INSERT INTO short_urls (id, destination_url, slug, created_at, user_id, expires_at, password_hash, max_clicks, remaining_clicks, activates_at, force_preview, redirect_type, query_passthrough, path_passthrough, utm_source, utm_medium, utm_campaign, routing_rules, sticky_variants, sliding_ttl, batch_id, batch_position)
+				 VALUES ($1, $2, $3, NOW(), $4, $5, $6, $7, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20)
+				 ON CONFLICT DO NOTHING
+				 RETURNING `+shortUrlColumns,
+				r.Id, r.DestinationUrl, r.Slug, r.UserId, r.ExpiresAt, r.PasswordHash, r.MaxClicks, r.ActivatesAt, r.ForcePreview, r.RedirectType, r.QueryPassthrough, r.PathPassthrough, r.UtmSource, r.UtmMedium, r.UtmCampaign, routingRulesParam(r.RoutingRules), r.StickyVariants, r.SlidingTtl, req.Id, item.Position), &newShortUrl)
+			// the ids are new, so nothing being inserted means the slug is taken
+			if errors.Is(err, pgx.ErrNoRows) {
+				results = append(results, types.CreateShortUrlBatchResult{Position: item.Position})
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+
+			err = insertShortUrlVariants(ctx, tx, newShortUrl.Id, r.Variants)
+			if err != nil {
+				return nil, err
+			}
+			err = insertShortUrlTags(ctx, tx, newShortUrl.Id, r.UserId, r.TagIds)
+			if err != nil {
+				return nil, err
+			}
+			results = append(results, types.CreateShortUrlBatchResult{Position: item.Position, ShortUrl: &newShortUrl})
+			created = append(created, &newShortUrl)
+		}
+
+		err = loadShortUrlVariants(ctx, tx, created...)
+		if err != nil {
+			return nil, err
+		}
+		return results, loadShortUrlTags(ctx, tx, created...)
+	})
+}
+
+func (p *PostgreSQLContext) getShortUrlBatchWithTx(ctx context.Context, tx pgx.Tx, batchId uuid.UUID, items []types.CreateShortUrlBatchItem) ([]types.CreateShortUrlBatchResult, error) {
+	rows, err := tx.Query(ctx, `SELECT `+shortUrlColumns+`, batch_position FROM short_urls WHERE batch_id = $1 AND `+shortUrlNotDeleted, batchId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	byPosition := map[int]*types.ShortUrl{}
+	for rows.Next() {
+		var shortUrl types.ShortUrl
+		var position int
+		err = rows.Scan(append(shortUrlScanTargets(&shortUrl), &position)...)
+		if err != nil {
+			return nil, err
+		}
+		byPosition[position] = &shortUrl
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	results := make([]types.CreateShortUrlBatchResult, 0, len(items))
+	created := []*types.ShortUrl{}
+	for _, item := range items {
+		shortUrl := byPosition[item.Position]
+		results = append(results, types.CreateShortUrlBatchResult{Position: item.Position, ShortUrl: shortUrl})
+		if shortUrl != nil {
+			created = append(created, shortUrl)
+		}
+	}
+
+	err = loadShortUrlVariants(ctx, tx, created...)
+	if err != nil {
+		return nil, err
+	}
+	return results, loadShortUrlTags(ctx, tx, created...)
+}
+
 func (p *PostgreSQLContext) GetShortUrlBySlug(ctx context.Context, slug string, excludeExpired bool) (*types.ShortUrl, error) {
 	return ExecWithRetry(ctx, p.logger, p.dbPool, func(tx pgx.Tx) (*types.ShortUrl, error) {
 		var shortUrl types.ShortUrl
-		query := `SELECT id, destination_url, slug, created_at FROM short_urls WHERE slug = $1`
+		query := `SELECT ` + shortUrlColumns + ` FROM short_urls WHERE slug = $1 AND ` + shortUrlNotDeleted
 		if excludeExpired {
-			query += ` AND expires_at > NOW()`
+			query += ` AND expires_at > NOW() AND ` + shortUrlIsActive
 		}
 
 		// slug should be unique
-		err := tx.QueryRow(ctx, query, slug).Scan(
-			&shortUrl.Id, &shortUrl.DestinationUrl, &shortUrl.Slug, &shortUrl.CreatedAt,
-		)
+		err := scanShortUrl(tx.QueryRow(ctx, query, slug), &shortUrl)
 		if err != nil && errors.Is(err, pgx.ErrNoRows) {
 			return nil, nil
 		}
-		return &shortUrl, err
+		if err != nil {
+			return nil, err
+		}
+		return &shortUrl, loadShortUrlVariants(ctx, tx, &shortUrl)
+	})
+}
+
+// GetTakenSlugs returns the slugs that already belong to a short url, expired and trashed ones included
+func (p *PostgreSQLContext) GetTakenSlugs(ctx context.Context, slugs []string) ([]string, error) {
+	return ExecWithRetry(ctx, p.logger, p.dbPool, func(tx pgx.Tx) ([]string, error) {
+		taken := []string{}
+		if len(slugs) == 0 {
+			return taken, nil
+		}
+
+		rows, err := tx.Query(ctx, `SELECT slug FROM short_urls WHERE slug = ANY($1)`, slugs)
+		if err != nil {
+			return nil, err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var slug string
+			if err = rows.Scan(&slug); err != nil {
+				return nil, err
+			}
+			taken = append(taken, slug)
+		}
+		return taken, rows.Err()
 	})
 }
 
@@ -169,6 +324,12 @@ func (p *PostgreSQLContext) getUserByIdWithTx(ctx context.Context, tx pgx.Tx, us
 	return &user, err
 }
 
+func (p *PostgreSQLContext) GetUserById(ctx context.Context, userId uuid.UUID) (*types.User, error) {
+	return ExecWithRetry(ctx, p.logger, p.dbPool, func(tx pgx.Tx) (*types.User, error) {
+		return p.getUserByIdWithTx(ctx, tx, userId)
+	})
+}
+
 func (p *PostgreSQLContext) GetUserByEmail(ctx context.Context, email string) (*types.User, error) {
 	return ExecWithRetry(ctx, p.logger, p.dbPool, func(tx pgx.Tx) (*types.User, error) {
 		var user types.User
@@ -183,6 +344,53 @@ func (p *PostgreSQLContext) GetUserByEmail(ctx context.Context, email string) (*
 	})
 }
 
+// GetUserPreferences returns the defaults when the user has never changed their preferences
+func (p *PostgreSQLContext) GetUserPreferences(ctx context.Context, userId uuid.UUID) (types.UserPreferences, error) {
+	return ExecWithRetry(ctx, p.logger, p.dbPool, func(tx pgx.Tx) (types.UserPreferences, error) {
+		return getUserPreferencesWithTx(ctx, tx, userId)
+	})
+}
+
+func (p *PostgreSQLContext) UpdateUserPreferences(ctx context.Context, userId uuid.UUID, req types.UpdateUserPreferences) (types.UserPreferences, error) {
+	return ExecWithRetry(ctx, p.logger, p.dbPool, func(tx pgx.Tx) (types.UserPreferences, error) {
+		// the insert values are what a user without a row gets, so the update has to fall back to them as well
+		_, err := tx.Exec(ctx,
+			`INSERT INTO user_preferences AS p (user_id, default_ttl, default_redirect_type, default_tag_ids, timezone, updated_at)
+			 VALUES ($1, $2, $3, COALESCE($4::uuid[], '{}'), COALESCE($5, $6), NOW())
+			 ON CONFLICT (user_id) DO UPDATE SET
+				default_ttl = CASE WHEN $7 THEN NULL ELSE COALESCE($2, p.default_ttl) END,
+				default_redirect_type = CASE WHEN $8 THEN NULL ELSE COALESCE($3, p.default_redirect_type) END,
+				default_tag_ids = COALESCE($4::uuid[], p.default_tag_ids),
+				timezone = COALESCE($5, p.timezone),
+				updated_at = NOW()`,
+			userId, req.DefaultTtl, req.DefaultRedirectType, req.DefaultTagIds, req.Timezone, types.DefaultTimezone, req.RemoveDefaultTtl, req.RemoveDefaultRedirectType)
+		if err != nil {
+			return types.UserPreferences{}, err
+		}
+		return getUserPreferencesWithTx(ctx, tx, userId)
+	})
+}
+
+func getUserPreferencesWithTx(ctx context.Context, tx pgx.Tx, userId uuid.UUID) (types.UserPreferences, error) {
+	prefs := types.UserPreferences{UserId: userId, DefaultTagIds: []uuid.UUID{}, Timezone: types.DefaultTimezone}
+	// tags deleted since they were picked are left out
+	err := tx.QueryRow(ctx,
+		`SELECT p.default_ttl, p.default_redirect_type, ARRAY(
+				SELECT t.id FROM tags t
+				WHERE t.id = ANY(p.default_tag_ids)
+				AND t.user_id = p.user_id
+				ORDER BY lower(t.name)
+			 ), p.timezone, p.updated_at
+		 FROM user_preferences p
+		 WHERE p.user_id = $1`, userId).Scan(
+		&prefs.DefaultTtl, &prefs.DefaultRedirectType, &prefs.DefaultTagIds, &prefs.Timezone, &prefs.UpdatedAt,
+	)
+	if err != nil && errors.Is(err, pgx.ErrNoRows) {
+		return prefs, nil
+	}
+	return prefs, err
+}
+
 func (p *PostgreSQLContext) DeleteExpiredIdempotencyKeys(ctx context.Context) (int, error) {
 	return ExecWithRetry(ctx, p.logger, p.dbPool, func(tx pgx.Tx) (int, error) {
 		ct, err := tx.Exec(ctx, `DELETE FROM idempotency_keys WHERE expires_at < NOW()`)
@@ -212,6 +420,43 @@ func (p *PostgreSQLContext) DeleteExpiredShortUrls(ctx context.Context) (int, er
 	})
 }
 
+// DeleteExhaustedShortUrls deletes the short urls whose last click was used up before exhaustedBefore.
+// Until then they answer with 410 Gone and keep their stats, short urls in the trash are left to the trash cleanup
+func (p *PostgreSQLContext) DeleteExhaustedShortUrls(ctx context.Context, exhaustedBefore time.Time) (int, error) {
+	return ExecWithRetry(ctx, p.logger, p.dbPool, func(tx pgx.Tx) (int, error) {
+		ct, err := tx.Exec(ctx, `DELETE FROM short_urls WHERE remaining_clicks = 0 AND exhausted_at < $1 AND deleted_at IS NULL`, exhaustedBefore)
+		return int(ct.RowsAffected()), err
+	})
+}
+
+// PurgeDeletedShortUrls deletes the short urls that were moved to the trash before deletedBefore for good
+func (p *PostgreSQLContext) PurgeDeletedShortUrls(ctx context.Context, deletedBefore time.Time) (int, error) {
+	return ExecWithRetry(ctx, p.logger, p.dbPool, func(tx pgx.Tx) (int, error) {
+		ct, err := tx.Exec(ctx, `DELETE FROM short_urls WHERE deleted_at < $1`, deletedBefore)
+		return int(ct.RowsAffected()), err
+	})
+}
+
+// ConsumeShortUrlClick uses up one click of a click limited short url.
+// It returns false when there are no clicks left, the decrement happens in a single statement so concurrent redirects can't go over the limit.
+func (p *PostgreSQLContext) ConsumeShortUrlClick(ctx context.Context, shortUrlId uuid.UUID) (bool, error) {
+	return ExecWithRetry(ctx, p.logger, p.dbPool, func(tx pgx.Tx) (bool, error) {
+		ct, err := tx.Exec(ctx,
+			`UPDATE short_urls
+			 SET remaining_clicks = remaining_clicks - 1,
+			 exhausted_at = CASE WHEN remaining_clicks = 1 THEN NOW() ELSE exhausted_at END
+			 WHERE id = $1
+			 AND remaining_clicks > 0
+			 AND expires_at > NOW()
+			 AND `+shortUrlNotDeleted+`
+			 AND `+shortUrlIsActive, shortUrlId)
+		if err != nil {
+			return false, err
+		}
+		return ct.RowsAffected() == 1, nil
+	})
+}
+
 // untested
 func (p *PostgreSQLContext) DeleteExpiredShortUrlsBatched(ctx context.Context, batchSize int) (int, error) {
 	return ExecWithRetry(ctx, p.logger, p.dbPool, func(tx pgx.Tx) (int, error) {
@@ -227,18 +472,26 @@ func (p *PostgreSQLContext) DeleteExpiredShortUrlsBatched(ctx context.Context, b
 	})
 }
 
-func (p *PostgreSQLContext) GetShortUrlsByUserId(ctx context.Context, userId uuid.UUID, size int, offset int) (types.GetShortUrlsResult, error) {
+func (p *PostgreSQLContext) GetShortUrlsByUserId(ctx context.Context, userId uuid.UUID, filter types.ShortUrlFilter, page types.ShortUrlPage) (types.GetShortUrlsResult, error) {
 	return ExecWithRetry(ctx, p.logger, p.dbPool, func(tx pgx.Tx) (types.GetShortUrlsResult, error) {
 		ret := types.GetShortUrlsResult{}
 		var shortUrls []types.ShortUrl
 
-		q := `SELECT id, destination_url, slug, created_at, user_id, expires_at 
-				FROM short_urls
-				WHERE user_id = $1
-				AND expires_at > NOW()
-				ORDER BY created_at DESC
-				LIMIT $2 OFFSET $3`
-		rows, err := tx.Query(ctx, q, userId, size, offset)
+		conditions, args := shortUrlFilterConditions(userId, filter)
+		pageConditions, pageArgs := conditions, args
+		offset := page.Offset
+		if page.After != nil {
+			pageConditions, pageArgs = shortUrlCursorCondition(conditions, args, filter, *page.After)
+			offset = 0
+		}
+
+		// One extra row says whether there is another page without having to count everything
+		q := `SELECT ` + shortUrlColumns + `
+				FROM ` + shortUrlFrom(filter) + `
+				WHERE ` + pageConditions + `
+				ORDER BY ` + shortUrlOrderBy(filter) + `
+				LIMIT $` + strconv.Itoa(len(pageArgs)+1) + ` OFFSET $` + strconv.Itoa(len(pageArgs)+2)
+		rows, err := tx.Query(ctx, q, append(pageArgs, page.Size+1, offset)...)
 		if err != nil {
 			return ret, err
 		}
@@ -246,7 +499,7 @@ func (p *PostgreSQLContext) GetShortUrlsByUserId(ctx context.Context, userId uui
 
 		for rows.Next() {
 			var r types.ShortUrl
-			err := rows.Scan(&r.Id, &r.DestinationUrl, &r.Slug, &r.CreatedAt, &r.UserId, &r.ExpiresAt)
+			err := scanShortUrl(rows, &r)
 			if err != nil {
 				return ret, err
 			}
@@ -254,53 +507,911 @@ func (p *PostgreSQLContext) GetShortUrlsByUserId(ctx context.Context, userId uui
 			shortUrls = append(shortUrls, r)
 		}
 
-		ret.Items = shortUrls
 		if err = rows.Err(); err != nil {
 			return ret, err
 		}
+		rows.Close()
+
+		if len(shortUrls) > page.Size {
+			shortUrls = shortUrls[:page.Size]
+			ret.HasMore = true
+			ret.NextCursor = shortUrlCursorAt(filter, &shortUrls[len(shortUrls)-1])
+		}
+
+		shortUrlPtrs := make([]*types.ShortUrl, len(shortUrls))
+		for i := range shortUrls {
+			shortUrlPtrs[i] = &shortUrls[i]
+		}
+		err = loadShortUrlVariants(ctx, tx, shortUrlPtrs...)
+		if err != nil {
+			return ret, err
+		}
+		err = loadShortUrlTags(ctx, tx, shortUrlPtrs...)
+		if err != nil {
+			return ret, err
+		}
+		ret.Items = shortUrls
+
+		if !page.WithTotal {
+			return ret, nil
+		}
 
 		var count int
 		err = tx.QueryRow(ctx, `
 			SELECT COUNT(id) FROM short_urls 
-			WHERE user_id = $1
-			AND expires_at > NOW()`, userId).Scan(&count)
+			WHERE `+conditions, args...).Scan(&count)
 		if err != nil {
 			return ret, err
 		}
 
-		ret.Total = count
+		ret.Total = &count
 		return ret, nil
 	})
 }
 
+// ExportShortUrlsByUserId streams every short url of the user to each, oldest first, without holding them all in memory.
+// It doesn't go through ExecWithRetry, rows that were already handed to each can't be taken back to try again.
+func (p *PostgreSQLContext) ExportShortUrlsByUserId(ctx context.Context, userId uuid.UUID, opts types.ShortUrlExportOptions, each func(types.ExportedShortUrl) error) error {
+	filter := types.ShortUrlFilter{Status: types.ShortUrlStatusActive, Ascending: true}
+	if opts.IncludeExpired {
+		filter.Status = types.ShortUrlStatusAll
+	}
+	conditions, args := shortUrlFilterConditions(userId, filter)
+
+	clicks := `NULL::bigint`
+	if opts.WithClicks {
+		clicks = `(SELECT COUNT(*) FROM click_events ce WHERE ce.short_url_id = short_urls.id)`
+	}
+
+	// the tags and variants come back as json with each row, loading them separately would mean buffering the rows
+	rows, err := p.dbPool.Query(ctx, `SELECT `+shortUrlColumns+`
+			, (SELECT json_agg(json_build_object('id', t.id, 'name', t.name, 'created_at', t.created_at) ORDER BY lower(t.name))
+				FROM short_url_tags st
+				JOIN tags t ON t.id = st.tag_id
+				WHERE st.short_url_id = short_urls.id)
+			, (SELECT json_agg(json_build_object('id', v.id, 'destination_url', v.destination_url, 'weight', v.weight) ORDER BY v.position)
+				FROM short_url_variants v
+				WHERE v.short_url_id = short_urls.id)
+			, `+clicks+`
+			FROM `+shortUrlFrom(filter)+`
+			WHERE `+conditions+`
+			ORDER BY `+shortUrlOrderBy(filter), args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var e types.ExportedShortUrl
+		err = rows.Scan(append(shortUrlScanTargets(&e.ShortUrl), &e.ShortUrl.Tags, &e.ShortUrl.Variants, &e.Clicks)...)
+		if err != nil {
+			return err
+		}
+		if err = each(e); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// shortUrlCursorCondition adds the keyset condition for the rows after the cursor, in the same order shortUrlOrderBy uses
+func shortUrlCursorCondition(conditions string, args []any, filter types.ShortUrlFilter, cursor types.ShortUrlCursor) (string, []any) {
+	var column string
+	switch filter.Sort {
+	case types.ShortUrlSortExpiresAt:
+		column = "expires_at"
+	case types.ShortUrlSortSlug:
+		column = "slug"
+	default:
+		column = "created_at"
+	}
+	cast := "::timestamptz"
+	if column == "slug" {
+		cast = "::text"
+	}
+	comparison := " < "
+	if filter.Ascending {
+		comparison = " > "
+	}
+
+	args = append(args[:len(args):len(args)], cursor.Value, cursor.Id)
+	conditions += ` AND (` + column + `, id)` + comparison + `($` + strconv.Itoa(len(args)-1) + cast + `, $` + strconv.Itoa(len(args)) + `)`
+	return conditions, args
+}
+
+// shortUrlCursorAt returns the cursor for the rows after shortUrl, clicks change between requests so they can't be paged by cursor
+func shortUrlCursorAt(filter types.ShortUrlFilter, shortUrl *types.ShortUrl) *types.ShortUrlCursor {
+	var value string
+	switch filter.Sort {
+	case types.ShortUrlSortClicks:
+		return nil
+	case types.ShortUrlSortExpiresAt:
+		value = shortUrl.ExpiresAt.Format(time.RFC3339Nano)
+	case types.ShortUrlSortSlug:
+		value = shortUrl.Slug
+	default:
+		value = shortUrl.CreatedAt.Format(time.RFC3339Nano)
+	}
+	return &types.ShortUrlCursor{Value: value, Id: shortUrl.Id}
+}
+
+// shortUrlFilterConditions builds the WHERE conditions shared by the page and the total, the user id is always $1
+func shortUrlFilterConditions(userId uuid.UUID, filter types.ShortUrlFilter) (string, []any) {
+	args := []any{userId}
+	conditions := `user_id = $1 AND ` + shortUrlNotDeleted
+	switch filter.Status {
+	case types.ShortUrlStatusAll:
+	case types.ShortUrlStatusExpired:
+		conditions += ` AND expires_at <= NOW()`
+	default:
+		conditions += ` AND expires_at > NOW()`
+	}
+
+	if filter.Search != "" {
+		args = append(args, "%"+likeEscaper.Replace(filter.Search)+"%")
+		n := strconv.Itoa(len(args))
+		conditions += ` AND (slug ILIKE $` + n + ` OR destination_url ILIKE $` + n + `)`
+	}
+	if filter.CreatedAfter != nil {
+		args = append(args, *filter.CreatedAfter)
+		conditions += ` AND created_at >= $` + strconv.Itoa(len(args))
+	}
+	if filter.CreatedBefore != nil {
+		args = append(args, *filter.CreatedBefore)
+		conditions += ` AND created_at < $` + strconv.Itoa(len(args))
+	}
+	if filter.Tag != "" {
+		args = append(args, filter.Tag)
+		conditions += ` AND EXISTS (
+					SELECT 1 FROM short_url_tags st
+					JOIN tags t ON t.id = st.tag_id
+					WHERE st.short_url_id = short_urls.id
+					AND lower(t.name) = lower($` + strconv.Itoa(len(args)) + `)
+				)`
+	}
+	return conditions, args
+}
+
+// likeEscaper stops a search for "50%" or "my_link" from matching everything
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// shortUrlFrom joins the click counts of all of the user's short urls in one aggregate when they are sorted by clicks,
+// instead of counting the clicks of every row separately before the limit can be applied. The user id is always $1
+func shortUrlFrom(filter types.ShortUrlFilter) string {
+	if filter.Sort != types.ShortUrlSortClicks {
+		return "short_urls"
+	}
+	return `short_urls
+			LEFT JOIN (
+				SELECT short_url_id, COUNT(*) AS clicks
+				FROM click_events
+				WHERE short_url_id IN (SELECT id FROM short_urls WHERE user_id = $1)
+				GROUP BY short_url_id
+			) click_counts ON click_counts.short_url_id = short_urls.id`
+}
+
+// shortUrlOrderBy only ever returns one of the fixed orderings, the id breaks ties so paging is stable
+func shortUrlOrderBy(filter types.ShortUrlFilter) string {
+	direction := " DESC"
+	if filter.Ascending {
+		direction = " ASC"
+	}
+
+	var column string
+	switch filter.Sort {
+	case types.ShortUrlSortExpiresAt:
+		column = "expires_at"
+	case types.ShortUrlSortSlug:
+		column = "slug"
+	case types.ShortUrlSortClicks:
+		column = "COALESCE(click_counts.clicks, 0)"
+	default:
+		column = "created_at"
+	}
+	return column + direction + ", id" + direction
+}
+
+// DeleteShortUrlById moves the short url to the trash, its slug stays taken until it is purged
 func (p *PostgreSQLContext) DeleteShortUrlById(ctx context.Context, userId uuid.UUID, shortUrlId uuid.UUID) (types.DeleteShortUrlResult, error) {
 	return ExecWithRetry(ctx, p.logger, p.dbPool, func(tx pgx.Tx) (types.DeleteShortUrlResult, error) {
-		ct, err := tx.Exec(ctx,
-			`DELETE FROM short_urls 
-			 WHERE user_id = $1 
+		var res types.DeleteShortUrlResult
+		err := tx.QueryRow(ctx,
+			`UPDATE short_urls
+			 SET deleted_at = NOW()
+			 WHERE user_id = $1
 			 AND id = $2
-			`, userId, shortUrlId)
+			 AND deleted_at IS NULL
+			 RETURNING slug
+			`, userId, shortUrlId).Scan(&res.Slug)
+		if err != nil && errors.Is(err, pgx.ErrNoRows) {
+			return res, nil
+		}
 		if err != nil {
-			return types.DeleteShortUrlResult{}, err
+			return res, err
 		}
 
-		var res types.DeleteShortUrlResult
-		deleted := ct.RowsAffected()
-		switch deleted {
-		case 1:
-			res.Found = true
-			res.NumDeleted = int(deleted)
-			return res, nil
-		case 0:
-			res.Found = false
-			res.NumDeleted = int(deleted)
-			return res, nil
-		default:
-			return res, &types.DeleteCountUnexpectedErr{}
+		res.Found = true
+		res.NumDeleted = 1
+		return res, nil
+	})
+}
+
+// GetDeletedShortUrlsByUserId lists the short urls in the user's trash, the most recently deleted first
+func (p *PostgreSQLContext) GetDeletedShortUrlsByUserId(ctx context.Context, userId uuid.UUID, page types.ShortUrlPage) (types.GetShortUrlsResult, error) {
+	return ExecWithRetry(ctx, p.logger, p.dbPool, func(tx pgx.Tx) (types.GetShortUrlsResult, error) {
+		ret := types.GetShortUrlsResult{}
+		var shortUrls []types.ShortUrl
+
+		// One extra row says whether there is another page without having to count everything
+		rows, err := tx.Query(ctx,
+			`SELECT `+shortUrlColumns+`
+			 FROM short_urls
+			 WHERE user_id = $1
+			 AND deleted_at IS NOT NULL
+			 ORDER BY deleted_at DESC, id DESC
+			 LIMIT $2 OFFSET $3`, userId, page.Size+1, page.Offset)
+		if err != nil {
+			return ret, err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var r types.ShortUrl
+			err := scanShortUrl(rows, &r)
+			if err != nil {
+				return ret, err
+			}
+
+			shortUrls = append(shortUrls, r)
+		}
+
+		if err = rows.Err(); err != nil {
+			return ret, err
+		}
+		rows.Close()
+
+		if len(shortUrls) > page.Size {
+			shortUrls = shortUrls[:page.Size]
+			ret.HasMore = true
+		}
+
+		shortUrlPtrs := make([]*types.ShortUrl, len(shortUrls))
+		for i := range shortUrls {
+			shortUrlPtrs[i] = &shortUrls[i]
+		}
+		err = loadShortUrlVariants(ctx, tx, shortUrlPtrs...)
+		if err != nil {
+			return ret, err
+		}
+		err = loadShortUrlTags(ctx, tx, shortUrlPtrs...)
+		if err != nil {
+			return ret, err
+		}
+		ret.Items = shortUrls
+
+		if !page.WithTotal {
+			return ret, nil
+		}
+
+		var count int
+		err = tx.QueryRow(ctx, `
+			SELECT COUNT(id) FROM short_urls
+			WHERE user_id = $1
+			AND deleted_at IS NOT NULL`, userId).Scan(&count)
+		if err != nil {
+			return ret, err
+		}
+
+		ret.Total = &count
+		return ret, nil
+	})
+}
+
+// RestoreShortUrl takes the short url out of the trash, it returns nil if it isn't in the user's trash.
+// A short url that expired while it was in the trash is restored as it is, expired.
+func (p *PostgreSQLContext) RestoreShortUrl(ctx context.Context, userId uuid.UUID, shortUrlId uuid.UUID) (*types.ShortUrl, error) {
+	return ExecWithRetry(ctx, p.logger, p.dbPool, func(tx pgx.Tx) (*types.ShortUrl, error) {
+		var shortUrl types.ShortUrl
+		err := scanShortUrl(tx.QueryRow(ctx,
+			`UPDATE short_urls
+			 SET deleted_at = NULL
+			 WHERE user_id = $1
+			 AND id = $2
+			 AND deleted_at IS NOT NULL
+			 RETURNING `+shortUrlColumns, userId, shortUrlId), &shortUrl)
+		if err != nil && errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		err = loadShortUrlVariants(ctx, tx, &shortUrl)
+		if err != nil {
+			return nil, err
+		}
+		return &shortUrl, loadShortUrlTags(ctx, tx, &shortUrl)
+	})
+}
+
+// DeleteShortUrls moves the whole selection to the trash in one statement
+func (p *PostgreSQLContext) DeleteShortUrls(ctx context.Context, userId uuid.UUID, selection types.ShortUrlSelection) (types.ChangeShortUrlsResult, error) {
+	return ExecWithRetry(ctx, p.logger, p.dbPool, func(tx pgx.Tx) (types.ChangeShortUrlsResult, error) {
+		conditions, args := shortUrlSelectionConditions(userId, selection)
+		return changeShortUrls(ctx, tx, selection, `UPDATE short_urls SET deleted_at = NOW() WHERE `+conditions+` RETURNING id, slug`, args)
+	})
+}
+
+// RenewShortUrl pushes the expiry out to ttl from now, or from the activation time of a scheduled short url. It never brings the expiry closer,
+// and like SetShortUrlsExpiry it brings back expired short urls that haven't been cleaned up yet. It returns nil if the user has no such short url.
+func (p *PostgreSQLContext) RenewShortUrl(ctx context.Context, userId uuid.UUID, shortUrlId uuid.UUID, ttl time.Duration) (*types.ShortUrl, error) {
+	return ExecWithRetry(ctx, p.logger, p.dbPool, func(tx pgx.Tx) (*types.ShortUrl, error) {
+		var shortUrl types.ShortUrl
+		err := scanShortUrl(tx.QueryRow(ctx,
+			`UPDATE short_urls
+			 SET expires_at = GREATEST(expires_at, GREATEST(NOW(), COALESCE(activates_at, NOW())) + $3::integer * INTERVAL '1 second')
+			 WHERE user_id = $1
+			 AND id = $2
+			 AND `+shortUrlNotDeleted+`
+			 RETURNING `+shortUrlColumns, userId, shortUrlId, int(ttl.Seconds())), &shortUrl)
+		if err != nil && errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		err = loadShortUrlVariants(ctx, tx, &shortUrl)
+		if err != nil {
+			return nil, err
+		}
+		return &shortUrl, loadShortUrlTags(ctx, tx, &shortUrl)
+	})
+}
+
+// SetShortUrlNeverExpires is RenewShortUrl for short urls that never expire, a sliding ttl is dropped since there is nothing left to slide.
+// It returns nil if the user has no such short url.
+func (p *PostgreSQLContext) SetShortUrlNeverExpires(ctx context.Context, userId uuid.UUID, shortUrlId uuid.UUID) (*types.ShortUrl, error) {
+	return ExecWithRetry(ctx, p.logger, p.dbPool, func(tx pgx.Tx) (*types.ShortUrl, error) {
+		var shortUrl types.ShortUrl
+		err := scanShortUrl(tx.QueryRow(ctx,
+			`UPDATE short_urls
+			 SET expires_at = $3, sliding_ttl = NULL
+			 WHERE user_id = $1
+			 AND id = $2
+			 AND `+shortUrlNotDeleted+`
+			 RETURNING `+shortUrlColumns, userId, shortUrlId, types.NeverExpires), &shortUrl)
+		if err != nil && errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		err = loadShortUrlVariants(ctx, tx, &shortUrl)
+		if err != nil {
+			return nil, err
+		}
+		return &shortUrl, loadShortUrlTags(ctx, tx, &shortUrl)
+	})
+}
+
+// SlideShortUrlExpiry pushes the expiry of a live short url with a sliding ttl out to that ttl from now.
+// It returns nil when the short url doesn't slide or isn't live anymore, the tags aren't loaded since this is only called on redirects.
+func (p *PostgreSQLContext) SlideShortUrlExpiry(ctx context.Context, shortUrlId uuid.UUID) (*types.ShortUrl, error) {
+	return ExecWithRetry(ctx, p.logger, p.dbPool, func(tx pgx.Tx) (*types.ShortUrl, error) {
+		var shortUrl types.ShortUrl
+		err := scanShortUrl(tx.QueryRow(ctx,
+			`UPDATE short_urls
+			 SET expires_at = GREATEST(expires_at, NOW() + sliding_ttl * INTERVAL '1 second')
+			 WHERE id = $1
+			 AND sliding_ttl IS NOT NULL
+			 AND expires_at > NOW()
+			 AND `+shortUrlNotDeleted+`
+			 AND `+shortUrlIsActive+`
+			 RETURNING `+shortUrlColumns, shortUrlId), &shortUrl)
+		if err != nil && errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		return &shortUrl, loadShortUrlVariants(ctx, tx, &shortUrl)
+	})
+}
+
+// SetShortUrlsExpiry also works on expired short urls that haven't been cleaned up yet, which brings them back
+func (p *PostgreSQLContext) SetShortUrlsExpiry(ctx context.Context, userId uuid.UUID, selection types.ShortUrlSelection, expiresAt time.Time) (types.ChangeShortUrlsResult, error) {
+	return ExecWithRetry(ctx, p.logger, p.dbPool, func(tx pgx.Tx) (types.ChangeShortUrlsResult, error) {
+		conditions, args := shortUrlSelectionConditions(userId, selection)
+		args = append(args, expiresAt)
+		return changeShortUrls(ctx, tx, selection, `UPDATE short_urls SET expires_at = $`+strconv.Itoa(len(args))+` WHERE `+conditions+` RETURNING id, slug`, args)
+	})
+}
+
+func shortUrlSelectionConditions(userId uuid.UUID, selection types.ShortUrlSelection) (string, []any) {
+	if selection.Filter != nil {
+		return shortUrlFilterConditions(userId, *selection.Filter)
+	}
+	return `user_id = $1 AND id = ANY($2) AND ` + shortUrlNotDeleted, []any{userId, selection.Ids}
+}
+
+// changeShortUrls runs a statement that returns the id and slug of every short url it changed
+func changeShortUrls(ctx context.Context, tx pgx.Tx, selection types.ShortUrlSelection, query string, args []any) (types.ChangeShortUrlsResult, error) {
+	var res types.ChangeShortUrlsResult
+	rows, err := tx.Query(ctx, query, args...)
+	if err != nil {
+		return res, err
+	}
+	defer rows.Close()
+
+	slugs := map[uuid.UUID]string{}
+	for rows.Next() {
+		var id uuid.UUID
+		var slug string
+		if err = rows.Scan(&id, &slug); err != nil {
+			return res, err
+		}
+		slugs[id] = slug
+		if selection.Filter != nil {
+			res.Items = append(res.Items, types.ChangedShortUrl{Id: id, Slug: slug, Found: true})
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return res, err
+	}
+	res.NumChanged = len(slugs)
+
+	if selection.Filter == nil {
+		for _, id := range selection.Ids {
+			slug, found := slugs[id]
+			res.Items = append(res.Items, types.ChangedShortUrl{Id: id, Slug: slug, Found: found})
+		}
+	}
+	return res, nil
+}
+
+func (p *PostgreSQLContext) UpdateShortUrl(ctx context.Context, userId uuid.UUID, shortUrlId uuid.UUID, req types.UpdateShortUrl) (*types.ShortUrl, error) {
+	return ExecWithRetry(ctx, p.logger, p.dbPool, func(tx pgx.Tx) (*types.ShortUrl, error) {
+		var shortUrl types.ShortUrl
+
+		// nil fields are left as they are
+		err := scanShortUrl(tx.QueryRow(ctx,
+			`UPDATE short_urls
+			 SET destination_url = COALESCE($3, destination_url)
+			   , expires_at = COALESCE($4, expires_at)
+			   , password_hash = CASE WHEN $6 THEN NULL ELSE COALESCE($5, password_hash) END
+			   , force_preview = COALESCE($7, force_preview)
+			   , redirect_type = COALESCE($8, redirect_type)
+			   , query_passthrough = COALESCE($9, query_passthrough)
+			   , path_passthrough = COALESCE($10, path_passthrough)
+			   , utm_source = NULLIF(COALESCE($11, utm_source), '')
+			   , utm_medium = NULLIF(COALESCE($12, utm_medium), '')
+			   , utm_campaign = NULLIF(COALESCE($13, utm_campaign), '')
+			   , routing_rules = CASE WHEN $15 THEN NULL ELSE COALESCE($14, routing_rules) END
+			   , sticky_variants = COALESCE($16, sticky_variants)
+			   , sliding_ttl = CASE WHEN $18 THEN NULL ELSE COALESCE($17, sliding_ttl) END
+			 WHERE user_id = $1
+			 AND id = $2
+			 AND expires_at > NOW()
+			 AND `+shortUrlNotDeleted+`
+			 RETURNING `+shortUrlColumns,
+			userId, shortUrlId, req.DestinationUrl, req.ExpiresAt, req.PasswordHash, req.RemovePassword, req.ForcePreview, req.RedirectType, req.QueryPassthrough, req.PathPassthrough,
+			req.UtmSource, req.UtmMedium, req.UtmCampaign, routingRulesParam(req.RoutingRules), req.RemoveRoutingRules, req.StickyVariants, req.SlidingTtl, req.RemoveSlidingTtl), &shortUrl)
+		if err != nil && errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		// only after the update so that the short url is known to belong to the user
+		if req.RemoveVariants || len(req.Variants) > 0 {
+			_, err = tx.Exec(ctx, `DELETE FROM short_url_variants WHERE short_url_id = $1`, shortUrl.Id)
+			if err != nil {
+				return nil, err
+			}
+			err = insertShortUrlVariants(ctx, tx, shortUrl.Id, req.Variants)
+			if err != nil {
+				return nil, err
+			}
+		}
+		err = loadShortUrlVariants(ctx, tx, &shortUrl)
+		if err != nil {
+			return nil, err
+		}
+		return &shortUrl, loadShortUrlTags(ctx, tx, &shortUrl)
+	})
+}
+
+func (p *PostgreSQLContext) CreateTag(ctx context.Context, req types.CreateTag) (*types.Tag, error) {
+	return ExecWithRetry(ctx, p.logger, p.dbPool, func(tx pgx.Tx) (*types.Tag, error) {
+		var tag types.Tag
+		err := tx.QueryRow(ctx,
+			`INSERT INTO tags (id, user_id, name, created_at)
+			 VALUES ($1, $2, $3, NOW())
+			 RETURNING id, name, created_at`,
+			req.Id, req.UserId, req.Name).Scan(&tag.Id, &tag.Name, &tag.CreatedAt)
+		if err != nil {
+			var pgErr *pgconn.PgError
+			if errors.As(err, &pgErr) {
+				if pgErr.Code == "23505" { // unique constraint violation error code
+					return nil, &types.TagExistsError{}
+				}
+			}
+			return nil, err
+		}
+		return &tag, nil
+	})
+}
+
+func (p *PostgreSQLContext) GetTagsByUserId(ctx context.Context, userId uuid.UUID) ([]types.Tag, error) {
+	return ExecWithRetry(ctx, p.logger, p.dbPool, func(tx pgx.Tx) ([]types.Tag, error) {
+		tags := []types.Tag{}
+		rows, err := tx.Query(ctx,
+			`SELECT id, name, created_at
+			 FROM tags
+			 WHERE user_id = $1
+			 ORDER BY lower(name)`, userId)
+		if err != nil {
+			return nil, err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var t types.Tag
+			err := rows.Scan(&t.Id, &t.Name, &t.CreatedAt)
+			if err != nil {
+				return nil, err
+			}
+			tags = append(tags, t)
+		}
+		return tags, rows.Err()
+	})
+}
+
+// DeleteTag also returns the short urls that had the tag, so that cached copies of them can be dropped
+func (p *PostgreSQLContext) DeleteTag(ctx context.Context, userId uuid.UUID, tagId uuid.UUID) (types.DeleteTagResult, error) {
+	return ExecWithRetry(ctx, p.logger, p.dbPool, func(tx pgx.Tx) (types.DeleteTagResult, error) {
+		var res types.DeleteTagResult
+		rows, err := tx.Query(ctx,
+			`SELECT st.short_url_id
+			 FROM short_url_tags st
+			 JOIN tags t ON t.id = st.tag_id
+			 WHERE t.user_id = $1
+			 AND t.id = $2`, userId, tagId)
+		if err != nil {
+			return res, err
+		}
+		res.ShortUrlIds, err = pgx.CollectRows(rows, pgx.RowTo[uuid.UUID])
+		if err != nil {
+			return res, err
+		}
+
+		ct, err := tx.Exec(ctx,
+			`DELETE FROM tags
+			 WHERE user_id = $1
+			 AND id = $2`, userId, tagId)
+		if err != nil {
+			return res, err
+		}
+
+		res.Found = ct.RowsAffected() == 1
+		return res, nil
+	})
+}
+
+// AddShortUrlTag returns false when the short url or the tag doesn't belong to the user, adding a tag twice is not an error
+func (p *PostgreSQLContext) AddShortUrlTag(ctx context.Context, userId uuid.UUID, shortUrlId uuid.UUID, tagId uuid.UUID) (bool, error) {
+	return ExecWithRetry(ctx, p.logger, p.dbPool, func(tx pgx.Tx) (bool, error) {
+		var found bool
+		err := tx.QueryRow(ctx,
+			`SELECT EXISTS (
+				SELECT 1 FROM short_urls WHERE id = $2 AND user_id = $1 AND expires_at > NOW() AND deleted_at IS NULL
+			 ) AND EXISTS (
+				SELECT 1 FROM tags WHERE id = $3 AND user_id = $1
+			 )`, userId, shortUrlId, tagId).Scan(&found)
+		if err != nil || !found {
+			return false, err
 		}
+
+		_, err = tx.Exec(ctx,
+			`INSERT INTO short_url_tags (short_url_id, tag_id)
+			 VALUES ($1, $2)
+			 ON CONFLICT DO NOTHING`, shortUrlId, tagId)
+		if err != nil {
+			return false, err
+		}
+		return true, nil
 	})
 }
 
+// RemoveShortUrlTag returns false when the short url doesn't have the tag or either of them doesn't belong to the user
+func (p *PostgreSQLContext) RemoveShortUrlTag(ctx context.Context, userId uuid.UUID, shortUrlId uuid.UUID, tagId uuid.UUID) (bool, error) {
+	return ExecWithRetry(ctx, p.logger, p.dbPool, func(tx pgx.Tx) (bool, error) {
+		ct, err := tx.Exec(ctx,
+			`DELETE FROM short_url_tags st
+			 USING short_urls s, tags t
+			 WHERE st.short_url_id = $2
+			 AND st.tag_id = $3
+			 AND s.id = st.short_url_id
+			 AND s.user_id = $1
+			 AND s.deleted_at IS NULL
+			 AND t.id = st.tag_id
+			 AND t.user_id = $1`, userId, shortUrlId, tagId)
+		if err != nil {
+			return false, err
+		}
+		return ct.RowsAffected() == 1, nil
+	})
+}
+
+// CreateClickEvents inserts the whole batch in one statement. Events for short urls that no longer exist are skipped
+func (p *PostgreSQLContext) CreateClickEvents(ctx context.Context, events []types.ClickEvent) (int, error) {
+	ids := make([]uuid.UUID, len(events))
+	shortUrlIds := make([]uuid.UUID, len(events))
+	slugs := make([]string, len(events))
+	clickedAts := make([]time.Time, len(events))
+	referrers := make([]*string, len(events))
+	userAgents := make([]*string, len(events))
+	ipAddresses := make([]*string, len(events))
+	variantIds := make([]*uuid.UUID, len(events))
+	for i, e := range events {
+		ids[i] = e.Id
+		shortUrlIds[i] = e.ShortUrlId
+		slugs[i] = e.Slug
+		clickedAts[i] = e.ClickedAt
+		referrers[i] = e.Referrer
+		userAgents[i] = e.UserAgent
+		ipAddresses[i] = e.IpAddress
+		variantIds[i] = e.VariantId
+	}
+
+	return ExecWithRetry(ctx, p.logger, p.dbPool, func(tx pgx.Tx) (int, error) {
+		// the variant hit counters only count events that were inserted, so a batch that is sent twice isn't counted twice
+		var inserted int
+		err := tx.QueryRow(ctx,
+			`WITH inserted AS (
+				INSERT INTO click_events (id, short_url_id, slug, clicked_at, referrer, user_agent, ip_address, variant_id)
+				SELECT e.id, e.short_url_id, e.slug, e.clicked_at, e.referrer, e.user_agent, e.ip_address, e.variant_id
+				FROM unnest($1::uuid[], $2::uuid[], $3::text[], $4::timestamptz[], $5::text[], $6::text[], $7::text[], $8::uuid[])
+					AS e(id, short_url_id, slug, clicked_at, referrer, user_agent, ip_address, variant_id)
+				WHERE EXISTS (SELECT 1 FROM short_urls WHERE id = e.short_url_id)
+				ON CONFLICT (id) DO NOTHING
+				RETURNING variant_id
+			 ), variant_hits AS (
+				UPDATE short_url_variants v
+				SET hits = v.hits + h.hits
+				FROM (
+					SELECT variant_id, COUNT(*) AS hits FROM inserted
+					WHERE variant_id IS NOT NULL
+					GROUP BY variant_id
+				) h
+				WHERE v.id = h.variant_id
+			 )
+			 SELECT COUNT(*) FROM inserted`,
+			ids, shortUrlIds, slugs, clickedAts, referrers, userAgents, ipAddresses, variantIds).Scan(&inserted)
+		if err != nil {
+			return 0, err
+		}
+		return inserted, nil
+	})
+}
+
+// GetShortUrlClickStats returns nil if the short url doesn't exist or doesn't belong to the user, clicks are split into days in the timezone
+func (p *PostgreSQLContext) GetShortUrlClickStats(ctx context.Context, userId uuid.UUID, shortUrlId uuid.UUID, since time.Time, timezone string) (*types.ShortUrlClickStats, error) {
+	return ExecWithRetry(ctx, p.logger, p.dbPool, func(tx pgx.Tx) (*types.ShortUrlClickStats, error) {
+		var exists bool
+		err := tx.QueryRow(ctx,
+			`SELECT EXISTS (
+				SELECT 1 FROM short_urls
+				WHERE id = $1
+				AND user_id = $2
+				AND deleted_at IS NULL
+			)`, shortUrlId, userId).Scan(&exists)
+		if err != nil {
+			return nil, err
+		}
+		if !exists {
+			return nil, nil
+		}
+
+		stats := types.ShortUrlClickStats{Daily: []types.DailyClicks{}}
+		err = tx.QueryRow(ctx, `SELECT COUNT(id) FROM click_events WHERE short_url_id = $1`, shortUrlId).Scan(&stats.Total)
+		if err != nil {
+			return nil, err
+		}
+
+		// generate_series makes sure days without any clicks are still in the result
+		rows, err := tx.Query(ctx,
+			`SELECT d.day, COUNT(ce.id)
+			 FROM generate_series(
+				date_trunc('day', $2::timestamptz AT TIME ZONE $3),
+				date_trunc('day', NOW() AT TIME ZONE $3),
+				INTERVAL '1 day'
+			 ) AS d(day)
+			 LEFT JOIN click_events ce
+				ON ce.short_url_id = $1
+				AND ce.clicked_at >= $2
+				AND date_trunc('day', ce.clicked_at AT TIME ZONE $3) = d.day
+			 GROUP BY d.day
+			 ORDER BY d.day`, shortUrlId, since, timezone)
+		if err != nil {
+			return nil, err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var d types.DailyClicks
+			err := rows.Scan(&d.Day, &d.Clicks)
+			if err != nil {
+				return nil, err
+			}
+			stats.Daily = append(stats.Daily, d)
+		}
+
+		if err = rows.Err(); err != nil {
+			return nil, err
+		}
+		rows.Close()
+
+		variantRows, err := tx.Query(ctx,
+			`SELECT id, destination_url, weight, hits
+			 FROM short_url_variants
+			 WHERE short_url_id = $1
+			 ORDER BY position`, shortUrlId)
+		if err != nil {
+			return nil, err
+		}
+		defer variantRows.Close()
+
+		for variantRows.Next() {
+			var v types.VariantHits
+			err := variantRows.Scan(&v.Id, &v.DestinationUrl, &v.Weight, &v.Hits)
+			if err != nil {
+				return nil, err
+			}
+			stats.Variants = append(stats.Variants, v)
+		}
+
+		if err = variantRows.Err(); err != nil {
+			return nil, err
+		}
+		return &stats, nil
+	})
+}
+
+func scanShortUrl(row pgx.Row, shortUrl *types.ShortUrl) error {
+	return row.Scan(shortUrlScanTargets(shortUrl)...)
+}
+
+// shortUrlScanTargets is in the same order as shortUrlColumns
+func shortUrlScanTargets(shortUrl *types.ShortUrl) []any {
+	return []any{
+		&shortUrl.Id, &shortUrl.DestinationUrl, &shortUrl.Slug, &shortUrl.CreatedAt, &shortUrl.UserId, &shortUrl.ExpiresAt, &shortUrl.PasswordHash,
+		&shortUrl.MaxClicks, &shortUrl.RemainingClicks, &shortUrl.ActivatesAt, &shortUrl.ForcePreview, &shortUrl.RedirectType, &shortUrl.QueryPassthrough, &shortUrl.PathPassthrough,
+		&shortUrl.UtmSource, &shortUrl.UtmMedium, &shortUrl.UtmCampaign, &shortUrl.RoutingRules, &shortUrl.StickyVariants, &shortUrl.SlidingTtl, &shortUrl.DeletedAt,
+	}
+}
+
+// insertShortUrlVariants keeps the order of the variants in their position
+func insertShortUrlVariants(ctx context.Context, tx pgx.Tx, shortUrlId uuid.UUID, variants []types.ShortUrlVariant) error {
+	if len(variants) == 0 {
+		return nil
+	}
+
+	ids := make([]uuid.UUID, len(variants))
+	destinationUrls := make([]string, len(variants))
+	weights := make([]int, len(variants))
+	for i, v := range variants {
+		ids[i] = v.Id
+		destinationUrls[i] = v.DestinationUrl
+		weights[i] = v.Weight
+	}
+
+	_, err := tx.Exec(ctx,
+		`INSERT INTO short_url_variants (id, short_url_id, position, destination_url, weight)
+		 SELECT v.id, $1, v.position, v.destination_url, v.weight
+		 FROM unnest($2::uuid[], $3::text[], $4::int[]) WITH ORDINALITY AS v(id, destination_url, weight, position)`,
+		shortUrlId, ids, destinationUrls, weights)
+	return err
+}
+
+// insertShortUrlTags skips tags that don't belong to the user, anonymous short urls can't have tags
+func insertShortUrlTags(ctx context.Context, tx pgx.Tx, shortUrlId uuid.UUID, userId *uuid.UUID, tagIds []uuid.UUID) error {
+	if len(tagIds) == 0 || userId == nil {
+		return nil
+	}
+
+	_, err := tx.Exec(ctx,
+		`INSERT INTO short_url_tags (short_url_id, tag_id)
+		 SELECT $1, id FROM tags
+		 WHERE user_id = $2
+		 AND id = ANY($3)
+		 ON CONFLICT DO NOTHING`,
+		shortUrlId, userId, tagIds)
+	return err
+}
+
+// loadShortUrlVariants fills in the variants of every short url with a single query
+func loadShortUrlVariants(ctx context.Context, tx pgx.Tx, shortUrls ...*types.ShortUrl) error {
+	if len(shortUrls) == 0 {
+		return nil
+	}
+
+	byId := make(map[uuid.UUID]*types.ShortUrl, len(shortUrls))
+	ids := make([]uuid.UUID, len(shortUrls))
+	for i, s := range shortUrls {
+		byId[s.Id] = s
+		ids[i] = s.Id
+	}
+
+	rows, err := tx.Query(ctx,
+		`SELECT short_url_id, id, destination_url, weight
+		 FROM short_url_variants
+		 WHERE short_url_id = ANY($1)
+		 ORDER BY short_url_id, position`, ids)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var shortUrlId uuid.UUID
+		var v types.ShortUrlVariant
+		err := rows.Scan(&shortUrlId, &v.Id, &v.DestinationUrl, &v.Weight)
+		if err != nil {
+			return err
+		}
+		byId[shortUrlId].Variants = append(byId[shortUrlId].Variants, v)
+	}
+	return rows.Err()
+}
+
+// loadShortUrlTags fills in the tags of every short url with a single query, sorted by name
+func loadShortUrlTags(ctx context.Context, tx pgx.Tx, shortUrls ...*types.ShortUrl) error {
+	if len(shortUrls) == 0 {
+		return nil
+	}
+
+	byId := make(map[uuid.UUID]*types.ShortUrl, len(shortUrls))
+	ids := make([]uuid.UUID, len(shortUrls))
+	for i, s := range shortUrls {
+		byId[s.Id] = s
+		ids[i] = s.Id
+	}
+
+	rows, err := tx.Query(ctx,
+		`SELECT st.short_url_id, t.id, t.name, t.created_at
+		 FROM short_url_tags st
+		 JOIN tags t ON t.id = st.tag_id
+		 WHERE st.short_url_id = ANY($1)
+		 ORDER BY st.short_url_id, lower(t.name)`, ids)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var shortUrlId uuid.UUID
+		var t types.Tag
+		err := rows.Scan(&shortUrlId, &t.Id, &t.Name, &t.CreatedAt)
+		if err != nil {
+			return err
+		}
+		byId[shortUrlId].Tags = append(byId[shortUrlId].Tags, t)
+	}
+	return rows.Err()
+}
+
+// routingRulesParam stores a short url without routing rules as NULL instead of an empty json array
+func routingRulesParam(rules []types.RoutingRule) any {
+	if len(rules) == 0 {
+		return nil
+	}
+	return rules
+}
+
 func storeIdempotencyKey(ctx context.Context, tx pgx.Tx, idempotencyKey uuid.UUID, requestHash string, referenceId uuid.UUID) (bool, string, uuid.UUID, error) {
 	idempotencyKeyUuid, err := uuid.NewV7()
 	if err != nil {
@@ -0,0 +1,19 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS click_events (
+    id              UUID PRIMARY KEY
+  , short_url_id    UUID NOT NULL REFERENCES short_urls(id) ON DELETE CASCADE
+  , slug            TEXT NOT NULL
+  , clicked_at      TIMESTAMPTZ NOT NULL
+  , referrer        TEXT
+  , user_agent      TEXT
+  , ip_address      TEXT -- anonymised before being stored, the last octets are zeroed
+);
+CREATE INDEX IF NOT EXISTS idx_click_events_short_url_id_clicked_at ON click_events (short_url_id, clicked_at);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS idx_click_events_short_url_id_clicked_at;
+DROP TABLE IF EXISTS click_events;
+-- +goose StatementEnd
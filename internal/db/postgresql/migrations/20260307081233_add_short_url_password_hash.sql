@@ -0,0 +1,11 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE short_urls
+ADD COLUMN IF NOT EXISTS password_hash TEXT; -- argon2id hash, NULL when the short url is not password protected
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE short_urls
+DROP COLUMN IF EXISTS password_hash;
+-- +goose StatementEnd
@@ -0,0 +1,18 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE short_urls
+ADD COLUMN IF NOT EXISTS max_clicks INTEGER CHECK (max_clicks > 0), -- NULL when the short url has no click limit
+ADD COLUMN IF NOT EXISTS remaining_clicks INTEGER CHECK (remaining_clicks >= 0);
+
+CREATE INDEX IF NOT EXISTS idx_short_urls_exhausted
+ON short_urls (remaining_clicks) WHERE remaining_clicks = 0;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS idx_short_urls_exhausted;
+
+ALTER TABLE short_urls
+DROP COLUMN IF EXISTS remaining_clicks,
+DROP COLUMN IF EXISTS max_clicks;
+-- +goose StatementEnd
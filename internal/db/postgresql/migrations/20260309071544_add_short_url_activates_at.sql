@@ -0,0 +1,11 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE short_urls
+ADD COLUMN IF NOT EXISTS activates_at TIMESTAMPTZ; -- NULL when the short url is active as soon as it is created
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE short_urls
+DROP COLUMN IF EXISTS activates_at;
+-- +goose StatementEnd
@@ -0,0 +1,11 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE short_urls
+ADD COLUMN IF NOT EXISTS force_preview BOOLEAN NOT NULL DEFAULT FALSE; -- always show the preview page instead of redirecting straight away
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE short_urls
+DROP COLUMN IF EXISTS force_preview;
+-- +goose StatementEnd
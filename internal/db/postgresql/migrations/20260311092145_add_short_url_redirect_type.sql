@@ -0,0 +1,11 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE short_urls
+ADD COLUMN IF NOT EXISTS redirect_type SMALLINT CHECK (redirect_type IN (301, 302, 307, 308)); -- NULL uses the server default
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE short_urls
+DROP COLUMN IF EXISTS redirect_type;
+-- +goose StatementEnd
@@ -0,0 +1,13 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE short_urls
+ADD COLUMN IF NOT EXISTS query_passthrough BOOLEAN NOT NULL DEFAULT FALSE, -- query parameters on the short url are added to the destination
+ADD COLUMN IF NOT EXISTS path_passthrough BOOLEAN NOT NULL DEFAULT FALSE; -- anything after the slug is appended to the destination path
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE short_urls
+DROP COLUMN IF EXISTS path_passthrough,
+DROP COLUMN IF EXISTS query_passthrough;
+-- +goose StatementEnd
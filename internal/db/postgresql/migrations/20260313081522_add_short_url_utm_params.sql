@@ -0,0 +1,15 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE short_urls
+ADD COLUMN IF NOT EXISTS utm_source TEXT, -- NULL when the parameter isn't added to the destination
+ADD COLUMN IF NOT EXISTS utm_medium TEXT,
+ADD COLUMN IF NOT EXISTS utm_campaign TEXT;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE short_urls
+DROP COLUMN IF EXISTS utm_campaign,
+DROP COLUMN IF EXISTS utm_medium,
+DROP COLUMN IF EXISTS utm_source;
+-- +goose StatementEnd
@@ -0,0 +1,30 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS short_url_variants (
+    id              UUID PRIMARY KEY
+  , short_url_id    UUID NOT NULL REFERENCES short_urls(id) ON DELETE CASCADE
+  , position        SMALLINT NOT NULL -- keeps the variants in the order they were given
+  , destination_url TEXT NOT NULL
+  , weight          INTEGER NOT NULL CHECK (weight > 0)
+  , hits            BIGINT NOT NULL DEFAULT 0
+  , UNIQUE (short_url_id, position)
+);
+
+ALTER TABLE short_urls
+ADD COLUMN IF NOT EXISTS sticky_variants BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- no foreign key, variants can be replaced while their click events are still queued
+ALTER TABLE click_events
+ADD COLUMN IF NOT EXISTS variant_id UUID;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE click_events
+DROP COLUMN IF EXISTS variant_id;
+
+ALTER TABLE short_urls
+DROP COLUMN IF EXISTS sticky_variants;
+
+DROP TABLE IF EXISTS short_url_variants;
+-- +goose StatementEnd
@@ -0,0 +1,26 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS tags (
+    id              UUID PRIMARY KEY
+  , user_id         UUID NOT NULL REFERENCES shurl_users(id) ON DELETE CASCADE
+  , name            TEXT NOT NULL
+  , created_at      TIMESTAMPTZ NOT NULL
+);
+-- tag names are unique per user regardless of case, ?tag= filtering is case insensitive too
+CREATE UNIQUE INDEX IF NOT EXISTS idx_tags_user_id_lower_name ON tags (user_id, lower(name));
+
+CREATE TABLE IF NOT EXISTS short_url_tags (
+    short_url_id    UUID NOT NULL REFERENCES short_urls(id) ON DELETE CASCADE
+  , tag_id          UUID NOT NULL REFERENCES tags(id) ON DELETE CASCADE
+  , PRIMARY KEY (short_url_id, tag_id)
+);
+CREATE INDEX IF NOT EXISTS idx_short_url_tags_tag_id ON short_url_tags (tag_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS idx_short_url_tags_tag_id;
+DROP TABLE IF EXISTS short_url_tags;
+DROP INDEX IF EXISTS idx_tags_user_id_lower_name;
+DROP TABLE IF EXISTS tags;
+-- +goose StatementEnd
@@ -0,0 +1,11 @@
+-- +goose Up
+-- +goose StatementBegin
+-- The default listing order, lets cursor pages start at the cursor instead of skipping rows
+CREATE INDEX IF NOT EXISTS idx_short_urls_user_id_created_at_id
+ON short_urls(user_id, created_at DESC, id DESC);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS idx_short_urls_user_id_created_at_id;
+-- +goose StatementEnd
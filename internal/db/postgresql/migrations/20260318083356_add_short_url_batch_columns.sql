@@ -0,0 +1,16 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE short_urls
+ADD COLUMN IF NOT EXISTS batch_id UUID, -- the batch request that created the short url, the reference id of its idempotency key
+ADD COLUMN IF NOT EXISTS batch_position INTEGER; -- where the item was in the batch request
+CREATE INDEX IF NOT EXISTS idx_short_urls_batch_id
+ON short_urls(batch_id) WHERE batch_id IS NOT NULL;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS idx_short_urls_batch_id;
+ALTER TABLE short_urls
+DROP COLUMN IF EXISTS batch_position,
+DROP COLUMN IF EXISTS batch_id;
+-- +goose StatementEnd
@@ -0,0 +1,15 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE short_urls
+ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMPTZ; -- set when the short url is moved to the trash, it is purged for good once the retention period has passed
+-- The trash listing only ever looks at deleted short urls, which keeps this index small
+CREATE INDEX IF NOT EXISTS idx_short_urls_user_id_deleted_at
+ON short_urls(user_id, deleted_at DESC) WHERE deleted_at IS NOT NULL;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS idx_short_urls_user_id_deleted_at;
+ALTER TABLE short_urls
+DROP COLUMN IF EXISTS deleted_at;
+-- +goose StatementEnd
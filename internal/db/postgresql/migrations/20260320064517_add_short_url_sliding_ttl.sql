@@ -0,0 +1,11 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE short_urls
+ADD COLUMN IF NOT EXISTS sliding_ttl INTEGER; -- in seconds, when set every redirect pushes expires_at out to at least this far from the redirect
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE short_urls
+DROP COLUMN IF EXISTS sliding_ttl;
+-- +goose StatementEnd
@@ -0,0 +1,17 @@
+-- +goose Up
+-- +goose StatementBegin
+-- a user only has a row once they have changed their preferences, until then the defaults apply
+CREATE TABLE IF NOT EXISTS user_preferences (
+    user_id               UUID PRIMARY KEY REFERENCES shurl_users(id) ON DELETE CASCADE
+  , default_ttl           INTEGER -- in seconds, null uses the server's default
+  , default_redirect_type SMALLINT CHECK (default_redirect_type IN (301, 302, 307, 308)) -- null uses the server's redirect type
+  , default_tag_ids       UUID[] NOT NULL DEFAULT '{}' -- no foreign key, ids of deleted tags are skipped when they are read
+  , timezone              TEXT NOT NULL DEFAULT 'UTC' -- IANA name, used to split click stats into days
+  , updated_at            TIMESTAMPTZ NOT NULL
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS user_preferences;
+-- +goose StatementEnd
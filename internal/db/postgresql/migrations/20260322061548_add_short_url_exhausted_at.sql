@@ -0,0 +1,22 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE short_urls
+ADD COLUMN IF NOT EXISTS exhausted_at TIMESTAMPTZ; -- when the last click was used up, exhausted short urls are kept for a while so they answer with 410 Gone and keep their stats
+
+-- short urls that are already used up get the grace period from now
+UPDATE short_urls SET exhausted_at = NOW() WHERE remaining_clicks = 0;
+
+DROP INDEX IF EXISTS idx_short_urls_exhausted;
+CREATE INDEX IF NOT EXISTS idx_short_urls_exhausted_at
+ON short_urls (exhausted_at) WHERE exhausted_at IS NOT NULL;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS idx_short_urls_exhausted_at;
+CREATE INDEX IF NOT EXISTS idx_short_urls_exhausted
+ON short_urls (remaining_clicks) WHERE remaining_clicks = 0;
+
+ALTER TABLE short_urls
+DROP COLUMN IF EXISTS exhausted_at;
+-- +goose StatementEnd
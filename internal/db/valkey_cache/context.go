@@ -4,7 +4,9 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"net/url"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/amieldelatorre/shurl/internal/db"
@@ -26,6 +28,7 @@ const (
 	DB_VERSION_KEY               = "goose_db_version_max_id"
 	USER_EMAIL_PREFIX            = "shurl_user:email::"
 	CACHE_DOUBLE_DELETE_SLEEP_MS = 250
+	CACHE_DEFAULT_EXPIRY         = 300 * time.Second
 )
 
 func NewValkeyCacheContext(logger utils.CustomJsonLogger, client *glide.Client, dbContext db.DbContext) *ValkeyCacheContext {
@@ -68,6 +71,10 @@ func (v *ValkeyCacheContext) GetDatabaseVersion(ctx context.Context) (int64, err
 
 func (v *ValkeyCacheContext) CreateShortUrl(ctx context.Context, req types.CreateShortUrl, idempotencyKey uuid.UUID, request_hash string) (*types.ShortUrl, error) {
 	delKeys := func() {
+		err := v.delKeys(ctx, []string{getShortUrlBySlugCachePrefix(req.Slug)})
+		if err != nil {
+			v.logger.Error(ctx, "couldn't delete keys from valkey", "error", err.Error())
+		}
 		if req.UserId != nil {
 			err := v.delUserShortUrlQueries(ctx, getShortUrlsByUserIdCachePrefix(*req.UserId)+"*")
 			if err != nil {
@@ -84,6 +91,40 @@ func (v *ValkeyCacheContext) CreateShortUrl(ctx context.Context, req types.Creat
 	return res, resErr
 }
 
+// CreateShortUrlBatch invalidates the keys of the whole batch at once instead of once per short url
+func (v *ValkeyCacheContext) CreateShortUrlBatch(ctx context.Context, req types.CreateShortUrlBatch, idempotencyKey uuid.UUID, requestHash string) ([]types.CreateShortUrlBatchResult, error) {
+	slugKeys := make([]string, 0, len(req.Items))
+	userIds := map[uuid.UUID]struct{}{}
+	for _, item := range req.Items {
+		slugKeys = append(slugKeys, getShortUrlBySlugCachePrefix(item.ShortUrl.Slug))
+		if item.ShortUrl.UserId != nil {
+			userIds[*item.ShortUrl.UserId] = struct{}{}
+		}
+	}
+
+	delKeys := func() {
+		if len(slugKeys) > 0 {
+			err := v.delKeys(ctx, slugKeys)
+			if err != nil {
+				v.logger.Error(ctx, "couldn't delete keys from valkey", "error", err.Error())
+			}
+		}
+		for userId := range userIds {
+			err := v.delUserShortUrlQueries(ctx, getShortUrlsByUserIdCachePrefix(userId)+"*")
+			if err != nil {
+				v.logger.Error(ctx, "couldn't unlink keys from valkey", "error", err.Error())
+			}
+		}
+	}
+
+	delKeys()
+	res, resErr := v.dbContext.CreateShortUrlBatch(ctx, req, idempotencyKey, requestHash)
+	time.Sleep(CACHE_DOUBLE_DELETE_SLEEP_MS * time.Millisecond)
+	delKeys()
+
+	return res, resErr
+}
+
 func (v *ValkeyCacheContext) GetShortUrlById(ctx context.Context, id uuid.UUID, excludeExpired bool) (*types.ShortUrl, error) {
 	cacheKey := getShortUrlByIdCachePrefix(id)
 	resStr, err := v.getKey(ctx, cacheKey)
@@ -98,6 +139,10 @@ func (v *ValkeyCacheContext) GetShortUrlById(ctx context.Context, id uuid.UUID,
 			return nil, err
 		}
 
+		// the cached short url may have been stored by a call that didn't exclude expired or scheduled short urls
+		if excludeExpired && !r.IsLive(time.Now()) {
+			return nil, nil
+		}
 		return &r, nil
 	}
 
@@ -116,7 +161,7 @@ func (v *ValkeyCacheContext) GetShortUrlById(ctx context.Context, id uuid.UUID,
 		return shortUrl, nil
 	}
 
-	err = v.setKey(ctx, cacheKey, string(strData))
+	err = v.setKeyWithExpiry(ctx, cacheKey, string(strData), getShortUrlCacheExpiry(shortUrl))
 	if err != nil {
 		v.logger.Error(ctx, "could not set short url in valkey", "error", err.Error())
 	}
@@ -137,6 +182,10 @@ func (v *ValkeyCacheContext) GetShortUrlBySlug(ctx context.Context, slug string,
 			return nil, err
 		}
 
+		// the cached short url may have been stored by a call that didn't exclude expired or scheduled short urls
+		if excludeExpired && !r.IsLive(time.Now()) {
+			return nil, nil
+		}
 		return &r, nil
 	}
 
@@ -155,7 +204,7 @@ func (v *ValkeyCacheContext) GetShortUrlBySlug(ctx context.Context, slug string,
 		return shortUrl, nil
 	}
 
-	err = v.setKey(ctx, cacheKey, string(strData))
+	err = v.setKeyWithExpiry(ctx, cacheKey, string(strData), getShortUrlCacheExpiry(shortUrl))
 	if err != nil {
 		v.logger.Error(ctx, "could not set short url in valkey", "error", err.Error())
 	}
@@ -166,6 +215,19 @@ func (v *ValkeyCacheContext) GetShortUrlBySlug(ctx context.Context, slug string,
 func (v *ValkeyCacheContext) CreateUser(ctx context.Context, idempotencyKey uuid.UUID, requestHash string, req types.CreateUserRequest) (*types.User, error) {
 	return v.dbContext.CreateUser(ctx, idempotencyKey, requestHash, req)
 }
+func (v *ValkeyCacheContext) GetUserById(ctx context.Context, userId uuid.UUID) (*types.User, error) {
+	return v.dbContext.GetUserById(ctx, userId)
+}
+
+// GetUserPreferences isn't cached, it is a single row read by primary key
+func (v *ValkeyCacheContext) GetUserPreferences(ctx context.Context, userId uuid.UUID) (types.UserPreferences, error) {
+	return v.dbContext.GetUserPreferences(ctx, userId)
+}
+
+func (v *ValkeyCacheContext) UpdateUserPreferences(ctx context.Context, userId uuid.UUID, req types.UpdateUserPreferences) (types.UserPreferences, error) {
+	return v.dbContext.UpdateUserPreferences(ctx, userId, req)
+}
+
 func (v *ValkeyCacheContext) GetUserByEmail(ctx context.Context, email string) (*types.User, error) {
 	cacheKey := USER_EMAIL_PREFIX + email
 	resStr, err := v.getKey(ctx, cacheKey)
@@ -222,8 +284,31 @@ func (v *ValkeyCacheContext) DeleteExpiredShortUrlsBatched(ctx context.Context,
 	return v.dbContext.DeleteExpiredShortUrlsBatched(ctx, batchSize)
 }
 
-func (v *ValkeyCacheContext) GetShortUrlsByUserId(ctx context.Context, userId uuid.UUID, size int, offset int) (types.GetShortUrlsResult, error) {
-	cacheKey := getShortUrlsByUserIdCacheKey(userId, size, offset)
+func (v *ValkeyCacheContext) DeleteExhaustedShortUrls(ctx context.Context, exhaustedBefore time.Time) (int, error) {
+	return v.dbContext.DeleteExhaustedShortUrls(ctx, exhaustedBefore)
+}
+
+// PurgeDeletedShortUrls has nothing to invalidate, short urls in the trash were dropped from the cache when they were deleted
+func (v *ValkeyCacheContext) PurgeDeletedShortUrls(ctx context.Context, deletedBefore time.Time) (int, error) {
+	return v.dbContext.PurgeDeletedShortUrls(ctx, deletedBefore)
+}
+
+// ConsumeShortUrlClick always goes to the database, the remaining clicks in the cache can be out of date
+func (v *ValkeyCacheContext) ConsumeShortUrlClick(ctx context.Context, shortUrlId uuid.UUID) (bool, error) {
+	return v.dbContext.ConsumeShortUrlClick(ctx, shortUrlId)
+}
+
+func (v *ValkeyCacheContext) GetTakenSlugs(ctx context.Context, slugs []string) ([]string, error) {
+	return v.dbContext.GetTakenSlugs(ctx, slugs)
+}
+
+// GetShortUrlsByUserId doesn't cache lists sorted by clicks, new clicks are flushed in the background and nothing would drop the cached order
+func (v *ValkeyCacheContext) GetShortUrlsByUserId(ctx context.Context, userId uuid.UUID, filter types.ShortUrlFilter, page types.ShortUrlPage) (types.GetShortUrlsResult, error) {
+	if filter.Sort == types.ShortUrlSortClicks {
+		return v.dbContext.GetShortUrlsByUserId(ctx, userId, filter, page)
+	}
+
+	cacheKey := getShortUrlsByUserIdCacheKey(userId, filter, page)
 
 	resStr, err := v.getKey(ctx, cacheKey)
 	if err != nil {
@@ -240,7 +325,7 @@ func (v *ValkeyCacheContext) GetShortUrlsByUserId(ctx context.Context, userId uu
 		return userShortUrls, nil
 	}
 
-	userShortUrls, err = v.dbContext.GetShortUrlsByUserId(ctx, userId, size, offset)
+	userShortUrls, err = v.dbContext.GetShortUrlsByUserId(ctx, userId, filter, page)
 	if err != nil {
 		return userShortUrls, err
 	}
@@ -259,9 +344,31 @@ func (v *ValkeyCacheContext) GetShortUrlsByUserId(ctx context.Context, userId uu
 	return userShortUrls, nil
 }
 
-func (v *ValkeyCacheContext) DeleteShortUrlById(ctx context.Context, userId uuid.UUID, shortUrlId uuid.UUID) (types.DeleteShortUrlResult, error) {
-	delKeys := func() {
-		err := v.delKeys(ctx, []string{getShortUrlByIdCachePrefix(shortUrlId)})
+func (v *ValkeyCacheContext) UpdateShortUrl(ctx context.Context, userId uuid.UUID, shortUrlId uuid.UUID, req types.UpdateShortUrl) (*types.ShortUrl, error) {
+	delKeys := v.delShortUrlKeys(ctx, userId, shortUrlId)
+	delKeys(nil)
+	result, resultErr := v.dbContext.UpdateShortUrl(ctx, userId, shortUrlId, req)
+	var slug *string
+	if result != nil {
+		slug = &result.Slug
+	}
+	delKeys(slug)
+	time.Sleep(CACHE_DOUBLE_DELETE_SLEEP_MS * time.Millisecond)
+	delKeys(slug)
+
+	return result, resultErr
+}
+
+// delShortUrlKeys drops the cached copies of a short url and the user's lists.
+// The slug is only known once the change has returned, so the first delete can only cover the id and is given nil
+func (v *ValkeyCacheContext) delShortUrlKeys(ctx context.Context, userId uuid.UUID, shortUrlId uuid.UUID) func(slug *string) {
+	return func(slug *string) {
+		keys := []string{getShortUrlByIdCachePrefix(shortUrlId)}
+		if slug != nil {
+			keys = append(keys, getShortUrlBySlugCachePrefix(*slug))
+		}
+
+		err := v.delKeys(ctx, keys)
 		if err != nil {
 			v.logger.Error(ctx, "couldn't delete keys from valkey", "error", err.Error())
 		}
@@ -270,15 +377,243 @@ func (v *ValkeyCacheContext) DeleteShortUrlById(ctx context.Context, userId uuid
 			v.logger.Error(ctx, "couldn't unlink keys from valkey", "error", err.Error())
 		}
 	}
+}
 
-	delKeys()
+// DeleteShortUrlById also drops the short url by slug once it is known, otherwise a trashed short url keeps redirecting until its cached copy expires
+func (v *ValkeyCacheContext) DeleteShortUrlById(ctx context.Context, userId uuid.UUID, shortUrlId uuid.UUID) (types.DeleteShortUrlResult, error) {
+	delKeys := v.delShortUrlKeys(ctx, userId, shortUrlId)
+	delKeys(nil)
 	result, resultErr := v.dbContext.DeleteShortUrlById(ctx, userId, shortUrlId)
+	var slug *string
+	if result.Slug != "" {
+		slug = &result.Slug
+	}
+	delKeys(slug)
+	time.Sleep(CACHE_DOUBLE_DELETE_SLEEP_MS * time.Millisecond)
+	delKeys(slug)
+
+	return result, resultErr
+}
+
+// GetDeletedShortUrlsByUserId isn't cached, the purge worker would have to invalidate it for every user it touches
+func (v *ValkeyCacheContext) GetDeletedShortUrlsByUserId(ctx context.Context, userId uuid.UUID, page types.ShortUrlPage) (types.GetShortUrlsResult, error) {
+	return v.dbContext.GetDeletedShortUrlsByUserId(ctx, userId, page)
+}
+
+// RestoreShortUrl follows UpdateShortUrl, the slug is only known once the short url is out of the trash
+func (v *ValkeyCacheContext) RestoreShortUrl(ctx context.Context, userId uuid.UUID, shortUrlId uuid.UUID) (*types.ShortUrl, error) {
+	delKeys := v.delShortUrlKeys(ctx, userId, shortUrlId)
+	delKeys(nil)
+	result, resultErr := v.dbContext.RestoreShortUrl(ctx, userId, shortUrlId)
+	var slug *string
+	if result != nil {
+		slug = &result.Slug
+	}
+	delKeys(slug)
+	time.Sleep(CACHE_DOUBLE_DELETE_SLEEP_MS * time.Millisecond)
+	delKeys(slug)
+
+	return result, resultErr
+}
+
+// RenewShortUrl follows UpdateShortUrl, the slug is only known once the expiry has changed
+func (v *ValkeyCacheContext) RenewShortUrl(ctx context.Context, userId uuid.UUID, shortUrlId uuid.UUID, ttl time.Duration) (*types.ShortUrl, error) {
+	delKeys := v.delShortUrlKeys(ctx, userId, shortUrlId)
+	delKeys(nil)
+	result, resultErr := v.dbContext.RenewShortUrl(ctx, userId, shortUrlId, ttl)
+	var slug *string
+	if result != nil {
+		slug = &result.Slug
+	}
+	delKeys(slug)
+	time.Sleep(CACHE_DOUBLE_DELETE_SLEEP_MS * time.Millisecond)
+	delKeys(slug)
+
+	return result, resultErr
+}
+
+// SetShortUrlNeverExpires follows RenewShortUrl
+func (v *ValkeyCacheContext) SetShortUrlNeverExpires(ctx context.Context, userId uuid.UUID, shortUrlId uuid.UUID) (*types.ShortUrl, error) {
+	delKeys := v.delShortUrlKeys(ctx, userId, shortUrlId)
+	delKeys(nil)
+	result, resultErr := v.dbContext.SetShortUrlNeverExpires(ctx, userId, shortUrlId)
+	var slug *string
+	if result != nil {
+		slug = &result.Slug
+	}
+	delKeys(slug)
+	time.Sleep(CACHE_DOUBLE_DELETE_SLEEP_MS * time.Millisecond)
+	delKeys(slug)
+
+	return result, resultErr
+}
+
+// SlideShortUrlExpiry happens after a redirect, so instead of a double delete the short url by slug is replaced with the one that has the new expiry.
+// Otherwise the cached copy would stop resolving at the old expiry. The copy by id has tags that aren't loaded here, so it is dropped.
+func (v *ValkeyCacheContext) SlideShortUrlExpiry(ctx context.Context, shortUrlId uuid.UUID) (*types.ShortUrl, error) {
+	shortUrl, err := v.dbContext.SlideShortUrlExpiry(ctx, shortUrlId)
+	if err != nil || shortUrl == nil {
+		return shortUrl, err
+	}
+
+	err = v.delKeys(ctx, []string{getShortUrlByIdCachePrefix(shortUrlId)})
+	if err != nil {
+		v.logger.Error(ctx, "couldn't delete keys from valkey", "error", err.Error())
+	}
+	if shortUrl.UserId != nil {
+		err = v.delUserShortUrlQueries(ctx, getShortUrlsByUserIdCachePrefix(*shortUrl.UserId)+"*")
+		if err != nil {
+			v.logger.Error(ctx, "couldn't unlink keys from valkey", "error", err.Error())
+		}
+	}
+
+	strData, err := json.Marshal(shortUrl)
+	if err != nil {
+		v.logger.Error(ctx, "could not marshal short url for valkey", "error", err.Error())
+		return shortUrl, nil
+	}
+
+	err = v.setKeyWithExpiry(ctx, getShortUrlBySlugCachePrefix(shortUrl.Slug), string(strData), getShortUrlCacheExpiry(shortUrl))
+	if err != nil {
+		v.logger.Error(ctx, "could not set short url in valkey", "error", err.Error())
+	}
+	return shortUrl, nil
+}
+
+func (v *ValkeyCacheContext) DeleteShortUrls(ctx context.Context, userId uuid.UUID, selection types.ShortUrlSelection) (types.ChangeShortUrlsResult, error) {
+	return v.changeShortUrls(ctx, userId, selection, func() (types.ChangeShortUrlsResult, error) {
+		return v.dbContext.DeleteShortUrls(ctx, userId, selection)
+	})
+}
+
+func (v *ValkeyCacheContext) SetShortUrlsExpiry(ctx context.Context, userId uuid.UUID, selection types.ShortUrlSelection, expiresAt time.Time) (types.ChangeShortUrlsResult, error) {
+	return v.changeShortUrls(ctx, userId, selection, func() (types.ChangeShortUrlsResult, error) {
+		return v.dbContext.SetShortUrlsExpiry(ctx, userId, selection, expiresAt)
+	})
+}
+
+// changeShortUrls invalidates the cache once for the whole batch. A filter selection only knows its short urls after the change,
+// so the first delete can only cover the requested ids and the user's queries, the second one covers everything that changed.
+func (v *ValkeyCacheContext) changeShortUrls(ctx context.Context, userId uuid.UUID, selection types.ShortUrlSelection, change func() (types.ChangeShortUrlsResult, error)) (types.ChangeShortUrlsResult, error) {
+	delKeys := func(keys []string) {
+		if len(keys) > 0 {
+			err := v.delKeys(ctx, keys)
+			if err != nil {
+				v.logger.Error(ctx, "couldn't delete keys from valkey", "error", err.Error())
+			}
+		}
+		err := v.delUserShortUrlQueries(ctx, getShortUrlsByUserIdCachePrefix(userId)+"*")
+		if err != nil {
+			v.logger.Error(ctx, "couldn't unlink keys from valkey", "error", err.Error())
+		}
+	}
+
+	keys := []string{}
+	for _, id := range selection.Ids {
+		keys = append(keys, getShortUrlByIdCachePrefix(id))
+	}
+	delKeys(keys)
+	result, resultErr := change()
+
+	keys = []string{}
+	for _, item := range result.Items {
+		if item.Found {
+			keys = append(keys, getShortUrlByIdCachePrefix(item.Id), getShortUrlBySlugCachePrefix(item.Slug))
+		}
+	}
+	// with no changes there is nothing new to invalidate, the sleep would only slow the response down
+	if result.NumChanged > 0 {
+		delKeys(keys)
+		time.Sleep(CACHE_DOUBLE_DELETE_SLEEP_MS * time.Millisecond)
+		delKeys(keys)
+	}
+
+	return result, resultErr
+}
+
+func (v *ValkeyCacheContext) CreateTag(ctx context.Context, req types.CreateTag) (*types.Tag, error) {
+	return v.dbContext.CreateTag(ctx, req)
+}
+
+func (v *ValkeyCacheContext) GetTagsByUserId(ctx context.Context, userId uuid.UUID) ([]types.Tag, error) {
+	return v.dbContext.GetTagsByUserId(ctx, userId)
+}
+
+// DeleteTag only knows which short urls had the tag once it has been deleted, before that only the queries can be dropped
+func (v *ValkeyCacheContext) DeleteTag(ctx context.Context, userId uuid.UUID, tagId uuid.UUID) (types.DeleteTagResult, error) {
+	delKeys := func(shortUrlIds []uuid.UUID) {
+		keys := []string{}
+		for _, id := range shortUrlIds {
+			keys = append(keys, getShortUrlByIdCachePrefix(id))
+		}
+		if len(keys) > 0 {
+			err := v.delKeys(ctx, keys)
+			if err != nil {
+				v.logger.Error(ctx, "couldn't delete keys from valkey", "error", err.Error())
+			}
+		}
+		err := v.delUserShortUrlQueries(ctx, getShortUrlsByUserIdCachePrefix(userId)+"*")
+		if err != nil {
+			v.logger.Error(ctx, "couldn't unlink keys from valkey", "error", err.Error())
+		}
+	}
+
+	delKeys(nil)
+	result, resultErr := v.dbContext.DeleteTag(ctx, userId, tagId)
+	delKeys(result.ShortUrlIds)
+	time.Sleep(CACHE_DOUBLE_DELETE_SLEEP_MS * time.Millisecond)
+	delKeys(result.ShortUrlIds)
+
+	return result, resultErr
+}
+
+func (v *ValkeyCacheContext) AddShortUrlTag(ctx context.Context, userId uuid.UUID, shortUrlId uuid.UUID, tagId uuid.UUID) (bool, error) {
+	delKeys := v.delShortUrlTagKeys(ctx, userId, shortUrlId)
+	delKeys()
+	result, resultErr := v.dbContext.AddShortUrlTag(ctx, userId, shortUrlId, tagId)
+	time.Sleep(CACHE_DOUBLE_DELETE_SLEEP_MS * time.Millisecond)
+	delKeys()
+
+	return result, resultErr
+}
+
+func (v *ValkeyCacheContext) RemoveShortUrlTag(ctx context.Context, userId uuid.UUID, shortUrlId uuid.UUID, tagId uuid.UUID) (bool, error) {
+	delKeys := v.delShortUrlTagKeys(ctx, userId, shortUrlId)
+	delKeys()
+	result, resultErr := v.dbContext.RemoveShortUrlTag(ctx, userId, shortUrlId, tagId)
 	time.Sleep(CACHE_DOUBLE_DELETE_SLEEP_MS * time.Millisecond)
 	delKeys()
 
 	return result, resultErr
 }
 
+// delShortUrlTagKeys drops everything that shows the tags of a short url, the cached copy by slug doesn't have tags
+func (v *ValkeyCacheContext) delShortUrlTagKeys(ctx context.Context, userId uuid.UUID, shortUrlId uuid.UUID) func() {
+	return func() {
+		err := v.delKeys(ctx, []string{getShortUrlByIdCachePrefix(shortUrlId)})
+		if err != nil {
+			v.logger.Error(ctx, "couldn't delete keys from valkey", "error", err.Error())
+		}
+		err = v.delUserShortUrlQueries(ctx, getShortUrlsByUserIdCachePrefix(userId)+"*")
+		if err != nil {
+			v.logger.Error(ctx, "couldn't unlink keys from valkey", "error", err.Error())
+		}
+	}
+}
+
+func (v *ValkeyCacheContext) CreateClickEvents(ctx context.Context, events []types.ClickEvent) (int, error) {
+	return v.dbContext.CreateClickEvents(ctx, events)
+}
+
+// ExportShortUrlsByUserId isn't cached, an export is rare and would only push everything else out of the cache
+func (v *ValkeyCacheContext) ExportShortUrlsByUserId(ctx context.Context, userId uuid.UUID, opts types.ShortUrlExportOptions, each func(types.ExportedShortUrl) error) error {
+	return v.dbContext.ExportShortUrlsByUserId(ctx, userId, opts, each)
+}
+
+func (v *ValkeyCacheContext) GetShortUrlClickStats(ctx context.Context, userId uuid.UUID, shortUrlId uuid.UUID, since time.Time, timezone string) (*types.ShortUrlClickStats, error) {
+	return v.dbContext.GetShortUrlClickStats(ctx, userId, shortUrlId, since, timezone)
+}
+
 func (v *ValkeyCacheContext) getKey(ctx context.Context, key string) (*string, error) {
 	value, err := v.client.Get(ctx, key)
 	if err != nil {
@@ -294,8 +629,12 @@ func (v *ValkeyCacheContext) getKey(ctx context.Context, key string) (*string, e
 }
 
 func (v *ValkeyCacheContext) setKey(ctx context.Context, key string, value string) error {
+	return v.setKeyWithExpiry(ctx, key, value, CACHE_DEFAULT_EXPIRY)
+}
+
+func (v *ValkeyCacheContext) setKeyWithExpiry(ctx context.Context, key string, value string, expiry time.Duration) error {
 	_, err := v.client.SetWithOptions(ctx, key, value, options.SetOptions{
-		Expiry: options.NewExpiryIn(time.Duration(300) * time.Second),
+		Expiry: options.NewExpiryIn(expiry),
 	})
 	return err
 }
@@ -338,12 +677,63 @@ func (v *ValkeyCacheContext) delUserShortUrlQueries(ctx context.Context, keyPref
 	return nil
 }
 
+// getShortUrlCacheExpiry stops the cache from holding on to a short url after it expires,
+// and makes a scheduled short url get read from the database again once it activates
+func getShortUrlCacheExpiry(shortUrl *types.ShortUrl) time.Duration {
+	now := time.Now()
+	expiry := CACHE_DEFAULT_EXPIRY
+	if untilExpired := shortUrl.ExpiresAt.Sub(now); untilExpired < expiry {
+		expiry = untilExpired
+	}
+	if shortUrl.IsScheduled(now) {
+		if untilActive := shortUrl.ActivatesAt.Sub(now); untilActive < expiry {
+			expiry = untilActive
+		}
+	}
+
+	// valkey doesn't accept an expiry of 0, an already expired short url is only cached for a moment
+	if expiry < time.Second {
+		expiry = time.Second
+	}
+	return expiry
+}
+
 func getShortUrlsByUserIdCachePrefix(userId uuid.UUID) string {
 	return fmt.Sprintf("{shurl_user:id::%s}:short_urls_query", userId.String())
 }
 
-func getShortUrlsByUserIdCacheKey(userId uuid.UUID, size int, offset int) string {
-	return fmt.Sprintf("%s:size::%d:offset::%d", getShortUrlsByUserIdCachePrefix(userId), size, offset)
+// getShortUrlsByUserIdCacheKey normalises the filter first so that requests which return the same list share a key.
+// The filter values are escaped so that a tag name can't run into the next part of the key
+func getShortUrlsByUserIdCacheKey(userId uuid.UUID, filter types.ShortUrlFilter, page types.ShortUrlPage) string {
+	status := filter.Status
+	if status == "" {
+		status = types.ShortUrlStatusActive
+	}
+	sort := filter.Sort
+	if sort == "" {
+		sort = types.ShortUrlSortCreatedAt
+	}
+	order := "desc"
+	if filter.Ascending {
+		order = "asc"
+	}
+
+	after := ""
+	if page.After != nil {
+		after = url.QueryEscape(page.After.Value) + ":" + page.After.Id.String()
+	}
+
+	return fmt.Sprintf("%s:size::%d:offset::%d:after::%s:total::%t:tag::%s:q::%s:status::%s:created_after::%s:created_before::%s:sort::%s:order::%s",
+		getShortUrlsByUserIdCachePrefix(userId), page.Size, page.Offset, after, page.WithTotal,
+		url.QueryEscape(strings.ToLower(filter.Tag)), url.QueryEscape(strings.ToLower(filter.Search)), status,
+		cacheKeyTime(filter.CreatedAfter), cacheKeyTime(filter.CreatedBefore), sort, order)
+}
+
+func cacheKeyTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return strconv.FormatInt(t.UnixNano(), 10)
 }
 
 func getShortUrlByIdCachePrefix(id uuid.UUID) string {
@@ -0,0 +1,97 @@
+package events
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"github.com/amieldelatorre/shurl/internal/types"
+)
+
+// Once the queue is this full it is reported as being under backpressure
+const BackpressureThreshold = 0.8
+
+// ClickEventQueue is a bounded buffer between the redirect path and the click event worker.
+// Enqueue never blocks, when the queue is full the event is dropped and counted instead.
+type ClickEventQueue struct {
+	events        chan types.ClickEvent
+	drained       chan struct{}
+	mu            sync.RWMutex
+	closed        bool
+	dropped       atomic.Uint64
+	workerRunning atomic.Bool
+}
+
+func NewClickEventQueue(capacity int) *ClickEventQueue {
+	return &ClickEventQueue{
+		events:  make(chan types.ClickEvent, capacity),
+		drained: make(chan struct{}),
+	}
+}
+
+// Enqueue returns false if the event was dropped because the queue is full or closed
+func (q *ClickEventQueue) Enqueue(event types.ClickEvent) bool {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+
+	if q.closed {
+		q.dropped.Add(1)
+		return false
+	}
+
+	select {
+	case q.events <- event:
+		return true
+	default:
+		q.dropped.Add(1)
+		return false
+	}
+}
+
+// Events is closed after Close is called, once the remaining events have been received
+func (q *ClickEventQueue) Events() <-chan types.ClickEvent {
+	return q.events
+}
+
+func (q *ClickEventQueue) Close() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.closed {
+		return
+	}
+	q.closed = true
+	close(q.events)
+}
+
+// MarkDrained is called by the worker once every event left in the queue has been flushed
+func (q *ClickEventQueue) MarkDrained() {
+	close(q.drained)
+}
+
+func (q *ClickEventQueue) Drained() <-chan struct{} {
+	return q.drained
+}
+
+func (q *ClickEventQueue) SetWorkerRunning(running bool) {
+	q.workerRunning.Store(running)
+}
+
+func (q *ClickEventQueue) WorkerRunning() bool {
+	return q.workerRunning.Load()
+}
+
+func (q *ClickEventQueue) Len() int {
+	return len(q.events)
+}
+
+func (q *ClickEventQueue) Cap() int {
+	return cap(q.events)
+}
+
+func (q *ClickEventQueue) Dropped() uint64 {
+	return q.dropped.Load()
+}
+
+func (q *ClickEventQueue) UnderBackpressure() bool {
+	return float64(q.Len()) >= float64(q.Cap())*BackpressureThreshold
+}
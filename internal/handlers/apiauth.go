@@ -57,6 +57,8 @@ type LoginResponse struct {
 
 type JwtClaims struct {
 	jwt.RegisteredClaims
+	// only on unlock tokens, ties the token to the password the short url had when it was unlocked
+	PasswordFingerprint string `json:"pwf,omitempty"`
 }
 
 func (h *ApiAuthHandler) Login(w http.ResponseWriter, r *http.Request) {
@@ -179,6 +181,20 @@ func (h *ApiAuthHandler) Validate(w http.ResponseWriter, r *http.Request) {
 }
 
 func ValidateAccessToken(token string, publicKey *ecdsa.PublicKey) (*JwtClaims, bool, error) {
+	claims, ok, err := validateToken(token, publicKey)
+	if err != nil || !ok {
+		return nil, ok, err
+	}
+
+	// Access tokens never have an audience, this stops other tokens signed with the same key (like unlock tokens) being used to log in
+	if len(claims.Audience) > 0 {
+		return nil, false, nil
+	}
+
+	return claims, true, nil
+}
+
+func validateToken(token string, publicKey *ecdsa.PublicKey, opts ...jwt.ParserOption) (*JwtClaims, bool, error) {
 	claims := &JwtClaims{}
 	parsedToken, err := jwt.ParseWithClaims(token, claims, func(t *jwt.Token) (interface{}, error) {
 		if _, ok := t.Method.(*jwt.SigningMethodECDSA); !ok {
@@ -190,7 +206,7 @@ func ValidateAccessToken(token string, publicKey *ecdsa.PublicKey) (*JwtClaims,
 		}
 
 		return publicKey, nil
-	})
+	}, opts...)
 
 	if err != nil {
 		return nil, false, err
@@ -6,33 +6,39 @@ import (
 
 	"github.com/amieldelatorre/shurl/internal/config"
 	"github.com/amieldelatorre/shurl/internal/db"
+	"github.com/amieldelatorre/shurl/internal/events"
 	"github.com/amieldelatorre/shurl/internal/utils"
 )
 
 var (
 	IdempotencyKeyCleanupWorkerRunning = false
 	ShortUrlCleanupWorkerRunning       = false
+	TrashCleanupWorkerRunning          = false
 )
 
 type ApiHealthHandler struct {
-	Logger utils.CustomJsonLogger
-	Config *config.Config
-	Db     db.DbContext
-	Cache  db.DbContext
+	Logger      utils.CustomJsonLogger
+	Config      *config.Config
+	Db          db.DbContext
+	Cache       db.DbContext
+	ClickEvents *events.ClickEventQueue
 }
 
-func NewApiHealthHandler(logger utils.CustomJsonLogger, config *config.Config, dbContext db.DbContext, cache db.DbContext) ApiHealthHandler {
+func NewApiHealthHandler(logger utils.CustomJsonLogger, config *config.Config, dbContext db.DbContext, cache db.DbContext, clickEvents *events.ClickEventQueue) ApiHealthHandler {
 	return ApiHealthHandler{
-		Logger: logger,
-		Config: config,
-		Db:     dbContext,
-		Cache:  cache,
+		Logger:      logger,
+		Config:      config,
+		Db:          dbContext,
+		Cache:       cache,
+		ClickEvents: clickEvents,
 	}
 }
 
 type HealthCheckResponse struct {
 	IdempotencyKeyCleanupWorker IdempotencyKeyCleanupWorkerHealthCheck `json:"idempotency_key_cleanup_worker"`
 	ShortUrlCleanUpWorker       ShortUrlCleanupWorkerHealthCheck       `json:"short_url_cleanup_worker"`
+	TrashCleanupWorker          TrashCleanupWorkerHealthCheck          `json:"trash_cleanup_worker"`
+	ClickEventWorker            ClickEventWorkerHealthCheck            `json:"click_event_worker"`
 	Database                    DatabaseHealthCheck                    `json:"database"`
 	Cache                       CacheHealthCheck                       `json:"cache"`
 	Errors                      []string                               `json:"errors,omitempty"`
@@ -56,6 +62,18 @@ type ShortUrlCleanupWorkerHealthCheck struct {
 	Running bool `json:"running"`
 }
 
+type TrashCleanupWorkerHealthCheck struct {
+	Running bool `json:"running"`
+}
+
+type ClickEventWorkerHealthCheck struct {
+	Running       bool   `json:"running"`
+	QueueLength   int    `json:"queue_length"`
+	QueueCapacity int    `json:"queue_capacity"`
+	Dropped       uint64 `json:"dropped"`
+	Backpressure  bool   `json:"backpressure"`
+}
+
 func (h *ApiHealthHandler) HealthCheck(w http.ResponseWriter, r *http.Request) {
 	errs := []string{}
 	status := http.StatusOK
@@ -67,6 +85,16 @@ func (h *ApiHealthHandler) HealthCheck(w http.ResponseWriter, r *http.Request) {
 		ShortUrlCleanUpWorker: ShortUrlCleanupWorkerHealthCheck{
 			Running: ShortUrlCleanupWorkerRunning,
 		},
+		TrashCleanupWorker: TrashCleanupWorkerHealthCheck{
+			Running: TrashCleanupWorkerRunning,
+		},
+		ClickEventWorker: ClickEventWorkerHealthCheck{
+			Running:       h.ClickEvents.WorkerRunning(),
+			QueueLength:   h.ClickEvents.Len(),
+			QueueCapacity: h.ClickEvents.Cap(),
+			Dropped:       h.ClickEvents.Dropped(),
+			Backpressure:  h.ClickEvents.UnderBackpressure(),
+		},
 		Database: DatabaseHealthCheck{
 			Ok: true,
 		},
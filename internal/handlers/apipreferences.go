@@ -0,0 +1,198 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/amieldelatorre/shurl/internal/config"
+	"github.com/amieldelatorre/shurl/internal/db"
+	"github.com/amieldelatorre/shurl/internal/types"
+	"github.com/amieldelatorre/shurl/internal/utils"
+	"github.com/go-playground/validator/v10"
+	"github.com/google/uuid"
+)
+
+const (
+	PreferencesTimezoneError    = "`timezone` must be an IANA timezone name like Pacific/Auckland"
+	PreferencesUnknownTagsError = "`default_tag_ids` can only have your own tags"
+)
+
+type ApiPreferencesHandler struct {
+	Logger utils.CustomJsonLogger
+	Config *config.Config
+	Db     db.DbContext
+}
+
+func NewApiPreferencesHandler(logger utils.CustomJsonLogger, config *config.Config, dbContext db.DbContext) ApiPreferencesHandler {
+	return ApiPreferencesHandler{Logger: logger, Config: config, Db: dbContext}
+}
+
+type PatchUserPreferencesRequest struct {
+	DefaultTtl          *uint32 `json:"default_ttl,omitempty"`                                                      // 0 goes back to the server's default
+	DefaultRedirectType *int    `json:"default_redirect_type,omitempty" validate:"omitnil,oneof=0 301 302 307 308"` // 0 goes back to the server's redirect type
+	// replaces all of the default tags, an empty list removes them
+	DefaultTagIds *[]uuid.UUID `json:"default_tag_ids,omitempty" validate:"omitnil,max=20"`
+	Timezone      *string      `json:"timezone,omitempty"`
+}
+
+// UserPreferencesResponse leaves out the defaults that aren't set, the server's own are used for those
+type UserPreferencesResponse struct {
+	DefaultTtl          *int        `json:"default_ttl,omitempty"`
+	DefaultRedirectType *int        `json:"default_redirect_type,omitempty"`
+	DefaultTagIds       []uuid.UUID `json:"default_tag_ids,omitempty"`
+	Timezone            *string     `json:"timezone,omitempty"`
+	UpdatedAt           *time.Time  `json:"updated_at,omitempty"`
+	Errors              []string    `json:"errors,omitempty"`
+}
+
+func newUserPreferencesResponse(prefs types.UserPreferences) UserPreferencesResponse {
+	return UserPreferencesResponse{
+		DefaultTtl:          prefs.DefaultTtl,
+		DefaultRedirectType: prefs.DefaultRedirectType,
+		DefaultTagIds:       prefs.DefaultTagIds,
+		Timezone:            &prefs.Timezone,
+		UpdatedAt:           prefs.UpdatedAt,
+	}
+}
+
+func (h *ApiPreferencesHandler) GetPreferences(w http.ResponseWriter, r *http.Request) {
+	userIdValue := r.Context().Value(UserIdKey)
+	userIdUuid, ok := userIdValue.(uuid.UUID)
+	if !ok {
+		EncodeResponse[types.ErrorResponse](h.Logger, r.Context(), w, http.StatusInternalServerError, types.ErrorResponse{Errors: []string{"Something is wrong with the server. Please try again later"}})
+		h.Logger.Error(r.Context(), "casting uuid from context not ok")
+		return
+	}
+
+	prefs, err := h.Db.GetUserPreferences(r.Context(), userIdUuid)
+	if err != nil {
+		EncodeResponse[types.ErrorResponse](h.Logger, r.Context(), w, http.StatusInternalServerError, types.ErrorResponse{Errors: []string{"Something is wrong with the server. Please try again later"}})
+		h.Logger.Error(r.Context(), err.Error())
+		return
+	}
+
+	EncodeResponse[UserPreferencesResponse](h.Logger, r.Context(), w, http.StatusOK, newUserPreferencesResponse(prefs))
+}
+
+// PatchPreferences only changes the fields that are provided, a user that has never saved any starts from the defaults
+func (h *ApiPreferencesHandler) PatchPreferences(w http.ResponseWriter, r *http.Request) {
+	var req PatchUserPreferencesRequest
+
+	userIdValue := r.Context().Value(UserIdKey)
+	userIdUuid, ok := userIdValue.(uuid.UUID)
+	if !ok {
+		EncodeResponse[types.ErrorResponse](h.Logger, r.Context(), w, http.StatusInternalServerError, types.ErrorResponse{Errors: []string{"Something is wrong with the server. Please try again later"}})
+		h.Logger.Error(r.Context(), "casting uuid from context not ok")
+		return
+	}
+
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		errorCode, message := parseJsonDecodeError(err)
+		EncodeResponse[types.ErrorResponse](h.Logger, r.Context(), w, errorCode, types.ErrorResponse{Errors: []string{message}})
+		if errorCode == http.StatusInternalServerError {
+			h.Logger.Error(r.Context(), "Server error when parsing json body. error: %v", "error", err.Error())
+		}
+		return
+	}
+
+	if req.DefaultTtl == nil && req.DefaultRedirectType == nil && req.DefaultTagIds == nil && req.Timezone == nil {
+		EncodeResponse[types.ErrorResponse](h.Logger, r.Context(), w, http.StatusBadRequest, types.ErrorResponse{Errors: []string{"at least one of `default_ttl`, `default_redirect_type`, `default_tag_ids` or `timezone` must be provided"}})
+		return
+	}
+
+	validate, err := utils.GetValidator()
+	if err != nil {
+		EncodeResponse[types.ErrorResponse](h.Logger, r.Context(), w, http.StatusInternalServerError, types.ErrorResponse{Errors: []string{"Something is wrong with the server. Please try again later"}})
+		h.Logger.Error(r.Context(), err.Error())
+		return
+	}
+	var validationError validator.ValidationErrors
+	err = validate.Struct(&req)
+	if err != nil {
+		if errors.As(err, &validationError) {
+			EncodeResponse[UserPreferencesResponse](h.Logger, r.Context(), w, http.StatusBadRequest, UserPreferencesResponse{Errors: EncodeValidationError(validationError)})
+			return
+		}
+		EncodeResponse[types.ErrorResponse](h.Logger, r.Context(), w, http.StatusInternalServerError, types.ErrorResponse{Errors: []string{"Something is wrong with the server. Please try again later"}})
+		h.Logger.Error(r.Context(), err.Error())
+		return
+	}
+
+	var update types.UpdateUserPreferences
+	if req.DefaultTtl != nil {
+		maxTtl := uint32(h.Config.ShortUrlTtl.AuthenticatedMaxSeconds)
+		switch {
+		case *req.DefaultTtl == 0:
+			update.RemoveDefaultTtl = true
+		case *req.DefaultTtl < 900:
+			EncodeResponse[types.ErrorResponse](h.Logger, r.Context(), w, http.StatusBadRequest, types.ErrorResponse{Errors: []string{"`default_ttl` must be at least 900 seconds"}})
+			return
+		case *req.DefaultTtl > maxTtl:
+			EncodeResponse[types.ErrorResponse](h.Logger, r.Context(), w, http.StatusBadRequest, types.ErrorResponse{Errors: []string{fmt.Sprintf("`default_ttl` can only be up to %d seconds", maxTtl)}})
+			return
+		default:
+			defaultTtl := int(*req.DefaultTtl)
+			update.DefaultTtl = &defaultTtl
+		}
+	}
+
+	if req.DefaultRedirectType != nil {
+		if *req.DefaultRedirectType == 0 {
+			update.RemoveDefaultRedirectType = true
+		} else {
+			update.DefaultRedirectType = req.DefaultRedirectType
+		}
+	}
+
+	if req.Timezone != nil {
+		timezone := strings.TrimSpace(*req.Timezone)
+		// an empty name and Local would load the server's timezone instead of a named one
+		location, err := time.LoadLocation(timezone)
+		if err != nil || timezone == "" || timezone == "Local" {
+			EncodeResponse[types.ErrorResponse](h.Logger, r.Context(), w, http.StatusBadRequest, types.ErrorResponse{Errors: []string{PreferencesTimezoneError}})
+			return
+		}
+		timezone = location.String()
+		update.Timezone = &timezone
+	}
+
+	if req.DefaultTagIds != nil {
+		tagIds := []uuid.UUID{}
+		for _, id := range *req.DefaultTagIds {
+			if !slices.Contains(tagIds, id) {
+				tagIds = append(tagIds, id)
+			}
+		}
+
+		if len(tagIds) > 0 {
+			tags, err := h.Db.GetTagsByUserId(r.Context(), userIdUuid)
+			if err != nil {
+				EncodeResponse[types.ErrorResponse](h.Logger, r.Context(), w, http.StatusInternalServerError, types.ErrorResponse{Errors: []string{"Something is wrong with the server. Please try again later"}})
+				h.Logger.Error(r.Context(), err.Error())
+				return
+			}
+			for _, id := range tagIds {
+				if !slices.ContainsFunc(tags, func(t types.Tag) bool { return t.Id == id }) {
+					EncodeResponse[types.ErrorResponse](h.Logger, r.Context(), w, http.StatusBadRequest, types.ErrorResponse{Errors: []string{PreferencesUnknownTagsError}})
+					return
+				}
+			}
+		}
+		update.DefaultTagIds = tagIds
+	}
+
+	prefs, err := h.Db.UpdateUserPreferences(r.Context(), userIdUuid, update)
+	if err != nil {
+		EncodeResponse[types.ErrorResponse](h.Logger, r.Context(), w, http.StatusInternalServerError, types.ErrorResponse{Errors: []string{"Something is wrong with the server. Please try again later"}})
+		h.Logger.Error(r.Context(), err.Error())
+		return
+	}
+
+	EncodeResponse[UserPreferencesResponse](h.Logger, r.Context(), w, http.StatusOK, newUserPreferencesResponse(prefs))
+}
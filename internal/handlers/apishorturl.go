@@ -3,15 +3,19 @@ package handlers
 import (
 	"context"
 	"crypto/rand"
+	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"math/big"
 	"net/http"
+	"net/url"
 	"strconv"
 	"strings"
 	"time"
 
+	"github.com/alexedwards/argon2id"
+	"github.com/amieldelatorre/shurl/internal/config"
 	"github.com/amieldelatorre/shurl/internal/db"
 	"github.com/amieldelatorre/shurl/internal/types"
 	"github.com/amieldelatorre/shurl/internal/utils"
@@ -20,29 +24,100 @@ import (
 )
 
 const (
-	SizeQueryParamError                    = "Invalid page value, must be a number greater than or equal to 1 and less than or equal to 50"
-	DefaultSizeQueryParam                  = "20"
-	PageQueryParamError                    = "Invalid page value, must be a number greater than or equal to 1"
-	DefaultPageQueryParam                  = "1"
-	DefaultAnonymousShortUrlTtl     uint32 = 259200 // 3 days
-	MaxAnonymousShortUrlTtl         uint32 = 604800 // 7 Days
-	DefaultAuthenticatedShortUrlTtl uint32 = 604800 // 7 days
-	MaxAuthenticatedShortUrlTtl
+	SizeQueryParamError                       = "Invalid page value, must be a number greater than or equal to 1 and less than or equal to 50"
+	DefaultSizeQueryParam                     = "20"
+	PageQueryParamError                       = "Invalid page value, must be a number greater than or equal to 1"
+	DefaultPageQueryParam                     = "1"
+	DaysQueryParamError                       = "Invalid days value, must be a number greater than or equal to 1 and less than or equal to 365"
+	DefaultDaysQueryParam                     = "30"
+	SearchQueryParamError                     = "Invalid q value, must be 255 characters or less"
+	StatusQueryParamError                     = "Invalid status value, must be one of active, expired or all"
+	SortQueryParamError                       = "Invalid sort value, must be one of created_at, expires_at, slug or clicks"
+	OrderQueryParamError                      = "Invalid order value, must be asc or desc"
+	CreatedAfterQueryParamError               = "Invalid created_after value, must be an RFC 3339 timestamp"
+	CreatedBeforeQueryParamError              = "Invalid created_before value, must be an RFC 3339 timestamp"
+	CursorQueryParamError                     = "Invalid cursor value, use the next_cursor of a previous response with the same sort and order"
+	CursorWithPageQueryParamError             = "page can't be used together with cursor"
+	TotalQueryParamError                      = "Invalid total value, must be true or false"
+	NeverExpiresWithTtlError                  = "`ttl` can't be used together with `never_expires`"
+	NeverExpiresWithSlidingTtlError           = "`sliding_ttl` can't be used together with `never_expires`"
+	NeverExpiresNotAllowedError               = "short urls that never expire are not allowed"
+	AnonymousTagIdsError                      = "only logged in users can tag short urls"
+	IdempotencyKeyShortUrlDeletedError        = "the short url created with this %s header value has been deleted"
+	MinShortUrlPasswordLength                 = 4        // same as the validator on PostShortUrlRequest.Password
+	MinShortUrlSlidingTtl              uint32 = 900      // same as the validator on PostShortUrlRequest.SlidingTtl
+	MaxShortUrlActivationDelay         uint32 = 31556952 // 1 year
+)
+
+var (
+	// Slugs that would take over the paths of the app's own pages and assets, or read like the unlock route of another short url.
+	// Anything shorter than 4 characters or outside the slug characters can't be asked for, so "api", "_" and "favicon.ico" don't need to be here
+	ReservedSlugs = []string{
+		"assets",
+		"dashboard",
+		"login",
+		"signup",
+		"unlock",
+	}
 )
 
 type ApiShortUrlHandler struct {
 	Logger  utils.CustomJsonLogger
+	Config  *config.Config
 	Db      db.DbContext
 	BaseUrl string
 }
 
-func NewApiShortUrlHandler(logger utils.CustomJsonLogger, dbcontext db.DbContext, baseUrl string) ApiShortUrlHandler {
-	return ApiShortUrlHandler{Logger: logger, Db: dbcontext, BaseUrl: baseUrl}
+func NewApiShortUrlHandler(logger utils.CustomJsonLogger, config *config.Config, dbcontext db.DbContext, baseUrl string) ApiShortUrlHandler {
+	return ApiShortUrlHandler{Logger: logger, Config: config, Db: dbcontext, BaseUrl: baseUrl}
+}
+
+// ttlLimits returns the default and maximum ttl of new short urls, anonymous users have their own
+func (h *ApiShortUrlHandler) ttlLimits(userIdUuid uuid.UUID) (uint32, uint32) {
+	if userIdUuid == uuid.Nil {
+		return uint32(h.Config.ShortUrlTtl.AnonymousDefaultSeconds), uint32(h.Config.ShortUrlTtl.AnonymousMaxSeconds)
+	}
+	return uint32(h.Config.ShortUrlTtl.AuthenticatedDefaultSeconds), uint32(h.Config.ShortUrlTtl.AuthenticatedMaxSeconds)
+}
+
+// maxExpiresAt is the latest expiry an existing short url can be changed to, only logged in users can change short urls
+func (h *ApiShortUrlHandler) maxExpiresAt(now time.Time) time.Time {
+	return now.Add(time.Duration(h.Config.ShortUrlTtl.AuthenticatedMaxSeconds) * time.Second)
 }
 
 type PostShortUrlRequest struct {
-	DestinationUrl string  `json:"destination_url" validate:"required,url"`
-	TTL            *uint32 `json:"ttl" validate:"required,min=900,max=2629746"` // 15 minutes to 1 months
+	DestinationUrl   string     `json:"destination_url" validate:"required,url"`
+	TTL              *uint32    `json:"ttl" validate:"omitnil,min=900"` // at least 15 minutes, the maximum is configured
+	NeverExpires     bool       `json:"never_expires,omitempty"`        // only for logged in users, when the server allows it
+	Slug             *string    `json:"slug,omitempty" validate:"omitempty,min=4,max=64,slugvalidator"`
+	Password         *string    `json:"password,omitempty" validate:"omitempty,min=4,max=128"`
+	MaxClicks        *int       `json:"max_clicks,omitempty" validate:"omitnil,min=1,max=1000000"` // the short url stops working after this many redirects
+	ActivatesAt      *time.Time `json:"activates_at,omitempty"`                                    // the short url doesn't resolve until this time, the ttl starts from here
+	ForcePreview     bool       `json:"force_preview,omitempty"`                                   // visitors always see the preview page before being redirected
+	RedirectType     *int       `json:"redirect_type,omitempty" validate:"omitnil,oneof=301 302 307 308"`
+	QueryPassthrough bool       `json:"query_passthrough,omitempty"` // query parameters on the short url are added to the destination
+	PathPassthrough  bool       `json:"path_passthrough,omitempty"`  // anything after the slug is appended to the destination path
+	// added to the destination's query at redirect time
+	UtmSource   *string `json:"utm_source,omitempty" validate:"omitnil,max=255"`
+	UtmMedium   *string `json:"utm_medium,omitempty" validate:"omitnil,max=255"`
+	UtmCampaign *string `json:"utm_campaign,omitempty" validate:"omitnil,max=255"`
+	// checked in order when someone is redirected, the first match is used instead of destination_url
+	RoutingRules []RoutingRuleRequest `json:"routing_rules,omitempty" validate:"omitempty,max=20,dive"`
+	// traffic that no routing rule matched is split between these by weight, sticky variants keep a visitor on the same one
+	Variants       []ShortUrlVariantRequest `json:"variants,omitempty" validate:"omitempty,max=10,dive"`
+	StickyVariants bool                     `json:"sticky_variants,omitempty"`
+	// every redirect pushes the expiry out to at least this many seconds from the redirect, so a link that keeps being used doesn't expire
+	SlidingTtl *uint32 `json:"sliding_ttl,omitempty" validate:"omitnil,min=900"`
+	// replaces the default tags from the user's preferences, an empty list creates the short url without tags. Tags that don't exist are skipped
+	TagIds *[]uuid.UUID `json:"tag_ids,omitempty" validate:"omitnil,max=20"`
+}
+
+// userPreferences returns the defaults for anonymous users without going to the database
+func (h *ApiShortUrlHandler) userPreferences(ctx context.Context, userIdUuid uuid.UUID) (types.UserPreferences, error) {
+	if userIdUuid == uuid.Nil {
+		return types.UserPreferences{DefaultTagIds: []uuid.UUID{}, Timezone: types.DefaultTimezone}, nil
+	}
+	return h.Db.GetUserPreferences(ctx, userIdUuid)
 }
 
 func (h *ApiShortUrlHandler) PostShortUrl(w http.ResponseWriter, r *http.Request) {
@@ -73,123 +148,282 @@ func (h *ApiShortUrlHandler) PostShortUrl(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	if req.TTL != nil {
-		// anonymous users can only have a maximum of 7 days
-		if userIdUuid == uuid.Nil && *req.TTL > MaxAnonymousShortUrlTtl {
-			EncodeResponse[types.ErrorResponse](h.Logger, r.Context(), w, http.StatusBadRequest, types.ErrorResponse{Errors: []string{fmt.Sprintf("anonymous short urls can only be up to %d seconds", MaxAnonymousShortUrlTtl)}})
+	prefs, err := h.userPreferences(r.Context(), userIdUuid)
+	if err != nil {
+		EncodeResponse[types.ErrorResponse](h.Logger, r.Context(), w, http.StatusInternalServerError, types.ErrorResponse{Errors: []string{"Something is wrong with the server. Please try again later"}})
+		h.Logger.Error(r.Context(), err.Error())
+		return
+	}
+
+	newShortUrl, requestedSlug, statusCode, errs := h.prepareCreateShortUrl(r.Context(), userIdUuid, prefs, &req, false)
+	if statusCode != 0 {
+		EncodeResponse[types.ErrorResponse](h.Logger, r.Context(), w, statusCode, types.ErrorResponse{Errors: errs})
+		return
+	}
+	if requestedSlug == "" {
+		slugs, err := h.generateUniqueSlugs(r.Context(), 1, nil)
+		if err != nil {
+			EncodeResponse[types.ErrorResponse](h.Logger, r.Context(), w, http.StatusInternalServerError, types.ErrorResponse{Errors: []string{"Something is wrong with the server. Please try again later"}})
+			h.Logger.Error(r.Context(), err.Error())
 			return
 		}
-	} else {
-		var ttl uint32
-		if userIdUuid == uuid.Nil {
-			ttl = DefaultAnonymousShortUrlTtl
-		} else {
-			ttl = DefaultAuthenticatedShortUrlTtl
-		}
-		req.TTL = &ttl
+		newShortUrl.Slug = slugs[0]
 	}
 
-	req.DestinationUrl = strings.TrimSpace(req.DestinationUrl)
-	validate, err := utils.GetValidator()
+	requestHash := db.HashCreateShortUrlRequest(requestedSlug, newShortUrl)
+	applyUserPreferences(&newShortUrl, prefs, &req)
+	shortUrl, err := h.Db.CreateShortUrl(r.Context(), newShortUrl, idempotencyKey, requestHash)
 	if err != nil {
+		var idempotencyKeyUsedError *types.DuplicateIdempotencyKeyError
+		if errors.As(err, &idempotencyKeyUsedError) {
+			EncodeResponse[types.ErrorResponse](h.Logger, r.Context(), w, http.StatusBadRequest, types.ErrorResponse{Errors: []string{fmt.Sprintf("%s header value has already been used", types.HeadersIdempotencyKey)}})
+			h.Logger.Error(r.Context(), err.Error())
+			return
+		}
+
+		var slugExistsError *types.SlugExistsError
+		if errors.As(err, &slugExistsError) {
+			EncodeResponse[types.ErrorResponse](h.Logger, r.Context(), w, http.StatusConflict, types.ErrorResponse{Errors: []string{fmt.Sprintf("slug '%s' is already taken", newShortUrl.Slug)}})
+			return
+		}
+
 		EncodeResponse[types.ErrorResponse](h.Logger, r.Context(), w, http.StatusInternalServerError, types.ErrorResponse{Errors: []string{"Something is wrong with the server. Please try again later"}})
 		h.Logger.Error(r.Context(), err.Error())
 		return
 	}
+
+	// a replayed request whose short url has been moved to the trash since
+	if shortUrl == nil {
+		EncodeResponse[types.ErrorResponse](h.Logger, r.Context(), w, http.StatusConflict, types.ErrorResponse{Errors: []string{fmt.Sprintf(IdempotencyKeyShortUrlDeletedError, types.HeadersIdempotencyKey)}})
+		return
+	}
+
+	response := newShortUrlResponse(shortUrl, h.BaseUrl)
+	EncodeResponse[types.ShortUrlResponse](h.Logger, r.Context(), w, http.StatusCreated, response)
+	h.Logger.Debug(r.Context(), "PostShortUrl created short url with id '%s'", "shortUrlId", shortUrl.Id, "responseStatusCode", 201)
+}
+
+// applyUserPreferences fills in the redirect type and tags that req left out from the user's preferences
+func applyUserPreferences(newShortUrl *types.CreateShortUrl, prefs types.UserPreferences, req *PostShortUrlRequest) {
+	if newShortUrl.RedirectType == nil {
+		newShortUrl.RedirectType = prefs.DefaultRedirectType
+	}
+	if req.TagIds == nil {
+		newShortUrl.TagIds = prefs.DefaultTagIds
+	}
+}
+
+// prepareCreateShortUrl normalises and validates req and builds the short url to create, along with the slug the caller asked for.
+// Only the expiry is taken from the user's preferences, the other defaults are filled in by applyUserPreferences once the
+// request has been hashed so that changing a preference doesn't change the hash. When no slug was asked for the slug is left empty,
+// the caller generates it with generateUniqueSlugs so that a batch can check all of its slugs at once.
+// A dry run doesn't hash the password, nothing is stored so the hash would only be thrown away.
+// When req can't be created it returns the status code and errors to respond with, server errors have already been logged.
+func (h *ApiShortUrlHandler) prepareCreateShortUrl(ctx context.Context, userIdUuid uuid.UUID, prefs types.UserPreferences, req *PostShortUrlRequest, dryRun bool) (types.CreateShortUrl, string, int, []string) {
+	defaultTtl, maxTtl := h.ttlLimits(userIdUuid)
+	// the server's limit may have been lowered since the preference was saved
+	if prefs.DefaultTtl != nil {
+		defaultTtl = min(uint32(*prefs.DefaultTtl), maxTtl)
+	}
+	kind := "short urls"
+	if userIdUuid == uuid.Nil {
+		kind = "anonymous short urls"
+		if req.TagIds != nil {
+			return types.CreateShortUrl{}, "", http.StatusBadRequest, []string{AnonymousTagIdsError}
+		}
+	}
+	if req.NeverExpires {
+		if req.TTL != nil {
+			return types.CreateShortUrl{}, "", http.StatusBadRequest, []string{NeverExpiresWithTtlError}
+		}
+		if req.SlidingTtl != nil {
+			return types.CreateShortUrl{}, "", http.StatusBadRequest, []string{NeverExpiresWithSlidingTtlError}
+		}
+		if userIdUuid == uuid.Nil || !h.Config.ShortUrlTtl.AllowNonExpiring {
+			return types.CreateShortUrl{}, "", http.StatusBadRequest, []string{NeverExpiresNotAllowedError}
+		}
+	} else if req.TTL != nil {
+		if *req.TTL > maxTtl {
+			return types.CreateShortUrl{}, "", http.StatusBadRequest, []string{fmt.Sprintf("%s can only be up to %d seconds", kind, maxTtl)}
+		}
+	} else {
+		req.TTL = &defaultTtl
+	}
+	if req.SlidingTtl != nil && *req.SlidingTtl > maxTtl {
+		return types.CreateShortUrl{}, "", http.StatusBadRequest, []string{fmt.Sprintf("%s can only slide up to %d seconds", kind, maxTtl)}
+	}
+
+	req.DestinationUrl = strings.TrimSpace(req.DestinationUrl)
+	if req.Slug != nil {
+		trimmedSlug := strings.TrimSpace(*req.Slug)
+		req.Slug = &trimmedSlug
+
+		if IsReservedSlug(trimmedSlug) {
+			return types.CreateShortUrl{}, "", http.StatusBadRequest, []string{fmt.Sprintf("slug '%s' is reserved", trimmedSlug)}
+		}
+	}
+	// an empty utm parameter is the same as not having one
+	req.UtmSource = trimUtmParam(req.UtmSource, true)
+	req.UtmMedium = trimUtmParam(req.UtmMedium, true)
+	req.UtmCampaign = trimUtmParam(req.UtmCampaign, true)
+	normalizeRoutingRules(req.RoutingRules)
+	trimShortUrlVariants(req.Variants)
+
+	validate, err := utils.GetValidator()
+	if err != nil {
+		h.Logger.Error(ctx, err.Error())
+		return types.CreateShortUrl{}, "", http.StatusInternalServerError, []string{"Something is wrong with the server. Please try again later"}
+	}
 	var validationError validator.ValidationErrors
-	err = validate.Struct(&req)
+	err = validate.Struct(req)
 	if err != nil {
 		if errors.As(err, &validationError) {
-			EncodeResponse[types.ShortUrlResponse](h.Logger, r.Context(), w, http.StatusBadRequest, types.ShortUrlResponse{Errors: EncodeValidationError(validationError)})
-			return
+			return types.CreateShortUrl{}, "", http.StatusBadRequest, EncodeValidationError(validationError)
 		}
-		EncodeResponse[types.ErrorResponse](h.Logger, r.Context(), w, http.StatusInternalServerError, types.ErrorResponse{Errors: []string{"Something is wrong with the server. Please try again later"}})
-		h.Logger.Error(r.Context(), err.Error())
-		return
+		h.Logger.Error(ctx, err.Error())
+		return types.CreateShortUrl{}, "", http.StatusInternalServerError, []string{"Something is wrong with the server. Please try again later"}
 	}
-	// if req.DestinationUrl == "" {
-	// 	EncodeResponse[types.ErrorResponse](h.Logger, r.Context(), w, http.StatusBadRequest, types.ErrorResponse{Errors: []string{"`destination_url` cannot be null or empty"}})
-	// 	return
-	// }
 
-	id, err := uuid.NewV7()
+	routingRules, errs := newRoutingRules(req.RoutingRules)
+	if len(errs) > 0 {
+		return types.CreateShortUrl{}, "", http.StatusBadRequest, errs
+	}
+
+	if len(req.Variants) == 1 {
+		return types.CreateShortUrl{}, "", http.StatusBadRequest, []string{TooFewVariantsError}
+	}
+	variants, err := newShortUrlVariants(req.Variants)
 	if err != nil {
-		EncodeResponse[types.ErrorResponse](h.Logger, r.Context(), w, http.StatusInternalServerError, types.ErrorResponse{Errors: []string{"Something is wrong with the server. Please try again later"}})
-		h.Logger.Error(r.Context(), err.Error())
-		return
+		h.Logger.Error(ctx, err.Error())
+		return types.CreateShortUrl{}, "", http.StatusInternalServerError, []string{"Something is wrong with the server. Please try again later"}
 	}
 
-	slug, err := h.generateUniqueSlug(r.Context())
+	// an activation time in the past is the same as not having one
+	activeFrom := time.Now()
+	if req.ActivatesAt != nil {
+		if req.ActivatesAt.After(activeFrom.Add(time.Duration(MaxShortUrlActivationDelay) * time.Second)) {
+			return types.CreateShortUrl{}, "", http.StatusBadRequest, []string{fmt.Sprintf("`activates_at` can only be up to %d seconds from now", MaxShortUrlActivationDelay)}
+		}
+
+		if req.ActivatesAt.After(activeFrom) {
+			activeFrom = *req.ActivatesAt
+		} else {
+			req.ActivatesAt = nil
+		}
+	}
+
+	id, err := uuid.NewV7()
 	if err != nil {
-		EncodeResponse[types.ErrorResponse](h.Logger, r.Context(), w, http.StatusInternalServerError, types.ErrorResponse{Errors: []string{"Something is wrong with the server. Please try again later"}})
-		h.Logger.Error(r.Context(), err.Error())
-		return
+		h.Logger.Error(ctx, err.Error())
+		return types.CreateShortUrl{}, "", http.StatusInternalServerError, []string{"Something is wrong with the server. Please try again later"}
+	}
+
+	// the requested slug is kept separately so that the request hash reflects what the caller asked for
+	var requestedSlug string
+	if req.Slug != nil {
+		requestedSlug = *req.Slug
 	}
 
 	newShortUrl := types.CreateShortUrl{
-		Id:             id,
-		DestinationUrl: req.DestinationUrl,
-		Slug:           slug,
-		ExpiresAt:      time.Now().Add(time.Duration(*req.TTL) * time.Second),
+		Id:               id,
+		DestinationUrl:   req.DestinationUrl,
+		Slug:             requestedSlug,
+		ExpiresAt:        types.NeverExpires,
+		MaxClicks:        req.MaxClicks,
+		ActivatesAt:      req.ActivatesAt,
+		ForcePreview:     req.ForcePreview,
+		RedirectType:     req.RedirectType,
+		QueryPassthrough: req.QueryPassthrough,
+		PathPassthrough:  req.PathPassthrough,
+		UtmSource:        req.UtmSource,
+		UtmMedium:        req.UtmMedium,
+		UtmCampaign:      req.UtmCampaign,
+		RoutingRules:     routingRules,
+		Variants:         variants,
+		StickyVariants:   req.StickyVariants,
 	}
 	if userIdUuid != uuid.Nil {
 		newShortUrl.UserId = &userIdUuid
 	}
-
-	requestHash := db.HashCreateShortUrlRequest(req.DestinationUrl)
-	shortUrl, err := h.Db.CreateShortUrl(r.Context(), newShortUrl, idempotencyKey, requestHash)
-	if err != nil {
-		var idempotencyKeyUsedError *types.DuplicateIdempotencyKeyError
-		if errors.As(err, &idempotencyKeyUsedError) {
-			EncodeResponse[types.ErrorResponse](h.Logger, r.Context(), w, http.StatusBadRequest, types.ErrorResponse{Errors: []string{fmt.Sprintf("%s header value has already been used", types.HeadersIdempotencyKey)}})
-			h.Logger.Error(r.Context(), err.Error())
-			return
-		}
-
-		EncodeResponse[types.ErrorResponse](h.Logger, r.Context(), w, http.StatusInternalServerError, types.ErrorResponse{Errors: []string{"Something is wrong with the server. Please try again later"}})
-		h.Logger.Error(r.Context(), err.Error())
-		return
+	if !req.NeverExpires {
+		newShortUrl.ExpiresAt = activeFrom.Add(time.Duration(*req.TTL) * time.Second)
+	}
+	if req.SlidingTtl != nil {
+		slidingTtl := int(*req.SlidingTtl)
+		newShortUrl.SlidingTtl = &slidingTtl
+	}
+	if req.TagIds != nil {
+		newShortUrl.TagIds = *req.TagIds
 	}
 
-	response := types.ShortUrlResponse{
-		Id:             &shortUrl.Id,
-		DestinationUrl: &shortUrl.DestinationUrl,
-		Slug:           &shortUrl.Slug,
-		CreatedAt:      &shortUrl.CreatedAt,
-		ExpiresAt:      &shortUrl.ExpiresAt,
-		Url:            createShortUrl(h.BaseUrl, shortUrl.Slug),
-		UserId:         shortUrl.UserId,
+	if req.Password != nil && *req.Password != "" && !dryRun {
+		passwordHash, err := argon2id.CreateHash(*req.Password, argon2idParams)
+		if err != nil {
+			h.Logger.Error(ctx, err.Error())
+			return types.CreateShortUrl{}, "", http.StatusInternalServerError, []string{"Something is wrong with the server. Please try again later"}
+		}
+		newShortUrl.PasswordHash = &passwordHash
 	}
 
-	EncodeResponse[types.ShortUrlResponse](h.Logger, r.Context(), w, http.StatusCreated, response)
-	h.Logger.Debug(r.Context(), "PostShortUrl created short url with id '%s'", "shortUrlId", shortUrl.Id, "responseStatusCode", 201)
+	return newShortUrl, requestedSlug, 0, nil
 }
 
-func (h *ApiShortUrlHandler) generateUniqueSlug(ctx context.Context) (string, error) {
+// generateUniqueSlugs returns n new slugs that aren't taken and aren't in reserved, checking each round of them with a single query.
+// It checks the taken slugs instead of looking the slugs up, a short url in the trash doesn't resolve but still holds on to its slug
+func (h *ApiShortUrlHandler) generateUniqueSlugs(ctx context.Context, n int, reserved map[string]bool) ([]string, error) {
+	slugs := make([]string, 0, n)
+	picked := map[string]bool{}
 	maxAttempts := 3
-	for attempt := 0; attempt < maxAttempts; attempt++ {
-		slug, err := GenerateSlug()
-		if err != nil {
-			return "", err
+	for attempt := 0; attempt < maxAttempts && len(slugs) < n; attempt++ {
+		candidates := make([]string, 0, n-len(slugs))
+		for len(candidates) < cap(candidates) {
+			slug, err := GenerateSlug()
+			if err != nil {
+				return nil, err
+			}
+			if picked[slug] || reserved[slug] || IsReservedSlug(slug) {
+				continue
+			}
+			picked[slug] = true
+			candidates = append(candidates, slug)
 		}
-		existingShortUrl, err := h.Db.GetShortUrlBySlug(ctx, slug, false)
+
+		taken, err := h.Db.GetTakenSlugs(ctx, candidates)
 		if err != nil {
-			return "", err
+			return nil, err
+		}
+		takenSlugs := map[string]bool{}
+		for _, slug := range taken {
+			takenSlugs[slug] = true
 		}
-		if existingShortUrl == nil {
-			return slug, nil
+		for _, slug := range candidates {
+			if !takenSlugs[slug] {
+				slugs = append(slugs, slug)
+			}
 		}
 	}
-	return "", errors.New("couldn't generate a unique slug")
+	if len(slugs) < n {
+		return nil, errors.New("couldn't generate unique slugs")
+	}
+	return slugs, nil
 }
 
 type GetShortUrlsByUserIdResponse struct {
-	Items  []types.ShortUrlResponse `json:"items"`
-	Total  *int                     `json:"total,omitempty"`
-	Next   *bool                    `json:"next,omitempty"`
-	Page   *int                     `json:"page,omitempty"`
-	Size   *int                     `json:"size,omitempty"`
-	Errors []string                 `json:"errors,omitempty"`
+	Items      []types.ShortUrlResponse `json:"items"`
+	Total      *int                     `json:"total,omitempty"`
+	Next       *bool                    `json:"next,omitempty"`
+	NextCursor *string                  `json:"next_cursor,omitempty"`
+	Page       *int                     `json:"page,omitempty"`
+	Size       *int                     `json:"size,omitempty"`
+	Errors     []string                 `json:"errors,omitempty"`
+}
+
+// shortUrlListCursor is what the opaque cursor decodes to, the sort and order are kept so a cursor can't be used with a different ordering
+type shortUrlListCursor struct {
+	Sort      string    `json:"s"`
+	Ascending bool      `json:"a"`
+	Value     string    `json:"v"`
+	Id        uuid.UUID `json:"i"`
 }
 
 func (h *ApiShortUrlHandler) GetShortUrls(w http.ResponseWriter, r *http.Request) {
@@ -203,7 +437,12 @@ func (h *ApiShortUrlHandler) GetShortUrls(w http.ResponseWriter, r *http.Request
 
 	params := r.URL.Query()
 
+	cursorStr := strings.TrimSpace(params.Get("cursor"))
 	pageStr := strings.TrimSpace(params.Get("page"))
+	if cursorStr != "" && pageStr != "" {
+		EncodeResponse[GetShortUrlsByUserIdResponse](h.Logger, r.Context(), w, http.StatusBadRequest, GetShortUrlsByUserIdResponse{Errors: []string{CursorWithPageQueryParamError}})
+		return
+	}
 	if pageStr == "" {
 		pageStr = DefaultPageQueryParam
 	}
@@ -223,20 +462,137 @@ func (h *ApiShortUrlHandler) GetShortUrls(w http.ResponseWriter, r *http.Request
 		return
 	}
 
+	filter, errMessage := parseShortUrlFilter(params)
+	if errMessage != "" {
+		EncodeResponse[GetShortUrlsByUserIdResponse](h.Logger, r.Context(), w, http.StatusBadRequest, GetShortUrlsByUserIdResponse{Errors: []string{errMessage}})
+		return
+	}
+
 	// Subtract 1 from offset because this actually does 0 indexing
 	// For a users persective a page 0 doesn't really exist, page 1 is where they expect to see the first items
-	offset := (page - 1) * size
-	shortUrls, err := h.Db.GetShortUrlsByUserId(r.Context(), userIdUuid, size, offset)
+	listPage := types.ShortUrlPage{Size: size, Offset: (page - 1) * size, WithTotal: cursorStr == ""}
+	if cursorStr != "" {
+		listPage.After = decodeShortUrlCursor(cursorStr, filter)
+		if listPage.After == nil {
+			EncodeResponse[GetShortUrlsByUserIdResponse](h.Logger, r.Context(), w, http.StatusBadRequest, GetShortUrlsByUserIdResponse{Errors: []string{CursorQueryParamError}})
+			return
+		}
+	}
+
+	// The total stays on by default for page based requests so existing clients keep working
+	switch strings.ToLower(strings.TrimSpace(params.Get("total"))) {
+	case "":
+	case "true":
+		listPage.WithTotal = true
+	case "false":
+		listPage.WithTotal = false
+	default:
+		EncodeResponse[GetShortUrlsByUserIdResponse](h.Logger, r.Context(), w, http.StatusBadRequest, GetShortUrlsByUserIdResponse{Errors: []string{TotalQueryParamError}})
+		return
+	}
+
+	shortUrls, err := h.Db.GetShortUrlsByUserId(r.Context(), userIdUuid, filter, listPage)
 	if err != nil {
 		EncodeResponse[types.ErrorResponse](h.Logger, r.Context(), w, http.StatusInternalServerError, types.ErrorResponse{Errors: []string{"Something is wrong with the server. Please try again later"}})
 		h.Logger.Error(r.Context(), err.Error())
 		return
 	}
 
-	resp := shortUrlToResponse(shortUrls, h.BaseUrl, page, size)
+	var respPage *int
+	if listPage.After == nil {
+		respPage = &page
+	}
+	resp := shortUrlToResponse(shortUrls, h.BaseUrl, filter, respPage, size)
 	EncodeResponse[GetShortUrlsByUserIdResponse](h.Logger, r.Context(), w, http.StatusOK, resp)
 }
 
+func encodeShortUrlCursor(filter types.ShortUrlFilter, cursor types.ShortUrlCursor) string {
+	// Marshalling only fails for unsupported types, shortUrlListCursor has none
+	b, _ := json.Marshal(shortUrlListCursor{Sort: filter.Sort, Ascending: filter.Ascending, Value: cursor.Value, Id: cursor.Id})
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// decodeShortUrlCursor returns nil when the cursor is malformed or was made for a different sort or order
+func decodeShortUrlCursor(cursorStr string, filter types.ShortUrlFilter) *types.ShortUrlCursor {
+	b, err := base64.RawURLEncoding.DecodeString(cursorStr)
+	if err != nil {
+		return nil
+	}
+	var c shortUrlListCursor
+	if err = json.Unmarshal(b, &c); err != nil {
+		return nil
+	}
+	if c.Sort != filter.Sort || c.Ascending != filter.Ascending || c.Sort == types.ShortUrlSortClicks {
+		return nil
+	}
+	if c.Sort != types.ShortUrlSortSlug {
+		if _, err = time.Parse(time.RFC3339Nano, c.Value); err != nil {
+			return nil
+		}
+	}
+	return &types.ShortUrlCursor{Value: c.Value, Id: c.Id}
+}
+
+// parseShortUrlFilter returns the filter with every value normalised, or the error message for the first invalid query parameter
+func parseShortUrlFilter(params url.Values) (types.ShortUrlFilter, string) {
+	filter := types.ShortUrlFilter{
+		Tag:    strings.TrimSpace(params.Get("tag")),
+		Search: strings.TrimSpace(params.Get("q")),
+		Status: strings.ToLower(strings.TrimSpace(params.Get("status"))),
+		Sort:   strings.ToLower(strings.TrimSpace(params.Get("sort"))),
+	}
+
+	if len(filter.Search) > 255 {
+		return filter, SearchQueryParamError
+	}
+
+	switch filter.Status {
+	case "":
+		filter.Status = types.ShortUrlStatusActive
+	case types.ShortUrlStatusActive, types.ShortUrlStatusExpired, types.ShortUrlStatusAll:
+	default:
+		return filter, StatusQueryParamError
+	}
+
+	switch filter.Sort {
+	case "":
+		filter.Sort = types.ShortUrlSortCreatedAt
+	case types.ShortUrlSortCreatedAt, types.ShortUrlSortExpiresAt, types.ShortUrlSortSlug, types.ShortUrlSortClicks:
+	default:
+		return filter, SortQueryParamError
+	}
+
+	// Slugs read best alphabetically, everything else newest or biggest first
+	switch strings.ToLower(strings.TrimSpace(params.Get("order"))) {
+	case "":
+		filter.Ascending = filter.Sort == types.ShortUrlSortSlug
+	case "asc":
+		filter.Ascending = true
+	case "desc":
+		filter.Ascending = false
+	default:
+		return filter, OrderQueryParamError
+	}
+
+	if createdAfterStr := strings.TrimSpace(params.Get("created_after")); createdAfterStr != "" {
+		createdAfter, err := time.Parse(time.RFC3339, createdAfterStr)
+		if err != nil {
+			return filter, CreatedAfterQueryParamError
+		}
+		createdAfter = createdAfter.UTC()
+		filter.CreatedAfter = &createdAfter
+	}
+	if createdBeforeStr := strings.TrimSpace(params.Get("created_before")); createdBeforeStr != "" {
+		createdBefore, err := time.Parse(time.RFC3339, createdBeforeStr)
+		if err != nil {
+			return filter, CreatedBeforeQueryParamError
+		}
+		createdBefore = createdBefore.UTC()
+		filter.CreatedBefore = &createdBefore
+	}
+	return filter, ""
+}
+
 func (h *ApiShortUrlHandler) DeleteById(w http.ResponseWriter, r *http.Request) {
 	userIdValue := r.Context().Value(UserIdKey)
 	userIdUuid, ok := userIdValue.(uuid.UUID)
@@ -273,40 +629,363 @@ func (h *ApiShortUrlHandler) DeleteById(w http.ResponseWriter, r *http.Request)
 	h.Logger.Error(r.Context(), "reached end of short url delete by id. this should not happen")
 }
 
-func shortUrlToResponse(shortUrls types.GetShortUrlsResult, baseUrl string, page int, size int) GetShortUrlsByUserIdResponse {
+type PatchShortUrlRequest struct {
+	DestinationUrl   *string    `json:"destination_url,omitempty" validate:"omitnil,url"`
+	ExpiresAt        *time.Time `json:"expires_at,omitempty"`
+	Password         *string    `json:"password,omitempty" validate:"omitnil,max=128"` // an empty string removes the password
+	ForcePreview     *bool      `json:"force_preview,omitempty"`
+	RedirectType     *int       `json:"redirect_type,omitempty" validate:"omitnil,oneof=301 302 307 308"`
+	QueryPassthrough *bool      `json:"query_passthrough,omitempty"`
+	PathPassthrough  *bool      `json:"path_passthrough,omitempty"`
+	// an empty string removes the parameter
+	UtmSource   *string `json:"utm_source,omitempty" validate:"omitnil,max=255"`
+	UtmMedium   *string `json:"utm_medium,omitempty" validate:"omitnil,max=255"`
+	UtmCampaign *string `json:"utm_campaign,omitempty" validate:"omitnil,max=255"`
+	// replaces all of the existing rules, an empty list removes them
+	RoutingRules *[]RoutingRuleRequest `json:"routing_rules,omitempty" validate:"omitnil,max=20,dive"`
+	// replaces all of the existing variants and resets their hits, an empty list removes them
+	Variants       *[]ShortUrlVariantRequest `json:"variants,omitempty" validate:"omitnil,max=10,dive"`
+	StickyVariants *bool                     `json:"sticky_variants,omitempty"`
+	// 0 turns sliding expiry off
+	SlidingTtl *uint32 `json:"sliding_ttl,omitempty"`
+}
+
+func (h *ApiShortUrlHandler) PatchById(w http.ResponseWriter, r *http.Request) {
+	var req PatchShortUrlRequest
+
+	userIdValue := r.Context().Value(UserIdKey)
+	userIdUuid, ok := userIdValue.(uuid.UUID)
+	if !ok {
+		EncodeResponse[types.ErrorResponse](h.Logger, r.Context(), w, http.StatusInternalServerError, types.ErrorResponse{Errors: []string{"Something is wrong with the server. Please try again later"}})
+		h.Logger.Error(r.Context(), "casting uuid from context not ok")
+		return
+	}
+
+	shortUrlIdStr := strings.TrimSpace(r.PathValue("shortUrlId"))
+	shortUrlid, err := uuid.Parse(shortUrlIdStr)
+	if err != nil {
+		EncodeResponse[types.ErrorResponse](h.Logger, r.Context(), w, http.StatusBadRequest, types.ErrorResponse{Errors: []string{"Short url id provided is not a valid uuid"}})
+		return
+	}
+
+	err = json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		errorCode, message := parseJsonDecodeError(err)
+		EncodeResponse[types.ErrorResponse](h.Logger, r.Context(), w, errorCode, types.ErrorResponse{Errors: []string{message}})
+		if errorCode == http.StatusInternalServerError {
+			h.Logger.Error(r.Context(), "Server error when parsing json body. error: %v", "error", err.Error())
+		}
+		return
+	}
+
+	if req.DestinationUrl == nil && req.ExpiresAt == nil && req.Password == nil && req.ForcePreview == nil && req.RedirectType == nil &&
+		req.QueryPassthrough == nil && req.PathPassthrough == nil && req.UtmSource == nil && req.UtmMedium == nil && req.UtmCampaign == nil &&
+		req.RoutingRules == nil && req.Variants == nil && req.StickyVariants == nil && req.SlidingTtl == nil {
+		EncodeResponse[types.ErrorResponse](h.Logger, r.Context(), w, http.StatusBadRequest, types.ErrorResponse{Errors: []string{"at least one of `destination_url`, `expires_at`, `password`, `force_preview`, `redirect_type`, `query_passthrough`, `path_passthrough`, `utm_source`, `utm_medium`, `utm_campaign`, `routing_rules`, `variants`, `sticky_variants` or `sliding_ttl` must be provided"}})
+		return
+	}
+
+	if req.DestinationUrl != nil {
+		trimmedDestinationUrl := strings.TrimSpace(*req.DestinationUrl)
+		req.DestinationUrl = &trimmedDestinationUrl
+	}
+	req.UtmSource = trimUtmParam(req.UtmSource, false)
+	req.UtmMedium = trimUtmParam(req.UtmMedium, false)
+	req.UtmCampaign = trimUtmParam(req.UtmCampaign, false)
+	if req.RoutingRules != nil {
+		normalizeRoutingRules(*req.RoutingRules)
+	}
+	if req.Variants != nil {
+		trimShortUrlVariants(*req.Variants)
+	}
+
+	validate, err := utils.GetValidator()
+	if err != nil {
+		EncodeResponse[types.ErrorResponse](h.Logger, r.Context(), w, http.StatusInternalServerError, types.ErrorResponse{Errors: []string{"Something is wrong with the server. Please try again later"}})
+		h.Logger.Error(r.Context(), err.Error())
+		return
+	}
+	var validationError validator.ValidationErrors
+	err = validate.Struct(&req)
+	if err != nil {
+		if errors.As(err, &validationError) {
+			EncodeResponse[types.ShortUrlResponse](h.Logger, r.Context(), w, http.StatusBadRequest, types.ShortUrlResponse{Errors: EncodeValidationError(validationError)})
+			return
+		}
+		EncodeResponse[types.ErrorResponse](h.Logger, r.Context(), w, http.StatusInternalServerError, types.ErrorResponse{Errors: []string{"Something is wrong with the server. Please try again later"}})
+		h.Logger.Error(r.Context(), err.Error())
+		return
+	}
+
+	if req.ExpiresAt != nil {
+		now := time.Now()
+		if !req.ExpiresAt.After(now) {
+			EncodeResponse[types.ErrorResponse](h.Logger, r.Context(), w, http.StatusBadRequest, types.ErrorResponse{Errors: []string{"`expires_at` must be in the future"}})
+			return
+		}
+		if req.ExpiresAt.After(h.maxExpiresAt(now)) {
+			EncodeResponse[types.ErrorResponse](h.Logger, r.Context(), w, http.StatusBadRequest, types.ErrorResponse{Errors: []string{fmt.Sprintf("`expires_at` can only be up to %d seconds from now", h.Config.ShortUrlTtl.AuthenticatedMaxSeconds)}})
+			return
+		}
+	}
+
+	update := types.UpdateShortUrl{
+		DestinationUrl:   req.DestinationUrl,
+		ExpiresAt:        req.ExpiresAt,
+		ForcePreview:     req.ForcePreview,
+		RedirectType:     req.RedirectType,
+		QueryPassthrough: req.QueryPassthrough,
+		PathPassthrough:  req.PathPassthrough,
+		UtmSource:        req.UtmSource,
+		UtmMedium:        req.UtmMedium,
+		UtmCampaign:      req.UtmCampaign,
+		StickyVariants:   req.StickyVariants,
+	}
+	if req.RoutingRules != nil {
+		routingRules, errs := newRoutingRules(*req.RoutingRules)
+		if len(errs) > 0 {
+			EncodeResponse[types.ErrorResponse](h.Logger, r.Context(), w, http.StatusBadRequest, types.ErrorResponse{Errors: errs})
+			return
+		}
+		update.RoutingRules = routingRules
+		update.RemoveRoutingRules = len(routingRules) == 0
+	}
+	if req.Variants != nil {
+		if len(*req.Variants) == 1 {
+			EncodeResponse[types.ErrorResponse](h.Logger, r.Context(), w, http.StatusBadRequest, types.ErrorResponse{Errors: []string{TooFewVariantsError}})
+			return
+		}
+		variants, err := newShortUrlVariants(*req.Variants)
+		if err != nil {
+			EncodeResponse[types.ErrorResponse](h.Logger, r.Context(), w, http.StatusInternalServerError, types.ErrorResponse{Errors: []string{"Something is wrong with the server. Please try again later"}})
+			h.Logger.Error(r.Context(), err.Error())
+			return
+		}
+		update.Variants = variants
+		update.RemoveVariants = len(variants) == 0
+	}
+	if req.SlidingTtl != nil {
+		if *req.SlidingTtl == 0 {
+			update.RemoveSlidingTtl = true
+		} else if *req.SlidingTtl < MinShortUrlSlidingTtl {
+			EncodeResponse[types.ErrorResponse](h.Logger, r.Context(), w, http.StatusBadRequest, types.ErrorResponse{Errors: []string{fmt.Sprintf("`sliding_ttl` must be at least %d seconds, or 0 to turn it off", MinShortUrlSlidingTtl)}})
+			return
+		} else if *req.SlidingTtl > uint32(h.Config.ShortUrlTtl.AuthenticatedMaxSeconds) {
+			EncodeResponse[types.ErrorResponse](h.Logger, r.Context(), w, http.StatusBadRequest, types.ErrorResponse{Errors: []string{fmt.Sprintf("`sliding_ttl` can only be up to %d seconds", h.Config.ShortUrlTtl.AuthenticatedMaxSeconds)}})
+			return
+		} else {
+			slidingTtl := int(*req.SlidingTtl)
+			update.SlidingTtl = &slidingTtl
+		}
+	}
+	if req.Password != nil {
+		if *req.Password == "" {
+			update.RemovePassword = true
+		} else if len(*req.Password) < MinShortUrlPasswordLength {
+			EncodeResponse[types.ErrorResponse](h.Logger, r.Context(), w, http.StatusBadRequest, types.ErrorResponse{Errors: []string{fmt.Sprintf("`password` must be at least %d characters, or empty to remove it", MinShortUrlPasswordLength)}})
+			return
+		} else {
+			passwordHash, err := argon2id.CreateHash(*req.Password, argon2idParams)
+			if err != nil {
+				EncodeResponse[types.ErrorResponse](h.Logger, r.Context(), w, http.StatusInternalServerError, types.ErrorResponse{Errors: []string{"Something is wrong with the server. Please try again later"}})
+				h.Logger.Error(r.Context(), err.Error())
+				return
+			}
+			update.PasswordHash = &passwordHash
+		}
+	}
+
+	shortUrl, err := h.Db.UpdateShortUrl(r.Context(), userIdUuid, shortUrlid, update)
+	if err != nil {
+		EncodeResponse[types.ErrorResponse](h.Logger, r.Context(), w, http.StatusInternalServerError, types.ErrorResponse{Errors: []string{"Something is wrong with the server. Please try again later"}})
+		h.Logger.Error(r.Context(), err.Error())
+		return
+	}
+
+	if shortUrl == nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	EncodeResponse[types.ShortUrlResponse](h.Logger, r.Context(), w, http.StatusOK, newShortUrlResponse(shortUrl, h.BaseUrl))
+	h.Logger.Debug(r.Context(), "PatchById updated short url", "shortUrlId", shortUrl.Id, "responseStatusCode", 200)
+}
+
+type GetShortUrlStatsResponse struct {
+	Id       *uuid.UUID            `json:"id,omitempty"`
+	Total    *int                  `json:"total,omitempty"`
+	Timezone string                `json:"timezone,omitempty"` // the days are split in the user's preferred timezone
+	Daily    []DailyClicksResponse `json:"daily,omitempty"`
+	Variants []VariantHitsResponse `json:"variants,omitempty"`
+	Errors   []string              `json:"errors,omitempty"`
+}
+
+// VariantHitsResponse counts redirects to the variant since it was created, replacing the variants starts the counts again
+type VariantHitsResponse struct {
+	Id             uuid.UUID `json:"id"`
+	DestinationUrl string    `json:"destination_url"`
+	Weight         int       `json:"weight"`
+	Hits           int       `json:"hits"`
+}
+
+type DailyClicksResponse struct {
+	Date   string `json:"date"`
+	Clicks int    `json:"clicks"`
+}
+
+func (h *ApiShortUrlHandler) GetStatsById(w http.ResponseWriter, r *http.Request) {
+	userIdValue := r.Context().Value(UserIdKey)
+	userIdUuid, ok := userIdValue.(uuid.UUID)
+	if !ok {
+		EncodeResponse[types.ErrorResponse](h.Logger, r.Context(), w, http.StatusInternalServerError, types.ErrorResponse{Errors: []string{"Something is wrong with the server. Please try again later"}})
+		h.Logger.Error(r.Context(), "casting uuid from context not ok")
+		return
+	}
+
+	shortUrlIdStr := strings.TrimSpace(r.PathValue("shortUrlId"))
+	shortUrlid, err := uuid.Parse(shortUrlIdStr)
+	if err != nil {
+		EncodeResponse[types.ErrorResponse](h.Logger, r.Context(), w, http.StatusBadRequest, types.ErrorResponse{Errors: []string{"Short url id provided is not a valid uuid"}})
+		return
+	}
+
+	daysStr := strings.TrimSpace(r.URL.Query().Get("days"))
+	if daysStr == "" {
+		daysStr = DefaultDaysQueryParam
+	}
+	days, err := strconv.Atoi(daysStr)
+	if err != nil || days < 1 || days > 365 {
+		EncodeResponse[GetShortUrlStatsResponse](h.Logger, r.Context(), w, http.StatusBadRequest, GetShortUrlStatsResponse{Errors: []string{DaysQueryParamError}})
+		return
+	}
+
+	prefs, err := h.Db.GetUserPreferences(r.Context(), userIdUuid)
+	if err != nil {
+		EncodeResponse[types.ErrorResponse](h.Logger, r.Context(), w, http.StatusInternalServerError, types.ErrorResponse{Errors: []string{"Something is wrong with the server. Please try again later"}})
+		h.Logger.Error(r.Context(), err.Error())
+		return
+	}
+	location, err := time.LoadLocation(prefs.Timezone)
+	if err != nil {
+		// the timezone was valid when it was saved, fall back instead of failing if the tz database has changed since
+		h.Logger.Warn(r.Context(), "couldn't load the preferred timezone", "timezone", prefs.Timezone, "error", err.Error())
+		location = time.UTC
+	}
+
+	// The series always ends today, so 1 day only covers today
+	now := time.Now().In(location)
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, location)
+	since := today.AddDate(0, 0, -(days - 1))
+
+	stats, err := h.Db.GetShortUrlClickStats(r.Context(), userIdUuid, shortUrlid, since, location.String())
+	if err != nil {
+		EncodeResponse[types.ErrorResponse](h.Logger, r.Context(), w, http.StatusInternalServerError, types.ErrorResponse{Errors: []string{"Something is wrong with the server. Please try again later"}})
+		h.Logger.Error(r.Context(), err.Error())
+		return
+	}
+
+	if stats == nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	resp := GetShortUrlStatsResponse{
+		Id:       &shortUrlid,
+		Total:    &stats.Total,
+		Timezone: location.String(),
+		Daily:    []DailyClicksResponse{},
+	}
+	for _, d := range stats.Daily {
+		resp.Daily = append(resp.Daily, DailyClicksResponse{Date: d.Day.Format(time.DateOnly), Clicks: d.Clicks})
+	}
+	for _, v := range stats.Variants {
+		resp.Variants = append(resp.Variants, VariantHitsResponse{Id: v.Id, DestinationUrl: v.DestinationUrl, Weight: v.Weight, Hits: v.Hits})
+	}
+	EncodeResponse[GetShortUrlStatsResponse](h.Logger, r.Context(), w, http.StatusOK, resp)
+}
+
+// shortUrlToResponse leaves the page out for cursor based requests
+func shortUrlToResponse(shortUrls types.GetShortUrlsResult, baseUrl string, filter types.ShortUrlFilter, page *int, size int) GetShortUrlsByUserIdResponse {
 	resp := GetShortUrlsByUserIdResponse{
 		Items: []types.ShortUrlResponse{},
-		Total: &shortUrls.Total,
-		Page:  &page,
+		Total: shortUrls.Total,
+		Next:  &shortUrls.HasMore,
+		Page:  page,
 		Size:  &size,
 	}
 
-	var p int
-	if page == 0 {
-		p = 1
-	} else {
-		p = page
+	if shortUrls.NextCursor != nil {
+		nextCursor := encodeShortUrlCursor(filter, *shortUrls.NextCursor)
+		resp.NextCursor = &nextCursor
 	}
-	next := p*size < shortUrls.Total
-	resp.Next = &next
 
 	for _, s := range shortUrls.Items {
-		r := types.ShortUrlResponse{
-			Id:             &s.Id,
-			DestinationUrl: &s.DestinationUrl,
-			Slug:           &s.Slug,
-			CreatedAt:      &s.CreatedAt,
-			ExpiresAt:      &s.ExpiresAt,
-			Url:            createShortUrl(baseUrl, s.Slug),
-			UserId:         s.UserId,
-			Errors:         []string{},
-		}
+		r := newShortUrlResponse(&s, baseUrl)
+		r.Errors = []string{}
 
 		resp.Items = append(resp.Items, r)
 	}
 	return resp
 }
 
+func newShortUrlResponse(s *types.ShortUrl, baseUrl string) types.ShortUrlResponse {
+	resp := types.ShortUrlResponse{
+		Id:              &s.Id,
+		DestinationUrl:  &s.DestinationUrl,
+		Slug:            &s.Slug,
+		CreatedAt:       &s.CreatedAt,
+		Url:             createShortUrl(baseUrl, s.Slug),
+		UserId:          s.UserId,
+		MaxClicks:       s.MaxClicks,
+		RemainingClicks: s.RemainingClicks,
+		ActivatesAt:     s.ActivatesAt,
+		RedirectType:    s.RedirectType,
+		UtmSource:       s.UtmSource,
+		UtmMedium:       s.UtmMedium,
+		UtmCampaign:     s.UtmCampaign,
+		RoutingRules:    s.RoutingRules,
+		Variants:        s.Variants,
+		Tags:            s.Tags,
+		SlidingTtl:      s.SlidingTtl,
+		DeletedAt:       s.DeletedAt,
+	}
+	if s.PasswordHash != nil {
+		passwordProtected := true
+		resp.PasswordProtected = &passwordProtected
+	}
+	if s.ForcePreview {
+		resp.ForcePreview = &s.ForcePreview
+	}
+	if s.QueryPassthrough {
+		resp.QueryPassthrough = &s.QueryPassthrough
+	}
+	if s.PathPassthrough {
+		resp.PathPassthrough = &s.PathPassthrough
+	}
+	if s.StickyVariants {
+		resp.StickyVariants = &s.StickyVariants
+	}
+	if s.Expires() {
+		resp.ExpiresAt = &s.ExpiresAt
+	} else {
+		neverExpires := true
+		resp.NeverExpires = &neverExpires
+	}
+	return resp
+}
+
+// trimUtmParam removes surrounding whitespace, when emptyAsNil is set a blank value becomes nil instead of an empty string
+func trimUtmParam(value *string, emptyAsNil bool) *string {
+	if value == nil {
+		return nil
+	}
+	trimmed := strings.TrimSpace(*value)
+	if trimmed == "" && emptyAsNil {
+		return nil
+	}
+	return &trimmed
+}
+
 func GenerateSlug() (string, error) {
 	valueRange := big.NewInt(5) // Generate a random number [0, 1, 2, 3 , 4]
 	n, err := rand.Int(rand.Reader, valueRange)
@@ -330,6 +1009,15 @@ func GenerateSlug() (string, error) {
 	return result.String(), nil
 }
 
+func IsReservedSlug(slug string) bool {
+	for _, reserved := range ReservedSlugs {
+		if strings.EqualFold(slug, reserved) {
+			return true
+		}
+	}
+	return false
+}
+
 func createShortUrl(baseUrl string, slug string) string {
 	return fmt.Sprintf("%s/%s", baseUrl, slug)
 }
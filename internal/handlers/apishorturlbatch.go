@@ -0,0 +1,395 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/amieldelatorre/shurl/internal/db"
+	"github.com/amieldelatorre/shurl/internal/types"
+	"github.com/amieldelatorre/shurl/internal/utils"
+	"github.com/go-playground/validator/v10"
+	"github.com/google/uuid"
+)
+
+const (
+	MaxShortUrlBatchSize       = 500
+	ShortUrlBatchActionDelete  = "delete"
+	ShortUrlBatchActionExpire  = "set_expiry"
+	BatchSelectionError        = "exactly one of `ids` or `filter` must be provided"
+	BatchFilterEmptyError      = "`filter` needs at least one of `tag`, `q`, `status`, `created_after` or `created_before`, use `ids` to pick short urls one by one"
+	BatchExpiresAtMissingError = "`expires_at` is required for the set_expiry action"
+	BatchExpiresAtUnusedError  = "`expires_at` can only be used with the set_expiry action"
+)
+
+var (
+	errShortUrlBatchItem = errors.New("couldn't prepare a short url of the batch, see the errors logged before this one")
+	BatchSizeError       = fmt.Sprintf("`items` must have between 1 and %d short urls", MaxShortUrlBatchSize)
+	BatchIdsSizeError    = fmt.Sprintf("`ids` must have between 1 and %d short url ids", MaxShortUrlBatchSize)
+)
+
+type PostShortUrlBatchRequest struct {
+	Items []PostShortUrlRequest `json:"items"`
+}
+
+// ShortUrlBatchItemResponse has the status code a single request for the item would have returned
+type ShortUrlBatchItemResponse struct {
+	Index      int                     `json:"index"`
+	StatusCode int                     `json:"status_code"`
+	ShortUrl   *types.ShortUrlResponse `json:"short_url,omitempty"`
+	Errors     []string                `json:"errors,omitempty"`
+}
+
+type PostShortUrlBatchResponse struct {
+	Items   []ShortUrlBatchItemResponse `json:"items,omitempty"`
+	Created *int                        `json:"created,omitempty"`
+	Failed  *int                        `json:"failed,omitempty"`
+	Errors  []string                    `json:"errors,omitempty"`
+}
+
+// PostShortUrlBatch creates every valid item in one transaction under a single idempotency key.
+// Items that fail don't stop the others, the response has a result for each item in the order they were sent.
+func (h *ApiShortUrlHandler) PostShortUrlBatch(w http.ResponseWriter, r *http.Request) {
+	var req PostShortUrlBatchRequest
+
+	userIdValue := r.Context().Value(UserIdKey)
+	userIdUuid, ok := userIdValue.(uuid.UUID)
+	if !ok {
+		EncodeResponse[types.ErrorResponse](h.Logger, r.Context(), w, http.StatusInternalServerError, types.ErrorResponse{Errors: []string{"Something is wrong with the server. Please try again later"}})
+		h.Logger.Error(r.Context(), "casting uuid from context not ok")
+		return
+	}
+
+	idempotencyKeyString := r.Header.Get(types.HeadersIdempotencyKey)
+	idempotencyKey, err := uuid.Parse(idempotencyKeyString)
+	if err != nil {
+		EncodeResponse[types.ErrorResponse](h.Logger, r.Context(), w, http.StatusBadRequest, types.ErrorResponse{Errors: []string{"idempotency key provided is not a valid UUID"}})
+		return
+	}
+
+	err = json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		errorCode, message := parseJsonDecodeError(err)
+		EncodeResponse[types.ErrorResponse](h.Logger, r.Context(), w, errorCode, types.ErrorResponse{Errors: []string{message}})
+		if errorCode == http.StatusInternalServerError {
+			h.Logger.Error(r.Context(), "Server error when parsing json body. error: %v", "error", err.Error())
+		}
+		return
+	}
+
+	if len(req.Items) == 0 || len(req.Items) > MaxShortUrlBatchSize {
+		EncodeResponse[types.ErrorResponse](h.Logger, r.Context(), w, http.StatusBadRequest, types.ErrorResponse{Errors: []string{BatchSizeError}})
+		return
+	}
+
+	results := make([]ShortUrlBatchItemResponse, len(req.Items))
+	err = h.createShortUrlItems(r.Context(), userIdUuid, req.Items, results, idempotencyKey, false)
+	if err != nil {
+		var idempotencyKeyUsedError *types.DuplicateIdempotencyKeyError
+		if errors.As(err, &idempotencyKeyUsedError) {
+			EncodeResponse[types.ErrorResponse](h.Logger, r.Context(), w, http.StatusBadRequest, types.ErrorResponse{Errors: []string{fmt.Sprintf("%s header value has already been used", types.HeadersIdempotencyKey)}})
+			h.Logger.Error(r.Context(), err.Error())
+			return
+		}
+
+		EncodeResponse[types.ErrorResponse](h.Logger, r.Context(), w, http.StatusInternalServerError, types.ErrorResponse{Errors: []string{"Something is wrong with the server. Please try again later"}})
+		h.Logger.Error(r.Context(), err.Error())
+		return
+	}
+
+	createdCount := countShortUrlBatchResults(results, http.StatusCreated)
+	failedCount := len(results) - createdCount
+
+	resp := PostShortUrlBatchResponse{Items: results, Created: &createdCount, Failed: &failedCount}
+	EncodeResponse[PostShortUrlBatchResponse](h.Logger, r.Context(), w, http.StatusOK, resp)
+	h.Logger.Debug(r.Context(), "PostShortUrlBatch created short urls", "created", createdCount, "failed", failedCount)
+}
+
+// createShortUrlItems fills in the result of every item that doesn't have a status code yet, they are all created in one transaction.
+// A dry run stops before anything is written, the items that would have been created get http.StatusOK.
+func (h *ApiShortUrlHandler) createShortUrlItems(ctx context.Context, userId uuid.UUID, reqs []PostShortUrlRequest, results []ShortUrlBatchItemResponse, idempotencyKey uuid.UUID, dryRun bool) error {
+	batchId, err := uuid.NewV7()
+	if err != nil {
+		return err
+	}
+
+	prefs, err := h.userPreferences(ctx, userId)
+	if err != nil {
+		return err
+	}
+
+	itemHashes := make([]string, len(reqs))
+	batch := types.CreateShortUrlBatch{Id: batchId}
+	requestedSlugs := map[string]bool{}
+	for i := range reqs {
+		results[i].Index = i
+		if results[i].StatusCode != 0 {
+			continue
+		}
+
+		newShortUrl, requestedSlug, statusCode, errs := h.prepareCreateShortUrl(ctx, userId, prefs, &reqs[i], dryRun)
+		if statusCode == http.StatusInternalServerError {
+			return errShortUrlBatchItem
+		}
+		if statusCode != 0 {
+			results[i] = ShortUrlBatchItemResponse{Index: i, StatusCode: statusCode, Errors: errs}
+			continue
+		}
+		// only the first item asking for a slug can get it
+		if requestedSlug != "" {
+			if requestedSlugs[requestedSlug] {
+				results[i] = ShortUrlBatchItemResponse{Index: i, StatusCode: http.StatusConflict, Errors: []string{fmt.Sprintf("slug '%s' is already taken", requestedSlug)}}
+				continue
+			}
+			requestedSlugs[requestedSlug] = true
+		}
+
+		itemHashes[i] = db.HashCreateShortUrlRequest(requestedSlug, newShortUrl)
+		applyUserPreferences(&newShortUrl, prefs, &reqs[i])
+		batch.Items = append(batch.Items, types.CreateShortUrlBatchItem{Position: i, ShortUrl: newShortUrl})
+	}
+
+	if len(batch.Items) == 0 {
+		return nil
+	}
+
+	if dryRun {
+		slugs := make([]string, 0, len(requestedSlugs))
+		for slug := range requestedSlugs {
+			slugs = append(slugs, slug)
+		}
+		taken, err := h.Db.GetTakenSlugs(ctx, slugs)
+		if err != nil {
+			return err
+		}
+		takenSlugs := map[string]bool{}
+		for _, slug := range taken {
+			takenSlugs[slug] = true
+		}
+
+		for _, item := range batch.Items {
+			s := item.ShortUrl
+			if takenSlugs[s.Slug] {
+				results[item.Position] = ShortUrlBatchItemResponse{Index: item.Position, StatusCode: http.StatusConflict, Errors: []string{fmt.Sprintf("slug '%s' is already taken", s.Slug)}}
+				continue
+			}
+			// slugs are only generated on the real run, so only the requested ones are shown
+			preview := types.ShortUrlResponse{DestinationUrl: &s.DestinationUrl, ExpiresAt: &s.ExpiresAt}
+			if s.ExpiresAt.Equal(types.NeverExpires) {
+				neverExpires := true
+				preview.ExpiresAt = nil
+				preview.NeverExpires = &neverExpires
+			}
+			if requestedSlugs[s.Slug] {
+				preview.Slug = &s.Slug
+				preview.Url = createShortUrl(h.BaseUrl, s.Slug)
+			}
+			results[item.Position] = ShortUrlBatchItemResponse{Index: item.Position, StatusCode: http.StatusOK, ShortUrl: &preview}
+		}
+		return nil
+	}
+
+	// the generated slugs are checked together instead of one query per item
+	generated := []int{}
+	for j, item := range batch.Items {
+		if item.ShortUrl.Slug == "" {
+			generated = append(generated, j)
+		}
+	}
+	if len(generated) > 0 {
+		slugs, err := h.generateUniqueSlugs(ctx, len(generated), requestedSlugs)
+		if err != nil {
+			return err
+		}
+		for k, j := range generated {
+			batch.Items[j].ShortUrl.Slug = slugs[k]
+		}
+	}
+
+	created, err := h.Db.CreateShortUrlBatch(ctx, batch, idempotencyKey, db.HashCreateShortUrlBatchRequest(itemHashes))
+	if err != nil {
+		return err
+	}
+
+	for j, c := range created {
+		if c.ShortUrl == nil {
+			results[c.Position] = ShortUrlBatchItemResponse{Index: c.Position, StatusCode: http.StatusConflict, Errors: []string{fmt.Sprintf("slug '%s' is already taken", batch.Items[j].ShortUrl.Slug)}}
+			continue
+		}
+		shortUrlResponse := newShortUrlResponse(c.ShortUrl, h.BaseUrl)
+		results[c.Position] = ShortUrlBatchItemResponse{Index: c.Position, StatusCode: http.StatusCreated, ShortUrl: &shortUrlResponse}
+	}
+	return nil
+}
+
+func countShortUrlBatchResults(results []ShortUrlBatchItemResponse, statusCode int) int {
+	count := 0
+	for _, result := range results {
+		if result.StatusCode == statusCode {
+			count++
+		}
+	}
+	return count
+}
+
+// ShortUrlBatchFilterRequest works like the query parameters of GetShortUrls, without the sorting
+type ShortUrlBatchFilterRequest struct {
+	Tag           string     `json:"tag,omitempty" validate:"max=64"`
+	Search        string     `json:"q,omitempty" validate:"max=255"`
+	Status        string     `json:"status,omitempty" validate:"omitempty,oneof=active expired all"`
+	CreatedAfter  *time.Time `json:"created_after,omitempty"`
+	CreatedBefore *time.Time `json:"created_before,omitempty"`
+}
+
+type ChangeShortUrlBatchRequest struct {
+	Action    string                      `json:"action" validate:"required,oneof=delete set_expiry"`
+	Ids       []uuid.UUID                 `json:"ids,omitempty"`
+	Filter    *ShortUrlBatchFilterRequest `json:"filter,omitempty"`
+	ExpiresAt *time.Time                  `json:"expires_at,omitempty"`
+}
+
+type ChangedShortUrlResponse struct {
+	Id    uuid.UUID `json:"id"`
+	Slug  *string   `json:"slug,omitempty"`
+	Found bool      `json:"found"`
+}
+
+type ChangeShortUrlBatchResponse struct {
+	Items   []ChangedShortUrlResponse `json:"items,omitempty"`
+	Changed *int                      `json:"changed,omitempty"`
+	Errors  []string                  `json:"errors,omitempty"`
+}
+
+// ChangeShortUrlBatch deletes or sets a new expiry on many short urls at once, picked by id or by a filter
+func (h *ApiShortUrlHandler) ChangeShortUrlBatch(w http.ResponseWriter, r *http.Request) {
+	var req ChangeShortUrlBatchRequest
+
+	userIdValue := r.Context().Value(UserIdKey)
+	userIdUuid, ok := userIdValue.(uuid.UUID)
+	if !ok {
+		EncodeResponse[types.ErrorResponse](h.Logger, r.Context(), w, http.StatusInternalServerError, types.ErrorResponse{Errors: []string{"Something is wrong with the server. Please try again later"}})
+		h.Logger.Error(r.Context(), "casting uuid from context not ok")
+		return
+	}
+
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		errorCode, message := parseJsonDecodeError(err)
+		EncodeResponse[types.ErrorResponse](h.Logger, r.Context(), w, errorCode, types.ErrorResponse{Errors: []string{message}})
+		if errorCode == http.StatusInternalServerError {
+			h.Logger.Error(r.Context(), "Server error when parsing json body. error: %v", "error", err.Error())
+		}
+		return
+	}
+
+	req.Action = strings.ToLower(strings.TrimSpace(req.Action))
+	if req.Filter != nil {
+		req.Filter.Tag = strings.TrimSpace(req.Filter.Tag)
+		req.Filter.Search = strings.TrimSpace(req.Filter.Search)
+		req.Filter.Status = strings.ToLower(strings.TrimSpace(req.Filter.Status))
+	}
+
+	validate, err := utils.GetValidator()
+	if err != nil {
+		EncodeResponse[types.ErrorResponse](h.Logger, r.Context(), w, http.StatusInternalServerError, types.ErrorResponse{Errors: []string{"Something is wrong with the server. Please try again later"}})
+		h.Logger.Error(r.Context(), err.Error())
+		return
+	}
+	var validationError validator.ValidationErrors
+	err = validate.Struct(&req)
+	if err != nil {
+		if errors.As(err, &validationError) {
+			EncodeResponse[ChangeShortUrlBatchResponse](h.Logger, r.Context(), w, http.StatusBadRequest, ChangeShortUrlBatchResponse{Errors: EncodeValidationError(validationError)})
+			return
+		}
+		EncodeResponse[types.ErrorResponse](h.Logger, r.Context(), w, http.StatusInternalServerError, types.ErrorResponse{Errors: []string{"Something is wrong with the server. Please try again later"}})
+		h.Logger.Error(r.Context(), err.Error())
+		return
+	}
+
+	selection, errMessage := newShortUrlSelection(req)
+	if errMessage != "" {
+		EncodeResponse[types.ErrorResponse](h.Logger, r.Context(), w, http.StatusBadRequest, types.ErrorResponse{Errors: []string{errMessage}})
+		return
+	}
+
+	var result types.ChangeShortUrlsResult
+	switch req.Action {
+	case ShortUrlBatchActionDelete:
+		if req.ExpiresAt != nil {
+			EncodeResponse[types.ErrorResponse](h.Logger, r.Context(), w, http.StatusBadRequest, types.ErrorResponse{Errors: []string{BatchExpiresAtUnusedError}})
+			return
+		}
+		result, err = h.Db.DeleteShortUrls(r.Context(), userIdUuid, selection)
+	case ShortUrlBatchActionExpire:
+		if req.ExpiresAt == nil {
+			EncodeResponse[types.ErrorResponse](h.Logger, r.Context(), w, http.StatusBadRequest, types.ErrorResponse{Errors: []string{BatchExpiresAtMissingError}})
+			return
+		}
+		// the same limits as changing the expiry of a single short url
+		now := time.Now()
+		if !req.ExpiresAt.After(now) {
+			EncodeResponse[types.ErrorResponse](h.Logger, r.Context(), w, http.StatusBadRequest, types.ErrorResponse{Errors: []string{"`expires_at` must be in the future"}})
+			return
+		}
+		if req.ExpiresAt.After(h.maxExpiresAt(now)) {
+			EncodeResponse[types.ErrorResponse](h.Logger, r.Context(), w, http.StatusBadRequest, types.ErrorResponse{Errors: []string{fmt.Sprintf("`expires_at` can only be up to %d seconds from now", h.Config.ShortUrlTtl.AuthenticatedMaxSeconds)}})
+			return
+		}
+		result, err = h.Db.SetShortUrlsExpiry(r.Context(), userIdUuid, selection, *req.ExpiresAt)
+	}
+	if err != nil {
+		EncodeResponse[types.ErrorResponse](h.Logger, r.Context(), w, http.StatusInternalServerError, types.ErrorResponse{Errors: []string{"Something is wrong with the server. Please try again later"}})
+		h.Logger.Error(r.Context(), err.Error())
+		return
+	}
+
+	resp := ChangeShortUrlBatchResponse{Items: []ChangedShortUrlResponse{}, Changed: &result.NumChanged}
+	for _, item := range result.Items {
+		changed := ChangedShortUrlResponse{Id: item.Id, Found: item.Found}
+		if item.Found {
+			changed.Slug = &item.Slug
+		}
+		resp.Items = append(resp.Items, changed)
+	}
+	EncodeResponse[ChangeShortUrlBatchResponse](h.Logger, r.Context(), w, http.StatusOK, resp)
+	h.Logger.Debug(r.Context(), "ChangeShortUrlBatch changed short urls", "action", req.Action, "changed", result.NumChanged)
+}
+
+// newShortUrlSelection drops repeated ids and refuses a filter without any conditions, that would pick every active short url
+func newShortUrlSelection(req ChangeShortUrlBatchRequest) (types.ShortUrlSelection, string) {
+	if (len(req.Ids) > 0) == (req.Filter != nil) {
+		return types.ShortUrlSelection{}, BatchSelectionError
+	}
+
+	if req.Filter != nil {
+		f := req.Filter
+		if f.Tag == "" && f.Search == "" && f.Status == "" && f.CreatedAfter == nil && f.CreatedBefore == nil {
+			return types.ShortUrlSelection{}, BatchFilterEmptyError
+		}
+		return types.ShortUrlSelection{Filter: &types.ShortUrlFilter{
+			Tag:           f.Tag,
+			Search:        f.Search,
+			Status:        f.Status,
+			CreatedAfter:  f.CreatedAfter,
+			CreatedBefore: f.CreatedBefore,
+		}}, ""
+	}
+
+	if len(req.Ids) > MaxShortUrlBatchSize {
+		return types.ShortUrlSelection{}, BatchIdsSizeError
+	}
+	seen := map[uuid.UUID]bool{}
+	ids := make([]uuid.UUID, 0, len(req.Ids))
+	for _, id := range req.Ids {
+		if !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	return types.ShortUrlSelection{Ids: ids}, ""
+}
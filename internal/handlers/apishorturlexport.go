@@ -0,0 +1,311 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/amieldelatorre/shurl/internal/types"
+	"github.com/google/uuid"
+)
+
+const (
+	ExportFormatCsv                     = "csv"
+	ExportFormatJson                    = "json"
+	ExportFormatNdjson                  = "ndjson"
+	DefaultExportFormat                 = ExportFormatCsv
+	ExportFormatQueryParamError         = "Invalid format value, must be one of `csv`, `json` or `ndjson`"
+	ExportIncludeExpiredQueryParamError = "Invalid include_expired value, must be true or false"
+	ExportClicksQueryParamError         = "Invalid clicks value, must be true or false"
+	exportFlushEvery                    = 100 // rows written before pushing what we have to the client
+)
+
+var (
+	exportContentTypes = map[string]string{
+		ExportFormatCsv:    "text/csv; charset=utf-8",
+		ExportFormatJson:   types.HeadersContentTypeJsonValue,
+		ExportFormatNdjson: "application/x-ndjson",
+	}
+	// ShortUrlExportCsvHeader doesn't have the routing rules or variants, they don't fit in a single column. Use json or ndjson to get them.
+	ShortUrlExportCsvHeader = []string{
+		"id", "slug", "url", "destination_url", "created_at", "expires_at", "password_protected", "max_clicks", "remaining_clicks",
+		"activates_at", "redirect_type", "force_preview", "query_passthrough", "path_passthrough", "utm_source", "utm_medium", "utm_campaign", "tags",
+	}
+)
+
+// ShortUrlExportItem is a json and ndjson export row, Clicks is only there when they were asked for
+type ShortUrlExportItem struct {
+	types.ShortUrlResponse
+	Clicks *int `json:"clicks,omitempty"`
+}
+
+type shortUrlExportOptions struct {
+	Format string
+	Export types.ShortUrlExportOptions
+}
+
+// parseShortUrlExportOptions reads the format, include_expired and clicks query parameters
+func parseShortUrlExportOptions(r *http.Request) (shortUrlExportOptions, []string) {
+	query := r.URL.Query()
+	errs := []string{}
+	opts := shortUrlExportOptions{Format: DefaultExportFormat}
+
+	if format := strings.ToLower(strings.TrimSpace(query.Get("format"))); format != "" {
+		if _, ok := exportContentTypes[format]; !ok {
+			errs = append(errs, ExportFormatQueryParamError)
+		}
+		opts.Format = format
+	}
+
+	var ok bool
+	if opts.Export.IncludeExpired, ok = parseBoolQueryParam(query.Get("include_expired")); !ok {
+		errs = append(errs, ExportIncludeExpiredQueryParamError)
+	}
+	if opts.Export.WithClicks, ok = parseBoolQueryParam(query.Get("clicks")); !ok {
+		errs = append(errs, ExportClicksQueryParamError)
+	}
+	return opts, errs
+}
+
+// parseBoolQueryParam treats a missing value as false
+func parseBoolQueryParam(value string) (bool, bool) {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "", "false":
+		return false, true
+	case "true":
+		return true, true
+	default:
+		return false, false
+	}
+}
+
+// ExportShortUrls streams every short url the user owns as a download. Once the first row is out the status can't change anymore,
+// so an error part way through is only logged and the body is cut short, which leaves a json export unterminated.
+func (h *ApiShortUrlHandler) ExportShortUrls(w http.ResponseWriter, r *http.Request) {
+	userIdValue := r.Context().Value(UserIdKey)
+	userIdUuid, ok := userIdValue.(uuid.UUID)
+	if !ok {
+		EncodeResponse[types.ErrorResponse](h.Logger, r.Context(), w, http.StatusInternalServerError, types.ErrorResponse{Errors: []string{"Something is wrong with the server. Please try again later"}})
+		h.Logger.Error(r.Context(), "casting uuid from context not ok")
+		return
+	}
+
+	opts, errs := parseShortUrlExportOptions(r)
+	if len(errs) > 0 {
+		EncodeResponse[types.ErrorResponse](h.Logger, r.Context(), w, http.StatusBadRequest, types.ErrorResponse{Errors: errs})
+		return
+	}
+
+	w.Header().Set(types.HeadersContentTypeKey, exportContentTypes[opts.Format])
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="shurl-export-%s.%s"`, time.Now().UTC().Format("20060102"), opts.Format))
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+
+	rc := http.NewResponseController(w)
+	var writer shortUrlExportWriter
+	switch opts.Format {
+	case ExportFormatJson:
+		writer = &jsonShortUrlExportWriter{w: w}
+	case ExportFormatNdjson:
+		writer = &ndjsonShortUrlExportWriter{encoder: json.NewEncoder(w)}
+	default:
+		writer = &csvShortUrlExportWriter{w: csv.NewWriter(w), withClicks: opts.Export.WithClicks}
+	}
+
+	count := 0
+	err := writer.Start()
+	if err == nil {
+		err = h.Db.ExportShortUrlsByUserId(r.Context(), userIdUuid, opts.Export, func(e types.ExportedShortUrl) error {
+			err := writer.Write(h.BaseUrl, e)
+			if err != nil {
+				return err
+			}
+			count++
+			if count%exportFlushEvery == 0 {
+				return writer.Flush(rc)
+			}
+			return nil
+		})
+	}
+	if err == nil {
+		err = writer.End()
+	}
+	if err == nil {
+		err = writer.Flush(rc)
+	}
+	if err != nil {
+		h.Logger.Error(r.Context(), "ExportShortUrls stopped part way through", "error", err.Error(), "rowsWritten", count)
+		return
+	}
+	h.Logger.Debug(r.Context(), "ExportShortUrls exported short urls", "format", opts.Format, "rowsWritten", count)
+}
+
+type shortUrlExportWriter interface {
+	Start() error
+	Write(baseUrl string, e types.ExportedShortUrl) error
+	End() error
+	Flush(rc *http.ResponseController) error
+}
+
+func newShortUrlExportItem(baseUrl string, e *types.ExportedShortUrl) ShortUrlExportItem {
+	return ShortUrlExportItem{ShortUrlResponse: newShortUrlResponse(&e.ShortUrl, baseUrl), Clicks: e.Clicks}
+}
+
+// flushResponse ignores writers that can't flush, the rows still get there once the handler returns
+func flushResponse(rc *http.ResponseController) error {
+	err := rc.Flush()
+	if err != nil && !errors.Is(err, http.ErrNotSupported) {
+		return err
+	}
+	return nil
+}
+
+// jsonShortUrlExportWriter writes a single array, one element at a time
+type jsonShortUrlExportWriter struct {
+	w       io.Writer
+	started bool
+}
+
+func (j *jsonShortUrlExportWriter) Start() error {
+	_, err := io.WriteString(j.w, "[")
+	return err
+}
+
+func (j *jsonShortUrlExportWriter) Write(baseUrl string, e types.ExportedShortUrl) error {
+	b, err := json.Marshal(newShortUrlExportItem(baseUrl, &e))
+	if err != nil {
+		return err
+	}
+	if j.started {
+		if _, err = io.WriteString(j.w, ","); err != nil {
+			return err
+		}
+	}
+	j.started = true
+	_, err = j.w.Write(b)
+	return err
+}
+
+func (j *jsonShortUrlExportWriter) End() error {
+	_, err := io.WriteString(j.w, "]\n")
+	return err
+}
+
+func (j *jsonShortUrlExportWriter) Flush(rc *http.ResponseController) error {
+	return flushResponse(rc)
+}
+
+type ndjsonShortUrlExportWriter struct {
+	encoder *json.Encoder
+}
+
+func (n *ndjsonShortUrlExportWriter) Start() error {
+	return nil
+}
+
+// Write relies on json.Encoder ending every value with a newline
+func (n *ndjsonShortUrlExportWriter) Write(baseUrl string, e types.ExportedShortUrl) error {
+	return n.encoder.Encode(newShortUrlExportItem(baseUrl, &e))
+}
+
+func (n *ndjsonShortUrlExportWriter) End() error {
+	return nil
+}
+
+func (n *ndjsonShortUrlExportWriter) Flush(rc *http.ResponseController) error {
+	return flushResponse(rc)
+}
+
+type csvShortUrlExportWriter struct {
+	w          *csv.Writer
+	withClicks bool
+}
+
+func (c *csvShortUrlExportWriter) Start() error {
+	header := ShortUrlExportCsvHeader
+	if c.withClicks {
+		header = append(header[:len(header):len(header)], "clicks")
+	}
+	return c.w.Write(header)
+}
+
+// Write leaves optional values empty and joins the tag names with a semicolon
+func (c *csvShortUrlExportWriter) Write(baseUrl string, e types.ExportedShortUrl) error {
+	s := &e.ShortUrl
+	tagNames := make([]string, len(s.Tags))
+	for i, t := range s.Tags {
+		tagNames[i] = t.Name
+	}
+
+	record := []string{
+		s.Id.String(),
+		s.Slug,
+		createShortUrl(baseUrl, s.Slug),
+		s.DestinationUrl,
+		s.CreatedAt.UTC().Format(time.RFC3339),
+		csvExpiresAt(s),
+		strconv.FormatBool(s.PasswordHash != nil),
+		csvOptionalInt(s.MaxClicks),
+		csvOptionalInt(s.RemainingClicks),
+		csvOptionalTime(s.ActivatesAt),
+		csvOptionalInt(s.RedirectType),
+		strconv.FormatBool(s.ForcePreview),
+		strconv.FormatBool(s.QueryPassthrough),
+		strconv.FormatBool(s.PathPassthrough),
+		csvOptionalString(s.UtmSource),
+		csvOptionalString(s.UtmMedium),
+		csvOptionalString(s.UtmCampaign),
+		strings.Join(tagNames, ";"),
+	}
+	if c.withClicks {
+		record = append(record, csvOptionalInt(e.Clicks))
+	}
+	return c.w.Write(record)
+}
+
+func (c *csvShortUrlExportWriter) End() error {
+	return nil
+}
+
+func (c *csvShortUrlExportWriter) Flush(rc *http.ResponseController) error {
+	c.w.Flush()
+	if err := c.w.Error(); err != nil {
+		return err
+	}
+	return flushResponse(rc)
+}
+
+func csvOptionalInt(value *int) string {
+	if value == nil {
+		return ""
+	}
+	return strconv.Itoa(*value)
+}
+
+// csvExpiresAt leaves the expiry empty for short urls that never expire
+func csvExpiresAt(s *types.ShortUrl) string {
+	if !s.Expires() {
+		return ""
+	}
+	return s.ExpiresAt.UTC().Format(time.RFC3339)
+}
+
+func csvOptionalTime(value *time.Time) string {
+	if value == nil {
+		return ""
+	}
+	return value.UTC().Format(time.RFC3339)
+}
+
+func csvOptionalString(value *string) string {
+	if value == nil {
+		return ""
+	}
+	return *value
+}
@@ -0,0 +1,509 @@
+package handlers
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/amieldelatorre/shurl/internal/types"
+	"github.com/google/uuid"
+)
+
+const (
+	MaxShortUrlImportRows         = 10000
+	MaxShortUrlImportSize         = 10 << 20 // 10 MiB
+	ImportFormatQueryParamError   = "Invalid format value, must be one of `csv`, `json` or `ndjson`, or leave it out and send a matching Content-Type"
+	ImportDryRunQueryParamError   = "Invalid dry_run value, must be true or false"
+	ImportTooLargeError           = "The import can't be larger than 10 MiB, split it into smaller files"
+	ImportCsvMissingColumnError   = "The csv header needs a destination column, one of destination_url, long_url, original_url, target, destination or url"
+	ImportExpiresAtInThePastError = "`expires_at` is in the past"
+	ImportUnknownTagError         = "tag '%s' doesn't exist, create it before importing"
+	importNdjsonMaxLineSize       = 1 << 20
+)
+
+var (
+	ImportTooManyRowsError = fmt.Sprintf("The import can have between 1 and %d short urls", MaxShortUrlImportRows)
+
+	// importCsvColumns maps the column names other shorteners use in their exports to ours, earlier names win when a file has several
+	importCsvColumns = map[string][]string{
+		"destination_url":   {"destination_url", "long_url", "longurl", "original_url", "target", "destination", "url"},
+		"slug":              {"slug", "keyword", "slashtag", "address", "back_half", "custom_alias", "alias"},
+		"short_url":         {"short_url", "shortlink", "short_link", "link"}, // the full short url, only used for its slug when there's no slug column
+		"ttl":               {"ttl"},
+		"expires_at":        {"expires_at", "expire_at", "expiration", "expires"},
+		"max_clicks":        {"max_clicks"},
+		"activates_at":      {"activates_at"},
+		"redirect_type":     {"redirect_type"},
+		"force_preview":     {"force_preview"},
+		"query_passthrough": {"query_passthrough"},
+		"path_passthrough":  {"path_passthrough"},
+		"utm_source":        {"utm_source"},
+		"utm_medium":        {"utm_medium"},
+		"utm_campaign":      {"utm_campaign"},
+		"tags":              {"tags"}, // tag names separated by semicolons, like in our own export
+	}
+	importFormats = map[string]string{
+		"text/csv":             ExportFormatCsv,
+		"application/json":     ExportFormatJson,
+		"application/x-ndjson": ExportFormatNdjson,
+	}
+)
+
+// ImportShortUrlRow is a short url read from an import file, Errors has the problems found while reading it
+type ImportShortUrlRow struct {
+	Request  PostShortUrlRequest
+	TagNames []string // turned into the ids of the user's tags when the rows are imported
+	// a row of our own csv export without an expiry, it only never expires when the server allows that and gets the default ttl otherwise
+	ExportedNeverExpires bool
+	Errors               []string
+}
+
+// ImportShortUrlItem is a json or ndjson import row. It takes everything PostShortUrlRequest does and also understands the
+// expires_at and tags of our own exports, anything else in the row is ignored.
+type ImportShortUrlItem struct {
+	PostShortUrlRequest
+	ExpiresAt *time.Time  `json:"expires_at,omitempty"`
+	Tags      []types.Tag `json:"tags,omitempty"`
+}
+
+// ImportShortUrlsResponse has a result for each row in the order of the file. In a dry run nothing is written,
+// the rows that would be created have a 200 status code and are counted in Created.
+type ImportShortUrlsResponse struct {
+	DryRun  bool                        `json:"dry_run,omitempty"`
+	Items   []ShortUrlBatchItemResponse `json:"items,omitempty"`
+	Created *int                        `json:"created,omitempty"`
+	Failed  *int                        `json:"failed,omitempty"`
+	Errors  []string                    `json:"errors,omitempty"`
+}
+
+// ImportFormatFromContentType returns an empty string for content types that aren't an import format
+func ImportFormatFromContentType(contentType string) string {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return ""
+	}
+	return importFormats[mediaType]
+}
+
+// ParseShortUrlImport reads every row of the file. The error is for problems with the whole file, a bad row only gets its own errors.
+func ParseShortUrlImport(r io.Reader, format string) ([]ImportShortUrlRow, error) {
+	var rows []ImportShortUrlRow
+	var err error
+	switch format {
+	case ExportFormatCsv:
+		rows, err = parseShortUrlImportCsv(r)
+	case ExportFormatJson:
+		rows, err = parseShortUrlImportJson(r)
+	case ExportFormatNdjson:
+		rows, err = parseShortUrlImportNdjson(r)
+	default:
+		return nil, errors.New(ImportFormatQueryParamError)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if len(rows) == 0 || len(rows) > MaxShortUrlImportRows {
+		return nil, errors.New(ImportTooManyRowsError)
+	}
+	return rows, nil
+}
+
+func parseShortUrlImportCsv(r io.Reader) ([]ImportShortUrlRow, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, errors.New(ImportTooManyRowsError)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("couldn't read the csv header: %s", err.Error())
+	}
+
+	// a utf-8 byte order mark from spreadsheet programs would otherwise end up in the first column name
+	if len(header) > 0 {
+		header[0] = strings.TrimPrefix(header[0], "\ufeff")
+	}
+	positions := map[string]int{}
+	for i, name := range header {
+		name = strings.ReplaceAll(strings.ToLower(strings.TrimSpace(name)), " ", "_")
+		if _, ok := positions[name]; !ok {
+			positions[name] = i
+		}
+	}
+	columns := map[string]int{}
+	for column, names := range importCsvColumns {
+		for _, name := range names {
+			if i, ok := positions[name]; ok {
+				columns[column] = i
+				break
+			}
+		}
+	}
+	// our own export has the short url in the url column, the destination is in destination_url
+	ownExport := false
+	if _, ok := positions["destination_url"]; ok {
+		if i, ok := positions["url"]; ok {
+			columns["short_url"] = i
+			ownExport = true
+		}
+	}
+	if _, ok := columns["destination_url"]; !ok {
+		return nil, errors.New(ImportCsvMissingColumnError)
+	}
+
+	rows := []ImportShortUrlRow{}
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if len(rows) >= MaxShortUrlImportRows {
+			return nil, errors.New(ImportTooManyRowsError)
+		}
+		var parseError *csv.ParseError
+		if errors.As(err, &parseError) {
+			rows = append(rows, ImportShortUrlRow{Errors: []string{err.Error()}})
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		rows = append(rows, newImportShortUrlCsvRow(columns, record, ownExport))
+	}
+	return rows, nil
+}
+
+// newImportShortUrlCsvRow reads a csv record, an empty expiry in our own export means the short url never expires
+func newImportShortUrlCsvRow(columns map[string]int, record []string, ownExport bool) ImportShortUrlRow {
+	row := ImportShortUrlRow{}
+	value := func(column string) string {
+		i, ok := columns[column]
+		if !ok || i >= len(record) {
+			return ""
+		}
+		return strings.TrimSpace(record[i])
+	}
+	optionalString := func(column string) *string {
+		v := value(column)
+		if v == "" {
+			return nil
+		}
+		return &v
+	}
+	optionalInt := func(column string) *int {
+		v := value(column)
+		if v == "" {
+			return nil
+		}
+		i, err := strconv.Atoi(v)
+		if err != nil {
+			row.Errors = append(row.Errors, fmt.Sprintf("`%s` must be a whole number", column))
+			return nil
+		}
+		return &i
+	}
+	optionalTime := func(column string) *time.Time {
+		v := value(column)
+		if v == "" {
+			return nil
+		}
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			row.Errors = append(row.Errors, fmt.Sprintf("`%s` must be an RFC 3339 timestamp", column))
+			return nil
+		}
+		return &t
+	}
+	optionalBool := func(column string) bool {
+		v := value(column)
+		if v == "" {
+			return false
+		}
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			row.Errors = append(row.Errors, fmt.Sprintf("`%s` must be true or false", column))
+		}
+		return b
+	}
+
+	req := &row.Request
+	req.DestinationUrl = value("destination_url")
+	req.Slug = optionalString("slug")
+	if req.Slug == nil {
+		req.Slug = slugFromShortUrl(value("short_url"))
+	}
+	if v := value("ttl"); v != "" {
+		ttl, err := strconv.ParseUint(v, 10, 32)
+		if err != nil {
+			row.Errors = append(row.Errors, "`ttl` must be a whole number of seconds")
+		} else {
+			ttlSeconds := uint32(ttl)
+			req.TTL = &ttlSeconds
+		}
+	}
+	if req.TTL == nil {
+		expiresAt := optionalTime("expires_at")
+		req.TTL, row.Errors = ttlFromExpiresAt(expiresAt, row.Errors)
+		_, hasExpiresAt := columns["expires_at"]
+		row.ExportedNeverExpires = ownExport && hasExpiresAt && value("expires_at") == ""
+	}
+	req.MaxClicks = optionalInt("max_clicks")
+	req.ActivatesAt = optionalTime("activates_at")
+	req.RedirectType = optionalInt("redirect_type")
+	req.ForcePreview = optionalBool("force_preview")
+	req.QueryPassthrough = optionalBool("query_passthrough")
+	req.PathPassthrough = optionalBool("path_passthrough")
+	req.UtmSource = optionalString("utm_source")
+	req.UtmMedium = optionalString("utm_medium")
+	req.UtmCampaign = optionalString("utm_campaign")
+	for _, name := range strings.Split(value("tags"), ";") {
+		if name = strings.TrimSpace(name); name != "" {
+			row.TagNames = append(row.TagNames, name)
+		}
+	}
+	return row
+}
+
+// slugFromShortUrl takes the last part of the path, e.g. abc from https://bit.ly/abc
+func slugFromShortUrl(shortUrl string) *string {
+	if shortUrl == "" {
+		return nil
+	}
+	if !strings.Contains(shortUrl, "://") {
+		shortUrl = "https://" + shortUrl
+	}
+	u, err := url.Parse(shortUrl)
+	if err != nil {
+		return nil
+	}
+	slug := path.Base(strings.TrimSuffix(u.Path, "/"))
+	if slug == "." || slug == "/" || slug == "" {
+		return nil
+	}
+	return &slug
+}
+
+// ttlFromExpiresAt turns the expiry of an exported short url into a ttl from now, nil leaves the default ttl
+func ttlFromExpiresAt(expiresAt *time.Time, errs []string) (*uint32, []string) {
+	if expiresAt == nil {
+		return nil, errs
+	}
+	seconds := math.Ceil(time.Until(*expiresAt).Seconds())
+	if seconds <= 0 {
+		return nil, append(errs, ImportExpiresAtInThePastError)
+	}
+	ttl := uint32(min(seconds, math.MaxUint32))
+	return &ttl, errs
+}
+
+func newImportShortUrlJsonRow(item ImportShortUrlItem) ImportShortUrlRow {
+	row := ImportShortUrlRow{Request: item.PostShortUrlRequest}
+	for _, t := range item.Tags {
+		row.TagNames = append(row.TagNames, t.Name)
+	}
+	if row.Request.TTL == nil {
+		row.Request.TTL, row.Errors = ttlFromExpiresAt(item.ExpiresAt, row.Errors)
+	}
+	return row
+}
+
+// parseShortUrlImportJson reads the array one element at a time, a row that doesn't decode stops the whole file
+func parseShortUrlImportJson(r io.Reader) ([]ImportShortUrlRow, error) {
+	decoder := json.NewDecoder(r)
+	token, err := decoder.Token()
+	if err != nil {
+		return nil, fmt.Errorf("couldn't read the json array: %s", err.Error())
+	}
+	if delim, ok := token.(json.Delim); !ok || delim != '[' {
+		return nil, errors.New("the json import must be an array of short urls")
+	}
+
+	rows := []ImportShortUrlRow{}
+	for decoder.More() {
+		if len(rows) >= MaxShortUrlImportRows {
+			return nil, errors.New(ImportTooManyRowsError)
+		}
+		var item ImportShortUrlItem
+		if err = decoder.Decode(&item); err != nil {
+			return nil, fmt.Errorf("couldn't read the short url at index %d: %s", len(rows), err.Error())
+		}
+		rows = append(rows, newImportShortUrlJsonRow(item))
+	}
+	if _, err = decoder.Token(); err != nil {
+		return nil, fmt.Errorf("couldn't read the end of the json array: %s", err.Error())
+	}
+	return rows, nil
+}
+
+// parseShortUrlImportNdjson skips blank lines, a line that doesn't decode only fails that row
+func parseShortUrlImportNdjson(r io.Reader) ([]ImportShortUrlRow, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), importNdjsonMaxLineSize)
+
+	rows := []ImportShortUrlRow{}
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		if len(rows) >= MaxShortUrlImportRows {
+			return nil, errors.New(ImportTooManyRowsError)
+		}
+
+		var item ImportShortUrlItem
+		if err := json.Unmarshal(line, &item); err != nil {
+			rows = append(rows, ImportShortUrlRow{Errors: []string{fmt.Sprintf("couldn't read the line: %s", err.Error())}})
+			continue
+		}
+		rows = append(rows, newImportShortUrlJsonRow(item))
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+// ImportShortUrls creates the rows for the user in a single transaction under the idempotency key, the same way as PostShortUrlBatch.
+// Rows that can't be read or fail validation are reported and the rest are still created.
+func (h *ApiShortUrlHandler) ImportShortUrls(ctx context.Context, userId uuid.UUID, rows []ImportShortUrlRow, idempotencyKey uuid.UUID, dryRun bool) (ImportShortUrlsResponse, error) {
+	tagIds, err := h.importTagIds(ctx, userId, rows)
+	if err != nil {
+		return ImportShortUrlsResponse{}, err
+	}
+
+	reqs := make([]PostShortUrlRequest, len(rows))
+	results := make([]ShortUrlBatchItemResponse, len(rows))
+	for i, row := range rows {
+		reqs[i] = row.Request
+		if row.ExportedNeverExpires && h.Config.ShortUrlTtl.AllowNonExpiring {
+			reqs[i].NeverExpires = true
+		}
+		for _, name := range row.TagNames {
+			id, ok := tagIds[strings.ToLower(name)]
+			if !ok {
+				row.Errors = append(row.Errors, fmt.Sprintf(ImportUnknownTagError, name))
+				continue
+			}
+			if reqs[i].TagIds == nil {
+				reqs[i].TagIds = &[]uuid.UUID{}
+			}
+			*reqs[i].TagIds = append(*reqs[i].TagIds, id)
+		}
+		if len(row.Errors) > 0 {
+			results[i] = ShortUrlBatchItemResponse{Index: i, StatusCode: http.StatusBadRequest, Errors: row.Errors}
+		}
+	}
+
+	err = h.createShortUrlItems(ctx, userId, reqs, results, idempotencyKey, dryRun)
+	if err != nil {
+		return ImportShortUrlsResponse{}, err
+	}
+
+	successCode := http.StatusCreated
+	if dryRun {
+		successCode = http.StatusOK
+	}
+	createdCount := countShortUrlBatchResults(results, successCode)
+	failedCount := len(results) - createdCount
+	return ImportShortUrlsResponse{DryRun: dryRun, Items: results, Created: &createdCount, Failed: &failedCount}, nil
+}
+
+// importTagIds looks up the user's tags by lower case name, only when a row has tags
+func (h *ApiShortUrlHandler) importTagIds(ctx context.Context, userId uuid.UUID, rows []ImportShortUrlRow) (map[string]uuid.UUID, error) {
+	tagIds := map[string]uuid.UUID{}
+	if !slices.ContainsFunc(rows, func(row ImportShortUrlRow) bool { return len(row.TagNames) > 0 }) {
+		return tagIds, nil
+	}
+
+	tags, err := h.Db.GetTagsByUserId(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+	for _, t := range tags {
+		tagIds[strings.ToLower(t.Name)] = t.Id
+	}
+	return tagIds, nil
+}
+
+// PostShortUrlImport takes the file as the request body, the format comes from the format query parameter or the Content-Type.
+// The dry_run query parameter checks every row, including for taken slugs, without creating anything.
+func (h *ApiShortUrlHandler) PostShortUrlImport(w http.ResponseWriter, r *http.Request) {
+	userIdValue := r.Context().Value(UserIdKey)
+	userIdUuid, ok := userIdValue.(uuid.UUID)
+	if !ok {
+		EncodeResponse[types.ErrorResponse](h.Logger, r.Context(), w, http.StatusInternalServerError, types.ErrorResponse{Errors: []string{"Something is wrong with the server. Please try again later"}})
+		h.Logger.Error(r.Context(), "casting uuid from context not ok")
+		return
+	}
+
+	idempotencyKeyString := r.Header.Get(types.HeadersIdempotencyKey)
+	idempotencyKey, err := uuid.Parse(idempotencyKeyString)
+	if err != nil {
+		EncodeResponse[types.ErrorResponse](h.Logger, r.Context(), w, http.StatusBadRequest, types.ErrorResponse{Errors: []string{"idempotency key provided is not a valid UUID"}})
+		return
+	}
+
+	query := r.URL.Query()
+	errs := []string{}
+	format := strings.ToLower(strings.TrimSpace(query.Get("format")))
+	if format == "" {
+		format = ImportFormatFromContentType(r.Header.Get(types.HeadersContentTypeKey))
+	}
+	if _, ok := exportContentTypes[format]; !ok {
+		errs = append(errs, ImportFormatQueryParamError)
+	}
+	dryRun, ok := parseBoolQueryParam(query.Get("dry_run"))
+	if !ok {
+		errs = append(errs, ImportDryRunQueryParamError)
+	}
+	if len(errs) > 0 {
+		EncodeResponse[types.ErrorResponse](h.Logger, r.Context(), w, http.StatusBadRequest, types.ErrorResponse{Errors: errs})
+		return
+	}
+
+	rows, err := ParseShortUrlImport(http.MaxBytesReader(w, r.Body, MaxShortUrlImportSize), format)
+	if err != nil {
+		var maxBytesError *http.MaxBytesError
+		if errors.As(err, &maxBytesError) {
+			EncodeResponse[types.ErrorResponse](h.Logger, r.Context(), w, http.StatusRequestEntityTooLarge, types.ErrorResponse{Errors: []string{ImportTooLargeError}})
+			return
+		}
+		EncodeResponse[types.ErrorResponse](h.Logger, r.Context(), w, http.StatusBadRequest, types.ErrorResponse{Errors: []string{err.Error()}})
+		return
+	}
+
+	resp, err := h.ImportShortUrls(r.Context(), userIdUuid, rows, idempotencyKey, dryRun)
+	if err != nil {
+		var idempotencyKeyUsedError *types.DuplicateIdempotencyKeyError
+		if errors.As(err, &idempotencyKeyUsedError) {
+			EncodeResponse[types.ErrorResponse](h.Logger, r.Context(), w, http.StatusBadRequest, types.ErrorResponse{Errors: []string{fmt.Sprintf("%s header value has already been used", types.HeadersIdempotencyKey)}})
+			h.Logger.Error(r.Context(), err.Error())
+			return
+		}
+
+		EncodeResponse[types.ErrorResponse](h.Logger, r.Context(), w, http.StatusInternalServerError, types.ErrorResponse{Errors: []string{"Something is wrong with the server. Please try again later"}})
+		h.Logger.Error(r.Context(), err.Error())
+		return
+	}
+
+	EncodeResponse[ImportShortUrlsResponse](h.Logger, r.Context(), w, http.StatusOK, resp)
+	h.Logger.Debug(r.Context(), "PostShortUrlImport imported short urls", "format", format, "dryRun", dryRun, "created", *resp.Created, "failed", *resp.Failed)
+}
@@ -0,0 +1,108 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/amieldelatorre/shurl/internal/types"
+	"github.com/amieldelatorre/shurl/internal/utils"
+	"github.com/go-playground/validator/v10"
+	"github.com/google/uuid"
+)
+
+type RenewShortUrlRequest struct {
+	// seconds from now, or from activation for scheduled short urls. Defaults to the authenticated default ttl
+	TTL          *uint32 `json:"ttl,omitempty" validate:"omitnil,min=900"`
+	NeverExpires bool    `json:"never_expires,omitempty"` // when the server allows short urls that never expire
+}
+
+// RenewById pushes the expiry of a short url out to ttl seconds from now, expired short urls can be renewed too.
+// A renewal never brings the expiry closer, renewing a short url that already expires later than that leaves it as is.
+// The body is optional
+func (h *ApiShortUrlHandler) RenewById(w http.ResponseWriter, r *http.Request) {
+	var req RenewShortUrlRequest
+
+	userIdValue := r.Context().Value(UserIdKey)
+	userIdUuid, ok := userIdValue.(uuid.UUID)
+	if !ok {
+		EncodeResponse[types.ErrorResponse](h.Logger, r.Context(), w, http.StatusInternalServerError, types.ErrorResponse{Errors: []string{"Something is wrong with the server. Please try again later"}})
+		h.Logger.Error(r.Context(), "casting uuid from context not ok")
+		return
+	}
+
+	shortUrlIdStr := strings.TrimSpace(r.PathValue("shortUrlId"))
+	shortUrlId, err := uuid.Parse(shortUrlIdStr)
+	if err != nil {
+		EncodeResponse[types.ErrorResponse](h.Logger, r.Context(), w, http.StatusBadRequest, types.ErrorResponse{Errors: []string{"Short url id provided is not a valid uuid"}})
+		return
+	}
+
+	err = json.NewDecoder(r.Body).Decode(&req)
+	if err != nil && !errors.Is(err, io.EOF) {
+		errorCode, message := parseJsonDecodeError(err)
+		EncodeResponse[types.ErrorResponse](h.Logger, r.Context(), w, errorCode, types.ErrorResponse{Errors: []string{message}})
+		if errorCode == http.StatusInternalServerError {
+			h.Logger.Error(r.Context(), "Server error when parsing json body. error: %v", "error", err.Error())
+		}
+		return
+	}
+
+	validate, err := utils.GetValidator()
+	if err != nil {
+		EncodeResponse[types.ErrorResponse](h.Logger, r.Context(), w, http.StatusInternalServerError, types.ErrorResponse{Errors: []string{"Something is wrong with the server. Please try again later"}})
+		h.Logger.Error(r.Context(), err.Error())
+		return
+	}
+	var validationError validator.ValidationErrors
+	err = validate.Struct(&req)
+	if err != nil {
+		if errors.As(err, &validationError) {
+			EncodeResponse[types.ShortUrlResponse](h.Logger, r.Context(), w, http.StatusBadRequest, types.ShortUrlResponse{Errors: EncodeValidationError(validationError)})
+			return
+		}
+		EncodeResponse[types.ErrorResponse](h.Logger, r.Context(), w, http.StatusInternalServerError, types.ErrorResponse{Errors: []string{"Something is wrong with the server. Please try again later"}})
+		h.Logger.Error(r.Context(), err.Error())
+		return
+	}
+
+	var shortUrl *types.ShortUrl
+	if req.NeverExpires {
+		if req.TTL != nil {
+			EncodeResponse[types.ErrorResponse](h.Logger, r.Context(), w, http.StatusBadRequest, types.ErrorResponse{Errors: []string{NeverExpiresWithTtlError}})
+			return
+		}
+		if !h.Config.ShortUrlTtl.AllowNonExpiring {
+			EncodeResponse[types.ErrorResponse](h.Logger, r.Context(), w, http.StatusBadRequest, types.ErrorResponse{Errors: []string{NeverExpiresNotAllowedError}})
+			return
+		}
+		shortUrl, err = h.Db.SetShortUrlNeverExpires(r.Context(), userIdUuid, shortUrlId)
+	} else {
+		defaultTtl, maxTtl := h.ttlLimits(userIdUuid)
+		ttl := defaultTtl
+		if req.TTL != nil {
+			ttl = *req.TTL
+		}
+		if ttl > maxTtl {
+			EncodeResponse[types.ErrorResponse](h.Logger, r.Context(), w, http.StatusBadRequest, types.ErrorResponse{Errors: []string{fmt.Sprintf("`ttl` can only be up to %d seconds", maxTtl)}})
+			return
+		}
+		shortUrl, err = h.Db.RenewShortUrl(r.Context(), userIdUuid, shortUrlId, time.Duration(ttl)*time.Second)
+	}
+	if err != nil {
+		EncodeResponse[types.ErrorResponse](h.Logger, r.Context(), w, http.StatusInternalServerError, types.ErrorResponse{Errors: []string{"Something is wrong with the server. Please try again later"}})
+		h.Logger.Error(r.Context(), err.Error())
+		return
+	}
+
+	if shortUrl == nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	EncodeResponse[types.ShortUrlResponse](h.Logger, r.Context(), w, http.StatusOK, newShortUrlResponse(shortUrl, h.BaseUrl))
+}
@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/amieldelatorre/shurl/internal/types"
+	"github.com/google/uuid"
+)
+
+// GetTrash lists the short urls the user has deleted that haven't been purged yet, the most recently deleted first.
+// It takes the same page and size parameters as GetShortUrls.
+func (h *ApiShortUrlHandler) GetTrash(w http.ResponseWriter, r *http.Request) {
+	userIdValue := r.Context().Value(UserIdKey)
+	userIdUuid, ok := userIdValue.(uuid.UUID)
+	if !ok {
+		EncodeResponse[types.ErrorResponse](h.Logger, r.Context(), w, http.StatusInternalServerError, types.ErrorResponse{Errors: []string{"Something is wrong with the server. Please try again later"}})
+		h.Logger.Error(r.Context(), "casting uuid from context not ok")
+		return
+	}
+
+	params := r.URL.Query()
+
+	pageStr := strings.TrimSpace(params.Get("page"))
+	if pageStr == "" {
+		pageStr = DefaultPageQueryParam
+	}
+	page, err := strconv.Atoi(pageStr)
+	if err != nil || page < 1 {
+		EncodeResponse[GetShortUrlsByUserIdResponse](h.Logger, r.Context(), w, http.StatusBadRequest, GetShortUrlsByUserIdResponse{Errors: []string{PageQueryParamError}})
+		return
+	}
+
+	sizeStr := strings.TrimSpace(params.Get("size"))
+	if sizeStr == "" {
+		sizeStr = DefaultSizeQueryParam
+	}
+	size, err := strconv.Atoi(sizeStr)
+	if err != nil || size < 1 || size > 50 {
+		EncodeResponse[GetShortUrlsByUserIdResponse](h.Logger, r.Context(), w, http.StatusBadRequest, GetShortUrlsByUserIdResponse{Errors: []string{SizeQueryParamError}})
+		return
+	}
+
+	trash, err := h.Db.GetDeletedShortUrlsByUserId(r.Context(), userIdUuid, types.ShortUrlPage{Size: size, Offset: (page - 1) * size, WithTotal: true})
+	if err != nil {
+		EncodeResponse[types.ErrorResponse](h.Logger, r.Context(), w, http.StatusInternalServerError, types.ErrorResponse{Errors: []string{"Something is wrong with the server. Please try again later"}})
+		h.Logger.Error(r.Context(), err.Error())
+		return
+	}
+
+	resp := shortUrlToResponse(trash, h.BaseUrl, types.ShortUrlFilter{}, &page, size)
+	EncodeResponse[GetShortUrlsByUserIdResponse](h.Logger, r.Context(), w, http.StatusOK, resp)
+}
+
+// RestoreById takes a short url out of the trash, it comes back with the same slug and keeps its clicks, tags and expiry
+func (h *ApiShortUrlHandler) RestoreById(w http.ResponseWriter, r *http.Request) {
+	userIdValue := r.Context().Value(UserIdKey)
+	userIdUuid, ok := userIdValue.(uuid.UUID)
+	if !ok {
+		EncodeResponse[types.ErrorResponse](h.Logger, r.Context(), w, http.StatusInternalServerError, types.ErrorResponse{Errors: []string{"Something is wrong with the server. Please try again later"}})
+		h.Logger.Error(r.Context(), "casting uuid from context not ok")
+		return
+	}
+
+	shortUrlIdStr := strings.TrimSpace(r.PathValue("shortUrlId"))
+	shortUrlId, err := uuid.Parse(shortUrlIdStr)
+	if err != nil {
+		EncodeResponse[types.ErrorResponse](h.Logger, r.Context(), w, http.StatusBadRequest, types.ErrorResponse{Errors: []string{"Short url id provided is not a valid uuid"}})
+		return
+	}
+
+	shortUrl, err := h.Db.RestoreShortUrl(r.Context(), userIdUuid, shortUrlId)
+	if err != nil {
+		EncodeResponse[types.ErrorResponse](h.Logger, r.Context(), w, http.StatusInternalServerError, types.ErrorResponse{Errors: []string{"Something is wrong with the server. Please try again later"}})
+		h.Logger.Error(r.Context(), err.Error())
+		return
+	}
+
+	// also covers short urls that exist but aren't in the trash
+	if shortUrl == nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	EncodeResponse[types.ShortUrlResponse](h.Logger, r.Context(), w, http.StatusOK, newShortUrlResponse(shortUrl, h.BaseUrl))
+}
@@ -0,0 +1,206 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/amieldelatorre/shurl/internal/db"
+	"github.com/amieldelatorre/shurl/internal/types"
+	"github.com/amieldelatorre/shurl/internal/utils"
+	"github.com/go-playground/validator/v10"
+	"github.com/google/uuid"
+)
+
+type ApiTagHandler struct {
+	Logger utils.CustomJsonLogger
+	Db     db.DbContext
+}
+
+func NewApiTagHandler(logger utils.CustomJsonLogger, dbContext db.DbContext) ApiTagHandler {
+	return ApiTagHandler{Logger: logger, Db: dbContext}
+}
+
+type PostTagRequest struct {
+	Name string `json:"name" validate:"required,max=64"`
+}
+
+type TagResponse struct {
+	Id        *uuid.UUID `json:"id,omitempty"`
+	Name      *string    `json:"name,omitempty"`
+	CreatedAt *time.Time `json:"created_at,omitempty"`
+	Errors    []string   `json:"errors,omitempty"`
+}
+
+type GetTagsResponse struct {
+	Items  []TagResponse `json:"items"`
+	Errors []string      `json:"errors,omitempty"`
+}
+
+func newTagResponse(t *types.Tag) TagResponse {
+	return TagResponse{Id: &t.Id, Name: &t.Name, CreatedAt: &t.CreatedAt}
+}
+
+func (h *ApiTagHandler) GetTags(w http.ResponseWriter, r *http.Request) {
+	userIdValue := r.Context().Value(UserIdKey)
+	userIdUuid, ok := userIdValue.(uuid.UUID)
+	if !ok {
+		EncodeResponse[types.ErrorResponse](h.Logger, r.Context(), w, http.StatusInternalServerError, types.ErrorResponse{Errors: []string{"Something is wrong with the server. Please try again later"}})
+		h.Logger.Error(r.Context(), "casting uuid from context not ok")
+		return
+	}
+
+	tags, err := h.Db.GetTagsByUserId(r.Context(), userIdUuid)
+	if err != nil {
+		EncodeResponse[types.ErrorResponse](h.Logger, r.Context(), w, http.StatusInternalServerError, types.ErrorResponse{Errors: []string{"Something is wrong with the server. Please try again later"}})
+		h.Logger.Error(r.Context(), err.Error())
+		return
+	}
+
+	resp := GetTagsResponse{Items: []TagResponse{}}
+	for i := range tags {
+		resp.Items = append(resp.Items, newTagResponse(&tags[i]))
+	}
+	EncodeResponse[GetTagsResponse](h.Logger, r.Context(), w, http.StatusOK, resp)
+}
+
+// PostTag doesn't need an idempotency key, creating the same tag twice is a conflict
+func (h *ApiTagHandler) PostTag(w http.ResponseWriter, r *http.Request) {
+	userIdValue := r.Context().Value(UserIdKey)
+	userIdUuid, ok := userIdValue.(uuid.UUID)
+	if !ok {
+		EncodeResponse[types.ErrorResponse](h.Logger, r.Context(), w, http.StatusInternalServerError, types.ErrorResponse{Errors: []string{"Something is wrong with the server. Please try again later"}})
+		h.Logger.Error(r.Context(), "casting uuid from context not ok")
+		return
+	}
+
+	var req PostTagRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		errorCode, message := parseJsonDecodeError(err)
+		EncodeResponse[types.ErrorResponse](h.Logger, r.Context(), w, errorCode, types.ErrorResponse{Errors: []string{message}})
+		if errorCode == http.StatusInternalServerError {
+			h.Logger.Error(r.Context(), "Server error when parsing json body. error: %v", "error", err.Error())
+		}
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+
+	validate, err := utils.GetValidator()
+	if err != nil {
+		EncodeResponse[types.ErrorResponse](h.Logger, r.Context(), w, http.StatusInternalServerError, types.ErrorResponse{Errors: []string{"Something is wrong with the server. Please try again later"}})
+		h.Logger.Error(r.Context(), err.Error())
+		return
+	}
+	var validationError validator.ValidationErrors
+	err = validate.Struct(&req)
+	if err != nil {
+		if errors.As(err, &validationError) {
+			EncodeResponse[TagResponse](h.Logger, r.Context(), w, http.StatusBadRequest, TagResponse{Errors: EncodeValidationError(validationError)})
+			return
+		}
+		EncodeResponse[types.ErrorResponse](h.Logger, r.Context(), w, http.StatusInternalServerError, types.ErrorResponse{Errors: []string{"Something is wrong with the server. Please try again later"}})
+		h.Logger.Error(r.Context(), err.Error())
+		return
+	}
+
+	id, err := uuid.NewV7()
+	if err != nil {
+		EncodeResponse[types.ErrorResponse](h.Logger, r.Context(), w, http.StatusInternalServerError, types.ErrorResponse{Errors: []string{"Something is wrong with the server. Please try again later"}})
+		h.Logger.Error(r.Context(), err.Error())
+		return
+	}
+
+	tag, err := h.Db.CreateTag(r.Context(), types.CreateTag{Id: id, UserId: userIdUuid, Name: req.Name})
+	if err != nil {
+		var tagExistsError *types.TagExistsError
+		if errors.As(err, &tagExistsError) {
+			EncodeResponse[types.ErrorResponse](h.Logger, r.Context(), w, http.StatusConflict, types.ErrorResponse{Errors: []string{fmt.Sprintf("tag '%s' already exists", req.Name)}})
+			return
+		}
+
+		EncodeResponse[types.ErrorResponse](h.Logger, r.Context(), w, http.StatusInternalServerError, types.ErrorResponse{Errors: []string{"Something is wrong with the server. Please try again later"}})
+		h.Logger.Error(r.Context(), err.Error())
+		return
+	}
+
+	EncodeResponse[TagResponse](h.Logger, r.Context(), w, http.StatusCreated, newTagResponse(tag))
+	h.Logger.Debug(r.Context(), "PostTag created tag", "tagId", tag.Id, "responseStatusCode", 201)
+}
+
+// DeleteById removes the tag from every short url that has it
+func (h *ApiTagHandler) DeleteById(w http.ResponseWriter, r *http.Request) {
+	userIdValue := r.Context().Value(UserIdKey)
+	userIdUuid, ok := userIdValue.(uuid.UUID)
+	if !ok {
+		EncodeResponse[types.ErrorResponse](h.Logger, r.Context(), w, http.StatusInternalServerError, types.ErrorResponse{Errors: []string{"Something is wrong with the server. Please try again later"}})
+		h.Logger.Error(r.Context(), "casting uuid from context not ok")
+		return
+	}
+
+	tagId, err := uuid.Parse(strings.TrimSpace(r.PathValue("tagId")))
+	if err != nil {
+		EncodeResponse[types.ErrorResponse](h.Logger, r.Context(), w, http.StatusBadRequest, types.ErrorResponse{Errors: []string{"Tag id provided is not a valid uuid"}})
+		return
+	}
+
+	delRes, err := h.Db.DeleteTag(r.Context(), userIdUuid, tagId)
+	if err != nil {
+		EncodeResponse[types.ErrorResponse](h.Logger, r.Context(), w, http.StatusInternalServerError, types.ErrorResponse{Errors: []string{"Something is wrong with the server. Please try again later"}})
+		h.Logger.Error(r.Context(), err.Error())
+		return
+	}
+
+	if !delRes.Found {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// AddToShortUrl is a PUT, adding a tag the short url already has is still a success
+func (h *ApiTagHandler) AddToShortUrl(w http.ResponseWriter, r *http.Request) {
+	h.changeShortUrlTag(w, r, h.Db.AddShortUrlTag)
+}
+
+func (h *ApiTagHandler) RemoveFromShortUrl(w http.ResponseWriter, r *http.Request) {
+	h.changeShortUrlTag(w, r, h.Db.RemoveShortUrlTag)
+}
+
+func (h *ApiTagHandler) changeShortUrlTag(w http.ResponseWriter, r *http.Request, change func(ctx context.Context, userId uuid.UUID, shortUrlId uuid.UUID, tagId uuid.UUID) (bool, error)) {
+	userIdValue := r.Context().Value(UserIdKey)
+	userIdUuid, ok := userIdValue.(uuid.UUID)
+	if !ok {
+		EncodeResponse[types.ErrorResponse](h.Logger, r.Context(), w, http.StatusInternalServerError, types.ErrorResponse{Errors: []string{"Something is wrong with the server. Please try again later"}})
+		h.Logger.Error(r.Context(), "casting uuid from context not ok")
+		return
+	}
+
+	shortUrlId, err := uuid.Parse(strings.TrimSpace(r.PathValue("shortUrlId")))
+	if err != nil {
+		EncodeResponse[types.ErrorResponse](h.Logger, r.Context(), w, http.StatusBadRequest, types.ErrorResponse{Errors: []string{"Short url id provided is not a valid uuid"}})
+		return
+	}
+	tagId, err := uuid.Parse(strings.TrimSpace(r.PathValue("tagId")))
+	if err != nil {
+		EncodeResponse[types.ErrorResponse](h.Logger, r.Context(), w, http.StatusBadRequest, types.ErrorResponse{Errors: []string{"Tag id provided is not a valid uuid"}})
+		return
+	}
+
+	found, err := change(r.Context(), userIdUuid, shortUrlId, tagId)
+	if err != nil {
+		EncodeResponse[types.ErrorResponse](h.Logger, r.Context(), w, http.StatusInternalServerError, types.ErrorResponse{Errors: []string{"Something is wrong with the server. Please try again later"}})
+		h.Logger.Error(r.Context(), err.Error())
+		return
+	}
+
+	if !found {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,258 @@
+package handlers
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/amieldelatorre/shurl/internal/types"
+	"github.com/google/uuid"
+	"github.com/skip2/go-qrcode"
+)
+
+const (
+	QrCodeFormatQueryParamError          = "Invalid format value, must be one of `png` or `svg`"
+	QrCodeSizeQueryParamError            = "Invalid size value, must be a number greater than or equal to 64 and less than or equal to 2048"
+	QrCodeMarginQueryParamError          = "Invalid margin value, must be a number greater than or equal to 0 and less than or equal to 16"
+	QrCodeErrorCorrectionQueryParamError = "Invalid error_correction value, must be one of `L`, `M`, `Q` or `H`"
+	QrCodeTooSmallError                  = "The size is too small to fit the qr code, increase the size or decrease the margin"
+	DefaultQrCodeFormat                  = "png"
+	DefaultQrCodeSize                    = 256
+	MinQrCodeSize                        = 64
+	MaxQrCodeSize                        = 2048
+	DefaultQrCodeMargin                  = 4 // the quiet zone recommended by the qr code spec
+	MaxQrCodeMargin                      = 16
+	DefaultQrCodeErrorCorrection         = "M"
+)
+
+var (
+	qrCodeErrorCorrectionLevels = map[string]qrcode.RecoveryLevel{
+		"L": qrcode.Low,
+		"M": qrcode.Medium,
+		"Q": qrcode.High,
+		"H": qrcode.Highest,
+	}
+	errQrCodeTooSmall = errors.New("qr code does not fit in the requested size")
+)
+
+type qrCodeOptions struct {
+	Format          string
+	Size            int
+	Margin          int
+	ErrorCorrection qrcode.RecoveryLevel
+}
+
+// parseQrCodeOptions reads the format, size, margin and error_correction query parameters, falling back to the defaults when they are missing
+func parseQrCodeOptions(r *http.Request) (qrCodeOptions, []string) {
+	query := r.URL.Query()
+	errs := []string{}
+	opts := qrCodeOptions{
+		Format:          DefaultQrCodeFormat,
+		Size:            DefaultQrCodeSize,
+		Margin:          DefaultQrCodeMargin,
+		ErrorCorrection: qrCodeErrorCorrectionLevels[DefaultQrCodeErrorCorrection],
+	}
+
+	if format := strings.ToLower(strings.TrimSpace(query.Get("format"))); format != "" {
+		if format != "png" && format != "svg" {
+			errs = append(errs, QrCodeFormatQueryParamError)
+		}
+		opts.Format = format
+	}
+
+	if sizeStr := strings.TrimSpace(query.Get("size")); sizeStr != "" {
+		size, err := strconv.Atoi(sizeStr)
+		if err != nil || size < MinQrCodeSize || size > MaxQrCodeSize {
+			errs = append(errs, QrCodeSizeQueryParamError)
+		}
+		opts.Size = size
+	}
+
+	if marginStr := strings.TrimSpace(query.Get("margin")); marginStr != "" {
+		margin, err := strconv.Atoi(marginStr)
+		if err != nil || margin < 0 || margin > MaxQrCodeMargin {
+			errs = append(errs, QrCodeMarginQueryParamError)
+		}
+		opts.Margin = margin
+	}
+
+	if levelStr := strings.ToUpper(strings.TrimSpace(query.Get("error_correction"))); levelStr != "" {
+		level, ok := qrCodeErrorCorrectionLevels[levelStr]
+		if !ok {
+			errs = append(errs, QrCodeErrorCorrectionQueryParamError)
+		}
+		opts.ErrorCorrection = level
+	}
+
+	return opts, errs
+}
+
+// renderQrCode returns the encoded image and its content type. Margin is in modules, size is the width and height of the whole image in pixels
+func renderQrCode(content string, opts qrCodeOptions) ([]byte, string, error) {
+	q, err := qrcode.New(content, opts.ErrorCorrection)
+	if err != nil {
+		return nil, "", err
+	}
+	// The library's border is always 4 modules, the margin is added when drawing instead
+	q.DisableBorder = true
+	bitmap := q.Bitmap()
+
+	modules := len(bitmap) + 2*opts.Margin
+	if opts.Format == "svg" {
+		return renderQrCodeSvg(bitmap, modules, opts), "image/svg+xml", nil
+	}
+
+	// Whole pixels per module keep the edges sharp, the leftover pixels are split around the code
+	scale := opts.Size / modules
+	if scale < 1 {
+		return nil, "", errQrCodeTooSmall
+	}
+	offset := (opts.Size-scale*modules)/2 + opts.Margin*scale
+
+	img := image.NewPaletted(image.Rect(0, 0, opts.Size, opts.Size), color.Palette{color.White, color.Black})
+	for y, row := range bitmap {
+		for x, dark := range row {
+			if !dark {
+				continue
+			}
+			for py := 0; py < scale; py++ {
+				for px := 0; px < scale; px++ {
+					img.SetColorIndex(offset+x*scale+px, offset+y*scale+py, 1)
+				}
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	err = png.Encode(&buf, img)
+	if err != nil {
+		return nil, "", err
+	}
+	return buf.Bytes(), "image/png", nil
+}
+
+// renderQrCodeSvg draws every dark module as part of a single path in a viewBox measured in modules, so it scales without blurring
+func renderQrCodeSvg(bitmap [][]bool, modules int, opts qrCodeOptions) []byte {
+	var path strings.Builder
+	for y, row := range bitmap {
+		for x, dark := range row {
+			if dark {
+				fmt.Fprintf(&path, "M%d %dh1v1h-1z", x+opts.Margin, y+opts.Margin)
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" shape-rendering="crispEdges">`, opts.Size, opts.Size, modules, modules)
+	fmt.Fprintf(&buf, `<rect width="%d" height="%d" fill="#ffffff"/>`, modules, modules)
+	fmt.Fprintf(&buf, `<path d="%s" fill="#000000"/>`, path.String())
+	buf.WriteString("</svg>")
+	return buf.Bytes()
+}
+
+func (h *ApiShortUrlHandler) GetQrCodeById(w http.ResponseWriter, r *http.Request) {
+	userIdValue := r.Context().Value(UserIdKey)
+	userIdUuid, ok := userIdValue.(uuid.UUID)
+	if !ok {
+		EncodeResponse[types.ErrorResponse](h.Logger, r.Context(), w, http.StatusInternalServerError, types.ErrorResponse{Errors: []string{"Something is wrong with the server. Please try again later"}})
+		h.Logger.Error(r.Context(), "casting uuid from context not ok")
+		return
+	}
+
+	shortUrlIdStr := strings.TrimSpace(r.PathValue("shortUrlId"))
+	shortUrlid, err := uuid.Parse(shortUrlIdStr)
+	if err != nil {
+		EncodeResponse[types.ErrorResponse](h.Logger, r.Context(), w, http.StatusBadRequest, types.ErrorResponse{Errors: []string{"Short url id provided is not a valid uuid"}})
+		return
+	}
+
+	opts, errs := parseQrCodeOptions(r)
+	if len(errs) > 0 {
+		EncodeResponse[types.ErrorResponse](h.Logger, r.Context(), w, http.StatusBadRequest, types.ErrorResponse{Errors: errs})
+		return
+	}
+
+	shortUrl, err := h.Db.GetShortUrlById(r.Context(), shortUrlid, false)
+	if err != nil {
+		EncodeResponse[types.ErrorResponse](h.Logger, r.Context(), w, http.StatusInternalServerError, types.ErrorResponse{Errors: []string{"Something is wrong with the server. Please try again later"}})
+		h.Logger.Error(r.Context(), err.Error())
+		return
+	}
+
+	if shortUrl == nil || shortUrl.UserId == nil || *shortUrl.UserId != userIdUuid {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	qrCode, contentType, err := renderQrCode(createShortUrl(h.BaseUrl, shortUrl.Slug), opts)
+	if errors.Is(err, errQrCodeTooSmall) {
+		EncodeResponse[types.ErrorResponse](h.Logger, r.Context(), w, http.StatusBadRequest, types.ErrorResponse{Errors: []string{QrCodeTooSmallError}})
+		return
+	}
+	if err != nil {
+		EncodeResponse[types.ErrorResponse](h.Logger, r.Context(), w, http.StatusInternalServerError, types.ErrorResponse{Errors: []string{"Something is wrong with the server. Please try again later"}})
+		h.Logger.Error(r.Context(), err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Cache-Control", "private, max-age=300")
+	w.WriteHeader(http.StatusOK)
+	_, err = w.Write(qrCode)
+	if err != nil {
+		h.Logger.Error(r.Context(), err.Error())
+	}
+}
+
+// GetQrCode is public like the redirect, scheduled short urls are included so the code can be printed before the link goes live
+func (h *RedirectionHandler) GetQrCode(w http.ResponseWriter, r *http.Request) {
+	slug := strings.TrimSpace(r.PathValue("slug"))
+	if len(slug) < 4 {
+		http.NotFound(w, r)
+		return
+	}
+
+	opts, errs := parseQrCodeOptions(r)
+	if len(errs) > 0 {
+		EncodeResponse[types.ErrorResponse](h.Logger, r.Context(), w, http.StatusBadRequest, types.ErrorResponse{Errors: errs})
+		return
+	}
+
+	shortUrl, err := h.Db.GetShortUrlBySlug(r.Context(), slug, false)
+	if err != nil {
+		EncodeResponse[types.ErrorResponse](h.Logger, r.Context(), w, http.StatusInternalServerError, types.ErrorResponse{Errors: []string{"Something is wrong with the server. Please try again later"}})
+		h.Logger.Error(r.Context(), err.Error())
+		return
+	}
+
+	if shortUrl == nil || !shortUrl.ExpiresAt.After(time.Now()) {
+		http.NotFound(w, r)
+		return
+	}
+
+	qrCode, contentType, err := renderQrCode(createShortUrl(h.BaseUrl, shortUrl.Slug), opts)
+	if errors.Is(err, errQrCodeTooSmall) {
+		EncodeResponse[types.ErrorResponse](h.Logger, r.Context(), w, http.StatusBadRequest, types.ErrorResponse{Errors: []string{QrCodeTooSmallError}})
+		return
+	}
+	if err != nil {
+		EncodeResponse[types.ErrorResponse](h.Logger, r.Context(), w, http.StatusInternalServerError, types.ErrorResponse{Errors: []string{"Something is wrong with the server. Please try again later"}})
+		h.Logger.Error(r.Context(), err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Cache-Control", "public, max-age=3600")
+	w.WriteHeader(http.StatusOK)
+	_, err = w.Write(qrCode)
+	if err != nil {
+		h.Logger.Error(r.Context(), err.Error())
+	}
+}
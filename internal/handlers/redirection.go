@@ -1,29 +1,56 @@
 package handlers
 
 import (
+	"errors"
+	"math"
+	"net"
 	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
 	"strings"
+	"time"
 
+	"github.com/amieldelatorre/shurl/internal/config"
 	"github.com/amieldelatorre/shurl/internal/db"
+	"github.com/amieldelatorre/shurl/internal/events"
 	"github.com/amieldelatorre/shurl/internal/types"
 	"github.com/amieldelatorre/shurl/internal/utils"
+	"github.com/google/uuid"
+)
+
+const (
+	MaxClickEventFieldSize = 512
+)
+
+var (
+	// Query parameters that control the redirect itself, they are never passed through to the destination
+	ReservedRedirectQueryParams = []string{"preview", "continue", "variant"}
 )
 
 type RedirectionHandler struct {
-	Logger utils.CustomJsonLogger
-	Db     db.DbContext
+	Logger        utils.CustomJsonLogger
+	Config        *config.Config
+	Db            db.DbContext
+	ClickEvents   *events.ClickEventQueue
+	UnlockLimiter *UnlockRateLimiter
+	BaseUrl       string
 }
 
-func NewRedirectionHandler(logger utils.CustomJsonLogger, db db.DbContext) RedirectionHandler {
-	return RedirectionHandler{Logger: logger, Db: db}
+func NewRedirectionHandler(logger utils.CustomJsonLogger, config *config.Config, db db.DbContext, clickEvents *events.ClickEventQueue, baseUrl string) RedirectionHandler {
+	return RedirectionHandler{Logger: logger, Config: config, Db: db, ClickEvents: clickEvents, UnlockLimiter: NewUnlockRateLimiter(), BaseUrl: baseUrl}
 }
 
 func (h *RedirectionHandler) Redirect(w http.ResponseWriter, r *http.Request) {
-	slug := strings.TrimSpace(r.PathValue("slug"))
+	// "/{slug}+" is the same as "/{slug}?preview", the slug validator doesn't allow a + so it can't be part of a slug
+	slug, previewRequested := strings.CutSuffix(strings.TrimSpace(r.PathValue("slug")), "+")
+	previewRequested = previewRequested || r.URL.Query().Has("preview")
 	if len(slug) < 4 {
 		http.NotFound(w, r)
 		return
 	}
+	// only set on "/{slug}/{rest...}"
+	subPath := r.PathValue("rest")
 
 	destination, err := h.Db.GetShortUrlBySlug(r.Context(), slug, true)
 	if err != nil {
@@ -32,12 +59,307 @@ func (h *RedirectionHandler) Redirect(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if destination == nil && h.Config.Server.ComingSoonPage {
+		scheduled, err := h.Db.GetShortUrlBySlug(r.Context(), slug, false)
+		if err != nil {
+			EncodeResponse[types.ErrorResponse](h.Logger, r.Context(), w, http.StatusInternalServerError, types.ErrorResponse{Errors: []string{"Something is wrong with the server. Please try again later"}})
+			h.Logger.Error(r.Context(), err.Error())
+			return
+		}
+
+		if scheduled != nil && scheduled.IsScheduled(time.Now()) {
+			h.renderComingSoonPage(w, r, scheduled)
+			h.Logger.Debug(r.Context(), "Short url not active yet", "slug", slug)
+			return
+		}
+	}
+
 	if destination == nil {
 		http.NotFound(w, r)
 		h.Logger.Debug(r.Context(), "Unknown slug", "slug", slug)
 		return
 	}
 
-	http.Redirect(w, r, destination.DestinationUrl, http.StatusTemporaryRedirect)
-	h.Logger.Info(r.Context(), "Redirect", "responseStatusCode", http.StatusTemporaryRedirect)
+	if subPath != "" && !destination.PathPassthrough {
+		http.NotFound(w, r)
+		h.Logger.Debug(r.Context(), "Short url does not allow path passthrough", "slug", slug)
+		return
+	}
+
+	// before a variant is picked, a sticky pick would otherwise be stored for a visitor who hasn't unlocked the short url
+	if destination.PasswordHash != nil && !h.isUnlocked(r, destination) {
+		h.renderUnlockPage(w, r, http.StatusUnauthorized, slug, "")
+		return
+	}
+
+	// the redirect depends on these headers when there are routing rules, shared caches must not hand one visitor's redirect to another
+	if len(destination.RoutingRules) > 0 {
+		w.Header().Add("Vary", "User-Agent, Accept-Language")
+	}
+	// a matching routing rule wins over the variants, the variants split whatever traffic would have gone to the destination url
+	selectedDestinationUrl := destination.DestinationUrl
+	var variant *types.ShortUrlVariant
+	if rule := matchRoutingRule(r, destination); rule != nil {
+		selectedDestinationUrl = rule.DestinationUrl
+	} else if len(destination.Variants) > 0 {
+		variant = h.selectVariant(w, r, destination)
+		selectedDestinationUrl = variant.DestinationUrl
+	}
+
+	destinationUrl, err := buildDestinationUrl(destination, selectedDestinationUrl, subPath, r.URL.Query(), h.Config.Server.QueryPassthroughOverride)
+	if err != nil {
+		http.Error(w, "Invalid path", http.StatusBadRequest)
+		h.Logger.Debug(r.Context(), "Could not build destination url", "slug", slug, "error", err.Error())
+		return
+	}
+
+	// the continue button on the preview page adds ?continue so a forced preview doesn't loop
+	forcePreview := (h.Config.Server.ForcePreview || destination.ForcePreview) && !r.URL.Query().Has("continue")
+	if previewRequested || forcePreview {
+		h.renderPreviewPage(w, r, destination, destinationUrl, previewContinueUrl(r, slug, subPath, variant))
+		return
+	}
+
+	if destination.MaxClicks != nil {
+		ok, err := h.Db.ConsumeShortUrlClick(r.Context(), destination.Id)
+		if err != nil {
+			EncodeResponse[types.ErrorResponse](h.Logger, r.Context(), w, http.StatusInternalServerError, types.ErrorResponse{Errors: []string{"Something is wrong with the server. Please try again later"}})
+			h.Logger.Error(r.Context(), err.Error())
+			return
+		}
+
+		if !ok {
+			http.Error(w, "This link has reached its maximum number of uses", http.StatusGone)
+			h.Logger.Debug(r.Context(), "Short url has no clicks remaining", "slug", slug)
+			return
+		}
+	}
+
+	redirectType := h.Config.Server.RedirectType
+	if destination.RedirectType != nil {
+		redirectType = *destination.RedirectType
+	}
+	// Browsers keep permanent redirects forever unless told otherwise, which would skip click recording, click limits, expiry and edits
+	if redirectType == http.StatusMovedPermanently || redirectType == http.StatusPermanentRedirect {
+		w.Header().Set("Cache-Control", "no-cache")
+	}
+	http.Redirect(w, r, destinationUrl, redirectType)
+	h.Logger.Info(r.Context(), "Redirect", "responseStatusCode", redirectType)
+	h.recordClick(r, destination, variant)
+}
+
+// buildDestinationUrl appends the sub path, the utm parameters and merges the query parameters for short urls that allow it, otherwise it is the destination url unchanged.
+// The destination url is the short url's own or the one picked by a routing rule
+func buildDestinationUrl(shortUrl *types.ShortUrl, destinationUrl string, subPath string, query url.Values, queryOverride bool) (string, error) {
+	utmParams := shortUrlUtmParams(shortUrl)
+	if !(shortUrl.PathPassthrough && subPath != "") && !(shortUrl.QueryPassthrough && len(query) > 0) && len(utmParams) == 0 {
+		return destinationUrl, nil
+	}
+
+	destination, err := url.Parse(destinationUrl)
+	if err != nil {
+		return "", err
+	}
+
+	if shortUrl.PathPassthrough && subPath != "" {
+		// JoinPath resolves dot segments, which would let the sub path climb out of the destination path
+		for _, segment := range strings.Split(subPath, "/") {
+			if segment == "." || segment == ".." {
+				return "", errors.New("sub path contains dot segments")
+			}
+		}
+		destination = destination.JoinPath(subPath)
+	}
+
+	destinationQuery := destination.Query()
+	merged := false
+	// the short url's utm parameters replace any the destination already has, they count as the destination's own for the passthrough below
+	for key, value := range utmParams {
+		destinationQuery.Set(key, value)
+		merged = true
+	}
+
+	if shortUrl.QueryPassthrough {
+		for key, values := range query {
+			if slices.Contains(ReservedRedirectQueryParams, key) {
+				continue
+			}
+			if destinationQuery.Has(key) && !queryOverride {
+				continue
+			}
+			destinationQuery[key] = values
+			merged = true
+		}
+	}
+
+	// re-encoding would reorder the destination's own parameters, so only do it when something was added
+	if merged {
+		destination.RawQuery = destinationQuery.Encode()
+	}
+
+	return destination.String(), nil
+}
+
+func shortUrlUtmParams(shortUrl *types.ShortUrl) map[string]string {
+	utmParams := map[string]string{}
+	if shortUrl.UtmSource != nil {
+		utmParams["utm_source"] = *shortUrl.UtmSource
+	}
+	if shortUrl.UtmMedium != nil {
+		utmParams["utm_medium"] = *shortUrl.UtmMedium
+	}
+	if shortUrl.UtmCampaign != nil {
+		utmParams["utm_campaign"] = *shortUrl.UtmCampaign
+	}
+	return utmParams
+}
+
+type comingSoonPageData struct {
+	ActivatesAt time.Time
+}
+
+// renderComingSoonPage responds with a 503 and a Retry-After so that crawlers come back once the short url is active
+func (h *RedirectionHandler) renderComingSoonPage(w http.ResponseWriter, r *http.Request, shortUrl *types.ShortUrl) {
+	retryAfter := int(math.Ceil(time.Until(*shortUrl.ActivatesAt).Seconds()))
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Retry-After", strconv.Itoa(max(retryAfter, 1)))
+	w.WriteHeader(http.StatusServiceUnavailable)
+	err := pages.ExecuteTemplate(w, "coming_soon.html", comingSoonPageData{ActivatesAt: shortUrl.ActivatesAt.UTC()})
+	if err != nil {
+		h.Logger.Error(r.Context(), err.Error())
+	}
+}
+
+type previewPageData struct {
+	ShortUrl       string
+	DestinationUrl string
+	ContinueUrl    string
+	CreatedAt      time.Time
+	ExpiresAt      *time.Time // nil when the short url never expires
+	Owner          string
+}
+
+// previewContinueUrl is the same short url with the sub path and query kept, ?continue stops a forced preview from showing again.
+// ?variant keeps the variant the preview showed so that the visitor ends up where the preview said
+func previewContinueUrl(r *http.Request, slug string, subPath string, variant *types.ShortUrlVariant) string {
+	path := "/" + slug
+	if subPath != "" {
+		path += "/" + subPath
+	}
+	query := r.URL.Query()
+	query.Del("preview")
+	query.Del("variant")
+	query.Set("continue", "")
+	if variant != nil {
+		query.Set("variant", variant.Id.String())
+	}
+	return (&url.URL{Path: path, RawQuery: query.Encode()}).String()
+}
+
+// renderPreviewPage shows where the short url goes without redirecting, no click is recorded or used up until the visitor continues
+func (h *RedirectionHandler) renderPreviewPage(w http.ResponseWriter, r *http.Request, shortUrl *types.ShortUrl, destinationUrl string, continueUrl string) {
+	data := previewPageData{
+		ShortUrl:       createShortUrl(h.BaseUrl, shortUrl.Slug),
+		DestinationUrl: destinationUrl,
+		ContinueUrl:    continueUrl,
+		CreatedAt:      shortUrl.CreatedAt.UTC(),
+	}
+	if shortUrl.Expires() {
+		expiresAt := shortUrl.ExpiresAt.UTC()
+		data.ExpiresAt = &expiresAt
+	}
+
+	if shortUrl.UserId != nil {
+		owner, err := h.Db.GetUserById(r.Context(), *shortUrl.UserId)
+		if err != nil {
+			EncodeResponse[types.ErrorResponse](h.Logger, r.Context(), w, http.StatusInternalServerError, types.ErrorResponse{Errors: []string{"Something is wrong with the server. Please try again later"}})
+			h.Logger.Error(r.Context(), err.Error())
+			return
+		}
+		if owner != nil {
+			data.Owner = owner.Username
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	err := pages.ExecuteTemplate(w, "preview.html", data)
+	if err != nil {
+		h.Logger.Error(r.Context(), err.Error())
+	}
+	h.Logger.Info(r.Context(), "Preview", "slug", shortUrl.Slug, "responseStatusCode", http.StatusOK)
+}
+
+// recordClick hands the click event to the click event worker so the redirect doesn't wait on the database,
+// the worker also counts the variant's hit and slides the expiry
+func (h *RedirectionHandler) recordClick(r *http.Request, shortUrl *types.ShortUrl, variant *types.ShortUrlVariant) {
+	eventId, err := uuid.NewV7()
+	if err != nil {
+		h.Logger.Error(r.Context(), "could not generate click event id", "error", err.Error())
+		return
+	}
+
+	event := types.ClickEvent{
+		Id:          eventId,
+		ShortUrlId:  shortUrl.Id,
+		Slug:        shortUrl.Slug,
+		ClickedAt:   time.Now().UTC(),
+		Referrer:    truncateClickEventField(r.Referer()),
+		UserAgent:   truncateClickEventField(r.UserAgent()),
+		IpAddress:   anonymiseIp(r.RemoteAddr),
+		SlideExpiry: slidesExpiry(shortUrl),
+	}
+	if variant != nil {
+		event.VariantId = &variant.Id
+	}
+
+	if !h.ClickEvents.Enqueue(event) {
+		h.Logger.Debug(r.Context(), "click event queue is full, dropping click event", "slug", shortUrl.Slug)
+	}
+}
+
+// slidesExpiry reports whether a redirect should push the expiry of a short url with sliding expiry out to its sliding ttl from now.
+// It is skipped while the expiry is still within a tenth of the window so busy links don't write on every redirect
+func slidesExpiry(shortUrl *types.ShortUrl) bool {
+	if shortUrl.SlidingTtl == nil {
+		return false
+	}
+
+	window := time.Duration(*shortUrl.SlidingTtl) * time.Second
+	return time.Until(shortUrl.ExpiresAt) <= window-window/10
+}
+
+// anonymiseIp zeroes the host part of the address, keeping only a /24 for IPv4 and a /48 for IPv6
+func anonymiseIp(remoteAddr string) *string {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		host = remoteAddr
+	}
+
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return nil
+	}
+
+	var masked string
+	if ipv4 := ip.To4(); ipv4 != nil {
+		masked = ipv4.Mask(net.CIDRMask(24, 32)).String()
+	} else {
+		masked = ip.Mask(net.CIDRMask(48, 128)).String()
+	}
+	return &masked
+}
+
+func truncateClickEventField(value string) *string {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return nil
+	}
+	if len(value) > MaxClickEventFieldSize {
+		// Cutting on a byte boundary can split a multi byte character, which postgres won't accept
+		value = strings.ToValidUTF8(value[:MaxClickEventFieldSize], "")
+	}
+	return &value
 }
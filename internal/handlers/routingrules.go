@@ -0,0 +1,128 @@
+package handlers
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/amieldelatorre/shurl/internal/types"
+)
+
+var (
+	RoutingRulePlatforms = []string{"ios", "android", "windows", "macos", "linux"}
+)
+
+type RoutingRuleRequest struct {
+	Match          string `json:"match" validate:"required,oneof=platform language host"`
+	Value          string `json:"value" validate:"required,max=255"`
+	DestinationUrl string `json:"destination_url" validate:"required,url"`
+}
+
+// normalizeRoutingRules trims every field and lowercases the value, matching is case insensitive
+func normalizeRoutingRules(rules []RoutingRuleRequest) {
+	for i := range rules {
+		rules[i].Match = strings.ToLower(strings.TrimSpace(rules[i].Match))
+		rules[i].Value = strings.ToLower(strings.TrimSpace(rules[i].Value))
+		rules[i].DestinationUrl = strings.TrimSpace(rules[i].DestinationUrl)
+	}
+}
+
+// newRoutingRules checks what the validator can't, platform rules need a platform that detectPlatform can return
+func newRoutingRules(rules []RoutingRuleRequest) ([]types.RoutingRule, []string) {
+	errs := []string{}
+	routingRules := make([]types.RoutingRule, 0, len(rules))
+	for i, rule := range rules {
+		if rule.Match == types.RoutingRuleMatchPlatform && !slices.Contains(RoutingRulePlatforms, rule.Value) {
+			errs = append(errs, fmt.Sprintf("`routing_rules[%d].value` must be one of `%s` for a platform rule", i, strings.Join(RoutingRulePlatforms, "`, `")))
+			continue
+		}
+		routingRules = append(routingRules, types.RoutingRule{Match: rule.Match, Value: rule.Value, DestinationUrl: rule.DestinationUrl})
+	}
+	return routingRules, errs
+}
+
+// matchRoutingRule returns the first rule that matches the request, nil when none of them do
+func matchRoutingRule(r *http.Request, shortUrl *types.ShortUrl) *types.RoutingRule {
+	if len(shortUrl.RoutingRules) == 0 {
+		return nil
+	}
+
+	platform := detectPlatform(r.UserAgent())
+	languages := acceptedLanguages(r.Header.Get("Accept-Language"))
+	host := requestHost(r)
+	for i, rule := range shortUrl.RoutingRules {
+		var matched bool
+		switch rule.Match {
+		case types.RoutingRuleMatchPlatform:
+			matched = platform != "" && platform == rule.Value
+		case types.RoutingRuleMatchLanguage:
+			matched = languageMatches(languages, rule.Value)
+		case types.RoutingRuleMatchHost:
+			matched = host == rule.Value
+		}
+		if matched {
+			return &shortUrl.RoutingRules[i]
+		}
+	}
+	return nil
+}
+
+// detectPlatform only looks for the operating system tokens, the order matters because iOS user agents say "like Mac OS X" and Android ones say "Linux"
+func detectPlatform(userAgent string) string {
+	userAgent = strings.ToLower(userAgent)
+	switch {
+	case strings.Contains(userAgent, "iphone"), strings.Contains(userAgent, "ipad"), strings.Contains(userAgent, "ipod"):
+		return "ios"
+	case strings.Contains(userAgent, "android"):
+		return "android"
+	case strings.Contains(userAgent, "windows"):
+		return "windows"
+	case strings.Contains(userAgent, "macintosh"), strings.Contains(userAgent, "mac os x"):
+		return "macos"
+	case strings.Contains(userAgent, "linux"), strings.Contains(userAgent, "x11"):
+		return "linux"
+	}
+	return ""
+}
+
+// acceptedLanguages returns the lowercased language tags from an Accept-Language header, leaving out the wildcard and anything with q=0
+func acceptedLanguages(header string) []string {
+	languages := []string{}
+	for _, part := range strings.Split(header, ",") {
+		tag, params, _ := strings.Cut(part, ";")
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" || tag == "*" {
+			continue
+		}
+
+		if q, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			weight, err := strconv.ParseFloat(q, 64)
+			if err != nil || weight <= 0 {
+				continue
+			}
+		}
+		languages = append(languages, tag)
+	}
+	return languages
+}
+
+// languageMatches treats a rule for "en" as matching "en-NZ" as well, a rule for "en-nz" only matches "en-NZ"
+func languageMatches(languages []string, value string) bool {
+	for _, language := range languages {
+		if language == value || strings.HasPrefix(language, value+"-") {
+			return true
+		}
+	}
+	return false
+}
+
+func requestHost(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.Host)
+	if err != nil {
+		host = r.Host
+	}
+	return strings.ToLower(host)
+}
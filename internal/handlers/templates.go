@@ -31,6 +31,12 @@ func (h *TemplateHandler) GetIndexJs(w http.ResponseWriter, r *http.Request) {
 		"allowRegistration": h.Config.Server.AllowRegistration,
 		"allowLogin":        h.Config.Server.AllowLogin,
 		"allowAnonymous":    h.Config.Server.AllowAnonymous,
+		// in seconds, the ui checks ttls against these before sending them
+		"anonymousDefaultTtl":     h.Config.ShortUrlTtl.AnonymousDefaultSeconds,
+		"anonymousMaxTtl":         h.Config.ShortUrlTtl.AnonymousMaxSeconds,
+		"authenticatedDefaultTtl": h.Config.ShortUrlTtl.AuthenticatedDefaultSeconds,
+		"authenticatedMaxTtl":     h.Config.ShortUrlTtl.AuthenticatedMaxSeconds,
+		"allowNonExpiring":        h.Config.ShortUrlTtl.AllowNonExpiring,
 	}
 
 	w.Header().Set("Content-Type", "text/javascript")
@@ -4,6 +4,12 @@ import { v7 as uuidv7 } from 'https://cdn.jsdelivr.net/npm/uuid@13.0.0/+esm';
 export const ALLOW_REGISTRATION = {{.allowRegistration}};
 export const ALLOW_LOGIN = {{.allowLogin}};
 export const ALLOW_ANONYMOUS = {{.allowAnonymous}};
+// short url ttl limits, in seconds
+export const ANONYMOUS_DEFAULT_TTL = {{.anonymousDefaultTtl}};
+export const ANONYMOUS_MAX_TTL = {{.anonymousMaxTtl}};
+export const AUTHENTICATED_DEFAULT_TTL = {{.authenticatedDefaultTtl}};
+export const AUTHENTICATED_MAX_TTL = {{.authenticatedMaxTtl}};
+export const ALLOW_NON_EXPIRING = {{.allowNonExpiring}};
 
 /// template the api url
 export const API_URL = "{{.apiUrl}}";
@@ -285,6 +291,9 @@ export function addCookieBanner() {
     INFO_BANNER_CONTAINER.append(cookieBanner);
 }
 
+// set by the last isLoggedIn call, the ttl limits depend on it
+let loggedIn = false;
+
 export async function isLoggedIn() {
     PAGE_LOADING_CONTAINER.hidden = false;
     
@@ -295,7 +304,8 @@ export async function isLoggedIn() {
 
     PAGE_LOADING_CONTAINER.hidden = true;
     // everything else, even connection errors is false
-    return (!result.isError && result.statusCode == 200);
+    loggedIn = (!result.isError && result.statusCode == 200);
+    return loggedIn;
 }
 
 export async function logout() {
@@ -369,6 +379,18 @@ function createSuccessfulLinkBox(destinationUrl, shortUrl, expires_at) {
 }
 
 
+// formatTtl turns a ttl in seconds into the largest whole unit, e.g. 604800 is "7 day(s)". Anything over a day that isn't whole days, like a month, is rounded to a tenth of a day
+export function formatTtl(seconds) {
+    const units = [[86400, "day(s)"], [3600, "hour(s)"], [60, "minute(s)"]];
+    for (const [unitSeconds, unitName] of units) {
+        if (seconds % unitSeconds === 0)
+            return `${seconds / unitSeconds} ${unitName}`;
+    }
+    if (seconds > 86400)
+        return `${(seconds / 86400).toFixed(1)} day(s)`;
+    return `${seconds} second(s)`;
+}
+
 export async function createShortUrl(event) {
     event.preventDefault();
     const submittingButton = event.submitter;
@@ -384,10 +406,72 @@ export async function createShortUrl(event) {
     const ttlUnit = Number(urlTtlUnitInput.value);
 
 
-    const data = JSON.stringify({
-        destination_url: destinationUrl,
-        ttl: urlTtl * ttlUnit
-    });
+    const requestBody = {
+        destination_url: destinationUrl
+    };
+
+    // the never expires checkbox is only shown when the server allows it
+    const neverExpiresInput = document.getElementById("never-expires-input");
+    const maxTtl = loggedIn ? AUTHENTICATED_MAX_TTL : ANONYMOUS_MAX_TTL;
+    if (ALLOW_NON_EXPIRING && neverExpiresInput && neverExpiresInput.checked) {
+        requestBody.never_expires = true;
+    } else if (urlTtl * ttlUnit > maxTtl) {
+        NOTIFICATION_CONTAINER.prepend(createErrorBox([`Short urls can only last up to ${formatTtl(maxTtl)}`]));
+        changeButtonToFailed(submittingButton, () => {
+            changeButtonToNormal(submittingButton, BUTTON_NORMAL_TEXT);
+        });
+        return;
+    } else {
+        requestBody.ttl = urlTtl * ttlUnit;
+    }
+
+    // custom slugs are optional, leaving it empty lets the server generate one
+    const slugInput = document.getElementById("slug-input");
+    if (slugInput && slugInput.value.trim() !== "") {
+        requestBody.slug = slugInput.value.trim();
+    }
+
+    // password protected links show an unlock page before redirecting
+    const passwordInput = document.getElementById("password-input");
+    if (passwordInput && passwordInput.value !== "") {
+        requestBody.password = passwordInput.value;
+    }
+
+    // utm parameters are added to the destination when someone is redirected
+    const utmInputs = {
+        utm_source: document.getElementById("utm-source-input"),
+        utm_medium: document.getElementById("utm-medium-input"),
+        utm_campaign: document.getElementById("utm-campaign-input"),
+    };
+    for (const [field, input] of Object.entries(utmInputs)) {
+        if (input && input.value.trim() !== "") {
+            requestBody[field] = input.value.trim();
+        }
+    }
+
+    // leaving it on the default lets the server decide the status code
+    const redirectTypeInput = document.getElementById("redirect-type-input");
+    if (redirectTypeInput && redirectTypeInput.value !== "") {
+        requestBody.redirect_type = Number(redirectTypeInput.value);
+    }
+
+    // visitors see where the link goes before they are redirected
+    const forcePreviewInput = document.getElementById("force-preview-input");
+    if (forcePreviewInput && forcePreviewInput.checked) {
+        requestBody.force_preview = true;
+    }
+
+    // lets campaign parameters and sub paths on the short url reach the destination
+    const queryPassthroughInput = document.getElementById("query-passthrough-input");
+    if (queryPassthroughInput && queryPassthroughInput.checked) {
+        requestBody.query_passthrough = true;
+    }
+    const pathPassthroughInput = document.getElementById("path-passthrough-input");
+    if (pathPassthroughInput && pathPassthroughInput.checked) {
+        requestBody.path_passthrough = true;
+    }
+
+    const data = JSON.stringify(requestBody);
 
     let result = await fetchWithRetry(
         SHORT_URL_ENDPONT, 
@@ -400,7 +484,7 @@ export async function createShortUrl(event) {
     )
 
     if (!result.isError) {
-        const successfulLinkCreateDiv = createSuccessfulLinkBox(result.json.destination_url, result.json.url, result.json.expires_at);
+        const successfulLinkCreateDiv = createSuccessfulLinkBox(result.json.destination_url, result.json.url, result.json.never_expires ? "Never" : result.json.expires_at);
         const parent = document.getElementById("success-links");
         parent.prepend(successfulLinkCreateDiv);
 
@@ -409,6 +493,22 @@ export async function createShortUrl(event) {
         });
 
         destinationUrlInput.value = "";
+        if (neverExpiresInput)
+            neverExpiresInput.checked = false;
+        if (slugInput)
+            slugInput.value = "";
+        if (passwordInput)
+            passwordInput.value = "";
+        if (forcePreviewInput)
+            forcePreviewInput.checked = false;
+        if (queryPassthroughInput)
+            queryPassthroughInput.checked = false;
+        if (pathPassthroughInput)
+            pathPassthroughInput.checked = false;
+        for (const input of Object.values(utmInputs)) {
+            if (input)
+                input.value = "";
+        }
         return;
     }
 
@@ -0,0 +1,222 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"errors"
+	"html/template"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/alexedwards/argon2id"
+	"github.com/amieldelatorre/shurl/internal/types"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	CookieUnlockTokenName = "shurl_unlock"
+	UnlockTokenAudience   = "shurl-unlock"
+	unlockTokenValidTime  = 1 * time.Hour
+	MaxUnlockAttempts     = 5
+	UnlockAttemptWindow   = 15 * time.Minute
+	maxUnlockFormSize     = 4096
+)
+
+// Pages are served to browsers as html, unlike the templates which are javascript
+//
+//go:embed pages
+var pagesFS embed.FS
+
+var pages = template.Must(template.ParseFS(pagesFS, "pages/*"))
+
+type unlockPageData struct {
+	Slug  string
+	Error string
+}
+
+type unlockAttempts struct {
+	failures    int
+	windowStart time.Time
+}
+
+// UnlockRateLimiter counts failed unlock attempts per slug, in memory so it is per instance
+type UnlockRateLimiter struct {
+	mu       sync.Mutex
+	attempts map[string]*unlockAttempts
+}
+
+func NewUnlockRateLimiter() *UnlockRateLimiter {
+	return &UnlockRateLimiter{attempts: map[string]*unlockAttempts{}}
+}
+
+// Reserve counts an attempt as failed before the password is compared, so concurrent guesses can't all get past the limit.
+// It returns false without counting anything when the limit has been reached
+func (l *UnlockRateLimiter) Reserve(slug string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	a, ok := l.attempts[slug]
+	if !ok || now.Sub(a.windowStart) > UnlockAttemptWindow {
+		l.removeExpired(now)
+		l.attempts[slug] = &unlockAttempts{failures: 1, windowStart: now}
+		return true
+	}
+	if a.failures >= MaxUnlockAttempts {
+		return false
+	}
+	a.failures++
+	return true
+}
+
+// Release gives back an attempt that was reserved but never got to compare the password
+func (l *UnlockRateLimiter) Release(slug string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if a, ok := l.attempts[slug]; ok && a.failures > 0 {
+		a.failures--
+	}
+}
+
+// Reset forgets the failed attempts of a slug once the right password was given
+func (l *UnlockRateLimiter) Reset(slug string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.attempts, slug)
+}
+
+// removeExpired keeps the map from growing forever, must be called while holding the lock
+func (l *UnlockRateLimiter) removeExpired(now time.Time) {
+	for slug, a := range l.attempts {
+		if now.Sub(a.windowStart) > UnlockAttemptWindow {
+			delete(l.attempts, slug)
+		}
+	}
+}
+
+func (h *RedirectionHandler) Unlock(w http.ResponseWriter, r *http.Request) {
+	slug := strings.TrimSpace(r.PathValue("slug"))
+	if len(slug) < 4 {
+		http.NotFound(w, r)
+		return
+	}
+
+	shortUrl, err := h.Db.GetShortUrlBySlug(r.Context(), slug, true)
+	if err != nil {
+		EncodeResponse[types.ErrorResponse](h.Logger, r.Context(), w, http.StatusInternalServerError, types.ErrorResponse{Errors: []string{"Something is wrong with the server. Please try again later"}})
+		h.Logger.Error(r.Context(), err.Error())
+		return
+	}
+
+	if shortUrl == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	if shortUrl.PasswordHash == nil {
+		http.Redirect(w, r, "/"+slug, http.StatusSeeOther)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxUnlockFormSize)
+	err = r.ParseForm()
+	if err != nil {
+		h.renderUnlockPage(w, r, http.StatusBadRequest, slug, "Invalid form submitted")
+		return
+	}
+
+	if !h.UnlockLimiter.Reserve(slug) {
+		h.renderUnlockPage(w, r, http.StatusTooManyRequests, slug, "Too many incorrect attempts. Please try again later")
+		return
+	}
+
+	passwordMatch, err := argon2id.ComparePasswordAndHash(r.PostForm.Get("password"), *shortUrl.PasswordHash)
+	if err != nil {
+		h.UnlockLimiter.Release(slug)
+		EncodeResponse[types.ErrorResponse](h.Logger, r.Context(), w, http.StatusInternalServerError, types.ErrorResponse{Errors: []string{"Something is wrong with the server. Please try again later"}})
+		h.Logger.Error(r.Context(), err.Error())
+		return
+	}
+
+	if !passwordMatch {
+		h.renderUnlockPage(w, r, http.StatusUnauthorized, slug, "Incorrect password")
+		h.Logger.Info(r.Context(), "incorrect short url password", "slug", slug)
+		return
+	}
+	h.UnlockLimiter.Reset(slug)
+
+	expiresAt := time.Now().Add(unlockTokenValidTime)
+	token := jwt.NewWithClaims(jwt.SigningMethodES512, JwtClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   shortUrl.Id.String(),
+			Issuer:    h.Config.Server.Auth.JwtIssuer,
+			Audience:  jwt.ClaimStrings{UnlockTokenAudience},
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			NotBefore: jwt.NewNumericDate(time.Now()),
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+		},
+		PasswordFingerprint: unlockPasswordFingerprint(*shortUrl.PasswordHash),
+	})
+	signedToken, err := token.SignedString(h.Config.Server.Auth.JwtEcdsaParsedKey)
+	if err != nil {
+		EncodeResponse[types.ErrorResponse](h.Logger, r.Context(), w, http.StatusInternalServerError, types.ErrorResponse{Errors: []string{"Something is wrong with the server. Please try again later"}})
+		h.Logger.Error(r.Context(), err.Error())
+		return
+	}
+
+	// The path scopes the cookie to this slug, the browser won't send it for any other short url.
+	// "/{slug}+" isn't under "/{slug}", so the preview gets a cookie of its own
+	for _, path := range []string{"/" + slug, "/" + slug + "+"} {
+		http.SetCookie(w, &http.Cookie{
+			Name:     CookieUnlockTokenName,
+			Value:    signedToken,
+			Path:     path,
+			MaxAge:   int(unlockTokenValidTime.Seconds()),
+			Expires:  expiresAt,
+			HttpOnly: true,
+			Secure:   h.Config.Server.HttpsEnabled,
+			SameSite: http.SameSiteLaxMode,
+		})
+	}
+	http.Redirect(w, r, "/"+slug, http.StatusSeeOther)
+	h.Logger.Info(r.Context(), "short url unlocked", "slug", slug)
+}
+
+// isUnlocked checks for an unlock cookie that was issued for this exact short url with the password it has now,
+// changing or removing the password stops the cookies from before working
+func (h *RedirectionHandler) isUnlocked(r *http.Request, shortUrl *types.ShortUrl) bool {
+	cookie, err := r.Cookie(CookieUnlockTokenName)
+	if err != nil {
+		if !errors.Is(err, http.ErrNoCookie) {
+			h.Logger.Debug(r.Context(), "could not read unlock cookie", "error", err.Error())
+		}
+		return false
+	}
+
+	claims, ok, err := validateToken(cookie.Value, &h.Config.Server.Auth.JwtEcdsaParsedKey.PublicKey, jwt.WithAudience(UnlockTokenAudience))
+	if err != nil || !ok {
+		return false
+	}
+	return claims.Subject == shortUrl.Id.String() && shortUrl.PasswordHash != nil && claims.PasswordFingerprint == unlockPasswordFingerprint(*shortUrl.PasswordHash)
+}
+
+// unlockPasswordFingerprint is a digest of the password hash rather than the hash itself, the token can be read by anyone holding it.
+// The hash has a new salt every time the password is set, so setting the same password again also changes it
+func unlockPasswordFingerprint(passwordHash string) string {
+	sum := sha256.Sum256([]byte(passwordHash))
+	return hex.EncodeToString(sum[:])
+}
+
+func (h *RedirectionHandler) renderUnlockPage(w http.ResponseWriter, r *http.Request, status int, slug string, errorMessage string) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	err := pages.ExecuteTemplate(w, "unlock.html", unlockPageData{Slug: slug, Error: errorMessage})
+	if err != nil {
+		h.Logger.Error(r.Context(), err.Error())
+	}
+}
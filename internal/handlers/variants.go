@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"math/rand/v2"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/amieldelatorre/shurl/internal/types"
+	"github.com/google/uuid"
+)
+
+const (
+	CookieVariantName   = "shurl_variant"
+	TooFewVariantsError = "`variants` needs at least 2 destinations to split traffic between"
+)
+
+type ShortUrlVariantRequest struct {
+	DestinationUrl string `json:"destination_url" validate:"required,url"`
+	Weight         int    `json:"weight" validate:"required,min=1,max=1000"`
+}
+
+func trimShortUrlVariants(variants []ShortUrlVariantRequest) {
+	for i := range variants {
+		variants[i].DestinationUrl = strings.TrimSpace(variants[i].DestinationUrl)
+	}
+}
+
+// newShortUrlVariants gives every variant a new id, the hits of a variant belong to its id
+func newShortUrlVariants(variants []ShortUrlVariantRequest) ([]types.ShortUrlVariant, error) {
+	shortUrlVariants := make([]types.ShortUrlVariant, 0, len(variants))
+	for _, v := range variants {
+		id, err := uuid.NewV7()
+		if err != nil {
+			return nil, err
+		}
+		shortUrlVariants = append(shortUrlVariants, types.ShortUrlVariant{Id: id, DestinationUrl: v.DestinationUrl, Weight: v.Weight})
+	}
+	return shortUrlVariants, nil
+}
+
+// selectVariant picks a variant by weight. With sticky variants the pick is stored in a cookie scoped to the slug and reused while that variant exists.
+// Continuing from the preview page keeps the variant the preview showed
+func (h *RedirectionHandler) selectVariant(w http.ResponseWriter, r *http.Request, shortUrl *types.ShortUrl) *types.ShortUrlVariant {
+	if r.URL.Query().Has("continue") {
+		if variant := findVariant(shortUrl, r.URL.Query().Get("variant")); variant != nil {
+			return variant
+		}
+	}
+
+	if shortUrl.StickyVariants {
+		cookie, err := r.Cookie(CookieVariantName)
+		if err == nil {
+			if variant := findVariant(shortUrl, cookie.Value); variant != nil {
+				return variant
+			}
+		}
+	}
+
+	variant := pickWeightedVariant(shortUrl.Variants)
+	if shortUrl.StickyVariants {
+		http.SetCookie(w, &http.Cookie{
+			Name:     CookieVariantName,
+			Value:    variant.Id.String(),
+			Path:     "/" + shortUrl.Slug,
+			MaxAge:   max(int(time.Until(shortUrl.ExpiresAt).Seconds()), 1),
+			Expires:  shortUrl.ExpiresAt,
+			HttpOnly: true,
+			Secure:   h.Config.Server.HttpsEnabled,
+			SameSite: http.SameSiteLaxMode,
+		})
+	}
+	return variant
+}
+
+func findVariant(shortUrl *types.ShortUrl, id string) *types.ShortUrlVariant {
+	for i := range shortUrl.Variants {
+		if shortUrl.Variants[i].Id.String() == id {
+			return &shortUrl.Variants[i]
+		}
+	}
+	return nil
+}
+
+// pickWeightedVariant expects at least one variant, the api never stores a short url with only one
+func pickWeightedVariant(variants []types.ShortUrlVariant) *types.ShortUrlVariant {
+	total := 0
+	for _, v := range variants {
+		total += v.Weight
+	}
+
+	n := rand.IntN(total)
+	for i := range variants {
+		n -= variants[i].Weight
+		if n < 0 {
+			return &variants[i]
+		}
+	}
+	return &variants[len(variants)-1]
+}
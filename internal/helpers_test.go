@@ -13,6 +13,7 @@ import (
 	"github.com/amieldelatorre/shurl/internal/config"
 	"github.com/amieldelatorre/shurl/internal/handlers"
 	"github.com/amieldelatorre/shurl/internal/utils"
+	"github.com/amieldelatorre/shurl/internal/workers"
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
 	"github.com/testcontainers/testcontainers-go"
@@ -57,7 +58,7 @@ type Dependencies struct {
 }
 
 const (
-	DB_VERSION     = "20260304055040"
+	DB_VERSION     = "20260321070935"
 	DB_NAME        = "shurl"
 	DB_USERNAME    = "shurl"
 	DB_PASSWORD    = "password"
@@ -147,16 +148,33 @@ func SetupDependencies(t *testing.T, ctx context.Context, enableCache bool) Depe
 	}
 
 	app := NewApp(ctx, config)
+	// App.Run isn't used in tests, start the click event worker so that redirects are still recorded
+	go workers.ClickEventWorker(ctx, app.Logger, app.ClickEventQueue, app.DbContext, app.Config.ClickEventWorker.BatchSize, app.Config.ClickEventWorker.FlushIntervalMs)
+	// the health check reports whether the worker is running, so it has to have started before any request is made
+	for attempt := 0; !app.ClickEventQueue.WorkerRunning(); attempt++ {
+		if attempt == 50 {
+			t.Fatal("click event worker did not start")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
 	ts := httptest.NewServer(app.Server.Handler)
 	deps := Dependencies{Db: db, Cache: cache, App: app, TestServer: ts}
 	err = deps.Db.Init(ctx)
 	if err != nil {
+		deps.StopClickEventWorker()
 		t.Fatal(err)
 	}
 
 	return deps
 }
 
+// StopClickEventWorker closes the click event queue and waits for the remaining events to be flushed.
+// It has to be called before the containers are terminated, otherwise the flush goes to a database that is gone
+func (d Dependencies) StopClickEventWorker() {
+	d.App.ClickEventQueue.Close()
+	<-d.App.ClickEventQueue.Drained()
+}
+
 func CreateAccessToken(t *testing.T, config config.AuthConfig, hours int, id *uuid.UUID, valid bool) string {
 	now := time.Now()
 	start := now.Add(-24 * time.Hour)
@@ -167,6 +167,7 @@ func runLogin(t *testing.T, tc LoginTestCase, cacheEnabled bool) {
 		if err := deps.App.Server.Close(); err != nil {
 			t.Fatal(err)
 		}
+		deps.StopClickEventWorker()
 
 		if err := deps.Db.Container.Terminate(ctx); err != nil {
 			t.Fatal(err)
@@ -239,6 +240,7 @@ func TestLogout(t *testing.T) {
 		if err := deps.App.Server.Close(); err != nil {
 			t.Fatal(err)
 		}
+		deps.StopClickEventWorker()
 
 		if err := deps.Db.Container.Terminate(ctx); err != nil {
 			t.Fatal(err)
@@ -303,6 +305,7 @@ func TestValidate(t *testing.T) {
 		if err := deps.App.Server.Close(); err != nil {
 			t.Fatal(err)
 		}
+		deps.StopClickEventWorker()
 
 		if err := deps.Db.Container.Terminate(ctx); err != nil {
 			t.Fatal(err)
@@ -31,6 +31,11 @@ func TestHealthCheck(t *testing.T) {
 			Expected: handlers.HealthCheckResponse{
 				IdempotencyKeyCleanupWorker: handlers.IdempotencyKeyCleanupWorkerHealthCheck{},
 				ShortUrlCleanUpWorker:       handlers.ShortUrlCleanupWorkerHealthCheck{},
+				TrashCleanupWorker:          handlers.TrashCleanupWorkerHealthCheck{},
+				ClickEventWorker: handlers.ClickEventWorkerHealthCheck{
+					Running:       true,
+					QueueCapacity: 10000,
+				},
 				Database: handlers.DatabaseHealthCheck{
 					Ok:      true,
 					Version: DB_VERSION,
@@ -49,6 +54,11 @@ func TestHealthCheck(t *testing.T) {
 			Expected: handlers.HealthCheckResponse{
 				IdempotencyKeyCleanupWorker: handlers.IdempotencyKeyCleanupWorkerHealthCheck{},
 				ShortUrlCleanUpWorker:       handlers.ShortUrlCleanupWorkerHealthCheck{},
+				TrashCleanupWorker:          handlers.TrashCleanupWorkerHealthCheck{},
+				ClickEventWorker: handlers.ClickEventWorkerHealthCheck{
+					Running:       true,
+					QueueCapacity: 10000,
+				},
 				Database: handlers.DatabaseHealthCheck{
 					Ok:      true,
 					Version: DB_VERSION,
@@ -67,6 +77,11 @@ func TestHealthCheck(t *testing.T) {
 			Expected: handlers.HealthCheckResponse{
 				IdempotencyKeyCleanupWorker: handlers.IdempotencyKeyCleanupWorkerHealthCheck{},
 				ShortUrlCleanUpWorker:       handlers.ShortUrlCleanupWorkerHealthCheck{},
+				TrashCleanupWorker:          handlers.TrashCleanupWorkerHealthCheck{},
+				ClickEventWorker: handlers.ClickEventWorkerHealthCheck{
+					Running:       true,
+					QueueCapacity: 10000,
+				},
 				Database: handlers.DatabaseHealthCheck{
 					Ok:      false,
 					Version: "0",
@@ -86,6 +101,11 @@ func TestHealthCheck(t *testing.T) {
 			Expected: handlers.HealthCheckResponse{
 				IdempotencyKeyCleanupWorker: handlers.IdempotencyKeyCleanupWorkerHealthCheck{},
 				ShortUrlCleanUpWorker:       handlers.ShortUrlCleanupWorkerHealthCheck{},
+				TrashCleanupWorker:          handlers.TrashCleanupWorkerHealthCheck{},
+				ClickEventWorker: handlers.ClickEventWorkerHealthCheck{
+					Running:       true,
+					QueueCapacity: 10000,
+				},
 				Database: handlers.DatabaseHealthCheck{
 					Ok:      true,
 					Version: DB_VERSION,
@@ -108,6 +128,7 @@ func TestHealthCheck(t *testing.T) {
 				if err := deps.App.Server.Close(); err != nil {
 					t.Fatal(err)
 				}
+				deps.StopClickEventWorker()
 
 				if !testCase.TerminateDb {
 					if err := deps.Db.Container.Terminate(ctx); err != nil {
@@ -0,0 +1,533 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/amieldelatorre/shurl/internal/handlers"
+	"github.com/amieldelatorre/shurl/internal/types"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"github.com/google/uuid"
+)
+
+type GetUserPreferencesCase struct {
+	Name               string
+	UserId             uuid.UUID
+	SkipAccessToken    bool
+	ExpectedStatusCode int
+	Expected           handlers.UserPreferencesResponse
+}
+
+func TestGetUserPreferences(t *testing.T) {
+	t.Parallel()
+
+	defaultTimezone := types.DefaultTimezone
+
+	cases := []GetUserPreferencesCase{
+		{
+			Name:               "NeverSaved",
+			UserId:             tagOwnerUuid,
+			ExpectedStatusCode: http.StatusOK,
+			Expected: handlers.UserPreferencesResponse{
+				Timezone: &defaultTimezone,
+			},
+		},
+		{
+			Name:               "NotLoggedIn",
+			UserId:             tagOwnerUuid,
+			SkipAccessToken:    true,
+			ExpectedStatusCode: http.StatusUnauthorized,
+			Expected: handlers.UserPreferencesResponse{
+				Errors: []string{"Login required"},
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.Name+"WithCache", func(t *testing.T) {
+			t.Parallel()
+			runGetUserPreferences(t, tc, true)
+		})
+		t.Run(tc.Name+"NoCache", func(t *testing.T) {
+			t.Parallel()
+			runGetUserPreferences(t, tc, false)
+		})
+	}
+}
+
+func runGetUserPreferences(t *testing.T, tc GetUserPreferencesCase, cacheEnabled bool) {
+	ctx := context.Background()
+	deps := SetupDependencies(t, ctx, cacheEnabled)
+	defer func() {
+		if err := deps.App.Server.Close(); err != nil {
+			t.Fatal(err)
+		}
+		deps.StopClickEventWorker()
+
+		if err := deps.Db.Container.Terminate(ctx); err != nil {
+			t.Fatal(err)
+		}
+
+		if cacheEnabled {
+			if err := deps.Cache.Container.Terminate(ctx); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}()
+
+	req, err := http.NewRequest(http.MethodGet, deps.TestServer.URL+"/api/v1/me/preferences", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	accessToken := CreateAccessToken(t, deps.App.Config.Server.Auth, 12, &tc.UserId, true)
+	if !tc.SkipAccessToken {
+		req.Header.Add(handlers.HeaderAuthorization, fmt.Sprintf("Bearer %s", accessToken))
+	}
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if res.StatusCode != tc.ExpectedStatusCode {
+		t.Errorf("expected status %d got %d", tc.ExpectedStatusCode, res.StatusCode)
+	}
+
+	var response handlers.UserPreferencesResponse
+	decoder := json.NewDecoder(res.Body)
+	decoder.DisallowUnknownFields()
+	if err = decoder.Decode(&response); err != nil {
+		t.Error("failed to decode body", err.Error())
+	}
+
+	if err = res.Body.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if diff := cmp.Diff(tc.Expected, response); diff != "" {
+		t.Errorf("actual does not equal expected. diff: %s", diff)
+	}
+}
+
+type PatchUserPreferencesCase struct {
+	Name               string
+	UserId             uuid.UUID
+	SkipAccessToken    bool
+	Requests           []handlers.PatchUserPreferencesRequest // sent in order, only the response to the last one is checked
+	ExpectedStatusCode int
+	Expected           handlers.UserPreferencesResponse
+}
+
+func TestPatchUserPreferences(t *testing.T) {
+	t.Parallel()
+
+	defaultTtl := uint32(86400)
+	tooShortTtl := uint32(60)
+	tooLongTtl := uint32(authenticatedMaxTtl + 1)
+	noTtl := uint32(0)
+	redirectType := http.StatusFound
+	invalidRedirectType := http.StatusSeeOther
+	noRedirectType := 0
+	timezone := "Pacific/Auckland"
+	invalidTimezone := "Middle/Earth"
+	localTimezone := "Local"
+	defaultTimezone := types.DefaultTimezone
+	marketingId := uuid.MustParse(marketingTagId)
+	unusedId := uuid.MustParse(unusedTagId)
+	otherUserTagIds := []uuid.UUID{marketingId}
+	// the same tag twice is only kept once, they come back sorted by name
+	tagIds := []uuid.UUID{unusedId, marketingId, unusedId}
+	noTagIds := []uuid.UUID{}
+
+	expectedTtl := int(defaultTtl)
+
+	cases := []PatchUserPreferencesCase{
+		{
+			Name:   "HappyPath",
+			UserId: tagOwnerUuid,
+			Requests: []handlers.PatchUserPreferencesRequest{
+				{DefaultTtl: &defaultTtl, DefaultRedirectType: &redirectType, DefaultTagIds: &tagIds, Timezone: &timezone},
+			},
+			ExpectedStatusCode: http.StatusOK,
+			Expected: handlers.UserPreferencesResponse{
+				DefaultTtl:          &expectedTtl,
+				DefaultRedirectType: &redirectType,
+				DefaultTagIds:       []uuid.UUID{marketingId, unusedId},
+				Timezone:            &timezone,
+			},
+		},
+		{
+			Name:   "OnlyChangesProvidedFields",
+			UserId: tagOwnerUuid,
+			Requests: []handlers.PatchUserPreferencesRequest{
+				{DefaultTtl: &defaultTtl, DefaultRedirectType: &redirectType},
+				{Timezone: &timezone},
+			},
+			ExpectedStatusCode: http.StatusOK,
+			Expected: handlers.UserPreferencesResponse{
+				DefaultTtl:          &expectedTtl,
+				DefaultRedirectType: &redirectType,
+				Timezone:            &timezone,
+			},
+		},
+		{
+			Name:   "RemoveDefaults",
+			UserId: tagOwnerUuid,
+			Requests: []handlers.PatchUserPreferencesRequest{
+				{DefaultTtl: &defaultTtl, DefaultRedirectType: &redirectType, DefaultTagIds: &tagIds},
+				{DefaultTtl: &noTtl, DefaultRedirectType: &noRedirectType, DefaultTagIds: &noTagIds},
+			},
+			ExpectedStatusCode: http.StatusOK,
+			Expected: handlers.UserPreferencesResponse{
+				Timezone: &defaultTimezone,
+			},
+		},
+		{
+			Name:               "NothingProvided",
+			UserId:             tagOwnerUuid,
+			Requests:           []handlers.PatchUserPreferencesRequest{{}},
+			ExpectedStatusCode: http.StatusBadRequest,
+			Expected: handlers.UserPreferencesResponse{
+				Errors: []string{"at least one of `default_ttl`, `default_redirect_type`, `default_tag_ids` or `timezone` must be provided"},
+			},
+		},
+		{
+			Name:               "DefaultTtlTooShort",
+			UserId:             tagOwnerUuid,
+			Requests:           []handlers.PatchUserPreferencesRequest{{DefaultTtl: &tooShortTtl}},
+			ExpectedStatusCode: http.StatusBadRequest,
+			Expected: handlers.UserPreferencesResponse{
+				Errors: []string{"`default_ttl` must be at least 900 seconds"},
+			},
+		},
+		{
+			Name:               "DefaultTtlTooLong",
+			UserId:             tagOwnerUuid,
+			Requests:           []handlers.PatchUserPreferencesRequest{{DefaultTtl: &tooLongTtl}},
+			ExpectedStatusCode: http.StatusBadRequest,
+			Expected: handlers.UserPreferencesResponse{
+				Errors: []string{fmt.Sprintf("`default_ttl` can only be up to %d seconds", authenticatedMaxTtl)},
+			},
+		},
+		{
+			Name:               "InvalidRedirectType",
+			UserId:             tagOwnerUuid,
+			Requests:           []handlers.PatchUserPreferencesRequest{{DefaultRedirectType: &invalidRedirectType}},
+			ExpectedStatusCode: http.StatusBadRequest,
+			Expected: handlers.UserPreferencesResponse{
+				Errors: []string{"Key: 'PatchUserPreferencesRequest.DefaultRedirectType' Error:Field validation for 'DefaultRedirectType' failed on the 'oneof' tag"},
+			},
+		},
+		{
+			Name:               "InvalidTimezone",
+			UserId:             tagOwnerUuid,
+			Requests:           []handlers.PatchUserPreferencesRequest{{Timezone: &invalidTimezone}},
+			ExpectedStatusCode: http.StatusBadRequest,
+			Expected: handlers.UserPreferencesResponse{
+				Errors: []string{handlers.PreferencesTimezoneError},
+			},
+		},
+		{
+			Name:               "LocalTimezone",
+			UserId:             tagOwnerUuid,
+			Requests:           []handlers.PatchUserPreferencesRequest{{Timezone: &localTimezone}},
+			ExpectedStatusCode: http.StatusBadRequest,
+			Expected: handlers.UserPreferencesResponse{
+				Errors: []string{handlers.PreferencesTimezoneError},
+			},
+		},
+		{
+			Name:               "OtherUserTags",
+			UserId:             validUserUuid,
+			Requests:           []handlers.PatchUserPreferencesRequest{{DefaultTagIds: &otherUserTagIds}},
+			ExpectedStatusCode: http.StatusBadRequest,
+			Expected: handlers.UserPreferencesResponse{
+				Errors: []string{handlers.PreferencesUnknownTagsError},
+			},
+		},
+		{
+			Name:               "NotLoggedIn",
+			UserId:             tagOwnerUuid,
+			SkipAccessToken:    true,
+			Requests:           []handlers.PatchUserPreferencesRequest{{Timezone: &timezone}},
+			ExpectedStatusCode: http.StatusUnauthorized,
+			Expected: handlers.UserPreferencesResponse{
+				Errors: []string{"Login required"},
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.Name+"WithCache", func(t *testing.T) {
+			t.Parallel()
+			runPatchUserPreferences(t, tc, true)
+		})
+		t.Run(tc.Name+"NoCache", func(t *testing.T) {
+			t.Parallel()
+			runPatchUserPreferences(t, tc, false)
+		})
+	}
+}
+
+func runPatchUserPreferences(t *testing.T, tc PatchUserPreferencesCase, cacheEnabled bool) {
+	ctx := context.Background()
+	deps := SetupDependencies(t, ctx, cacheEnabled)
+	defer func() {
+		if err := deps.App.Server.Close(); err != nil {
+			t.Fatal(err)
+		}
+		deps.StopClickEventWorker()
+
+		if err := deps.Db.Container.Terminate(ctx); err != nil {
+			t.Fatal(err)
+		}
+
+		if cacheEnabled {
+			if err := deps.Cache.Container.Terminate(ctx); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}()
+
+	var res *http.Response
+	for i, patch := range tc.Requests {
+		res = patchUserPreferences(t, deps, tc.UserId, patch, tc.SkipAccessToken)
+		if i < len(tc.Requests)-1 {
+			if res.StatusCode != http.StatusOK {
+				t.Fatalf("expected status %d got %d for request %d", http.StatusOK, res.StatusCode, i)
+			}
+			if err := res.Body.Close(); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	if res.StatusCode != tc.ExpectedStatusCode {
+		t.Errorf("expected status %d got %d", tc.ExpectedStatusCode, res.StatusCode)
+	}
+
+	var response handlers.UserPreferencesResponse
+	decoder := json.NewDecoder(res.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&response); err != nil {
+		t.Error("failed to decode body", err.Error())
+	}
+
+	if err := res.Body.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if tc.ExpectedStatusCode == http.StatusOK && response.UpdatedAt == nil {
+		t.Error("expected updated_at to be set")
+	}
+	if diff := cmp.Diff(tc.Expected, response, cmpopts.IgnoreFields(handlers.UserPreferencesResponse{}, "UpdatedAt")); diff != "" {
+		t.Errorf("actual does not equal expected. diff: %s", diff)
+	}
+}
+
+func patchUserPreferences(t *testing.T, deps Dependencies, userId uuid.UUID, patch handlers.PatchUserPreferencesRequest, skipAccessToken bool) *http.Response {
+	rbody, err := json.Marshal(patch)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req, err := http.NewRequest(http.MethodPatch, deps.TestServer.URL+"/api/v1/me/preferences", bytes.NewBuffer(rbody))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set(types.HeadersContentTypeKey, types.HeadersContentTypeJsonValue)
+
+	accessToken := CreateAccessToken(t, deps.App.Config.Server.Auth, 12, &userId, true)
+	if !skipAccessToken {
+		req.Header.Add(handlers.HeaderAuthorization, fmt.Sprintf("Bearer %s", accessToken))
+	}
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return res
+}
+
+type PostShortUrlWithPreferencesCase struct {
+	Name                 string
+	Preferences          handlers.PatchUserPreferencesRequest
+	Request              handlers.PostShortUrlRequest
+	ExpectedTtl          time.Duration
+	ExpectedRedirectType *int
+	ExpectedTagNames     []string
+	// saved before the request is sent again with the same idempotency key, the stored short url is expected back
+	ReplayPreferences *handlers.PatchUserPreferencesRequest
+}
+
+func TestPostShortUrlWithPreferences(t *testing.T) {
+	t.Parallel()
+
+	preferredTtl := uint32(86400)
+	requestedTtl := uint32(3600)
+	preferredRedirectType := http.StatusFound
+	requestedRedirectType := http.StatusTemporaryRedirect
+	preferredTagIds := []uuid.UUID{uuid.MustParse(marketingTagId)}
+	requestedTagIds := []uuid.UUID{uuid.MustParse(unusedTagId)}
+	noTagIds := []uuid.UUID{}
+	preferences := handlers.PatchUserPreferencesRequest{DefaultTtl: &preferredTtl, DefaultRedirectType: &preferredRedirectType, DefaultTagIds: &preferredTagIds}
+	changedPreferences := handlers.PatchUserPreferencesRequest{DefaultRedirectType: &requestedRedirectType, DefaultTagIds: &requestedTagIds}
+
+	cases := []PostShortUrlWithPreferencesCase{
+		{
+			Name:                 "FieldsLeftOut",
+			Preferences:          preferences,
+			Request:              handlers.PostShortUrlRequest{DestinationUrl: "https://example.invalid"},
+			ExpectedTtl:          time.Duration(preferredTtl) * time.Second,
+			ExpectedRedirectType: &preferredRedirectType,
+			ExpectedTagNames:     []string{"Marketing"},
+		},
+		{
+			Name:                 "FieldsProvided",
+			Preferences:          preferences,
+			Request:              handlers.PostShortUrlRequest{DestinationUrl: "https://example.invalid", TTL: &requestedTtl, RedirectType: &requestedRedirectType, TagIds: &requestedTagIds},
+			ExpectedTtl:          time.Duration(requestedTtl) * time.Second,
+			ExpectedRedirectType: &requestedRedirectType,
+			ExpectedTagNames:     []string{"Unused"},
+		},
+		{
+			Name:                 "EmptyTagIds",
+			Preferences:          preferences,
+			Request:              handlers.PostShortUrlRequest{DestinationUrl: "https://example.invalid", TagIds: &noTagIds},
+			ExpectedTtl:          time.Duration(preferredTtl) * time.Second,
+			ExpectedRedirectType: &preferredRedirectType,
+		},
+		{
+			Name:                 "ReplayAfterPreferencesChanged",
+			Preferences:          preferences,
+			Request:              handlers.PostShortUrlRequest{DestinationUrl: "https://example.invalid"},
+			ExpectedTtl:          time.Duration(preferredTtl) * time.Second,
+			ExpectedRedirectType: &preferredRedirectType,
+			ExpectedTagNames:     []string{"Marketing"},
+			ReplayPreferences:    &changedPreferences,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.Name+"WithCache", func(t *testing.T) {
+			t.Parallel()
+			runPostShortUrlWithPreferences(t, tc, true)
+		})
+		t.Run(tc.Name+"NoCache", func(t *testing.T) {
+			t.Parallel()
+			runPostShortUrlWithPreferences(t, tc, false)
+		})
+	}
+}
+
+func runPostShortUrlWithPreferences(t *testing.T, tc PostShortUrlWithPreferencesCase, cacheEnabled bool) {
+	ctx := context.Background()
+	deps := SetupDependencies(t, ctx, cacheEnabled)
+	defer func() {
+		if err := deps.App.Server.Close(); err != nil {
+			t.Fatal(err)
+		}
+		deps.StopClickEventWorker()
+
+		if err := deps.Db.Container.Terminate(ctx); err != nil {
+			t.Fatal(err)
+		}
+
+		if cacheEnabled {
+			if err := deps.Cache.Container.Terminate(ctx); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}()
+
+	res := patchUserPreferences(t, deps, tagOwnerUuid, tc.Preferences, false)
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("expected status %d got %d when saving preferences", http.StatusOK, res.StatusCode)
+	}
+	if err := res.Body.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	rbody, err := json.Marshal(tc.Request)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	idempotencyKey := uuid.NewString()
+	accessToken := CreateAccessToken(t, deps.App.Config.Server.Auth, 12, &tagOwnerUuid, true)
+	send := func() types.ShortUrlResponse {
+		req, err := http.NewRequest(http.MethodPost, deps.TestServer.URL+"/api/v1/shorturl", bytes.NewBuffer(rbody))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set(types.HeadersContentTypeKey, types.HeadersContentTypeJsonValue)
+		req.Header.Set(types.HeadersIdempotencyKey, idempotencyKey)
+		req.Header.Add(handlers.HeaderAuthorization, fmt.Sprintf("Bearer %s", accessToken))
+
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if res.StatusCode != http.StatusCreated {
+			t.Fatalf("expected status %d got %d", http.StatusCreated, res.StatusCode)
+		}
+
+		var response types.ShortUrlResponse
+		decoder := json.NewDecoder(res.Body)
+		decoder.DisallowUnknownFields()
+		if err = decoder.Decode(&response); err != nil {
+			t.Fatal("failed to decode body", err.Error())
+		}
+
+		if err = res.Body.Close(); err != nil {
+			t.Fatal(err)
+		}
+		return response
+	}
+
+	before := time.Now()
+	response := send()
+
+	if tc.ReplayPreferences != nil {
+		res := patchUserPreferences(t, deps, tagOwnerUuid, *tc.ReplayPreferences, false)
+		if res.StatusCode != http.StatusOK {
+			t.Fatalf("expected status %d got %d when changing preferences", http.StatusOK, res.StatusCode)
+		}
+		if err := res.Body.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		replayed := send()
+		if diff := cmp.Diff(response.Id, replayed.Id); diff != "" {
+			t.Errorf("expected the replay to return the same short url. diff: %s", diff)
+		}
+	}
+
+	if response.ExpiresAt == nil {
+		t.Fatal("expected expires_at to be set")
+	}
+	ttl := response.ExpiresAt.Sub(before)
+	if ttl < tc.ExpectedTtl-time.Minute || ttl > tc.ExpectedTtl+time.Minute {
+		t.Errorf("expected a ttl of about %s got %s", tc.ExpectedTtl, ttl)
+	}
+
+	if diff := cmp.Diff(tc.ExpectedRedirectType, response.RedirectType); diff != "" {
+		t.Errorf("redirect type does not equal expected. diff: %s", diff)
+	}
+
+	var tagNames []string
+	for _, tag := range response.Tags {
+		tagNames = append(tagNames, tag.Name)
+	}
+	if diff := cmp.Diff(tc.ExpectedTagNames, tagNames); diff != "" {
+		t.Errorf("tags do not equal expected. diff: %s", diff)
+	}
+}
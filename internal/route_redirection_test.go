@@ -1,14 +1,32 @@
 package internal
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"fmt"
+	"io"
 	"net/http"
+	"net/url"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/amieldelatorre/shurl/internal/handlers"
+	"github.com/amieldelatorre/shurl/internal/types"
+	"github.com/google/uuid"
 )
 
 type RedirectionTestCase struct {
 	Name               string
 	slug               string
+	PreviousRequests   int               // requests made before the one that is checked
+	ComingSoonPage     bool              // sets server.coming_soon_page
+	ForcePreview       bool              // sets server.force_preview
+	RedirectType       int               // sets server.redirect_type when not 0
+	QueryOverride      bool              // sets server.query_passthrough_override
+	Host               string            // replaces the test server's host when set
+	RequestHeaders     map[string]string // sent with every request
 	ExpectedStatusCode int
 	ExpectedHeaders    map[string]string
 }
@@ -36,6 +54,271 @@ func TestRedirection(t *testing.T) {
 			ExpectedStatusCode: http.StatusNotFound,
 			ExpectedHeaders:    map[string]string{},
 		},
+		{
+			Name:               "PasswordProtected",
+			slug:               "l0cked",
+			ExpectedStatusCode: http.StatusUnauthorized,
+			ExpectedHeaders: map[string]string{
+				"Content-Type": "text/html; charset=utf-8",
+				"Location":     "",
+			},
+		},
+		{
+			Name:               "ClickLimited",
+			slug:               "on3T1me",
+			ExpectedStatusCode: http.StatusTemporaryRedirect,
+			ExpectedHeaders: map[string]string{
+				"Location": "https://downloads.example.invalid/report.pdf",
+			},
+		},
+		{
+			Name:               "ClickLimitReached",
+			slug:               "on3T1me",
+			PreviousRequests:   1,
+			ExpectedStatusCode: http.StatusGone,
+			ExpectedHeaders: map[string]string{
+				"Location": "",
+			},
+		},
+		{
+			Name:               "ClickLimitExhausted",
+			slug:               "us3dUp",
+			ExpectedStatusCode: http.StatusGone,
+			ExpectedHeaders: map[string]string{
+				"Location": "",
+			},
+		},
+		{
+			Name:               "NotYetActive",
+			slug:               "s00n",
+			ExpectedStatusCode: http.StatusNotFound,
+			ExpectedHeaders: map[string]string{
+				"Location": "",
+			},
+		},
+		{
+			Name:               "NotYetActiveComingSoonPage",
+			slug:               "s00n",
+			ComingSoonPage:     true,
+			ExpectedStatusCode: http.StatusServiceUnavailable,
+			ExpectedHeaders: map[string]string{
+				"Content-Type":  "text/html; charset=utf-8",
+				"Cache-Control": "no-store",
+				"Location":      "",
+			},
+		},
+		{
+			Name:               "Preview",
+			slug:               "tiLd+",
+			ExpectedStatusCode: http.StatusOK,
+			ExpectedHeaders: map[string]string{
+				"Content-Type": "text/html; charset=utf-8",
+				"Location":     "",
+			},
+		},
+		{
+			Name:               "PreviewQueryParam",
+			slug:               "tiLd?preview",
+			ExpectedStatusCode: http.StatusOK,
+			ExpectedHeaders: map[string]string{
+				"Content-Type": "text/html; charset=utf-8",
+				"Location":     "",
+			},
+		},
+		{
+			Name:               "PreviewNotFound",
+			slug:               "asdfadsasdfasdf+",
+			ExpectedStatusCode: http.StatusNotFound,
+			ExpectedHeaders:    map[string]string{},
+		},
+		{
+			Name:               "PreviewDoesNotUseClick",
+			slug:               "on3T1me+",
+			ExpectedStatusCode: http.StatusOK,
+			ExpectedHeaders: map[string]string{
+				"Location": "",
+			},
+		},
+		{
+			Name:               "ForcedPreview",
+			slug:               "pr3view",
+			ExpectedStatusCode: http.StatusOK,
+			ExpectedHeaders: map[string]string{
+				"Content-Type": "text/html; charset=utf-8",
+				"Location":     "",
+			},
+		},
+		{
+			Name:               "ForcedPreviewContinue",
+			slug:               "pr3view?continue",
+			ExpectedStatusCode: http.StatusTemporaryRedirect,
+			ExpectedHeaders: map[string]string{
+				"Location": "https://news.example.invalid/article",
+			},
+		},
+		{
+			Name:               "GlobalForcedPreview",
+			slug:               "tiLd",
+			ForcePreview:       true,
+			ExpectedStatusCode: http.StatusOK,
+			ExpectedHeaders: map[string]string{
+				"Content-Type": "text/html; charset=utf-8",
+				"Location":     "",
+			},
+		},
+		{
+			Name:               "PermanentRedirect",
+			slug:               "p3rmLink",
+			ExpectedStatusCode: http.StatusPermanentRedirect,
+			ExpectedHeaders: map[string]string{
+				"Location":      "https://blog.example.invalid/moved",
+				"Cache-Control": "no-cache",
+			},
+		},
+		{
+			Name:               "ServerDefaultRedirectType",
+			slug:               "tiLd",
+			RedirectType:       http.StatusFound,
+			ExpectedStatusCode: http.StatusFound,
+			ExpectedHeaders: map[string]string{
+				"Location": "https://google.com",
+			},
+		},
+		{
+			Name:               "ShortUrlRedirectTypeOverridesServerDefault",
+			slug:               "p3rmLink",
+			RedirectType:       http.StatusFound,
+			ExpectedStatusCode: http.StatusPermanentRedirect,
+			ExpectedHeaders: map[string]string{
+				"Location": "https://blog.example.invalid/moved",
+			},
+		},
+		{
+			Name:               "PathPassthrough",
+			slug:               "d0csLink/guide/intro",
+			ExpectedStatusCode: http.StatusTemporaryRedirect,
+			ExpectedHeaders: map[string]string{
+				"Location": "https://docs.example.invalid/v2/guide/intro?lang=en",
+			},
+		},
+		{
+			Name:               "PathPassthroughNotAllowed",
+			slug:               "tiLd/guide/intro",
+			ExpectedStatusCode: http.StatusNotFound,
+			ExpectedHeaders:    map[string]string{},
+		},
+		{
+			Name:               "QueryPassthrough",
+			slug:               "d0csLink?utm_source=mail",
+			ExpectedStatusCode: http.StatusTemporaryRedirect,
+			ExpectedHeaders: map[string]string{
+				"Location": "https://docs.example.invalid/v2?lang=en&utm_source=mail",
+			},
+		},
+		{
+			Name:               "QueryPassthroughDestinationWins",
+			slug:               "d0csLink?lang=fr",
+			ExpectedStatusCode: http.StatusTemporaryRedirect,
+			ExpectedHeaders: map[string]string{
+				"Location": "https://docs.example.invalid/v2?lang=en",
+			},
+		},
+		{
+			Name:               "QueryPassthroughOverride",
+			slug:               "d0csLink?lang=fr",
+			QueryOverride:      true,
+			ExpectedStatusCode: http.StatusTemporaryRedirect,
+			ExpectedHeaders: map[string]string{
+				"Location": "https://docs.example.invalid/v2?lang=fr",
+			},
+		},
+		{
+			Name:               "QueryPassthroughNotAllowed",
+			slug:               "tiLd?utm_source=mail",
+			ExpectedStatusCode: http.StatusTemporaryRedirect,
+			ExpectedHeaders: map[string]string{
+				"Location": "https://google.com",
+			},
+		},
+		{
+			Name:               "UtmParams",
+			slug:               "c4mpaign",
+			ExpectedStatusCode: http.StatusTemporaryRedirect,
+			ExpectedHeaders: map[string]string{
+				"Location": "https://shop.example.invalid/sale?utm_campaign=spring+sale&utm_medium=email&utm_source=newsletter",
+			},
+		},
+		{
+			Name:               "UtmParamsNotOverriddenByQueryPassthrough",
+			slug:               "c4mpaign?utm_source=other&ref=abc",
+			ExpectedStatusCode: http.StatusTemporaryRedirect,
+			ExpectedHeaders: map[string]string{
+				"Location": "https://shop.example.invalid/sale?ref=abc&utm_campaign=spring+sale&utm_medium=email&utm_source=newsletter",
+			},
+		},
+		{
+			Name:               "RoutingRulePlatform",
+			slug:               "g3tApp",
+			RequestHeaders:     map[string]string{"User-Agent": "Mozilla/5.0 (iPhone; CPU iPhone OS 17_4 like Mac OS X) AppleWebKit/605.1.15"},
+			ExpectedStatusCode: http.StatusTemporaryRedirect,
+			ExpectedHeaders: map[string]string{
+				"Location": "https://apps.example.invalid/ios",
+				"Vary":     "User-Agent, Accept-Language",
+			},
+		},
+		{
+			Name:               "RoutingRuleOrder",
+			slug:               "g3tApp",
+			RequestHeaders:     map[string]string{"User-Agent": "Mozilla/5.0 (Linux; Android 14; Pixel 8)", "Accept-Language": "fr-CA,fr;q=0.9"},
+			ExpectedStatusCode: http.StatusTemporaryRedirect,
+			ExpectedHeaders: map[string]string{
+				"Location": "https://apps.example.invalid/android",
+			},
+		},
+		{
+			Name:               "RoutingRuleLanguage",
+			slug:               "g3tApp",
+			RequestHeaders:     map[string]string{"User-Agent": "Mozilla/5.0 (X11; Linux x86_64)", "Accept-Language": "en-NZ, fr-CA;q=0.5"},
+			ExpectedStatusCode: http.StatusTemporaryRedirect,
+			ExpectedHeaders: map[string]string{
+				"Location": "https://www.example.invalid/fr",
+			},
+		},
+		{
+			Name:               "RoutingRuleHost",
+			slug:               "g3tApp",
+			Host:               "go.example.invalid",
+			ExpectedStatusCode: http.StatusTemporaryRedirect,
+			ExpectedHeaders: map[string]string{
+				"Location": "https://partners.example.invalid/app",
+			},
+		},
+		{
+			Name:               "RoutingRuleFallback",
+			slug:               "g3tApp",
+			RequestHeaders:     map[string]string{"User-Agent": "Mozilla/5.0 (X11; Linux x86_64)", "Accept-Language": "en-NZ, fr;q=0"},
+			ExpectedStatusCode: http.StatusTemporaryRedirect,
+			ExpectedHeaders: map[string]string{
+				"Location": "https://www.example.invalid",
+			},
+		},
+		{
+			Name:               "StickyVariantCookie",
+			slug:               "spl1tAB",
+			RequestHeaders:     map[string]string{"Cookie": handlers.CookieVariantName + "=019cc1c7-d1f0-734f-a2b7-a5ee16fbae02"},
+			ExpectedStatusCode: http.StatusTemporaryRedirect,
+			ExpectedHeaders: map[string]string{
+				"Location":   "https://landing.example.invalid/b",
+				"Set-Cookie": "",
+			},
+		},
+		{
+			Name:               "ExpiredComingSoonPage",
+			slug:               "zzM0ofz",
+			ComingSoonPage:     true,
+			ExpectedStatusCode: http.StatusNotFound,
+			ExpectedHeaders:    map[string]string{},
+		},
 	}
 
 	for _, tc := range cases {
@@ -57,6 +340,7 @@ func runTestRedirect(t *testing.T, tc RedirectionTestCase, cacheEnabled bool) {
 		if err := deps.App.Server.Close(); err != nil {
 			t.Fatal(err)
 		}
+		deps.StopClickEventWorker()
 
 		if err := deps.Db.Container.Terminate(ctx); err != nil {
 			t.Fatal(err)
@@ -69,9 +353,11 @@ func runTestRedirect(t *testing.T, tc RedirectionTestCase, cacheEnabled bool) {
 		}
 	}()
 
-	req, err := http.NewRequest(http.MethodGet, deps.TestServer.URL+"/"+tc.slug, nil)
-	if err != nil {
-		t.Fatal(err)
+	deps.App.Config.Server.ComingSoonPage = tc.ComingSoonPage
+	deps.App.Config.Server.ForcePreview = tc.ForcePreview
+	deps.App.Config.Server.QueryPassthroughOverride = tc.QueryOverride
+	if tc.RedirectType != 0 {
+		deps.App.Config.Server.RedirectType = tc.RedirectType
 	}
 
 	client := &http.Client{
@@ -80,9 +366,26 @@ func runTestRedirect(t *testing.T, tc RedirectionTestCase, cacheEnabled bool) {
 		},
 	}
 
-	res, err := client.Do(req)
-	if err != nil {
-		t.Fatal(err)
+	var res *http.Response
+	for i := 0; i <= tc.PreviousRequests; i++ {
+		req, err := http.NewRequest(http.MethodGet, deps.TestServer.URL+"/"+tc.slug, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tc.Host != "" {
+			req.Host = tc.Host
+		}
+		for k, v := range tc.RequestHeaders {
+			req.Header.Set(k, v)
+		}
+
+		res, err = client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = res.Body.Close(); err != nil {
+			t.Fatal(err)
+		}
 	}
 
 	if res.StatusCode != tc.ExpectedStatusCode {
@@ -96,3 +399,493 @@ func runTestRedirect(t *testing.T, tc RedirectionTestCase, cacheEnabled bool) {
 		}
 	}
 }
+
+type UnlockTestCase struct {
+	Name                     string
+	Slug                     string
+	Passwords                []string // submitted in order, only the response to the last one is checked
+	ExpectedStatusCode       int
+	ExpectUnlocked           bool
+	UseUnlockTokenToLogin    bool
+	UsePreview               bool    // uses the unlock cookie on "/{slug}+" instead of "/{slug}"
+	ChangedPassword          *string // patched onto the short url after unlocking, an empty string removes the password
+	ExpectedStatusAfterUse   int
+	ExpectedLocationAfterUse string
+}
+
+func TestVariants(t *testing.T) {
+	t.Parallel()
+	t.Run("WithCache", func(t *testing.T) {
+		t.Parallel()
+		runTestVariants(t, true)
+	})
+	t.Run("NoCache", func(t *testing.T) {
+		t.Parallel()
+		runTestVariants(t, false)
+	})
+}
+
+func runTestVariants(t *testing.T, cacheEnabled bool) {
+	ctx := context.Background()
+	deps := SetupDependencies(t, ctx, cacheEnabled)
+	defer func() {
+		if err := deps.App.Server.Close(); err != nil {
+			t.Fatal(err)
+		}
+		deps.StopClickEventWorker()
+
+		if err := deps.Db.Container.Terminate(ctx); err != nil {
+			t.Fatal(err)
+		}
+
+		if cacheEnabled {
+			if err := deps.Cache.Container.Terminate(ctx); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}()
+
+	shortUrlId := "019cc1c7-d1f0-734f-a2b7-a5ee16fbad15"
+	ownerId := uuid.MustParse("019cbcdb-aaf4-7680-a3f7-8acef63e0151")
+	variantLocations := map[string]string{
+		"019cc1c7-d1f0-734f-a2b7-a5ee16fbae01": "https://landing.example.invalid/a",
+		"019cc1c7-d1f0-734f-a2b7-a5ee16fbae02": "https://landing.example.invalid/b",
+	}
+	initialHits := 4
+	redirects := 10
+
+	client := &http.Client{
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	// every new visitor is assigned a variant and told to remember it
+	for i := 0; i < redirects; i++ {
+		res, err := client.Get(deps.TestServer.URL + "/spl1tAB")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = res.Body.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		if res.StatusCode != http.StatusTemporaryRedirect {
+			t.Fatalf("expected status %d got %d", http.StatusTemporaryRedirect, res.StatusCode)
+		}
+
+		var variantCookie *http.Cookie
+		for _, cookie := range res.Cookies() {
+			if cookie.Name == handlers.CookieVariantName {
+				variantCookie = cookie
+			}
+		}
+		if variantCookie == nil {
+			t.Fatal("expected a variant cookie")
+		}
+		if variantCookie.Path != "/spl1tAB" {
+			t.Errorf("expected variant cookie path /spl1tAB got %s", variantCookie.Path)
+		}
+
+		expectedLocation, ok := variantLocations[variantCookie.Value]
+		if !ok {
+			t.Fatalf("variant cookie %s is not one of the short url's variants", variantCookie.Value)
+		}
+		if location := res.Header.Get("Location"); location != expectedLocation {
+			t.Errorf("expected redirect to %s for variant %s, got %s", expectedLocation, variantCookie.Value, location)
+		}
+	}
+
+	// hits are counted by the click event worker, give it a moment to flush
+	accessToken := CreateAccessToken(t, deps.App.Config.Server.Auth, 12, &ownerId, true)
+	var hits int
+	for attempt := 0; attempt < 20; attempt++ {
+		req, err := http.NewRequest(http.MethodGet, deps.TestServer.URL+"/api/v1/me/shorturl/"+shortUrlId+"/stats", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Add(handlers.HeaderAuthorization, fmt.Sprintf("Bearer %s", accessToken))
+
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var response handlers.GetShortUrlStatsResponse
+		if err = json.NewDecoder(res.Body).Decode(&response); err != nil {
+			t.Fatal("failed to decode body", err.Error())
+		}
+		if err = res.Body.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if len(response.Variants) != len(variantLocations) {
+			t.Fatalf("expected %d variants got %d", len(variantLocations), len(response.Variants))
+		}
+
+		hits = 0
+		for _, v := range response.Variants {
+			hits += v.Hits
+		}
+		if hits >= initialHits+redirects {
+			break
+		}
+		time.Sleep(200 * time.Millisecond)
+	}
+
+	if hits != initialHits+redirects {
+		t.Errorf("expected %d variant hits got %d", initialHits+redirects, hits)
+	}
+
+	// the preview's continue link keeps the variant the preview showed
+	res, err := client.Get(deps.TestServer.URL + "/spl1tAB+")
+	if err != nil {
+		t.Fatal(err)
+	}
+	previewBody, err := io.ReadAll(res.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = res.Body.Close(); err != nil {
+		t.Fatal(err)
+	}
+	var previewVariantId string
+	for id, location := range variantLocations {
+		if strings.Contains(string(previewBody), location) {
+			previewVariantId = id
+		}
+	}
+	if previewVariantId == "" || !strings.Contains(string(previewBody), "variant="+previewVariantId) {
+		t.Errorf("expected the preview to continue to the variant it shows, got %s", previewBody)
+	}
+
+	for id, location := range variantLocations {
+		res, err := client.Get(deps.TestServer.URL + "/spl1tAB?continue&variant=" + id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = res.Body.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if res.Header.Get("Location") != location {
+			t.Errorf("expected continuing with variant %s to redirect to %s, got %s", id, location, res.Header.Get("Location"))
+		}
+	}
+}
+
+func TestUnlock(t *testing.T) {
+	t.Parallel()
+	changedPassword := "new-password"
+	cases := []UnlockTestCase{
+		{
+			Name:                     "CorrectPassword",
+			Slug:                     "l0cked",
+			Passwords:                []string{"password"},
+			ExpectedStatusCode:       http.StatusSeeOther,
+			ExpectUnlocked:           true,
+			ExpectedStatusAfterUse:   http.StatusTemporaryRedirect,
+			ExpectedLocationAfterUse: "https://docs.example.invalid/internal",
+		},
+		{
+			Name:                   "CorrectPasswordPreview",
+			Slug:                   "l0cked",
+			Passwords:              []string{"password"},
+			ExpectedStatusCode:     http.StatusSeeOther,
+			ExpectUnlocked:         true,
+			UsePreview:             true,
+			ExpectedStatusAfterUse: http.StatusOK,
+		},
+		{
+			Name:                   "PasswordChangedAfterUnlock",
+			Slug:                   "l0cked",
+			Passwords:              []string{"password"},
+			ExpectedStatusCode:     http.StatusSeeOther,
+			ExpectUnlocked:         true,
+			ChangedPassword:        &changedPassword,
+			ExpectedStatusAfterUse: http.StatusUnauthorized,
+		},
+		{
+			Name:               "WrongPassword",
+			Slug:               "l0cked",
+			Passwords:          []string{"wrong-password"},
+			ExpectedStatusCode: http.StatusUnauthorized,
+		},
+		{
+			Name:               "RateLimited",
+			Slug:               "l0cked",
+			Passwords:          []string{"wrong1", "wrong2", "wrong3", "wrong4", "wrong5", "password"},
+			ExpectedStatusCode: http.StatusTooManyRequests,
+		},
+		{
+			Name:               "NotPasswordProtected",
+			Slug:               "tiLd",
+			Passwords:          []string{"password"},
+			ExpectedStatusCode: http.StatusSeeOther,
+		},
+		{
+			Name:               "NotFound",
+			Slug:               "asdfadsasdfasdf",
+			Passwords:          []string{"password"},
+			ExpectedStatusCode: http.StatusNotFound,
+		},
+		{
+			Name:                  "UnlockTokenCannotBeUsedToLogin",
+			Slug:                  "l0cked",
+			Passwords:             []string{"password"},
+			ExpectedStatusCode:    http.StatusSeeOther,
+			ExpectUnlocked:        true,
+			UseUnlockTokenToLogin: true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.Name+"WithCache", func(t *testing.T) {
+			t.Parallel()
+			runTestUnlock(t, tc, true)
+		})
+		t.Run(tc.Name+"NoCache", func(t *testing.T) {
+			t.Parallel()
+			runTestUnlock(t, tc, false)
+		})
+	}
+}
+
+func runTestUnlock(t *testing.T, tc UnlockTestCase, cacheEnabled bool) {
+	ctx := context.Background()
+	deps := SetupDependencies(t, ctx, cacheEnabled)
+	defer func() {
+		if err := deps.App.Server.Close(); err != nil {
+			t.Fatal(err)
+		}
+		deps.StopClickEventWorker()
+
+		if err := deps.Db.Container.Terminate(ctx); err != nil {
+			t.Fatal(err)
+		}
+
+		if cacheEnabled {
+			if err := deps.Cache.Container.Terminate(ctx); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}()
+
+	client := &http.Client{
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	var res *http.Response
+	for _, password := range tc.Passwords {
+		form := url.Values{"password": {password}}
+		req, err := http.NewRequest(http.MethodPost, deps.TestServer.URL+"/"+tc.Slug+"/unlock", strings.NewReader(form.Encode()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		res, err = client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = res.Body.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if res.StatusCode != tc.ExpectedStatusCode {
+		t.Errorf("expected status %d got %d", tc.ExpectedStatusCode, res.StatusCode)
+	}
+
+	// one cookie for the short url and one for its preview
+	unlockCookies := map[string]*http.Cookie{}
+	for _, c := range res.Cookies() {
+		if c.Name == handlers.CookieUnlockTokenName {
+			unlockCookies[c.Path] = c
+		}
+	}
+
+	if !tc.ExpectUnlocked {
+		if len(unlockCookies) > 0 {
+			t.Errorf("expected no unlock cookie, got one")
+		}
+		return
+	}
+
+	usePath := "/" + tc.Slug
+	if tc.UsePreview {
+		usePath += "+"
+	}
+	for _, path := range []string{"/" + tc.Slug, "/" + tc.Slug + "+"} {
+		if unlockCookies[path] == nil {
+			t.Fatalf("expected an unlock cookie with path %s, got %v", path, unlockCookies)
+		}
+	}
+	unlockCookie := unlockCookies[usePath]
+
+	if tc.UseUnlockTokenToLogin {
+		req, err := http.NewRequest(http.MethodGet, deps.TestServer.URL+"/api/v1/auth/validate", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Add(handlers.HeaderAuthorization, fmt.Sprintf("Bearer %s", unlockCookie.Value))
+
+		res, err = client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = res.Body.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		if res.StatusCode != http.StatusUnauthorized {
+			t.Errorf("expected status %d when logging in with an unlock token, got %d", http.StatusUnauthorized, res.StatusCode)
+		}
+		return
+	}
+
+	if tc.ChangedPassword != nil {
+		body, err := json.Marshal(handlers.PatchShortUrlRequest{Password: tc.ChangedPassword})
+		if err != nil {
+			t.Fatal(err)
+		}
+		req, err := http.NewRequest(http.MethodPatch, deps.TestServer.URL+"/api/v1/me/shorturl/019cc1c7-d1f0-734f-a2b7-a5ee16fbad0c", bytes.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		accessToken := CreateAccessToken(t, deps.App.Config.Server.Auth, 12, &tagOwnerUuid, true)
+		req.Header.Add(handlers.HeaderAuthorization, fmt.Sprintf("Bearer %s", accessToken))
+		req.Header.Set(types.HeadersContentTypeKey, types.HeadersContentTypeJsonValue)
+		res, err := client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = res.Body.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if res.StatusCode != http.StatusOK {
+			t.Fatalf("expected status %d changing the password got %d", http.StatusOK, res.StatusCode)
+		}
+	}
+
+	req, err := http.NewRequest(http.MethodGet, deps.TestServer.URL+usePath, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.AddCookie(unlockCookie)
+
+	res, err = client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = res.Body.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if res.StatusCode != tc.ExpectedStatusAfterUse {
+		t.Errorf("expected status %d after unlocking, got %d", tc.ExpectedStatusAfterUse, res.StatusCode)
+	}
+	if location := res.Header.Get("Location"); location != tc.ExpectedLocationAfterUse {
+		t.Errorf("expected redirect to %s after unlocking, got %s", tc.ExpectedLocationAfterUse, location)
+	}
+}
+
+type QrCodeTestCase struct {
+	Name                string
+	slug                string
+	Query               string
+	ExpectedStatusCode  int
+	ExpectedContentType string
+	ExpectedSize        int
+	Expected            types.ErrorResponse
+}
+
+func TestQrCode(t *testing.T) {
+	t.Parallel()
+	cases := []QrCodeTestCase{
+		{
+			Name:                "Found",
+			slug:                "tiLd",
+			ExpectedStatusCode:  http.StatusOK,
+			ExpectedContentType: "image/png",
+			ExpectedSize:        handlers.DefaultQrCodeSize,
+		},
+		{
+			Name:                "Svg",
+			slug:                "tiLd",
+			Query:               "?format=svg&size=512",
+			ExpectedStatusCode:  http.StatusOK,
+			ExpectedContentType: "image/svg+xml",
+		},
+		{
+			Name:                "NotYetActive",
+			slug:                "s00n",
+			ExpectedStatusCode:  http.StatusOK,
+			ExpectedContentType: "image/png",
+			ExpectedSize:        handlers.DefaultQrCodeSize,
+		},
+		{
+			Name:               "NotFound",
+			slug:               "asdfadsasdfasdf",
+			ExpectedStatusCode: http.StatusNotFound,
+		},
+		{
+			Name:               "Expired",
+			slug:               "zzM0ofz",
+			ExpectedStatusCode: http.StatusNotFound,
+		},
+		{
+			Name:               "InvalidFormat",
+			slug:               "tiLd",
+			Query:              "?format=gif",
+			ExpectedStatusCode: http.StatusBadRequest,
+			Expected: types.ErrorResponse{
+				Errors: []string{handlers.QrCodeFormatQueryParamError},
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.Name+"WithCache", func(t *testing.T) {
+			t.Parallel()
+			runTestQrCode(t, tc, true)
+		})
+		t.Run(tc.Name+"NoCache", func(t *testing.T) {
+			t.Parallel()
+			runTestQrCode(t, tc, false)
+		})
+	}
+}
+
+func runTestQrCode(t *testing.T, tc QrCodeTestCase, cacheEnabled bool) {
+	ctx := context.Background()
+	deps := SetupDependencies(t, ctx, cacheEnabled)
+	defer func() {
+		if err := deps.App.Server.Close(); err != nil {
+			t.Fatal(err)
+		}
+		deps.StopClickEventWorker()
+
+		if err := deps.Db.Container.Terminate(ctx); err != nil {
+			t.Fatal(err)
+		}
+
+		if cacheEnabled {
+			if err := deps.Cache.Container.Terminate(ctx); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}()
+
+	res, err := http.Get(deps.TestServer.URL + "/" + tc.slug + "/qr" + tc.Query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := res.Body.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	checkQrCodeResponse(t, res, tc.ExpectedStatusCode, tc.ExpectedContentType, tc.ExpectedSize, tc.Expected)
+}
@@ -3,10 +3,16 @@ package internal
 import (
 	"bytes"
 	"context"
+	"encoding/csv"
 	"encoding/json"
 	"fmt"
+	"image/png"
+	"io"
 	"net/http"
+	"net/url"
+	"slices"
 	"strconv"
+	"strings"
 	"testing"
 	"time"
 
@@ -21,6 +27,7 @@ type PostShortUrlTestCase struct {
 	Name                  string
 	Request               handlers.PostShortUrlRequest
 	AllowAnonymous        bool
+	AllowNonExpiring      bool
 	SkipIdempotencyKey    bool
 	SkipJsonHeader        bool
 	UseIdempotencyKeyUuid *uuid.UUID
@@ -29,10 +36,18 @@ type PostShortUrlTestCase struct {
 	UseHeader             bool
 	UseInvalidAccessToken bool
 	UseExpiredAccessToken bool
+	Replay                bool // sends the same request again with the same idempotency key
 	ExpectedStatusCode    int
 	Expected              types.ShortUrlResponse
 }
 
+// the default short url ttl limits, test/baseconf.yaml doesn't change them
+const (
+	anonymousMaxTtl         uint32 = 604800
+	authenticatedDefaultTtl uint32 = 604800
+	authenticatedMaxTtl     uint32 = 2629746
+)
+
 var (
 	usedIdempotencyKey = uuid.MustParse("019cc05a-72a5-7479-a1dd-0105df4fc6c4")
 	validUserUuid      = uuid.MustParse("019cc05a-7415-7528-8c5a-e0487fad449c")
@@ -42,10 +57,46 @@ func TestPostShortUrl(t *testing.T) {
 	happyPathUrl := "https://google.com"
 	var ttlLessThanMin uint32 = 899
 	var ttlOnMin uint32 = 900
-	ttlOnAnonymousMax := handlers.MaxAnonymousShortUrlTtl
+	ttlOnAnonymousMax := anonymousMaxTtl
 	var ttlGreaterThanAnonymousMax uint32 = 604801
-	ttlOnAuthenticatedMax := handlers.MaxAuthenticatedShortUrlTtl
+	ttlOnAuthenticatedMax := authenticatedMaxTtl
 	var ttlGreaterThanAuthenticatedMax uint32 = 2629747
+	var slidingTtl uint32 = 3600
+	slidingTtlInt := 3600
+	neverExpires := true
+	customSlug := "q3-report"
+	shortUrlPassword := "internal-docs"
+	shortUrlPasswordTooShort := "abc"
+	passwordProtected := true
+	maxClicks := 1
+	maxClicksTooLow := 0
+	// postgres only keeps microseconds, truncating keeps the round trip exact
+	activatesAt := time.Now().Add(24 * time.Hour).Truncate(time.Second)
+	enabled := true
+	utmSource := "newsletter"
+	utmMedium := "email"
+	utmCampaign := "spring sale"
+	utmSourcePadded := "  newsletter  "
+	utmBlank := "   "
+	utmTooLong := strings.Repeat("a", 256)
+	routingRules := []handlers.RoutingRuleRequest{
+		{Match: "platform", Value: " iOS ", DestinationUrl: "https://apps.example.invalid/ios"},
+		{Match: "language", Value: "fr", DestinationUrl: "https://www.example.invalid/fr"},
+	}
+	variants := []handlers.ShortUrlVariantRequest{
+		{DestinationUrl: "https://landing.example.invalid/a", Weight: 70},
+		{DestinationUrl: "https://landing.example.invalid/b", Weight: 30},
+	}
+	singleVariant := variants[:1]
+	invalidPlatformRoutingRules := []handlers.RoutingRuleRequest{
+		{Match: "platform", Value: "blackberry", DestinationUrl: "https://apps.example.invalid/bb"},
+	}
+	redirectType := http.StatusMovedPermanently
+	invalidRedirectType := http.StatusSeeOther
+	activatesAtTooFar := time.Now().Add(time.Duration(handlers.MaxShortUrlActivationDelay+3600) * time.Second)
+	takenSlug := "tiLd"
+	reservedSlug := "Dashboard"
+	invalidSlug := "q3/report"
 
 	t.Parallel()
 	cases := []PostShortUrlTestCase{
@@ -449,7 +500,7 @@ func TestPostShortUrl(t *testing.T) {
 			UseHeader:             false,
 			ExpectedStatusCode:    http.StatusBadRequest,
 			Expected: types.ShortUrlResponse{
-				Errors: []string{"Key: 'PostShortUrlRequest.TTL' Error:Field validation for 'TTL' failed on the 'max' tag"},
+				Errors: []string{"short urls can only be up to 2629746 seconds"},
 			},
 		},
 		{
@@ -491,11 +542,13 @@ func TestPostShortUrl(t *testing.T) {
 			},
 		},
 		{
-			Name: "HappyPathAuthenticated",
+			Name: "AuthenticatedNeverExpires",
 			Request: handlers.PostShortUrlRequest{
 				DestinationUrl: "https://google.com",
+				NeverExpires:   true,
 			},
-			AllowAnonymous:        false,
+			AllowAnonymous:        true,
+			AllowNonExpiring:      true,
 			SkipIdempotencyKey:    false,
 			SkipJsonHeader:        false,
 			UseIdempotencyKeyUuid: nil,
@@ -506,29 +559,73 @@ func TestPostShortUrl(t *testing.T) {
 			Expected: types.ShortUrlResponse{
 				DestinationUrl: &happyPathUrl,
 				UserId:         &validUserUuid,
+				NeverExpires:   &neverExpires,
 			},
 		},
 		{
-			Name: "HappyPathAnonymous",
+			Name: "AuthenticatedNeverExpiresNotAllowed",
+			Request: handlers.PostShortUrlRequest{
+				DestinationUrl: "https://google.com",
+				NeverExpires:   true,
+			},
+			AllowAnonymous:        true,
+			AllowNonExpiring:      false,
+			SkipIdempotencyKey:    false,
+			SkipJsonHeader:        false,
+			UseIdempotencyKeyUuid: nil,
+			UseUserUuid:           &validUserUuid,
+			UseCookie:             true,
+			UseHeader:             false,
+			ExpectedStatusCode:    http.StatusBadRequest,
+			Expected: types.ShortUrlResponse{
+				Errors: []string{handlers.NeverExpiresNotAllowedError},
+			},
+		},
+		{
+			Name: "AuthenticatedNeverExpiresWithTtl",
+			Request: handlers.PostShortUrlRequest{
+				DestinationUrl: "https://google.com",
+				TTL:            &ttlOnMin,
+				NeverExpires:   true,
+			},
+			AllowAnonymous:        true,
+			AllowNonExpiring:      true,
+			SkipIdempotencyKey:    false,
+			SkipJsonHeader:        false,
+			UseIdempotencyKeyUuid: nil,
+			UseUserUuid:           &validUserUuid,
+			UseCookie:             true,
+			UseHeader:             false,
+			ExpectedStatusCode:    http.StatusBadRequest,
+			Expected: types.ShortUrlResponse{
+				Errors: []string{handlers.NeverExpiresWithTtlError},
+			},
+		},
+		{
+			Name: "AnonymousNeverExpires",
 			Request: handlers.PostShortUrlRequest{
 				DestinationUrl: "https://google.com",
+				NeverExpires:   true,
 			},
 			AllowAnonymous:        true,
+			AllowNonExpiring:      true,
 			SkipIdempotencyKey:    false,
 			SkipJsonHeader:        false,
 			UseIdempotencyKeyUuid: nil,
 			UseUserUuid:           nil,
 			UseCookie:             false,
 			UseHeader:             false,
-			ExpectedStatusCode:    http.StatusCreated,
+			ExpectedStatusCode:    http.StatusBadRequest,
 			Expected: types.ShortUrlResponse{
-				DestinationUrl: &happyPathUrl,
+				Errors: []string{handlers.NeverExpiresNotAllowedError},
 			},
 		},
 		{
-			Name: "HappyPathAuthenticatedAllowAnonymous",
+			Name: "AuthenticatedSlidingTtl",
 			Request: handlers.PostShortUrlRequest{
 				DestinationUrl: "https://google.com",
+				TTL:            &ttlOnMin,
+				SlidingTtl:     &slidingTtl,
 			},
 			AllowAnonymous:        true,
 			SkipIdempotencyKey:    false,
@@ -541,278 +638,3701 @@ func TestPostShortUrl(t *testing.T) {
 			Expected: types.ShortUrlResponse{
 				DestinationUrl: &happyPathUrl,
 				UserId:         &validUserUuid,
+				SlidingTtl:     &slidingTtlInt,
 			},
 		},
-	}
-
-	for _, tc := range cases {
-		t.Run(tc.Name+"WithCache", func(t *testing.T) {
-			t.Parallel()
-			runTestPostShortUrl(t, tc, true)
-		})
-		t.Run(tc.Name+"NoCache", func(t *testing.T) {
-			t.Parallel()
-			runTestPostShortUrl(t, tc, false)
-		})
-	}
-}
-
-func runTestPostShortUrl(t *testing.T, tc PostShortUrlTestCase, cacheEnabled bool) {
-	ctx := context.Background()
-	deps := SetupDependencies(t, ctx, cacheEnabled)
-	deps.App.Config.Server.AllowAnonymous = tc.AllowAnonymous
-
-	defer func() {
-		if err := deps.App.Server.Close(); err != nil {
-			t.Fatal(err)
-		}
-
-		if err := deps.Db.Container.Terminate(ctx); err != nil {
-			t.Fatal(err)
-		}
-
-		if cacheEnabled {
-			if err := deps.Cache.Container.Terminate(ctx); err != nil {
-				t.Fatal(err)
-			}
-		}
-	}()
-
-	var accessToken string
-	if tc.UseUserUuid != nil {
-		var h int
-		if tc.UseExpiredAccessToken {
-			h = -12
-		} else {
-			h = 12
-		}
-		accessToken = CreateAccessToken(t, deps.App.Config.Server.Auth, h, tc.UseUserUuid, !tc.UseInvalidAccessToken)
-	}
-
-	rbody, err := json.Marshal(tc.Request)
-	if err != nil {
-		t.Fatal(err)
-	}
-
-	req, err := http.NewRequest(http.MethodPost, deps.TestServer.URL+"/api/v1/shorturl", bytes.NewBuffer(rbody))
-	if err != nil {
-		t.Fatal(err)
-	}
-
-	if !tc.SkipJsonHeader {
-		req.Header.Set(types.HeadersContentTypeKey, types.HeadersContentTypeJsonValue)
-	}
-
-	if tc.UseHeader && tc.UseUserUuid != nil {
-		req.Header.Add(handlers.HeaderAuthorization, fmt.Sprintf("Bearer %s", accessToken))
-	}
-
-	if !tc.SkipIdempotencyKey {
-		var key uuid.UUID
-		if tc.UseIdempotencyKeyUuid != nil {
-			key = *tc.UseIdempotencyKeyUuid
-		} else {
-			key, err = uuid.NewV7()
-			if err != nil {
-				t.Fatal(err)
-			}
-		}
-		req.Header.Add(types.HeadersIdempotencyKey, key.String())
-	}
-
-	if tc.UseCookie && tc.UseUserUuid != nil {
-		cookie := &http.Cookie{
-			Name:     handlers.CookieAccessTokenName,
-			Value:    accessToken,
-			Path:     "/",
-			MaxAge:   12 * 60 * 60, // x * minutes in an hour * seconds in a minute
-			Expires:  time.Now().Add(12 * time.Hour),
-			HttpOnly: true,
-			Secure:   deps.App.Config.Server.HttpsEnabled,
-			SameSite: http.SameSiteStrictMode,
-		}
-
-		req.AddCookie(cookie)
-	}
-
-	res, err := http.DefaultClient.Do(req)
-	if err != nil {
-		t.Fatal(err)
-	}
-
-	if res.StatusCode != tc.ExpectedStatusCode {
-		t.Errorf("expected status %d got %d", tc.ExpectedStatusCode, res.StatusCode)
-	}
-
-	var shortUrlPostResponse types.ShortUrlResponse
-	decoder := json.NewDecoder(res.Body)
-	decoder.DisallowUnknownFields()
-	if err = decoder.Decode(&shortUrlPostResponse); err != nil {
-		t.Error("failed to decode body", err.Error())
-	}
-
-	err = res.Body.Close()
-	if err != nil {
-		t.Fatal(err)
-	}
-
-	if diff := cmp.Diff(tc.Expected, shortUrlPostResponse, cmpopts.IgnoreFields(types.ShortUrlResponse{}, "CreatedAt", "ExpiresAt", "Slug", "Id", "Url")); diff != "" {
-		t.Errorf("actual does not equal expected. diff: %s", diff)
-	}
-
-	if tc.ExpectedStatusCode == http.StatusCreated && tc.UseUserUuid != nil {
-		if shortUrlPostResponse.UserId == nil {
-			t.Errorf("user id is nil")
-		}
-	}
-}
-
-type GetShortUrlsByUserIdCase struct {
-	Name               string
-	Page               int
-	SkipPage           bool
-	Size               int
-	SkipSize           bool
-	UserUuid           uuid.UUID
-	SkipAccessToken    bool
-	ExpectedStatusCode int
-	Expected           handlers.GetShortUrlsByUserIdResponse
-}
-
-func TestGetShortUrlsByUserId(t *testing.T) {
-	t.Parallel()
-
-	expect1Id := uuid.MustParse("019cc05b-d0e6-764d-a207-60cb9fd4d147")
-	expect1Destinationurl := "https://google.com"
-	expect1Slug := "zzM0ofu"
-	expect1Url := "http://localhost:8080/zzM0ofu"
-	expect1Total := 3
-	expect1Next := true
-	expect1Page := 1
-	expect1Size := 1
-
-	expect2Id := uuid.MustParse("019cc05b-c45d-76f9-ab03-02af299e76ea")
-	expect2Destinationurl := "https://google.com"
-	expect2Slug := "4kJe27"
-	expect2Url := "http://localhost:8080/4kJe27"
-	expect2Total := 3
-	expect2Next := false
-	expect2Page := 3
-	expect2Size := 20
-
-	expect3Id := uuid.MustParse("019cc05b-b0ca-7bf2-863f-2356491c227d")
-	expect3Destinationurl := "https://google.com"
-	expect3Slug := "S0VieOF"
-	expect3Url := "http://localhost:8080/S0VieOF"
-	expect3Total := 3
-	expect3Next := false
-	expect3Page := 1
-	expect3Size := 20
-
-	cases := []GetShortUrlsByUserIdCase{
 		{
-			Name:               "LoginRequired",
-			Page:               0,
-			Size:               0,
-			UserUuid:           validUserUuid,
-			SkipAccessToken:    true,
-			ExpectedStatusCode: http.StatusUnauthorized,
-			Expected: handlers.GetShortUrlsByUserIdResponse{
-				Errors: []string{"Login required"},
+			Name: "AuthenticatedSlidingTtlLessThanMin",
+			Request: handlers.PostShortUrlRequest{
+				DestinationUrl: "https://google.com",
+				SlidingTtl:     &ttlLessThanMin,
+			},
+			AllowAnonymous:        true,
+			SkipIdempotencyKey:    false,
+			SkipJsonHeader:        false,
+			UseIdempotencyKeyUuid: nil,
+			UseUserUuid:           &validUserUuid,
+			UseCookie:             true,
+			UseHeader:             false,
+			ExpectedStatusCode:    http.StatusBadRequest,
+			Expected: types.ShortUrlResponse{
+				Errors: []string{"Key: 'PostShortUrlRequest.SlidingTtl' Error:Field validation for 'SlidingTtl' failed on the 'min' tag"},
 			},
 		},
 		{
-			Name:               "InvalidPage",
-			Page:               0,
-			Size:               0,
-			UserUuid:           validUserUuid,
-			ExpectedStatusCode: http.StatusBadRequest,
-			Expected: handlers.GetShortUrlsByUserIdResponse{
-				Errors: []string{handlers.PageQueryParamError},
+			Name: "AnonymousSlidingTtlGreaterThanMax",
+			Request: handlers.PostShortUrlRequest{
+				DestinationUrl: "https://google.com",
+				SlidingTtl:     &ttlGreaterThanAnonymousMax,
+			},
+			AllowAnonymous:        true,
+			SkipIdempotencyKey:    false,
+			SkipJsonHeader:        false,
+			UseIdempotencyKeyUuid: nil,
+			UseUserUuid:           nil,
+			UseCookie:             false,
+			UseHeader:             false,
+			ExpectedStatusCode:    http.StatusBadRequest,
+			Expected: types.ShortUrlResponse{
+				Errors: []string{"anonymous short urls can only slide up to 604800 seconds"},
 			},
 		},
 		{
-			Name:               "InvalidSize",
-			Page:               1,
-			Size:               0,
-			UserUuid:           validUserUuid,
-			ExpectedStatusCode: http.StatusBadRequest,
-			Expected: handlers.GetShortUrlsByUserIdResponse{
+			Name: "AnonymousTagIds",
+			Request: handlers.PostShortUrlRequest{
+				DestinationUrl: "https://google.com",
+				TagIds:         &[]uuid.UUID{uuid.MustParse(marketingTagId)},
+			},
+			AllowAnonymous:        true,
+			SkipIdempotencyKey:    false,
+			SkipJsonHeader:        false,
+			UseIdempotencyKeyUuid: nil,
+			UseUserUuid:           nil,
+			UseCookie:             false,
+			UseHeader:             false,
+			ExpectedStatusCode:    http.StatusBadRequest,
+			Expected: types.ShortUrlResponse{
+				Errors: []string{handlers.AnonymousTagIdsError},
+			},
+		},
+		{
+			Name: "HappyPathAuthenticated",
+			Request: handlers.PostShortUrlRequest{
+				DestinationUrl: "https://google.com",
+			},
+			AllowAnonymous:        false,
+			SkipIdempotencyKey:    false,
+			SkipJsonHeader:        false,
+			UseIdempotencyKeyUuid: nil,
+			UseUserUuid:           &validUserUuid,
+			UseCookie:             true,
+			UseHeader:             false,
+			ExpectedStatusCode:    http.StatusCreated,
+			Expected: types.ShortUrlResponse{
+				DestinationUrl: &happyPathUrl,
+				UserId:         &validUserUuid,
+			},
+		},
+		{
+			Name: "HappyPathAnonymous",
+			Request: handlers.PostShortUrlRequest{
+				DestinationUrl: "https://google.com",
+			},
+			AllowAnonymous:        true,
+			SkipIdempotencyKey:    false,
+			SkipJsonHeader:        false,
+			UseIdempotencyKeyUuid: nil,
+			UseUserUuid:           nil,
+			UseCookie:             false,
+			UseHeader:             false,
+			ExpectedStatusCode:    http.StatusCreated,
+			Expected: types.ShortUrlResponse{
+				DestinationUrl: &happyPathUrl,
+			},
+		},
+		{
+			Name: "CustomSlug",
+			Request: handlers.PostShortUrlRequest{
+				DestinationUrl: "https://google.com",
+				Slug:           &customSlug,
+			},
+			AllowAnonymous:        false,
+			SkipIdempotencyKey:    false,
+			SkipJsonHeader:        false,
+			UseIdempotencyKeyUuid: nil,
+			UseUserUuid:           &validUserUuid,
+			UseCookie:             true,
+			UseHeader:             false,
+			ExpectedStatusCode:    http.StatusCreated,
+			Expected: types.ShortUrlResponse{
+				DestinationUrl: &happyPathUrl,
+				UserId:         &validUserUuid,
+			},
+		},
+		{
+			Name: "PasswordProtected",
+			Request: handlers.PostShortUrlRequest{
+				DestinationUrl: "https://google.com",
+				Password:       &shortUrlPassword,
+			},
+			AllowAnonymous:        false,
+			SkipIdempotencyKey:    false,
+			SkipJsonHeader:        false,
+			UseIdempotencyKeyUuid: nil,
+			UseUserUuid:           &validUserUuid,
+			UseCookie:             true,
+			UseHeader:             false,
+			ExpectedStatusCode:    http.StatusCreated,
+			Expected: types.ShortUrlResponse{
+				DestinationUrl:    &happyPathUrl,
+				UserId:            &validUserUuid,
+				PasswordProtected: &passwordProtected,
+			},
+		},
+		{
+			Name: "ClickLimited",
+			Request: handlers.PostShortUrlRequest{
+				DestinationUrl: "https://google.com",
+				MaxClicks:      &maxClicks,
+			},
+			AllowAnonymous:        false,
+			SkipIdempotencyKey:    false,
+			SkipJsonHeader:        false,
+			UseIdempotencyKeyUuid: nil,
+			UseUserUuid:           &validUserUuid,
+			UseCookie:             true,
+			UseHeader:             false,
+			ExpectedStatusCode:    http.StatusCreated,
+			Expected: types.ShortUrlResponse{
+				DestinationUrl:  &happyPathUrl,
+				UserId:          &validUserUuid,
+				MaxClicks:       &maxClicks,
+				RemainingClicks: &maxClicks,
+			},
+		},
+		{
+			Name: "ClickLimitTooLow",
+			Request: handlers.PostShortUrlRequest{
+				DestinationUrl: "https://google.com",
+				MaxClicks:      &maxClicksTooLow,
+			},
+			AllowAnonymous:        false,
+			SkipIdempotencyKey:    false,
+			SkipJsonHeader:        false,
+			UseIdempotencyKeyUuid: nil,
+			UseUserUuid:           &validUserUuid,
+			UseCookie:             true,
+			UseHeader:             false,
+			ExpectedStatusCode:    http.StatusBadRequest,
+			Expected: types.ShortUrlResponse{
+				Errors: []string{"Key: 'PostShortUrlRequest.MaxClicks' Error:Field validation for 'MaxClicks' failed on the 'min' tag"},
+			},
+		},
+		{
+			Name: "ForcePreview",
+			Request: handlers.PostShortUrlRequest{
+				DestinationUrl: "https://google.com",
+				ForcePreview:   true,
+			},
+			AllowAnonymous:        false,
+			SkipIdempotencyKey:    false,
+			SkipJsonHeader:        false,
+			UseIdempotencyKeyUuid: nil,
+			UseUserUuid:           &validUserUuid,
+			UseCookie:             true,
+			UseHeader:             false,
+			ExpectedStatusCode:    http.StatusCreated,
+			Expected: types.ShortUrlResponse{
+				DestinationUrl: &happyPathUrl,
+				UserId:         &validUserUuid,
+				ForcePreview:   &enabled,
+			},
+		},
+		{
+			Name: "RedirectType",
+			Request: handlers.PostShortUrlRequest{
+				DestinationUrl: "https://google.com",
+				RedirectType:   &redirectType,
+			},
+			AllowAnonymous:        false,
+			SkipIdempotencyKey:    false,
+			SkipJsonHeader:        false,
+			UseIdempotencyKeyUuid: nil,
+			UseUserUuid:           &validUserUuid,
+			UseCookie:             true,
+			UseHeader:             false,
+			ExpectedStatusCode:    http.StatusCreated,
+			Expected: types.ShortUrlResponse{
+				DestinationUrl: &happyPathUrl,
+				UserId:         &validUserUuid,
+				RedirectType:   &redirectType,
+			},
+		},
+		{
+			Name: "Passthrough",
+			Request: handlers.PostShortUrlRequest{
+				DestinationUrl:   "https://google.com",
+				QueryPassthrough: true,
+				PathPassthrough:  true,
+			},
+			AllowAnonymous:        false,
+			SkipIdempotencyKey:    false,
+			SkipJsonHeader:        false,
+			UseIdempotencyKeyUuid: nil,
+			UseUserUuid:           &validUserUuid,
+			UseCookie:             true,
+			UseHeader:             false,
+			ExpectedStatusCode:    http.StatusCreated,
+			Expected: types.ShortUrlResponse{
+				DestinationUrl:   &happyPathUrl,
+				UserId:           &validUserUuid,
+				QueryPassthrough: &enabled,
+				PathPassthrough:  &enabled,
+			},
+		},
+		{
+			Name: "UtmParams",
+			Request: handlers.PostShortUrlRequest{
+				DestinationUrl: "https://google.com",
+				UtmSource:      &utmSourcePadded,
+				UtmMedium:      &utmMedium,
+				UtmCampaign:    &utmCampaign,
+			},
+			AllowAnonymous:        false,
+			SkipIdempotencyKey:    false,
+			SkipJsonHeader:        false,
+			UseIdempotencyKeyUuid: nil,
+			UseUserUuid:           &validUserUuid,
+			UseCookie:             true,
+			UseHeader:             false,
+			ExpectedStatusCode:    http.StatusCreated,
+			Expected: types.ShortUrlResponse{
+				DestinationUrl: &happyPathUrl,
+				UserId:         &validUserUuid,
+				UtmSource:      &utmSource,
+				UtmMedium:      &utmMedium,
+				UtmCampaign:    &utmCampaign,
+			},
+		},
+		{
+			Name: "BlankUtmParam",
+			Request: handlers.PostShortUrlRequest{
+				DestinationUrl: "https://google.com",
+				UtmSource:      &utmBlank,
+			},
+			AllowAnonymous:        false,
+			SkipIdempotencyKey:    false,
+			SkipJsonHeader:        false,
+			UseIdempotencyKeyUuid: nil,
+			UseUserUuid:           &validUserUuid,
+			UseCookie:             true,
+			UseHeader:             false,
+			ExpectedStatusCode:    http.StatusCreated,
+			Expected: types.ShortUrlResponse{
+				DestinationUrl: &happyPathUrl,
+				UserId:         &validUserUuid,
+			},
+		},
+		{
+			Name: "UtmParamTooLong",
+			Request: handlers.PostShortUrlRequest{
+				DestinationUrl: "https://google.com",
+				UtmCampaign:    &utmTooLong,
+			},
+			AllowAnonymous:        false,
+			SkipIdempotencyKey:    false,
+			SkipJsonHeader:        false,
+			UseIdempotencyKeyUuid: nil,
+			UseUserUuid:           &validUserUuid,
+			UseCookie:             true,
+			UseHeader:             false,
+			ExpectedStatusCode:    http.StatusBadRequest,
+			Expected: types.ShortUrlResponse{
+				Errors: []string{"Key: 'PostShortUrlRequest.UtmCampaign' Error:Field validation for 'UtmCampaign' failed on the 'max' tag"},
+			},
+		},
+		{
+			Name: "RoutingRules",
+			Request: handlers.PostShortUrlRequest{
+				DestinationUrl: "https://google.com",
+				RoutingRules:   routingRules,
+			},
+			AllowAnonymous:        false,
+			SkipIdempotencyKey:    false,
+			SkipJsonHeader:        false,
+			UseIdempotencyKeyUuid: nil,
+			UseUserUuid:           &validUserUuid,
+			UseCookie:             true,
+			UseHeader:             false,
+			ExpectedStatusCode:    http.StatusCreated,
+			Expected: types.ShortUrlResponse{
+				DestinationUrl: &happyPathUrl,
+				UserId:         &validUserUuid,
+				RoutingRules: []types.RoutingRule{
+					{Match: "platform", Value: "ios", DestinationUrl: "https://apps.example.invalid/ios"},
+					{Match: "language", Value: "fr", DestinationUrl: "https://www.example.invalid/fr"},
+				},
+			},
+		},
+		{
+			Name: "RoutingRuleInvalidPlatform",
+			Request: handlers.PostShortUrlRequest{
+				DestinationUrl: "https://google.com",
+				RoutingRules:   invalidPlatformRoutingRules,
+			},
+			AllowAnonymous:        false,
+			SkipIdempotencyKey:    false,
+			SkipJsonHeader:        false,
+			UseIdempotencyKeyUuid: nil,
+			UseUserUuid:           &validUserUuid,
+			UseCookie:             true,
+			UseHeader:             false,
+			ExpectedStatusCode:    http.StatusBadRequest,
+			Expected: types.ShortUrlResponse{
+				Errors: []string{"`routing_rules[0].value` must be one of `ios`, `android`, `windows`, `macos`, `linux` for a platform rule"},
+			},
+		},
+		{
+			Name: "Variants",
+			Request: handlers.PostShortUrlRequest{
+				DestinationUrl: "https://google.com",
+				Variants:       variants,
+				StickyVariants: true,
+			},
+			AllowAnonymous:        false,
+			SkipIdempotencyKey:    false,
+			SkipJsonHeader:        false,
+			UseIdempotencyKeyUuid: nil,
+			UseUserUuid:           &validUserUuid,
+			UseCookie:             true,
+			UseHeader:             false,
+			ExpectedStatusCode:    http.StatusCreated,
+			Expected: types.ShortUrlResponse{
+				DestinationUrl: &happyPathUrl,
+				UserId:         &validUserUuid,
+				Variants: []types.ShortUrlVariant{
+					{DestinationUrl: "https://landing.example.invalid/a", Weight: 70},
+					{DestinationUrl: "https://landing.example.invalid/b", Weight: 30},
+				},
+				StickyVariants: &enabled,
+			},
+		},
+		{
+			Name: "TooFewVariants",
+			Request: handlers.PostShortUrlRequest{
+				DestinationUrl: "https://google.com",
+				Variants:       singleVariant,
+			},
+			AllowAnonymous:        false,
+			SkipIdempotencyKey:    false,
+			SkipJsonHeader:        false,
+			UseIdempotencyKeyUuid: nil,
+			UseUserUuid:           &validUserUuid,
+			UseCookie:             true,
+			UseHeader:             false,
+			ExpectedStatusCode:    http.StatusBadRequest,
+			Expected: types.ShortUrlResponse{
+				Errors: []string{handlers.TooFewVariantsError},
+			},
+		},
+		{
+			Name: "InvalidRedirectType",
+			Request: handlers.PostShortUrlRequest{
+				DestinationUrl: "https://google.com",
+				RedirectType:   &invalidRedirectType,
+			},
+			AllowAnonymous:        false,
+			SkipIdempotencyKey:    false,
+			SkipJsonHeader:        false,
+			UseIdempotencyKeyUuid: nil,
+			UseUserUuid:           &validUserUuid,
+			UseCookie:             true,
+			UseHeader:             false,
+			ExpectedStatusCode:    http.StatusBadRequest,
+			Expected: types.ShortUrlResponse{
+				Errors: []string{"Key: 'PostShortUrlRequest.RedirectType' Error:Field validation for 'RedirectType' failed on the 'oneof' tag"},
+			},
+		},
+		{
+			Name: "ScheduledActivation",
+			Request: handlers.PostShortUrlRequest{
+				DestinationUrl: "https://google.com",
+				ActivatesAt:    &activatesAt,
+			},
+			AllowAnonymous:        false,
+			SkipIdempotencyKey:    false,
+			SkipJsonHeader:        false,
+			UseIdempotencyKeyUuid: nil,
+			UseUserUuid:           &validUserUuid,
+			UseCookie:             true,
+			UseHeader:             false,
+			ExpectedStatusCode:    http.StatusCreated,
+			Expected: types.ShortUrlResponse{
+				DestinationUrl: &happyPathUrl,
+				UserId:         &validUserUuid,
+				ActivatesAt:    &activatesAt,
+			},
+		},
+		{
+			Name: "ScheduledActivationReplay",
+			Request: handlers.PostShortUrlRequest{
+				DestinationUrl: "https://google.com",
+				ActivatesAt:    &activatesAt,
+			},
+			AllowAnonymous:        false,
+			SkipIdempotencyKey:    false,
+			SkipJsonHeader:        false,
+			UseIdempotencyKeyUuid: nil,
+			UseUserUuid:           &validUserUuid,
+			UseCookie:             true,
+			UseHeader:             false,
+			Replay:                true,
+			ExpectedStatusCode:    http.StatusCreated,
+			Expected: types.ShortUrlResponse{
+				DestinationUrl: &happyPathUrl,
+				UserId:         &validUserUuid,
+				ActivatesAt:    &activatesAt,
+			},
+		},
+		{
+			Name: "ScheduledActivationTooFar",
+			Request: handlers.PostShortUrlRequest{
+				DestinationUrl: "https://google.com",
+				ActivatesAt:    &activatesAtTooFar,
+			},
+			AllowAnonymous:        false,
+			SkipIdempotencyKey:    false,
+			SkipJsonHeader:        false,
+			UseIdempotencyKeyUuid: nil,
+			UseUserUuid:           &validUserUuid,
+			UseCookie:             true,
+			UseHeader:             false,
+			ExpectedStatusCode:    http.StatusBadRequest,
+			Expected: types.ShortUrlResponse{
+				Errors: []string{fmt.Sprintf("`activates_at` can only be up to %d seconds from now", handlers.MaxShortUrlActivationDelay)},
+			},
+		},
+		{
+			Name: "PasswordTooShort",
+			Request: handlers.PostShortUrlRequest{
+				DestinationUrl: "https://google.com",
+				Password:       &shortUrlPasswordTooShort,
+			},
+			AllowAnonymous:        false,
+			SkipIdempotencyKey:    false,
+			SkipJsonHeader:        false,
+			UseIdempotencyKeyUuid: nil,
+			UseUserUuid:           &validUserUuid,
+			UseCookie:             true,
+			UseHeader:             false,
+			ExpectedStatusCode:    http.StatusBadRequest,
+			Expected: types.ShortUrlResponse{
+				Errors: []string{"Key: 'PostShortUrlRequest.Password' Error:Field validation for 'Password' failed on the 'min' tag"},
+			},
+		},
+		{
+			Name: "CustomSlugTaken",
+			Request: handlers.PostShortUrlRequest{
+				DestinationUrl: "https://google.com",
+				Slug:           &takenSlug,
+			},
+			AllowAnonymous:        false,
+			SkipIdempotencyKey:    false,
+			SkipJsonHeader:        false,
+			UseIdempotencyKeyUuid: nil,
+			UseUserUuid:           &validUserUuid,
+			UseCookie:             true,
+			UseHeader:             false,
+			ExpectedStatusCode:    http.StatusConflict,
+			Expected: types.ShortUrlResponse{
+				Errors: []string{"slug 'tiLd' is already taken"},
+			},
+		},
+		{
+			Name: "CustomSlugReserved",
+			Request: handlers.PostShortUrlRequest{
+				DestinationUrl: "https://google.com",
+				Slug:           &reservedSlug,
+			},
+			AllowAnonymous:        false,
+			SkipIdempotencyKey:    false,
+			SkipJsonHeader:        false,
+			UseIdempotencyKeyUuid: nil,
+			UseUserUuid:           &validUserUuid,
+			UseCookie:             true,
+			UseHeader:             false,
+			ExpectedStatusCode:    http.StatusBadRequest,
+			Expected: types.ShortUrlResponse{
+				Errors: []string{"slug 'Dashboard' is reserved"},
+			},
+		},
+		{
+			Name: "CustomSlugInvalidCharacters",
+			Request: handlers.PostShortUrlRequest{
+				DestinationUrl: "https://google.com",
+				Slug:           &invalidSlug,
+			},
+			AllowAnonymous:        false,
+			SkipIdempotencyKey:    false,
+			SkipJsonHeader:        false,
+			UseIdempotencyKeyUuid: nil,
+			UseUserUuid:           &validUserUuid,
+			UseCookie:             true,
+			UseHeader:             false,
+			ExpectedStatusCode:    http.StatusBadRequest,
+			Expected: types.ShortUrlResponse{
+				Errors: []string{"Key: 'PostShortUrlRequest.Slug' Error:Field validation for 'Slug' failed on the 'slugvalidator' tag"},
+			},
+		},
+		{
+			Name: "HappyPathAuthenticatedAllowAnonymous",
+			Request: handlers.PostShortUrlRequest{
+				DestinationUrl: "https://google.com",
+			},
+			AllowAnonymous:        true,
+			SkipIdempotencyKey:    false,
+			SkipJsonHeader:        false,
+			UseIdempotencyKeyUuid: nil,
+			UseUserUuid:           &validUserUuid,
+			UseCookie:             true,
+			UseHeader:             false,
+			ExpectedStatusCode:    http.StatusCreated,
+			Expected: types.ShortUrlResponse{
+				DestinationUrl: &happyPathUrl,
+				UserId:         &validUserUuid,
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.Name+"WithCache", func(t *testing.T) {
+			t.Parallel()
+			runTestPostShortUrl(t, tc, true)
+		})
+		t.Run(tc.Name+"NoCache", func(t *testing.T) {
+			t.Parallel()
+			runTestPostShortUrl(t, tc, false)
+		})
+	}
+}
+
+func runTestPostShortUrl(t *testing.T, tc PostShortUrlTestCase, cacheEnabled bool) {
+	ctx := context.Background()
+	deps := SetupDependencies(t, ctx, cacheEnabled)
+	deps.App.Config.Server.AllowAnonymous = tc.AllowAnonymous
+	deps.App.Config.ShortUrlTtl.AllowNonExpiring = tc.AllowNonExpiring
+
+	defer func() {
+		if err := deps.App.Server.Close(); err != nil {
+			t.Fatal(err)
+		}
+		deps.StopClickEventWorker()
+
+		if err := deps.Db.Container.Terminate(ctx); err != nil {
+			t.Fatal(err)
+		}
+
+		if cacheEnabled {
+			if err := deps.Cache.Container.Terminate(ctx); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}()
+
+	var accessToken string
+	if tc.UseUserUuid != nil {
+		var h int
+		if tc.UseExpiredAccessToken {
+			h = -12
+		} else {
+			h = 12
+		}
+		accessToken = CreateAccessToken(t, deps.App.Config.Server.Auth, h, tc.UseUserUuid, !tc.UseInvalidAccessToken)
+	}
+
+	rbody, err := json.Marshal(tc.Request)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, deps.TestServer.URL+"/api/v1/shorturl", bytes.NewBuffer(rbody))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !tc.SkipJsonHeader {
+		req.Header.Set(types.HeadersContentTypeKey, types.HeadersContentTypeJsonValue)
+	}
+
+	if tc.UseHeader && tc.UseUserUuid != nil {
+		req.Header.Add(handlers.HeaderAuthorization, fmt.Sprintf("Bearer %s", accessToken))
+	}
+
+	if !tc.SkipIdempotencyKey {
+		var key uuid.UUID
+		if tc.UseIdempotencyKeyUuid != nil {
+			key = *tc.UseIdempotencyKeyUuid
+		} else {
+			key, err = uuid.NewV7()
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		req.Header.Add(types.HeadersIdempotencyKey, key.String())
+	}
+
+	if tc.UseCookie && tc.UseUserUuid != nil {
+		cookie := &http.Cookie{
+			Name:     handlers.CookieAccessTokenName,
+			Value:    accessToken,
+			Path:     "/",
+			MaxAge:   12 * 60 * 60, // x * minutes in an hour * seconds in a minute
+			Expires:  time.Now().Add(12 * time.Hour),
+			HttpOnly: true,
+			Secure:   deps.App.Config.Server.HttpsEnabled,
+			SameSite: http.SameSiteStrictMode,
+		}
+
+		req.AddCookie(cookie)
+	}
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if res.StatusCode != tc.ExpectedStatusCode {
+		t.Errorf("expected status %d got %d", tc.ExpectedStatusCode, res.StatusCode)
+	}
+
+	var shortUrlPostResponse types.ShortUrlResponse
+	decoder := json.NewDecoder(res.Body)
+	decoder.DisallowUnknownFields()
+	if err = decoder.Decode(&shortUrlPostResponse); err != nil {
+		t.Error("failed to decode body", err.Error())
+	}
+
+	err = res.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if diff := cmp.Diff(tc.Expected, shortUrlPostResponse, cmpopts.IgnoreFields(types.ShortUrlResponse{}, "CreatedAt", "ExpiresAt", "Slug", "Id", "Url"), cmpopts.IgnoreFields(types.ShortUrlVariant{}, "Id")); diff != "" {
+		t.Errorf("actual does not equal expected. diff: %s", diff)
+	}
+
+	if tc.ExpectedStatusCode == http.StatusCreated && tc.UseUserUuid != nil {
+		if shortUrlPostResponse.UserId == nil {
+			t.Errorf("user id is nil")
+		}
+	}
+
+	if tc.ExpectedStatusCode == http.StatusCreated && tc.Request.Slug != nil {
+		if shortUrlPostResponse.Slug == nil || *shortUrlPostResponse.Slug != *tc.Request.Slug {
+			t.Errorf("expected slug %s got %v", *tc.Request.Slug, shortUrlPostResponse.Slug)
+		}
+	}
+
+	if tc.Replay {
+		replay, err := http.NewRequest(http.MethodPost, deps.TestServer.URL+"/api/v1/shorturl", bytes.NewBuffer(rbody))
+		if err != nil {
+			t.Fatal(err)
+		}
+		replay.Header = req.Header.Clone()
+
+		res, err := http.DefaultClient.Do(replay)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.StatusCode != tc.ExpectedStatusCode {
+			t.Errorf("expected status %d on replay got %d", tc.ExpectedStatusCode, res.StatusCode)
+		}
+
+		var replayed types.ShortUrlResponse
+		if err = json.NewDecoder(res.Body).Decode(&replayed); err != nil {
+			t.Error("failed to decode body", err.Error())
+		}
+		if err = res.Body.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		if diff := cmp.Diff(shortUrlPostResponse, replayed); diff != "" {
+			t.Errorf("expected the replay to return the same short url. diff: %s", diff)
+		}
+	}
+}
+
+type PostShortUrlBatchCase struct {
+	Name                    string
+	Request                 handlers.PostShortUrlBatchRequest
+	SkipAccessToken         bool
+	UseIdempotencyKeyUuid   *uuid.UUID
+	Replay                  bool // sends the same request again with the same idempotency key
+	ExpectedStatusCode      int
+	ExpectedItemStatusCodes []int
+	ExpectedErrors          []string
+}
+
+func TestPostShortUrlBatch(t *testing.T) {
+	t.Parallel()
+
+	batchSlug := "b4tchSlug"
+	takenSlug := "S0VieOF"
+	mixedItems := []handlers.PostShortUrlRequest{
+		{DestinationUrl: "https://example.invalid/one", Slug: &batchSlug},
+		{DestinationUrl: "not a url"},
+		{DestinationUrl: "https://example.invalid/taken", Slug: &takenSlug},
+		{DestinationUrl: "https://example.invalid/generated"},
+		{DestinationUrl: "https://example.invalid/same-slug", Slug: &batchSlug},
+	}
+	tooManyItems := make([]handlers.PostShortUrlRequest, handlers.MaxShortUrlBatchSize+1)
+	for i := range tooManyItems {
+		tooManyItems[i] = handlers.PostShortUrlRequest{DestinationUrl: "https://example.invalid"}
+	}
+
+	cases := []PostShortUrlBatchCase{
+		{
+			Name:                    "PerItemResults",
+			Request:                 handlers.PostShortUrlBatchRequest{Items: mixedItems},
+			ExpectedStatusCode:      http.StatusOK,
+			ExpectedItemStatusCodes: []int{http.StatusCreated, http.StatusBadRequest, http.StatusConflict, http.StatusCreated, http.StatusConflict},
+		},
+		{
+			Name:                    "ReplaySameIdempotencyKey",
+			Request:                 handlers.PostShortUrlBatchRequest{Items: mixedItems},
+			Replay:                  true,
+			ExpectedStatusCode:      http.StatusOK,
+			ExpectedItemStatusCodes: []int{http.StatusCreated, http.StatusBadRequest, http.StatusConflict, http.StatusCreated, http.StatusConflict},
+		},
+		{
+			Name:                  "UsedIdempotencyKey",
+			Request:               handlers.PostShortUrlBatchRequest{Items: mixedItems},
+			UseIdempotencyKeyUuid: &usedIdempotencyKey,
+			ExpectedStatusCode:    http.StatusBadRequest,
+			ExpectedErrors:        []string{fmt.Sprintf("%s header value has already been used", types.HeadersIdempotencyKey)},
+		},
+		{
+			Name:               "NoItems",
+			Request:            handlers.PostShortUrlBatchRequest{},
+			ExpectedStatusCode: http.StatusBadRequest,
+			ExpectedErrors:     []string{handlers.BatchSizeError},
+		},
+		{
+			Name:               "TooManyItems",
+			Request:            handlers.PostShortUrlBatchRequest{Items: tooManyItems},
+			ExpectedStatusCode: http.StatusBadRequest,
+			ExpectedErrors:     []string{handlers.BatchSizeError},
+		},
+		{
+			Name:               "NotLoggedIn",
+			Request:            handlers.PostShortUrlBatchRequest{Items: mixedItems},
+			SkipAccessToken:    true,
+			ExpectedStatusCode: http.StatusUnauthorized,
+			ExpectedErrors:     []string{"Login required"},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.Name+"WithCache", func(t *testing.T) {
+			t.Parallel()
+			runTestPostShortUrlBatch(t, tc, true)
+		})
+		t.Run(tc.Name+"NoCache", func(t *testing.T) {
+			t.Parallel()
+			runTestPostShortUrlBatch(t, tc, false)
+		})
+	}
+}
+
+func runTestPostShortUrlBatch(t *testing.T, tc PostShortUrlBatchCase, cacheEnabled bool) {
+	ctx := context.Background()
+	deps := SetupDependencies(t, ctx, cacheEnabled)
+
+	defer func() {
+		if err := deps.App.Server.Close(); err != nil {
+			t.Fatal(err)
+		}
+		deps.StopClickEventWorker()
+
+		if err := deps.Db.Container.Terminate(ctx); err != nil {
+			t.Fatal(err)
+		}
+
+		if cacheEnabled {
+			if err := deps.Cache.Container.Terminate(ctx); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}()
+
+	rbody, err := json.Marshal(tc.Request)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key := uuid.New()
+	if tc.UseIdempotencyKeyUuid != nil {
+		key = *tc.UseIdempotencyKeyUuid
+	}
+	accessToken := CreateAccessToken(t, deps.App.Config.Server.Auth, 12, &validUserUuid, true)
+
+	send := func() handlers.PostShortUrlBatchResponse {
+		req, err := http.NewRequest(http.MethodPost, deps.TestServer.URL+"/api/v1/shorturl/batch", bytes.NewBuffer(rbody))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set(types.HeadersContentTypeKey, types.HeadersContentTypeJsonValue)
+		req.Header.Add(types.HeadersIdempotencyKey, key.String())
+		if !tc.SkipAccessToken {
+			req.Header.Add(handlers.HeaderAuthorization, fmt.Sprintf("Bearer %s", accessToken))
+		}
+
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if res.StatusCode != tc.ExpectedStatusCode {
+			t.Errorf("expected status %d got %d", tc.ExpectedStatusCode, res.StatusCode)
+		}
+
+		var response handlers.PostShortUrlBatchResponse
+		decoder := json.NewDecoder(res.Body)
+		decoder.DisallowUnknownFields()
+		if err = decoder.Decode(&response); err != nil {
+			t.Error("failed to decode body", err.Error())
+		}
+
+		err = res.Body.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return response
+	}
+
+	response := send()
+	if diff := cmp.Diff(tc.ExpectedErrors, response.Errors); diff != "" {
+		t.Errorf("actual does not equal expected. diff: %s", diff)
+	}
+
+	itemStatusCodes := []int{}
+	for i, item := range response.Items {
+		if item.Index != i {
+			t.Errorf("expected item %d to have index %d got %d", i, i, item.Index)
+		}
+		itemStatusCodes = append(itemStatusCodes, item.StatusCode)
+		if item.StatusCode == http.StatusCreated && (item.ShortUrl == nil || item.ShortUrl.UserId == nil || *item.ShortUrl.UserId != validUserUuid) {
+			t.Errorf("expected item %d to be a short url owned by the user, got %+v", i, item.ShortUrl)
+		}
+	}
+	if len(tc.ExpectedItemStatusCodes) == 0 {
+		if len(response.Items) != 0 {
+			t.Errorf("expected no items got %d", len(response.Items))
+		}
+	} else if diff := cmp.Diff(tc.ExpectedItemStatusCodes, itemStatusCodes); diff != "" {
+		t.Errorf("item status codes do not equal expected. diff: %s", diff)
+	}
+
+	if tc.Replay {
+		replayed := send()
+		if diff := cmp.Diff(response, replayed, cmpopts.IgnoreFields(types.ShortUrlResponse{}, "CreatedAt", "ExpiresAt")); diff != "" {
+			t.Errorf("replayed response does not equal the first one. diff: %s", diff)
+		}
+	}
+}
+
+type PostShortUrlImportCase struct {
+	Name                    string
+	Body                    string
+	ContentType             string
+	Params                  map[string]string
+	UserId                  *uuid.UUID // validUserUuid when nil
+	SkipAccessToken         bool
+	Replay                  bool // sends the same request again with the same idempotency key
+	ExpectedStatusCode      int
+	ExpectedDryRun          bool
+	ExpectedItemStatusCodes []int
+	ExpectedFirstTagNames   []string // only checked when set
+	ExpectedErrors          []string
+}
+
+func TestPostShortUrlImport(t *testing.T) {
+	t.Parallel()
+
+	// a bitly style export, the slug comes from the short link
+	mixedCsv := "long_url,link,title\n" +
+		"https://example.invalid/one,https://bit.ly/1mp0rt,One\n" +
+		"https://example.invalid/taken,https://bit.ly/S0VieOF,Taken\n" +
+		"not a url,https://bit.ly/b4dUrl,Bad\n" +
+		"https://example.invalid/generated,,Generated\n"
+	ndjson := `{"destination_url":"https://example.invalid/one","slug":"nd1mport","ttl":3600}` + "\n" +
+		`{"destination_url":"https://example.invalid/two","slug":"nd1mport"}` + "\n" +
+		"not json\n"
+	// our own export, an empty expires_at never expires and the tags are looked up by name
+	ownExportCsv := strings.Join(handlers.ShortUrlExportCsvHeader, ",") + "\n" +
+		"019cc1c7-d1f0-734f-a2b7-a5ee16fbad99,0wnExp1,http://localhost/0wnExp1,https://example.invalid/own,2026-03-01T00:00:00Z,,false,,,,,false,false,false,,,,Marketing;unused\n" +
+		"019cc1c7-d1f0-734f-a2b7-a5ee16fbad98,0wnExp2,http://localhost/0wnExp2,https://example.invalid/own,2026-03-01T00:00:00Z,,false,,,,,false,false,false,,,,Missing\n"
+
+	cases := []PostShortUrlImportCase{
+		{
+			Name:                    "OwnCsvExport",
+			Body:                    ownExportCsv,
+			ContentType:             "text/csv",
+			UserId:                  &tagOwnerUuid,
+			ExpectedStatusCode:      http.StatusOK,
+			ExpectedItemStatusCodes: []int{http.StatusCreated, http.StatusBadRequest},
+			ExpectedFirstTagNames:   []string{"Marketing", "Unused"},
+		},
+		{
+			Name:                    "CsvDryRun",
+			Body:                    mixedCsv,
+			ContentType:             "text/csv",
+			Params:                  map[string]string{"dry_run": "true"},
+			ExpectedStatusCode:      http.StatusOK,
+			ExpectedDryRun:          true,
+			ExpectedItemStatusCodes: []int{http.StatusOK, http.StatusConflict, http.StatusBadRequest, http.StatusOK},
+		},
+		{
+			Name:                    "Csv",
+			Body:                    mixedCsv,
+			ContentType:             "text/csv; charset=utf-8",
+			ExpectedStatusCode:      http.StatusOK,
+			ExpectedItemStatusCodes: []int{http.StatusCreated, http.StatusConflict, http.StatusBadRequest, http.StatusCreated},
+		},
+		{
+			Name:                    "ReplaySameIdempotencyKey",
+			Body:                    mixedCsv,
+			ContentType:             "text/csv",
+			Replay:                  true,
+			ExpectedStatusCode:      http.StatusOK,
+			ExpectedItemStatusCodes: []int{http.StatusCreated, http.StatusConflict, http.StatusBadRequest, http.StatusCreated},
+		},
+		{
+			Name:                    "NdjsonFormatParam",
+			Body:                    ndjson,
+			ContentType:             "text/plain",
+			Params:                  map[string]string{"format": "ndjson"},
+			ExpectedStatusCode:      http.StatusOK,
+			ExpectedItemStatusCodes: []int{http.StatusCreated, http.StatusConflict, http.StatusBadRequest},
+		},
+		{
+			Name:               "UnknownFormat",
+			Body:               mixedCsv,
+			ContentType:        "text/plain",
+			ExpectedStatusCode: http.StatusBadRequest,
+			ExpectedErrors:     []string{handlers.ImportFormatQueryParamError},
+		},
+		{
+			Name:               "InvalidDryRun",
+			Body:               mixedCsv,
+			ContentType:        "text/csv",
+			Params:             map[string]string{"dry_run": "maybe"},
+			ExpectedStatusCode: http.StatusBadRequest,
+			ExpectedErrors:     []string{handlers.ImportDryRunQueryParamError},
+		},
+		{
+			Name:               "CsvWithoutDestination",
+			Body:               "slug,title\nabcdef,Title\n",
+			ContentType:        "text/csv",
+			ExpectedStatusCode: http.StatusBadRequest,
+			ExpectedErrors:     []string{handlers.ImportCsvMissingColumnError},
+		},
+		{
+			Name:               "EmptyJson",
+			Body:               "[]",
+			ContentType:        types.HeadersContentTypeJsonValue,
+			ExpectedStatusCode: http.StatusBadRequest,
+			ExpectedErrors:     []string{handlers.ImportTooManyRowsError},
+		},
+		{
+			Name:               "NotLoggedIn",
+			Body:               mixedCsv,
+			ContentType:        "text/csv",
+			SkipAccessToken:    true,
+			ExpectedStatusCode: http.StatusUnauthorized,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.Name+"WithCache", func(t *testing.T) {
+			t.Parallel()
+			runTestPostShortUrlImport(t, tc, true)
+		})
+		t.Run(tc.Name+"NoCache", func(t *testing.T) {
+			t.Parallel()
+			runTestPostShortUrlImport(t, tc, false)
+		})
+	}
+}
+
+func runTestPostShortUrlImport(t *testing.T, tc PostShortUrlImportCase, cacheEnabled bool) {
+	ctx := context.Background()
+	deps := SetupDependencies(t, ctx, cacheEnabled)
+
+	defer func() {
+		if err := deps.App.Server.Close(); err != nil {
+			t.Fatal(err)
+		}
+		deps.StopClickEventWorker()
+
+		if err := deps.Db.Container.Terminate(ctx); err != nil {
+			t.Fatal(err)
+		}
+
+		if cacheEnabled {
+			if err := deps.Cache.Container.Terminate(ctx); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}()
+
+	key := uuid.New()
+	userId := validUserUuid
+	if tc.UserId != nil {
+		userId = *tc.UserId
+	}
+	accessToken := CreateAccessToken(t, deps.App.Config.Server.Auth, 12, &userId, true)
+
+	send := func() handlers.ImportShortUrlsResponse {
+		req, err := http.NewRequest(http.MethodPost, deps.TestServer.URL+"/api/v1/me/shorturl/import", strings.NewReader(tc.Body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		query := req.URL.Query()
+		for k, v := range tc.Params {
+			query.Set(k, v)
+		}
+		req.URL.RawQuery = query.Encode()
+		req.Header.Set(types.HeadersContentTypeKey, tc.ContentType)
+		req.Header.Add(types.HeadersIdempotencyKey, key.String())
+		if !tc.SkipAccessToken {
+			req.Header.Add(handlers.HeaderAuthorization, fmt.Sprintf("Bearer %s", accessToken))
+		}
+
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if res.StatusCode != tc.ExpectedStatusCode {
+			t.Errorf("expected status %d got %d", tc.ExpectedStatusCode, res.StatusCode)
+		}
+
+		var response handlers.ImportShortUrlsResponse
+		decoder := json.NewDecoder(res.Body)
+		decoder.DisallowUnknownFields()
+		if err = decoder.Decode(&response); err != nil {
+			t.Error("failed to decode body", err.Error())
+		}
+
+		err = res.Body.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return response
+	}
+
+	response := send()
+	if diff := cmp.Diff(tc.ExpectedErrors, response.Errors); diff != "" {
+		t.Errorf("actual does not equal expected. diff: %s", diff)
+	}
+	if response.DryRun != tc.ExpectedDryRun {
+		t.Errorf("expected dry_run %t got %t", tc.ExpectedDryRun, response.DryRun)
+	}
+
+	itemStatusCodes := []int{}
+	for i, item := range response.Items {
+		if item.Index != i {
+			t.Errorf("expected item %d to have index %d got %d", i, i, item.Index)
+		}
+		itemStatusCodes = append(itemStatusCodes, item.StatusCode)
+		if item.StatusCode == http.StatusCreated && (item.ShortUrl == nil || item.ShortUrl.UserId == nil || *item.ShortUrl.UserId != userId) {
+			t.Errorf("expected item %d to be a short url owned by the user, got %+v", i, item.ShortUrl)
+		}
+	}
+	if len(tc.ExpectedItemStatusCodes) == 0 {
+		if len(response.Items) != 0 {
+			t.Errorf("expected no items got %d", len(response.Items))
+		}
+	} else if diff := cmp.Diff(tc.ExpectedItemStatusCodes, itemStatusCodes); diff != "" {
+		t.Errorf("item status codes do not equal expected. diff: %s", diff)
+	}
+
+	// the imported slugs are kept
+	if len(response.Items) > 0 && response.Items[0].StatusCode == http.StatusCreated && !slices.Contains([]string{"1mp0rt", "nd1mport", "0wnExp1"}, *response.Items[0].ShortUrl.Slug) {
+		t.Errorf("expected the slug of the import to be kept got %s", *response.Items[0].ShortUrl.Slug)
+	}
+
+	if tc.ExpectedFirstTagNames != nil && len(response.Items) > 0 && response.Items[0].ShortUrl != nil {
+		tagNames := []string{}
+		for _, tag := range response.Items[0].ShortUrl.Tags {
+			tagNames = append(tagNames, tag.Name)
+		}
+		if diff := cmp.Diff(tc.ExpectedFirstTagNames, tagNames); diff != "" {
+			t.Errorf("tags of the first item do not equal expected. diff: %s", diff)
+		}
+	}
+
+	if tc.Replay {
+		replayed := send()
+		if diff := cmp.Diff(response, replayed, cmpopts.IgnoreFields(types.ShortUrlResponse{}, "CreatedAt", "ExpiresAt")); diff != "" {
+			t.Errorf("replayed response does not equal the first one. diff: %s", diff)
+		}
+	}
+}
+
+type GetShortUrlsByUserIdCase struct {
+	Name               string
+	Page               int
+	SkipPage           bool
+	Size               int
+	SkipSize           bool
+	Params             map[string]string
+	UserUuid           uuid.UUID
+	SkipAccessToken    bool
+	ExpectedStatusCode int
+	Expected           handlers.GetShortUrlsByUserIdResponse
+}
+
+func TestGetShortUrlsByUserId(t *testing.T) {
+	t.Parallel()
+
+	expect1Id := uuid.MustParse("019cc05b-d0e6-764d-a207-60cb9fd4d147")
+	expect1Destinationurl := "https://google.com"
+	expect1Slug := "zzM0ofu"
+	expect1Url := "http://localhost:8080/zzM0ofu"
+	expect1Total := 3
+	expect1Next := true
+	expect1Page := 1
+	expect1Size := 1
+
+	expect2Id := uuid.MustParse("019cc05b-c45d-76f9-ab03-02af299e76ea")
+	expect2Destinationurl := "https://google.com"
+	expect2Slug := "4kJe27"
+	expect2Url := "http://localhost:8080/4kJe27"
+	expect2Total := 3
+	expect2Next := false
+	expect2Page := 3
+	expect2Size := 20
+
+	expect3Id := uuid.MustParse("019cc05b-b0ca-7bf2-863f-2356491c227d")
+	expect3Destinationurl := "https://google.com"
+	expect3Slug := "S0VieOF"
+	expect3Url := "http://localhost:8080/S0VieOF"
+	expect3Total := 3
+	expect3Next := false
+	expect3Page := 1
+	expect3Size := 20
+
+	expiredId := uuid.MustParse("019cc05b-d0e6-764d-a207-60cb9fd4d148")
+	expiredSlug := "zzM0ofz"
+	expiredUrl := "http://localhost:8080/zzM0ofz"
+	oneTotal := 1
+	twoTotal := 2
+	firstPage := 1
+	defaultSize := 20
+	sizeOne := 1
+	noNext := false
+	hasNext := true
+
+	tagOwnerUuid := uuid.MustParse("019cbcdb-aaf4-7680-a3f7-8acef63e0151")
+	tagFilterId := uuid.MustParse("019cc1c7-d1f0-734f-a2b7-a5ee16fbad13")
+	tagFilterDestinationUrl := "https://shop.example.invalid/sale?utm_source=old"
+	tagFilterSlug := "c4mpaign"
+	tagFilterUrl := "http://localhost:8080/c4mpaign"
+	tagFilterQueryPassthrough := true
+	tagFilterUtmSource := "newsletter"
+	tagFilterUtmMedium := "email"
+	tagFilterUtmCampaign := "spring sale"
+	tagFilterTotal := 1
+	tagFilterNext := false
+	tagFilterNoMatchTotal := 0
+	tagFilterPage := 1
+	tagFilterSize := 20
+
+	cases := []GetShortUrlsByUserIdCase{
+		{
+			Name:               "LoginRequired",
+			Page:               0,
+			Size:               0,
+			UserUuid:           validUserUuid,
+			SkipAccessToken:    true,
+			ExpectedStatusCode: http.StatusUnauthorized,
+			Expected: handlers.GetShortUrlsByUserIdResponse{
+				Errors: []string{"Login required"},
+			},
+		},
+		{
+			Name:               "InvalidPage",
+			Page:               0,
+			Size:               0,
+			UserUuid:           validUserUuid,
+			ExpectedStatusCode: http.StatusBadRequest,
+			Expected: handlers.GetShortUrlsByUserIdResponse{
+				Errors: []string{handlers.PageQueryParamError},
+			},
+		},
+		{
+			Name:               "InvalidSize",
+			Page:               1,
+			Size:               0,
+			UserUuid:           validUserUuid,
+			ExpectedStatusCode: http.StatusBadRequest,
+			Expected: handlers.GetShortUrlsByUserIdResponse{
 				Errors: []string{handlers.SizeQueryParamError},
 			},
 		},
 		{
-			Name:               "Expect1",
-			Page:               1,
-			Size:               1,
-			UserUuid:           validUserUuid,
+			Name:               "Expect1",
+			Page:               1,
+			Size:               1,
+			UserUuid:           validUserUuid,
+			ExpectedStatusCode: http.StatusOK,
+			Expected: handlers.GetShortUrlsByUserIdResponse{
+				Items: []types.ShortUrlResponse{
+					{
+						Id:             &expect1Id,
+						DestinationUrl: &expect1Destinationurl,
+						Slug:           &expect1Slug,
+						Url:            expect1Url,
+						UserId:         &validUserUuid,
+					},
+				},
+				Total: &expect1Total,
+				Page:  &expect1Page,
+				Size:  &expect1Size,
+				Next:  &expect1Next,
+			},
+		},
+		{
+			Name:               "ExpectNoneOffsetOvershoot",
+			Page:               3,
+			Size:               20,
+			UserUuid:           validUserUuid,
+			ExpectedStatusCode: http.StatusOK,
+			Expected: handlers.GetShortUrlsByUserIdResponse{
+				Items: []types.ShortUrlResponse{},
+				Total: &expect2Total,
+				Page:  &expect2Page,
+				Size:  &expect2Size,
+				Next:  &expect2Next,
+			},
+		},
+		{
+			Name:               "Expect3Normal",
+			Page:               -1,
+			SkipPage:           true,
+			Size:               -1,
+			SkipSize:           true,
+			UserUuid:           validUserUuid,
+			ExpectedStatusCode: http.StatusOK,
+			Expected: handlers.GetShortUrlsByUserIdResponse{
+				Items: []types.ShortUrlResponse{
+					{
+						Id:             &expect1Id,
+						DestinationUrl: &expect1Destinationurl,
+						Slug:           &expect1Slug,
+						Url:            expect1Url,
+						UserId:         &validUserUuid,
+					},
+					{
+						Id:             &expect2Id,
+						DestinationUrl: &expect2Destinationurl,
+						Slug:           &expect2Slug,
+						Url:            expect2Url,
+						UserId:         &validUserUuid,
+					},
+					{
+						Id:             &expect3Id,
+						DestinationUrl: &expect3Destinationurl,
+						Slug:           &expect3Slug,
+						Url:            expect3Url,
+						UserId:         &validUserUuid,
+					},
+				},
+				Total: &expect3Total,
+				Page:  &expect3Page,
+				Size:  &expect3Size,
+				Next:  &expect3Next,
+			},
+		},
+		{
+			Name:               "Search",
+			Page:               -1,
+			SkipPage:           true,
+			Size:               -1,
+			SkipSize:           true,
+			Params:             map[string]string{"q": "ZZm0"},
+			UserUuid:           validUserUuid,
+			ExpectedStatusCode: http.StatusOK,
+			Expected: handlers.GetShortUrlsByUserIdResponse{
+				Items: []types.ShortUrlResponse{
+					{
+						Id:             &expect1Id,
+						DestinationUrl: &expect1Destinationurl,
+						Slug:           &expect1Slug,
+						Url:            expect1Url,
+						UserId:         &validUserUuid,
+					},
+				},
+				Total: &oneTotal,
+				Page:  &firstPage,
+				Size:  &defaultSize,
+				Next:  &noNext,
+			},
+		},
+		{
+			Name:               "SearchWildcardIsLiteral",
+			Page:               -1,
+			SkipPage:           true,
+			Size:               -1,
+			SkipSize:           true,
+			Params:             map[string]string{"q": "%"},
+			UserUuid:           validUserUuid,
+			ExpectedStatusCode: http.StatusOK,
+			Expected: handlers.GetShortUrlsByUserIdResponse{
+				Items: []types.ShortUrlResponse{},
+				Total: &tagFilterNoMatchTotal,
+				Page:  &firstPage,
+				Size:  &defaultSize,
+				Next:  &noNext,
+			},
+		},
+		{
+			Name:               "StatusExpired",
+			Page:               -1,
+			SkipPage:           true,
+			Size:               -1,
+			SkipSize:           true,
+			Params:             map[string]string{"status": "expired"},
+			UserUuid:           validUserUuid,
+			ExpectedStatusCode: http.StatusOK,
+			Expected: handlers.GetShortUrlsByUserIdResponse{
+				Items: []types.ShortUrlResponse{
+					{
+						Id:             &expiredId,
+						DestinationUrl: &expect1Destinationurl,
+						Slug:           &expiredSlug,
+						Url:            expiredUrl,
+						UserId:         &validUserUuid,
+					},
+				},
+				Total: &oneTotal,
+				Page:  &firstPage,
+				Size:  &defaultSize,
+				Next:  &noNext,
+			},
+		},
+		{
+			Name:               "StatusAllSortSlug",
+			Page:               -1,
+			SkipPage:           true,
+			Size:               -1,
+			SkipSize:           true,
+			Params:             map[string]string{"q": "zzm0", "status": "ALL", "sort": "slug"},
+			UserUuid:           validUserUuid,
+			ExpectedStatusCode: http.StatusOK,
+			Expected: handlers.GetShortUrlsByUserIdResponse{
+				Items: []types.ShortUrlResponse{
+					{
+						Id:             &expect1Id,
+						DestinationUrl: &expect1Destinationurl,
+						Slug:           &expect1Slug,
+						Url:            expect1Url,
+						UserId:         &validUserUuid,
+					},
+					{
+						Id:             &expiredId,
+						DestinationUrl: &expect1Destinationurl,
+						Slug:           &expiredSlug,
+						Url:            expiredUrl,
+						UserId:         &validUserUuid,
+					},
+				},
+				Total: &twoTotal,
+				Page:  &firstPage,
+				Size:  &defaultSize,
+				Next:  &noNext,
+			},
+		},
+		{
+			Name:               "SortClicks",
+			Page:               1,
+			Size:               1,
+			Params:             map[string]string{"sort": "clicks"},
+			UserUuid:           validUserUuid,
+			ExpectedStatusCode: http.StatusOK,
+			Expected: handlers.GetShortUrlsByUserIdResponse{
+				Items: []types.ShortUrlResponse{
+					{
+						Id:             &expect2Id,
+						DestinationUrl: &expect2Destinationurl,
+						Slug:           &expect2Slug,
+						Url:            expect2Url,
+						UserId:         &validUserUuid,
+					},
+				},
+				Total: &expect3Total,
+				Page:  &firstPage,
+				Size:  &sizeOne,
+				Next:  &hasNext,
+			},
+		},
+		{
+			Name:               "CreatedBefore",
+			Page:               -1,
+			SkipPage:           true,
+			Size:               -1,
+			SkipSize:           true,
+			Params:             map[string]string{"created_before": "2000-01-01T00:00:00Z"},
+			UserUuid:           validUserUuid,
+			ExpectedStatusCode: http.StatusOK,
+			Expected: handlers.GetShortUrlsByUserIdResponse{
+				Items: []types.ShortUrlResponse{},
+				Total: &tagFilterNoMatchTotal,
+				Page:  &firstPage,
+				Size:  &defaultSize,
+				Next:  &noNext,
+			},
+		},
+		{
+			Name:               "InvalidSort",
+			Page:               1,
+			Size:               20,
+			Params:             map[string]string{"sort": "destination_url"},
+			UserUuid:           validUserUuid,
+			ExpectedStatusCode: http.StatusBadRequest,
+			Expected: handlers.GetShortUrlsByUserIdResponse{
+				Errors: []string{handlers.SortQueryParamError},
+			},
+		},
+		{
+			Name:               "InvalidOrder",
+			Page:               1,
+			Size:               20,
+			Params:             map[string]string{"order": "up"},
+			UserUuid:           validUserUuid,
+			ExpectedStatusCode: http.StatusBadRequest,
+			Expected: handlers.GetShortUrlsByUserIdResponse{
+				Errors: []string{handlers.OrderQueryParamError},
+			},
+		},
+		{
+			Name:               "InvalidStatus",
+			Page:               1,
+			Size:               20,
+			Params:             map[string]string{"status": "deleted"},
+			UserUuid:           validUserUuid,
+			ExpectedStatusCode: http.StatusBadRequest,
+			Expected: handlers.GetShortUrlsByUserIdResponse{
+				Errors: []string{handlers.StatusQueryParamError},
+			},
+		},
+		{
+			Name:               "InvalidCreatedAfter",
+			Page:               1,
+			Size:               20,
+			Params:             map[string]string{"created_after": "yesterday"},
+			UserUuid:           validUserUuid,
+			ExpectedStatusCode: http.StatusBadRequest,
+			Expected: handlers.GetShortUrlsByUserIdResponse{
+				Errors: []string{handlers.CreatedAfterQueryParamError},
+			},
+		},
+		{
+			Name:               "TagFilter",
+			Page:               -1,
+			SkipPage:           true,
+			Size:               -1,
+			SkipSize:           true,
+			Params:             map[string]string{"tag": "MARKETING"},
+			UserUuid:           tagOwnerUuid,
+			ExpectedStatusCode: http.StatusOK,
+			Expected: handlers.GetShortUrlsByUserIdResponse{
+				Items: []types.ShortUrlResponse{
+					{
+						Id:               &tagFilterId,
+						DestinationUrl:   &tagFilterDestinationUrl,
+						Slug:             &tagFilterSlug,
+						Url:              tagFilterUrl,
+						UserId:           &tagOwnerUuid,
+						QueryPassthrough: &tagFilterQueryPassthrough,
+						UtmSource:        &tagFilterUtmSource,
+						UtmMedium:        &tagFilterUtmMedium,
+						UtmCampaign:      &tagFilterUtmCampaign,
+						Tags: []types.Tag{
+							{Id: uuid.MustParse("019cc1c7-d1f0-734f-a2b7-a5ee16fbaf01"), Name: "Marketing"},
+						},
+					},
+				},
+				Total: &tagFilterTotal,
+				Page:  &tagFilterPage,
+				Size:  &tagFilterSize,
+				Next:  &tagFilterNext,
+			},
+		},
+		{
+			Name:               "TagFilterNoShortUrls",
+			Page:               -1,
+			SkipPage:           true,
+			Size:               -1,
+			SkipSize:           true,
+			Params:             map[string]string{"tag": "Unused"},
+			UserUuid:           tagOwnerUuid,
+			ExpectedStatusCode: http.StatusOK,
+			Expected: handlers.GetShortUrlsByUserIdResponse{
+				Items: []types.ShortUrlResponse{},
+				Total: &tagFilterNoMatchTotal,
+				Page:  &tagFilterPage,
+				Size:  &tagFilterSize,
+				Next:  &tagFilterNext,
+			},
+		},
+		{
+			Name:               "TagFilterOtherUsersTag",
+			Page:               -1,
+			SkipPage:           true,
+			Size:               -1,
+			SkipSize:           true,
+			Params:             map[string]string{"tag": "Marketing"},
+			UserUuid:           validUserUuid,
+			ExpectedStatusCode: http.StatusOK,
+			Expected: handlers.GetShortUrlsByUserIdResponse{
+				Items: []types.ShortUrlResponse{},
+				Total: &tagFilterNoMatchTotal,
+				Page:  &tagFilterPage,
+				Size:  &tagFilterSize,
+				Next:  &tagFilterNext,
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.Name+"WithCache", func(t *testing.T) {
+			t.Parallel()
+			runTestGetShortUrlsById(t, tc, true)
+		})
+		t.Run(tc.Name+"NoCache", func(t *testing.T) {
+			t.Parallel()
+			runTestGetShortUrlsById(t, tc, false)
+		})
+	}
+}
+
+func runTestGetShortUrlsById(t *testing.T, tc GetShortUrlsByUserIdCase, cacheEnabled bool) {
+	ctx := context.Background()
+	deps := SetupDependencies(t, ctx, cacheEnabled)
+
+	defer func() {
+		if err := deps.App.Server.Close(); err != nil {
+			t.Fatal(err)
+		}
+		deps.StopClickEventWorker()
+
+		if err := deps.Db.Container.Terminate(ctx); err != nil {
+			t.Fatal(err)
+		}
+
+		if cacheEnabled {
+			if err := deps.Cache.Container.Terminate(ctx); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}()
+
+	req, err := http.NewRequest(http.MethodGet, deps.TestServer.URL+"/api/v1/me/shorturl", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	queryValues := req.URL.Query()
+	if !tc.SkipPage {
+		queryValues.Add("page", strconv.Itoa(tc.Page))
+	}
+	if !tc.SkipSize {
+		queryValues.Add("size", strconv.Itoa(tc.Size))
+	}
+	for key, value := range tc.Params {
+		queryValues.Add(key, value)
+	}
+	req.URL.RawQuery = queryValues.Encode()
+
+	client := &http.Client{}
+
+	accessToken := CreateAccessToken(t, deps.App.Config.Server.Auth, 12, &tc.UserUuid, true)
+	if !tc.SkipAccessToken {
+		req.Header.Add(handlers.HeaderAuthorization, fmt.Sprintf("Bearer %s", accessToken))
+	}
+
+	res, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if res.StatusCode != tc.ExpectedStatusCode {
+		t.Errorf("expected status %d got %d", tc.ExpectedStatusCode, res.StatusCode)
+	}
+
+	var response handlers.GetShortUrlsByUserIdResponse
+	decoder := json.NewDecoder(res.Body)
+	decoder.DisallowUnknownFields()
+	if err = decoder.Decode(&response); err != nil {
+		t.Error("failed to decode body", err.Error())
+	}
+
+	err = res.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The cursor is opaque, TestGetShortUrlsByUserIdCursor follows it instead
+	if diff := cmp.Diff(tc.Expected, response, cmpopts.IgnoreFields(types.ShortUrlResponse{}, "CreatedAt", "ExpiresAt"), cmpopts.IgnoreFields(types.Tag{}, "CreatedAt"), cmpopts.IgnoreFields(handlers.GetShortUrlsByUserIdResponse{}, "NextCursor")); diff != "" {
+		t.Errorf("actual does not equal expected. diff: %s", diff)
+	}
+}
+
+type GetShortUrlsByUserIdCursorCase struct {
+	Name          string
+	Params        map[string]string
+	ExpectedSlugs []string
+}
+
+func TestGetShortUrlsByUserIdCursor(t *testing.T) {
+	t.Parallel()
+
+	cases := []GetShortUrlsByUserIdCursorCase{
+		{
+			Name:          "NewestFirst",
+			Params:        map[string]string{},
+			ExpectedSlugs: []string{"zzM0ofu", "4kJe27", "S0VieOF"},
+		},
+		{
+			Name:          "SortSlug",
+			Params:        map[string]string{"sort": "slug"},
+			ExpectedSlugs: []string{"4kJe27", "S0VieOF", "zzM0ofu"},
+		},
+		{
+			Name:          "SortExpiresAtAscending",
+			Params:        map[string]string{"sort": "expires_at", "order": "asc", "status": "all"},
+			ExpectedSlugs: []string{"zzM0ofz", "S0VieOF", "4kJe27", "zzM0ofu"},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.Name+"WithCache", func(t *testing.T) {
+			t.Parallel()
+			runTestGetShortUrlsByUserIdCursor(t, tc, true)
+		})
+		t.Run(tc.Name+"NoCache", func(t *testing.T) {
+			t.Parallel()
+			runTestGetShortUrlsByUserIdCursor(t, tc, false)
+		})
+	}
+}
+
+func runTestGetShortUrlsByUserIdCursor(t *testing.T, tc GetShortUrlsByUserIdCursorCase, cacheEnabled bool) {
+	ctx := context.Background()
+	deps := SetupDependencies(t, ctx, cacheEnabled)
+
+	defer func() {
+		if err := deps.App.Server.Close(); err != nil {
+			t.Fatal(err)
+		}
+		deps.StopClickEventWorker()
+
+		if err := deps.Db.Container.Terminate(ctx); err != nil {
+			t.Fatal(err)
+		}
+
+		if cacheEnabled {
+			if err := deps.Cache.Container.Terminate(ctx); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}()
+
+	client := &http.Client{}
+	accessToken := CreateAccessToken(t, deps.App.Config.Server.Auth, 12, &validUserUuid, true)
+
+	getPage := func(cursor string, extraParams map[string]string) (int, handlers.GetShortUrlsByUserIdResponse) {
+		req, err := http.NewRequest(http.MethodGet, deps.TestServer.URL+"/api/v1/me/shorturl", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		queryValues := req.URL.Query()
+		queryValues.Add("size", "1")
+		for key, value := range tc.Params {
+			queryValues.Set(key, value)
+		}
+		for key, value := range extraParams {
+			queryValues.Set(key, value)
+		}
+		if cursor != "" {
+			queryValues.Add("cursor", cursor)
+		}
+		req.URL.RawQuery = queryValues.Encode()
+		req.Header.Add(handlers.HeaderAuthorization, fmt.Sprintf("Bearer %s", accessToken))
+
+		res, err := client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var response handlers.GetShortUrlsByUserIdResponse
+		decoder := json.NewDecoder(res.Body)
+		decoder.DisallowUnknownFields()
+		if err = decoder.Decode(&response); err != nil {
+			t.Error("failed to decode body", err.Error())
+		}
+
+		err = res.Body.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return res.StatusCode, response
+	}
+
+	slugs := []string{}
+	cursor := ""
+	var firstCursor string
+	for range len(tc.ExpectedSlugs) + 1 {
+		statusCode, response := getPage(cursor, nil)
+		if statusCode != http.StatusOK {
+			t.Fatalf("expected status %d got %d, errors: %v", http.StatusOK, statusCode, response.Errors)
+		}
+		if cursor != "" && (response.Page != nil || response.Total != nil) {
+			t.Errorf("expected no page or total for a cursor request, got page %v total %v", response.Page, response.Total)
+		}
+		for _, item := range response.Items {
+			slugs = append(slugs, *item.Slug)
+		}
+
+		if response.NextCursor == nil {
+			break
+		}
+		cursor = *response.NextCursor
+		if firstCursor == "" {
+			firstCursor = cursor
+		}
+	}
+
+	if diff := cmp.Diff(tc.ExpectedSlugs, slugs); diff != "" {
+		t.Errorf("actual does not equal expected. diff: %s", diff)
+	}
+
+	statusCode, response := getPage(firstCursor, map[string]string{"page": "2"})
+	if statusCode != http.StatusBadRequest {
+		t.Errorf("expected status %d got %d", http.StatusBadRequest, statusCode)
+	}
+	if diff := cmp.Diff([]string{handlers.CursorWithPageQueryParamError}, response.Errors); diff != "" {
+		t.Errorf("actual does not equal expected. diff: %s", diff)
+	}
+
+	// A cursor only makes sense for the ordering it came from
+	statusCode, response = getPage(firstCursor, map[string]string{"sort": types.ShortUrlSortClicks})
+	if statusCode != http.StatusBadRequest {
+		t.Errorf("expected status %d got %d", http.StatusBadRequest, statusCode)
+	}
+	if diff := cmp.Diff([]string{handlers.CursorQueryParamError}, response.Errors); diff != "" {
+		t.Errorf("actual does not equal expected. diff: %s", diff)
+	}
+}
+
+type DeleteShortUrlByIdCase struct {
+	Name               string
+	ShortUrlIdToDelete string
+	Slug               string // checked to stop resolving once the short url is deleted
+	UserId             uuid.UUID
+	SkipAccessToken    bool
+	ExpectedStatusCode int
+	ExpectedErrors     types.ErrorResponse
+}
+
+func TestDeleteShortUrlById(t *testing.T) {
+	t.Parallel()
+
+	validShortUrlId := "019cc05b-d0e6-764d-a207-60cb9fd4d147"
+	otherUserShortUrlId := "019cbb9b-b28c-7c35-9dc0-8f3c553ca432"
+	nullUserShortUrlId := "019cc1c7-d1f0-734f-a2b7-a5ee16fbad0b"
+
+	cases := []DeleteShortUrlByIdCase{
+		{
+			Name:               "HappyPath",
+			ShortUrlIdToDelete: validShortUrlId,
+			Slug:               "zzM0ofu",
+			UserId:             validUserUuid,
+			SkipAccessToken:    false,
+			ExpectedStatusCode: http.StatusNoContent,
+			ExpectedErrors:     types.ErrorResponse{},
+		},
+		{
+			Name:               "NotLoggedIn",
+			ShortUrlIdToDelete: validShortUrlId,
+			UserId:             validUserUuid,
+			SkipAccessToken:    true,
+			ExpectedStatusCode: http.StatusUnauthorized,
+		},
+		{
+			Name:               "DeleteOtherUserShortUrl",
+			ShortUrlIdToDelete: otherUserShortUrlId,
+			UserId:             validUserUuid,
+			SkipAccessToken:    false,
+			ExpectedStatusCode: http.StatusNotFound,
+		},
+		{
+			Name:               "DeleteAnonymousShortUrl",
+			ShortUrlIdToDelete: nullUserShortUrlId,
+			UserId:             validUserUuid,
+			SkipAccessToken:    false,
+			ExpectedStatusCode: http.StatusNotFound,
+		},
+		{
+			Name:               "DeleteNotExistentShortUrl",
+			ShortUrlIdToDelete: uuid.Nil.String(),
+			UserId:             validUserUuid,
+			SkipAccessToken:    false,
+			ExpectedStatusCode: http.StatusNotFound,
+		},
+		{
+			Name:               "InvalidUuid",
+			ShortUrlIdToDelete: "sd",
+			UserId:             validUserUuid,
+			SkipAccessToken:    false,
+			ExpectedStatusCode: http.StatusBadRequest,
+			ExpectedErrors: types.ErrorResponse{
+				Errors: []string{"Short url id provided is not a valid uuid"},
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.Name+"WithCache", func(t *testing.T) {
+			t.Parallel()
+			runDeleteShortUrlById(t, tc, true)
+		})
+		t.Run(tc.Name+"NoCache", func(t *testing.T) {
+			t.Parallel()
+			runDeleteShortUrlById(t, tc, false)
+		})
+	}
+
+}
+
+func runDeleteShortUrlById(t *testing.T, tc DeleteShortUrlByIdCase, cacheEnabled bool) {
+	ctx := context.Background()
+	deps := SetupDependencies(t, ctx, cacheEnabled)
+	defer func() {
+		if err := deps.App.Server.Close(); err != nil {
+			t.Fatal(err)
+		}
+		deps.StopClickEventWorker()
+
+		if err := deps.Db.Container.Terminate(ctx); err != nil {
+			t.Fatal(err)
+		}
+
+		if cacheEnabled {
+			if err := deps.Cache.Container.Terminate(ctx); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}()
+
+	noRedirectClient := &http.Client{
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	// resolve the slug first so that the cache, when enabled, holds the short url
+	if tc.Slug != "" {
+		res, err := noRedirectClient.Get(deps.TestServer.URL + "/" + tc.Slug)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = res.Body.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	req, err := http.NewRequest(http.MethodDelete, deps.TestServer.URL+"/api/v1/me/shorturl/"+tc.ShortUrlIdToDelete, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := &http.Client{}
+	accessToken := CreateAccessToken(t, deps.App.Config.Server.Auth, 12, &tc.UserId, true)
+	if !tc.SkipAccessToken {
+		req.Header.Add(handlers.HeaderAuthorization, fmt.Sprintf("Bearer %s", accessToken))
+	}
+
+	res, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if res.StatusCode != tc.ExpectedStatusCode {
+		t.Errorf("expected status %d got %d", tc.ExpectedStatusCode, res.StatusCode)
+	}
+
+	if len(tc.ExpectedErrors.Errors) > 0 {
+		var response types.ErrorResponse
+		decoder := json.NewDecoder(res.Body)
+		decoder.DisallowUnknownFields()
+		if err = decoder.Decode(&response); err != nil {
+			t.Error("failed to decode body", err.Error())
+		}
+
+		err = res.Body.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if diff := cmp.Diff(tc.ExpectedErrors, response); diff != "" {
+			t.Errorf("actual does not equal expected. diff: %s", diff)
+		}
+	}
+
+	// a short url in the trash doesn't resolve anymore
+	if tc.Slug != "" && res.StatusCode == http.StatusNoContent {
+		res, err := noRedirectClient.Get(deps.TestServer.URL + "/" + tc.Slug)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = res.Body.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if res.StatusCode != http.StatusNotFound {
+			t.Errorf("expected deleted short url to return %d got %d", http.StatusNotFound, res.StatusCode)
+		}
+	}
+}
+
+type GetShortUrlTrashCase struct {
+	Name               string
+	IdsToDelete        []string // deleted in this order before the trash is listed
+	Params             map[string]string
+	UserId             uuid.UUID
+	SkipAccessToken    bool
+	ExpectedStatusCode int
+	ExpectedSlugs      []string
+	ExpectedTotal      int
+	ExpectedNext       bool
+	ExpectedErrors     []string
+}
+
+func TestGetShortUrlTrash(t *testing.T) {
+	t.Parallel()
+
+	cases := []GetShortUrlTrashCase{
+		{
+			Name:               "HappyPath",
+			IdsToDelete:        []string{"019cc05b-b0ca-7bf2-863f-2356491c227d", "019cc05b-d0e6-764d-a207-60cb9fd4d147"},
+			UserId:             validUserUuid,
+			ExpectedStatusCode: http.StatusOK,
+			ExpectedSlugs:      []string{"zzM0ofu", "S0VieOF"},
+			ExpectedTotal:      2,
+		},
+		{
+			Name:               "ExpiredShortUrlsAreListedToo",
+			IdsToDelete:        []string{"019cc05b-d0e6-764d-a207-60cb9fd4d148"},
+			UserId:             validUserUuid,
+			ExpectedStatusCode: http.StatusOK,
+			ExpectedSlugs:      []string{"zzM0ofz"},
+			ExpectedTotal:      1,
+		},
+		{
+			Name:               "Paged",
+			IdsToDelete:        []string{"019cc05b-b0ca-7bf2-863f-2356491c227d", "019cc05b-d0e6-764d-a207-60cb9fd4d147", "019cc05b-c45d-76f9-ab03-02af299e76ea"},
+			Params:             map[string]string{"page": "2", "size": "2"},
+			UserId:             validUserUuid,
+			ExpectedStatusCode: http.StatusOK,
+			ExpectedSlugs:      []string{"S0VieOF"},
+			ExpectedTotal:      3,
+		},
+		{
+			Name:               "HasMore",
+			IdsToDelete:        []string{"019cc05b-b0ca-7bf2-863f-2356491c227d", "019cc05b-d0e6-764d-a207-60cb9fd4d147"},
+			Params:             map[string]string{"size": "1"},
+			UserId:             validUserUuid,
+			ExpectedStatusCode: http.StatusOK,
+			ExpectedSlugs:      []string{"zzM0ofu"},
+			ExpectedTotal:      2,
+			ExpectedNext:       true,
+		},
+		{
+			Name:               "EmptyTrash",
+			UserId:             validUserUuid,
+			ExpectedStatusCode: http.StatusOK,
+			ExpectedSlugs:      []string{},
+		},
+		{
+			Name:               "OtherUsersTrashIsNotListed",
+			IdsToDelete:        []string{"019cc05b-d0e6-764d-a207-60cb9fd4d147"},
+			UserId:             tagOwnerUuid,
+			ExpectedStatusCode: http.StatusOK,
+			ExpectedSlugs:      []string{},
+		},
+		{
+			Name:               "InvalidSize",
+			Params:             map[string]string{"size": "51"},
+			UserId:             validUserUuid,
+			ExpectedStatusCode: http.StatusBadRequest,
+			ExpectedErrors:     []string{handlers.SizeQueryParamError},
+		},
+		{
+			Name:               "InvalidPage",
+			Params:             map[string]string{"page": "0"},
+			UserId:             validUserUuid,
+			ExpectedStatusCode: http.StatusBadRequest,
+			ExpectedErrors:     []string{handlers.PageQueryParamError},
+		},
+		{
+			Name:               "NotLoggedIn",
+			UserId:             validUserUuid,
+			SkipAccessToken:    true,
+			ExpectedStatusCode: http.StatusUnauthorized,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.Name+"WithCache", func(t *testing.T) {
+			t.Parallel()
+			runGetShortUrlTrash(t, tc, true)
+		})
+		t.Run(tc.Name+"NoCache", func(t *testing.T) {
+			t.Parallel()
+			runGetShortUrlTrash(t, tc, false)
+		})
+	}
+}
+
+func runGetShortUrlTrash(t *testing.T, tc GetShortUrlTrashCase, cacheEnabled bool) {
+	ctx := context.Background()
+	deps := SetupDependencies(t, ctx, cacheEnabled)
+	defer func() {
+		if err := deps.App.Server.Close(); err != nil {
+			t.Fatal(err)
+		}
+		deps.StopClickEventWorker()
+
+		if err := deps.Db.Container.Terminate(ctx); err != nil {
+			t.Fatal(err)
+		}
+
+		if cacheEnabled {
+			if err := deps.Cache.Container.Terminate(ctx); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}()
+
+	client := &http.Client{}
+	// the short urls are always deleted by their owner, the trash is then listed as tc.UserId
+	ownerAccessToken := CreateAccessToken(t, deps.App.Config.Server.Auth, 12, &validUserUuid, true)
+	for _, id := range tc.IdsToDelete {
+		req, err := http.NewRequest(http.MethodDelete, deps.TestServer.URL+"/api/v1/me/shorturl/"+id, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Add(handlers.HeaderAuthorization, fmt.Sprintf("Bearer %s", ownerAccessToken))
+		res, err := client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = res.Body.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if res.StatusCode != http.StatusNoContent {
+			t.Fatalf("expected status %d deleting %s got %d", http.StatusNoContent, id, res.StatusCode)
+		}
+	}
+
+	req, err := http.NewRequest(http.MethodGet, deps.TestServer.URL+"/api/v1/me/shorturl/trash", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := req.URL.Query()
+	for k, v := range tc.Params {
+		q.Add(k, v)
+	}
+	req.URL.RawQuery = q.Encode()
+
+	accessToken := CreateAccessToken(t, deps.App.Config.Server.Auth, 12, &tc.UserId, true)
+	if !tc.SkipAccessToken {
+		req.Header.Add(handlers.HeaderAuthorization, fmt.Sprintf("Bearer %s", accessToken))
+	}
+
+	res, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := res.Body.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	if res.StatusCode != tc.ExpectedStatusCode {
+		t.Errorf("expected status %d got %d", tc.ExpectedStatusCode, res.StatusCode)
+	}
+	if res.StatusCode == http.StatusUnauthorized {
+		return
+	}
+
+	var response handlers.GetShortUrlsByUserIdResponse
+	decoder := json.NewDecoder(res.Body)
+	decoder.DisallowUnknownFields()
+	if err = decoder.Decode(&response); err != nil {
+		t.Fatal("failed to decode body", err.Error())
+	}
+
+	if len(tc.ExpectedErrors) > 0 {
+		if diff := cmp.Diff(tc.ExpectedErrors, response.Errors); diff != "" {
+			t.Errorf("actual does not equal expected. diff: %s", diff)
+		}
+		return
+	}
+
+	slugs := []string{}
+	for _, item := range response.Items {
+		slugs = append(slugs, *item.Slug)
+		if item.DeletedAt == nil {
+			t.Errorf("expected short url %s in the trash to have a deleted_at", *item.Slug)
+		}
+	}
+	if diff := cmp.Diff(tc.ExpectedSlugs, slugs); diff != "" {
+		t.Errorf("actual does not equal expected. diff: %s", diff)
+	}
+	if response.Total == nil || *response.Total != tc.ExpectedTotal {
+		t.Errorf("expected total %d got %v", tc.ExpectedTotal, response.Total)
+	}
+	if response.Next == nil || *response.Next != tc.ExpectedNext {
+		t.Errorf("expected next %t got %v", tc.ExpectedNext, response.Next)
+	}
+}
+
+type RestoreShortUrlByIdCase struct {
+	Name                string
+	ShortUrlIdToRestore string
+	DeleteFirst         bool
+	UserId              uuid.UUID
+	SkipAccessToken     bool
+	ExpectedStatusCode  int
+	ExpectedSlug        string
+	ExpectedErrors      types.ErrorResponse
+}
+
+func TestRestoreShortUrlById(t *testing.T) {
+	t.Parallel()
+
+	validShortUrlId := "019cc05b-d0e6-764d-a207-60cb9fd4d147"
+	otherUserShortUrlId := "019cbb9b-b28c-7c35-9dc0-8f3c553ca432"
+
+	cases := []RestoreShortUrlByIdCase{
+		{
+			Name:                "HappyPath",
+			ShortUrlIdToRestore: validShortUrlId,
+			DeleteFirst:         true,
+			UserId:              validUserUuid,
+			ExpectedStatusCode:  http.StatusOK,
+			ExpectedSlug:        "zzM0ofu",
+		},
+		{
+			Name:                "NotInTheTrash",
+			ShortUrlIdToRestore: validShortUrlId,
+			UserId:              validUserUuid,
+			ExpectedStatusCode:  http.StatusNotFound,
+		},
+		{
+			Name:                "OtherUserShortUrl",
+			ShortUrlIdToRestore: validShortUrlId,
+			DeleteFirst:         true,
+			UserId:              tagOwnerUuid,
+			ExpectedStatusCode:  http.StatusNotFound,
+		},
+		{
+			Name:                "OtherUserShortUrlNotDeleted",
+			ShortUrlIdToRestore: otherUserShortUrlId,
+			UserId:              validUserUuid,
+			ExpectedStatusCode:  http.StatusNotFound,
+		},
+		{
+			Name:                "NotExistentShortUrl",
+			ShortUrlIdToRestore: uuid.Nil.String(),
+			UserId:              validUserUuid,
+			ExpectedStatusCode:  http.StatusNotFound,
+		},
+		{
+			Name:                "InvalidUuid",
+			ShortUrlIdToRestore: "sd",
+			UserId:              validUserUuid,
+			ExpectedStatusCode:  http.StatusBadRequest,
+			ExpectedErrors: types.ErrorResponse{
+				Errors: []string{"Short url id provided is not a valid uuid"},
+			},
+		},
+		{
+			Name:                "NotLoggedIn",
+			ShortUrlIdToRestore: validShortUrlId,
+			DeleteFirst:         true,
+			UserId:              validUserUuid,
+			SkipAccessToken:     true,
+			ExpectedStatusCode:  http.StatusUnauthorized,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.Name+"WithCache", func(t *testing.T) {
+			t.Parallel()
+			runRestoreShortUrlById(t, tc, true)
+		})
+		t.Run(tc.Name+"NoCache", func(t *testing.T) {
+			t.Parallel()
+			runRestoreShortUrlById(t, tc, false)
+		})
+	}
+}
+
+func runRestoreShortUrlById(t *testing.T, tc RestoreShortUrlByIdCase, cacheEnabled bool) {
+	ctx := context.Background()
+	deps := SetupDependencies(t, ctx, cacheEnabled)
+	defer func() {
+		if err := deps.App.Server.Close(); err != nil {
+			t.Fatal(err)
+		}
+		deps.StopClickEventWorker()
+
+		if err := deps.Db.Container.Terminate(ctx); err != nil {
+			t.Fatal(err)
+		}
+
+		if cacheEnabled {
+			if err := deps.Cache.Container.Terminate(ctx); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}()
+
+	client := &http.Client{}
+	noRedirectClient := &http.Client{
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	if tc.DeleteFirst {
+		ownerAccessToken := CreateAccessToken(t, deps.App.Config.Server.Auth, 12, &validUserUuid, true)
+		req, err := http.NewRequest(http.MethodDelete, deps.TestServer.URL+"/api/v1/me/shorturl/"+tc.ShortUrlIdToRestore, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Add(handlers.HeaderAuthorization, fmt.Sprintf("Bearer %s", ownerAccessToken))
+		res, err := client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = res.Body.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if res.StatusCode != http.StatusNoContent {
+			t.Fatalf("expected status %d deleting got %d", http.StatusNoContent, res.StatusCode)
+		}
+	}
+
+	req, err := http.NewRequest(http.MethodPost, deps.TestServer.URL+"/api/v1/me/shorturl/"+tc.ShortUrlIdToRestore+"/restore", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	accessToken := CreateAccessToken(t, deps.App.Config.Server.Auth, 12, &tc.UserId, true)
+	if !tc.SkipAccessToken {
+		req.Header.Add(handlers.HeaderAuthorization, fmt.Sprintf("Bearer %s", accessToken))
+	}
+
+	res, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := res.Body.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	if res.StatusCode != tc.ExpectedStatusCode {
+		t.Errorf("expected status %d got %d", tc.ExpectedStatusCode, res.StatusCode)
+	}
+
+	if len(tc.ExpectedErrors.Errors) > 0 {
+		var response types.ErrorResponse
+		decoder := json.NewDecoder(res.Body)
+		decoder.DisallowUnknownFields()
+		if err = decoder.Decode(&response); err != nil {
+			t.Error("failed to decode body", err.Error())
+		}
+
+		if diff := cmp.Diff(tc.ExpectedErrors, response); diff != "" {
+			t.Errorf("actual does not equal expected. diff: %s", diff)
+		}
+		return
+	}
+
+	if res.StatusCode != http.StatusOK {
+		return
+	}
+
+	var response types.ShortUrlResponse
+	decoder := json.NewDecoder(res.Body)
+	decoder.DisallowUnknownFields()
+	if err = decoder.Decode(&response); err != nil {
+		t.Fatal("failed to decode body", err.Error())
+	}
+	if response.Slug == nil || *response.Slug != tc.ExpectedSlug {
+		t.Errorf("expected slug %s got %v", tc.ExpectedSlug, response.Slug)
+	}
+	if response.DeletedAt != nil {
+		t.Errorf("expected restored short url to not have a deleted_at, got %v", response.DeletedAt)
+	}
+
+	// the restored short url resolves again
+	redirect, err := noRedirectClient.Get(deps.TestServer.URL + "/" + tc.ExpectedSlug)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = redirect.Body.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if redirect.StatusCode != http.StatusTemporaryRedirect {
+		t.Errorf("expected restored short url to redirect with %d got %d", http.StatusTemporaryRedirect, redirect.StatusCode)
+	}
+}
+
+type RenewShortUrlByIdCase struct {
+	Name                 string
+	ShortUrlIdToRenew    string
+	Body                 string
+	UserId               uuid.UUID
+	AllowNonExpiring     bool
+	SlidingTtl           *uint32 // patched onto the short url before it is renewed
+	SkipAccessToken      bool
+	ExpectedStatusCode   int
+	ExpectedExpiresIn    time.Duration
+	ExpectedNeverExpires bool
+	ExpectedSlug         string
+	ExpectedErrors       types.ErrorResponse
+}
+
+func TestRenewShortUrlById(t *testing.T) {
+	t.Parallel()
+
+	activeShortUrlId := "019cc05b-d0e6-764d-a207-60cb9fd4d147"
+	expiredShortUrlId := "019cc05b-d0e6-764d-a207-60cb9fd4d148"
+	otherUserShortUrlId := "019cbb9b-b28c-7c35-9dc0-8f3c553ca432"
+	slidingTtl := uint32(3600)
+
+	cases := []RenewShortUrlByIdCase{
+		{
+			Name:               "HappyPathExpiredDefaultTtl",
+			ShortUrlIdToRenew:  expiredShortUrlId,
+			UserId:             validUserUuid,
+			ExpectedStatusCode: http.StatusOK,
+			ExpectedExpiresIn:  time.Duration(authenticatedDefaultTtl) * time.Second,
+			ExpectedSlug:       "zzM0ofz",
+		},
+		{
+			Name:               "HappyPathExpiredCustomTtl",
+			ShortUrlIdToRenew:  expiredShortUrlId,
+			Body:               `{"ttl":3600}`,
+			UserId:             validUserUuid,
+			ExpectedStatusCode: http.StatusOK,
+			ExpectedExpiresIn:  time.Hour,
+			ExpectedSlug:       "zzM0ofz",
+		},
+		{
+			Name:               "ShorterTtlKeepsExpiry",
+			ShortUrlIdToRenew:  activeShortUrlId,
+			Body:               `{"ttl":900}`,
+			UserId:             validUserUuid,
+			ExpectedStatusCode: http.StatusOK,
+			ExpectedExpiresIn:  7 * 24 * time.Hour,
+			ExpectedSlug:       "zzM0ofu",
+		},
+		{
+			Name:                 "NeverExpires",
+			ShortUrlIdToRenew:    expiredShortUrlId,
+			Body:                 `{"never_expires":true}`,
+			UserId:               validUserUuid,
+			AllowNonExpiring:     true,
+			ExpectedStatusCode:   http.StatusOK,
+			ExpectedNeverExpires: true,
+			ExpectedSlug:         "zzM0ofz",
+		},
+		{
+			Name:                 "NeverExpiresDropsSlidingTtl",
+			ShortUrlIdToRenew:    activeShortUrlId,
+			Body:                 `{"never_expires":true}`,
+			UserId:               validUserUuid,
+			AllowNonExpiring:     true,
+			SlidingTtl:           &slidingTtl,
+			ExpectedStatusCode:   http.StatusOK,
+			ExpectedNeverExpires: true,
+			ExpectedSlug:         "zzM0ofu",
+		},
+		{
+			Name:               "NeverExpiresNotAllowed",
+			ShortUrlIdToRenew:  expiredShortUrlId,
+			Body:               `{"never_expires":true}`,
+			UserId:             validUserUuid,
+			ExpectedStatusCode: http.StatusBadRequest,
+			ExpectedErrors: types.ErrorResponse{
+				Errors: []string{handlers.NeverExpiresNotAllowedError},
+			},
+		},
+		{
+			Name:               "TtlGreaterThanMax",
+			ShortUrlIdToRenew:  activeShortUrlId,
+			Body:               `{"ttl":2629747}`,
+			UserId:             validUserUuid,
+			ExpectedStatusCode: http.StatusBadRequest,
+			ExpectedErrors: types.ErrorResponse{
+				Errors: []string{"`ttl` can only be up to 2629746 seconds"},
+			},
+		},
+		{
+			Name:               "TtlLessThanMin",
+			ShortUrlIdToRenew:  activeShortUrlId,
+			Body:               `{"ttl":899}`,
+			UserId:             validUserUuid,
+			ExpectedStatusCode: http.StatusBadRequest,
+			ExpectedErrors: types.ErrorResponse{
+				Errors: []string{"Key: 'RenewShortUrlRequest.TTL' Error:Field validation for 'TTL' failed on the 'min' tag"},
+			},
+		},
+		{
+			Name:               "InvalidJson",
+			ShortUrlIdToRenew:  activeShortUrlId,
+			Body:               `{"ttl":`,
+			UserId:             validUserUuid,
+			ExpectedStatusCode: http.StatusBadRequest,
+			ExpectedErrors: types.ErrorResponse{
+				Errors: []string{"Invalid JSON body for request"},
+			},
+		},
+		{
+			Name:               "OtherUserShortUrl",
+			ShortUrlIdToRenew:  otherUserShortUrlId,
+			UserId:             validUserUuid,
+			ExpectedStatusCode: http.StatusNotFound,
+		},
+		{
+			Name:               "NotExistentShortUrl",
+			ShortUrlIdToRenew:  uuid.Nil.String(),
+			UserId:             validUserUuid,
+			ExpectedStatusCode: http.StatusNotFound,
+		},
+		{
+			Name:               "InvalidUuid",
+			ShortUrlIdToRenew:  "sd",
+			UserId:             validUserUuid,
+			ExpectedStatusCode: http.StatusBadRequest,
+			ExpectedErrors: types.ErrorResponse{
+				Errors: []string{"Short url id provided is not a valid uuid"},
+			},
+		},
+		{
+			Name:               "NotLoggedIn",
+			ShortUrlIdToRenew:  expiredShortUrlId,
+			UserId:             validUserUuid,
+			SkipAccessToken:    true,
+			ExpectedStatusCode: http.StatusUnauthorized,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.Name+"WithCache", func(t *testing.T) {
+			t.Parallel()
+			runRenewShortUrlById(t, tc, true)
+		})
+		t.Run(tc.Name+"NoCache", func(t *testing.T) {
+			t.Parallel()
+			runRenewShortUrlById(t, tc, false)
+		})
+	}
+}
+
+func runRenewShortUrlById(t *testing.T, tc RenewShortUrlByIdCase, cacheEnabled bool) {
+	ctx := context.Background()
+	deps := SetupDependencies(t, ctx, cacheEnabled)
+	defer func() {
+		if err := deps.App.Server.Close(); err != nil {
+			t.Fatal(err)
+		}
+		deps.StopClickEventWorker()
+
+		if err := deps.Db.Container.Terminate(ctx); err != nil {
+			t.Fatal(err)
+		}
+
+		if cacheEnabled {
+			if err := deps.Cache.Container.Terminate(ctx); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}()
+
+	client := &http.Client{}
+	noRedirectClient := &http.Client{
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	deps.App.Config.ShortUrlTtl.AllowNonExpiring = tc.AllowNonExpiring
+	accessToken := CreateAccessToken(t, deps.App.Config.Server.Auth, 12, &tc.UserId, true)
+
+	if tc.SlidingTtl != nil {
+		body, err := json.Marshal(handlers.PatchShortUrlRequest{SlidingTtl: tc.SlidingTtl})
+		if err != nil {
+			t.Fatal(err)
+		}
+		req, err := http.NewRequest(http.MethodPatch, deps.TestServer.URL+"/api/v1/me/shorturl/"+tc.ShortUrlIdToRenew, bytes.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Add(handlers.HeaderAuthorization, fmt.Sprintf("Bearer %s", accessToken))
+		req.Header.Set(types.HeadersContentTypeKey, types.HeadersContentTypeJsonValue)
+		res, err := client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = res.Body.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if res.StatusCode != http.StatusOK {
+			t.Fatalf("expected status %d setting the sliding ttl got %d", http.StatusOK, res.StatusCode)
+		}
+	}
+
+	if tc.ExpectedSlug != "" {
+		// resolve the slug first so the cache holds the old expiry when caching is enabled
+		redirect, err := noRedirectClient.Get(deps.TestServer.URL + "/" + tc.ExpectedSlug)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = redirect.Body.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	req, err := http.NewRequest(http.MethodPost, deps.TestServer.URL+"/api/v1/me/shorturl/"+tc.ShortUrlIdToRenew+"/renew", strings.NewReader(tc.Body))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !tc.SkipAccessToken {
+		req.Header.Add(handlers.HeaderAuthorization, fmt.Sprintf("Bearer %s", accessToken))
+	}
+
+	res, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := res.Body.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	if res.StatusCode != tc.ExpectedStatusCode {
+		t.Errorf("expected status %d got %d", tc.ExpectedStatusCode, res.StatusCode)
+	}
+
+	if len(tc.ExpectedErrors.Errors) > 0 {
+		var response types.ErrorResponse
+		decoder := json.NewDecoder(res.Body)
+		decoder.DisallowUnknownFields()
+		if err = decoder.Decode(&response); err != nil {
+			t.Error("failed to decode body", err.Error())
+		}
+
+		if diff := cmp.Diff(tc.ExpectedErrors, response); diff != "" {
+			t.Errorf("actual does not equal expected. diff: %s", diff)
+		}
+		return
+	}
+
+	if res.StatusCode != http.StatusOK {
+		return
+	}
+
+	var response types.ShortUrlResponse
+	decoder := json.NewDecoder(res.Body)
+	decoder.DisallowUnknownFields()
+	if err = decoder.Decode(&response); err != nil {
+		t.Fatal("failed to decode body", err.Error())
+	}
+	if tc.ExpectedNeverExpires {
+		if response.NeverExpires == nil || !*response.NeverExpires || response.ExpiresAt != nil {
+			t.Errorf("expected the short url to never expire, got never_expires %v and expires_at %v", response.NeverExpires, response.ExpiresAt)
+		}
+		if response.SlidingTtl != nil {
+			t.Errorf("expected the sliding ttl to be dropped, got %d", *response.SlidingTtl)
+		}
+	} else {
+		if response.ExpiresAt == nil {
+			t.Fatal("expected the renewed short url to have an expires_at")
+		}
+		if expiresIn := time.Until(*response.ExpiresAt); expiresIn < tc.ExpectedExpiresIn-time.Minute || expiresIn > tc.ExpectedExpiresIn+time.Minute {
+			t.Errorf("expected the short url to expire in about %s, it expires in %s", tc.ExpectedExpiresIn, expiresIn)
+		}
+	}
+
+	// the renewed short url resolves, the cached entry from before the renewal must not be used
+	redirect, err := noRedirectClient.Get(deps.TestServer.URL + "/" + tc.ExpectedSlug)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = redirect.Body.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if redirect.StatusCode != http.StatusTemporaryRedirect {
+		t.Errorf("expected renewed short url to redirect with %d got %d", http.StatusTemporaryRedirect, redirect.StatusCode)
+	}
+}
+
+type SlidingShortUrlExpiryCase struct {
+	Name              string
+	SlidingTtl        uint32
+	ExpectedExpiresIn time.Duration
+}
+
+func TestSlidingShortUrlExpiry(t *testing.T) {
+	t.Parallel()
+
+	cases := []SlidingShortUrlExpiryCase{
+		{
+			Name:              "SlidesOnRedirect",
+			SlidingTtl:        3600,
+			ExpectedExpiresIn: time.Hour,
+		},
+		{
+			// the expiry is already past the sliding ttl so the redirect leaves it alone
+			Name:              "NeverShortensExpiry",
+			SlidingTtl:        900,
+			ExpectedExpiresIn: 2 * time.Hour,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.Name+"WithCache", func(t *testing.T) {
+			t.Parallel()
+			runSlidingShortUrlExpiry(t, tc, true)
+		})
+		t.Run(tc.Name+"NoCache", func(t *testing.T) {
+			t.Parallel()
+			runSlidingShortUrlExpiry(t, tc, false)
+		})
+	}
+}
+
+func runSlidingShortUrlExpiry(t *testing.T, tc SlidingShortUrlExpiryCase, cacheEnabled bool) {
+	ctx := context.Background()
+	deps := SetupDependencies(t, ctx, cacheEnabled)
+	defer func() {
+		if err := deps.App.Server.Close(); err != nil {
+			t.Fatal(err)
+		}
+		deps.StopClickEventWorker()
+
+		if err := deps.Db.Container.Terminate(ctx); err != nil {
+			t.Fatal(err)
+		}
+
+		if cacheEnabled {
+			if err := deps.Cache.Container.Terminate(ctx); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}()
+
+	client := &http.Client{}
+	noRedirectClient := &http.Client{
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	accessToken := CreateAccessToken(t, deps.App.Config.Server.Auth, 12, &validUserUuid, true)
+
+	var ttl uint32 = 900
+	if tc.SlidingTtl < 3600 {
+		ttl = 7200
+	}
+	body, err := json.Marshal(handlers.PostShortUrlRequest{DestinationUrl: "https://google.com", TTL: &ttl, SlidingTtl: &tc.SlidingTtl})
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, err := http.NewRequest(http.MethodPost, deps.TestServer.URL+"/api/v1/shorturl", bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Add(handlers.HeaderAuthorization, fmt.Sprintf("Bearer %s", accessToken))
+	req.Header.Set(types.HeadersContentTypeKey, types.HeadersContentTypeJsonValue)
+	req.Header.Add(types.HeadersIdempotencyKey, uuid.NewString())
+	res, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var created types.ShortUrlResponse
+	if err = json.NewDecoder(res.Body).Decode(&created); err != nil {
+		t.Fatal("failed to decode body", err.Error())
+	}
+	if err = res.Body.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if res.StatusCode != http.StatusCreated {
+		t.Fatalf("expected status %d creating got %d", http.StatusCreated, res.StatusCode)
+	}
+
+	// twice so the second redirect is served from the cache entry the first one refreshed when caching is enabled
+	for range 2 {
+		redirect, err := noRedirectClient.Get(deps.TestServer.URL + "/" + *created.Slug)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = redirect.Body.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if redirect.StatusCode != http.StatusTemporaryRedirect {
+			t.Errorf("expected status %d got %d", http.StatusTemporaryRedirect, redirect.StatusCode)
+		}
+	}
+
+	// the click event worker slides the expiry after the redirect, so keep checking until it has flushed
+	var expiresIn time.Duration
+	for range 20 {
+		req, err = http.NewRequest(http.MethodGet, deps.TestServer.URL+"/api/v1/me/shorturl?q="+*created.Slug, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Add(handlers.HeaderAuthorization, fmt.Sprintf("Bearer %s", accessToken))
+		res, err = client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var response handlers.GetShortUrlsByUserIdResponse
+		if err = json.NewDecoder(res.Body).Decode(&response); err != nil {
+			t.Fatal("failed to decode body", err.Error())
+		}
+		if err = res.Body.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if len(response.Items) != 1 || response.Items[0].ExpiresAt == nil {
+			t.Fatalf("expected to find the created short url, got %v", response.Items)
+		}
+
+		expiresIn = time.Until(*response.Items[0].ExpiresAt)
+		if expiresIn >= tc.ExpectedExpiresIn-time.Minute {
+			break
+		}
+		time.Sleep(200 * time.Millisecond)
+	}
+	if expiresIn < tc.ExpectedExpiresIn-time.Minute || expiresIn > tc.ExpectedExpiresIn+time.Minute {
+		t.Errorf("expected the short url to expire in about %s, it expires in %s", tc.ExpectedExpiresIn, expiresIn)
+	}
+}
+
+type ExportShortUrlsCase struct {
+	Name                string
+	Params              map[string]string
+	SkipAccessToken     bool
+	ExpectedStatusCode  int
+	ExpectedContentType string
+	ExpectedSlugs       []string
+	ExpectedClicks      map[string]int // nil when the clicks shouldn't be in the export
+	ExpectedErrors      []string
+}
+
+func TestExportShortUrls(t *testing.T) {
+	t.Parallel()
+
+	cases := []ExportShortUrlsCase{
+		{
+			Name:                "DefaultCsv",
+			Params:              map[string]string{},
+			ExpectedStatusCode:  http.StatusOK,
+			ExpectedContentType: "text/csv; charset=utf-8",
+			ExpectedSlugs:       []string{"S0VieOF", "4kJe27", "zzM0ofu"},
+		},
+		{
+			Name:                "CsvWithExpiredAndClicks",
+			Params:              map[string]string{"format": "csv", "include_expired": "true", "clicks": "true"},
+			ExpectedStatusCode:  http.StatusOK,
+			ExpectedContentType: "text/csv; charset=utf-8",
+			ExpectedSlugs:       []string{"zzM0ofz", "S0VieOF", "4kJe27", "zzM0ofu"},
+			ExpectedClicks:      map[string]int{"zzM0ofz": 0, "S0VieOF": 0, "4kJe27": 6, "zzM0ofu": 0},
+		},
+		{
+			Name:                "Json",
+			Params:              map[string]string{"format": "json"},
+			ExpectedStatusCode:  http.StatusOK,
+			ExpectedContentType: types.HeadersContentTypeJsonValue,
+			ExpectedSlugs:       []string{"S0VieOF", "4kJe27", "zzM0ofu"},
+		},
+		{
+			Name:                "NdjsonWithClicks",
+			Params:              map[string]string{"format": "NDJSON", "clicks": "true"},
+			ExpectedStatusCode:  http.StatusOK,
+			ExpectedContentType: "application/x-ndjson",
+			ExpectedSlugs:       []string{"S0VieOF", "4kJe27", "zzM0ofu"},
+			ExpectedClicks:      map[string]int{"S0VieOF": 0, "4kJe27": 6, "zzM0ofu": 0},
+		},
+		{
+			Name:               "InvalidParams",
+			Params:             map[string]string{"format": "xml", "include_expired": "yes", "clicks": "1"},
+			ExpectedStatusCode: http.StatusBadRequest,
+			ExpectedErrors:     []string{handlers.ExportFormatQueryParamError, handlers.ExportIncludeExpiredQueryParamError, handlers.ExportClicksQueryParamError},
+		},
+		{
+			Name:               "NotLoggedIn",
+			Params:             map[string]string{},
+			SkipAccessToken:    true,
+			ExpectedStatusCode: http.StatusUnauthorized,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.Name+"WithCache", func(t *testing.T) {
+			t.Parallel()
+			runExportShortUrls(t, tc, true)
+		})
+		t.Run(tc.Name+"NoCache", func(t *testing.T) {
+			t.Parallel()
+			runExportShortUrls(t, tc, false)
+		})
+	}
+}
+
+func runExportShortUrls(t *testing.T, tc ExportShortUrlsCase, cacheEnabled bool) {
+	ctx := context.Background()
+	deps := SetupDependencies(t, ctx, cacheEnabled)
+	defer func() {
+		if err := deps.App.Server.Close(); err != nil {
+			t.Fatal(err)
+		}
+		deps.StopClickEventWorker()
+
+		if err := deps.Db.Container.Terminate(ctx); err != nil {
+			t.Fatal(err)
+		}
+
+		if cacheEnabled {
+			if err := deps.Cache.Container.Terminate(ctx); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}()
+
+	req, err := http.NewRequest(http.MethodGet, deps.TestServer.URL+"/api/v1/me/shorturl/export", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	query := req.URL.Query()
+	for k, v := range tc.Params {
+		query.Set(k, v)
+	}
+	req.URL.RawQuery = query.Encode()
+
+	accessToken := CreateAccessToken(t, deps.App.Config.Server.Auth, 12, &validUserUuid, true)
+	if !tc.SkipAccessToken {
+		req.Header.Add(handlers.HeaderAuthorization, fmt.Sprintf("Bearer %s", accessToken))
+	}
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := res.Body.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	if res.StatusCode != tc.ExpectedStatusCode {
+		t.Errorf("expected status %d got %d", tc.ExpectedStatusCode, res.StatusCode)
+	}
+
+	if len(tc.ExpectedErrors) > 0 {
+		var response types.ErrorResponse
+		decoder := json.NewDecoder(res.Body)
+		decoder.DisallowUnknownFields()
+		if err = decoder.Decode(&response); err != nil {
+			t.Error("failed to decode body", err.Error())
+		}
+		if diff := cmp.Diff(tc.ExpectedErrors, response.Errors); diff != "" {
+			t.Errorf("actual does not equal expected. diff: %s", diff)
+		}
+		return
+	}
+	if res.StatusCode != http.StatusOK {
+		return
+	}
+
+	if contentType := res.Header.Get(types.HeadersContentTypeKey); contentType != tc.ExpectedContentType {
+		t.Errorf("expected content type %s got %s", tc.ExpectedContentType, contentType)
+	}
+	if !strings.HasPrefix(res.Header.Get("Content-Disposition"), "attachment;") {
+		t.Errorf("expected an attachment got %q", res.Header.Get("Content-Disposition"))
+	}
+
+	slugs := []string{}
+	var clicks map[string]int
+	if tc.ExpectedClicks != nil {
+		clicks = map[string]int{}
+	}
+
+	switch tc.ExpectedContentType {
+	case "text/csv; charset=utf-8":
+		records, err := csv.NewReader(res.Body).ReadAll()
+		if err != nil {
+			t.Fatal(err)
+		}
+		header := append([]string{}, handlers.ShortUrlExportCsvHeader...)
+		if tc.ExpectedClicks != nil {
+			header = append(header, "clicks")
+		}
+		if diff := cmp.Diff(header, records[0]); diff != "" {
+			t.Errorf("csv header does not equal expected. diff: %s", diff)
+		}
+		for _, record := range records[1:] {
+			slugs = append(slugs, record[1])
+			if tc.ExpectedClicks != nil {
+				count, err := strconv.Atoi(record[len(record)-1])
+				if err != nil {
+					t.Fatal(err)
+				}
+				clicks[record[1]] = count
+			}
+		}
+	default:
+		var items []handlers.ShortUrlExportItem
+		decoder := json.NewDecoder(res.Body)
+		decoder.DisallowUnknownFields()
+		if tc.ExpectedContentType == types.HeadersContentTypeJsonValue {
+			if err = decoder.Decode(&items); err != nil {
+				t.Fatal("failed to decode body", err.Error())
+			}
+		} else {
+			for decoder.More() {
+				var item handlers.ShortUrlExportItem
+				if err = decoder.Decode(&item); err != nil {
+					t.Fatal("failed to decode line", err.Error())
+				}
+				items = append(items, item)
+			}
+		}
+		for _, item := range items {
+			slugs = append(slugs, *item.Slug)
+			if item.Clicks != nil {
+				if clicks == nil {
+					t.Errorf("expected no clicks got %d for %s", *item.Clicks, *item.Slug)
+					continue
+				}
+				clicks[*item.Slug] = *item.Clicks
+			}
+		}
+	}
+
+	if diff := cmp.Diff(tc.ExpectedSlugs, slugs); diff != "" {
+		t.Errorf("exported slugs do not equal expected. diff: %s", diff)
+	}
+	if diff := cmp.Diff(tc.ExpectedClicks, clicks); diff != "" {
+		t.Errorf("exported clicks do not equal expected. diff: %s", diff)
+	}
+}
+
+type ChangeShortUrlBatchCase struct {
+	Name               string
+	Request            handlers.ChangeShortUrlBatchRequest
+	UserId             uuid.UUID
+	SkipAccessToken    bool
+	ExpectedStatusCode int
+	ExpectedItems      []handlers.ChangedShortUrlResponse
+	ExpectedChanged    *int
+	ExpectedErrors     []string
+}
+
+func TestChangeShortUrlBatch(t *testing.T) {
+	t.Parallel()
+
+	ownedId := uuid.MustParse("019cc05b-b0ca-7bf2-863f-2356491c227d")
+	ownedSlug := "S0VieOF"
+	expiredId := uuid.MustParse("019cc05b-d0e6-764d-a207-60cb9fd4d148")
+	expiredSlug := "zzM0ofz"
+	otherUserShortUrlId := uuid.MustParse("019cbb9b-b28c-7c35-9dc0-8f3c553ca432")
+	taggedId := uuid.MustParse("019cc1c7-d1f0-734f-a2b7-a5ee16fbad13")
+	taggedSlug := "c4mpaign"
+	newExpiresAt := time.Now().Add(48 * time.Hour)
+	pastExpiresAt := time.Now().Add(-time.Hour)
+	tooFarExpiresAt := time.Now().Add(time.Duration(authenticatedMaxTtl+3600) * time.Second)
+	zero, one, two := 0, 1, 2
+
+	tooManyIds := make([]uuid.UUID, handlers.MaxShortUrlBatchSize+1)
+	for i := range tooManyIds {
+		tooManyIds[i] = uuid.New()
+	}
+
+	cases := []ChangeShortUrlBatchCase{
+		{
+			Name: "DeleteByIds",
+			Request: handlers.ChangeShortUrlBatchRequest{
+				Action: handlers.ShortUrlBatchActionDelete,
+				Ids:    []uuid.UUID{ownedId, otherUserShortUrlId, expiredId, ownedId, uuid.Nil},
+			},
+			UserId:             validUserUuid,
+			ExpectedStatusCode: http.StatusOK,
+			ExpectedItems: []handlers.ChangedShortUrlResponse{
+				{Id: ownedId, Slug: &ownedSlug, Found: true},
+				{Id: otherUserShortUrlId, Found: false},
+				{Id: expiredId, Slug: &expiredSlug, Found: true},
+				{Id: uuid.Nil, Found: false},
+			},
+			ExpectedChanged: &two,
+		},
+		{
+			Name: "DeleteByFilter",
+			Request: handlers.ChangeShortUrlBatchRequest{
+				Action: handlers.ShortUrlBatchActionDelete,
+				Filter: &handlers.ShortUrlBatchFilterRequest{Status: types.ShortUrlStatusExpired},
+			},
+			UserId:             validUserUuid,
+			ExpectedStatusCode: http.StatusOK,
+			ExpectedItems: []handlers.ChangedShortUrlResponse{
+				{Id: expiredId, Slug: &expiredSlug, Found: true},
+			},
+			ExpectedChanged: &one,
+		},
+		{
+			Name: "SetExpiryByTag",
+			Request: handlers.ChangeShortUrlBatchRequest{
+				Action:    handlers.ShortUrlBatchActionExpire,
+				Filter:    &handlers.ShortUrlBatchFilterRequest{Tag: "Marketing"},
+				ExpiresAt: &newExpiresAt,
+			},
+			UserId:             tagOwnerUuid,
+			ExpectedStatusCode: http.StatusOK,
+			ExpectedItems: []handlers.ChangedShortUrlResponse{
+				{Id: taggedId, Slug: &taggedSlug, Found: true},
+			},
+			ExpectedChanged: &one,
+		},
+		{
+			Name: "SetExpiryOtherUserShortUrl",
+			Request: handlers.ChangeShortUrlBatchRequest{
+				Action:    handlers.ShortUrlBatchActionExpire,
+				Ids:       []uuid.UUID{taggedId},
+				ExpiresAt: &newExpiresAt,
+			},
+			UserId:             validUserUuid,
+			ExpectedStatusCode: http.StatusOK,
+			ExpectedItems: []handlers.ChangedShortUrlResponse{
+				{Id: taggedId, Found: false},
+			},
+			ExpectedChanged: &zero,
+		},
+		{
+			Name: "NotLoggedIn",
+			Request: handlers.ChangeShortUrlBatchRequest{
+				Action: handlers.ShortUrlBatchActionDelete,
+				Ids:    []uuid.UUID{ownedId},
+			},
+			UserId:             validUserUuid,
+			SkipAccessToken:    true,
+			ExpectedStatusCode: http.StatusUnauthorized,
+		},
+		{
+			Name: "InvalidAction",
+			Request: handlers.ChangeShortUrlBatchRequest{
+				Action: "archive",
+				Ids:    []uuid.UUID{ownedId},
+			},
+			UserId:             validUserUuid,
+			ExpectedStatusCode: http.StatusBadRequest,
+			ExpectedErrors:     []string{"Key: 'ChangeShortUrlBatchRequest.Action' Error:Field validation for 'Action' failed on the 'oneof' tag"},
+		},
+		{
+			Name: "IdsAndFilter",
+			Request: handlers.ChangeShortUrlBatchRequest{
+				Action: handlers.ShortUrlBatchActionDelete,
+				Ids:    []uuid.UUID{ownedId},
+				Filter: &handlers.ShortUrlBatchFilterRequest{Status: types.ShortUrlStatusExpired},
+			},
+			UserId:             validUserUuid,
+			ExpectedStatusCode: http.StatusBadRequest,
+			ExpectedErrors:     []string{handlers.BatchSelectionError},
+		},
+		{
+			Name: "NoSelection",
+			Request: handlers.ChangeShortUrlBatchRequest{
+				Action: handlers.ShortUrlBatchActionDelete,
+			},
+			UserId:             validUserUuid,
+			ExpectedStatusCode: http.StatusBadRequest,
+			ExpectedErrors:     []string{handlers.BatchSelectionError},
+		},
+		{
+			Name: "EmptyFilter",
+			Request: handlers.ChangeShortUrlBatchRequest{
+				Action: handlers.ShortUrlBatchActionDelete,
+				Filter: &handlers.ShortUrlBatchFilterRequest{},
+			},
+			UserId:             validUserUuid,
+			ExpectedStatusCode: http.StatusBadRequest,
+			ExpectedErrors:     []string{handlers.BatchFilterEmptyError},
+		},
+		{
+			Name: "TooManyIds",
+			Request: handlers.ChangeShortUrlBatchRequest{
+				Action: handlers.ShortUrlBatchActionDelete,
+				Ids:    tooManyIds,
+			},
+			UserId:             validUserUuid,
+			ExpectedStatusCode: http.StatusBadRequest,
+			ExpectedErrors:     []string{handlers.BatchIdsSizeError},
+		},
+		{
+			Name: "SetExpiryMissingExpiresAt",
+			Request: handlers.ChangeShortUrlBatchRequest{
+				Action: handlers.ShortUrlBatchActionExpire,
+				Ids:    []uuid.UUID{ownedId},
+			},
+			UserId:             validUserUuid,
+			ExpectedStatusCode: http.StatusBadRequest,
+			ExpectedErrors:     []string{handlers.BatchExpiresAtMissingError},
+		},
+		{
+			Name: "DeleteWithExpiresAt",
+			Request: handlers.ChangeShortUrlBatchRequest{
+				Action:    handlers.ShortUrlBatchActionDelete,
+				Ids:       []uuid.UUID{ownedId},
+				ExpiresAt: &newExpiresAt,
+			},
+			UserId:             validUserUuid,
+			ExpectedStatusCode: http.StatusBadRequest,
+			ExpectedErrors:     []string{handlers.BatchExpiresAtUnusedError},
+		},
+		{
+			Name: "SetExpiryInThePast",
+			Request: handlers.ChangeShortUrlBatchRequest{
+				Action:    handlers.ShortUrlBatchActionExpire,
+				Ids:       []uuid.UUID{ownedId},
+				ExpiresAt: &pastExpiresAt,
+			},
+			UserId:             validUserUuid,
+			ExpectedStatusCode: http.StatusBadRequest,
+			ExpectedErrors:     []string{"`expires_at` must be in the future"},
+		},
+		{
+			Name: "SetExpiryTooFar",
+			Request: handlers.ChangeShortUrlBatchRequest{
+				Action:    handlers.ShortUrlBatchActionExpire,
+				Ids:       []uuid.UUID{ownedId},
+				ExpiresAt: &tooFarExpiresAt,
+			},
+			UserId:             validUserUuid,
+			ExpectedStatusCode: http.StatusBadRequest,
+			ExpectedErrors:     []string{fmt.Sprintf("`expires_at` can only be up to %d seconds from now", authenticatedMaxTtl)},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.Name+"WithCache", func(t *testing.T) {
+			t.Parallel()
+			runChangeShortUrlBatch(t, tc, true)
+		})
+		t.Run(tc.Name+"NoCache", func(t *testing.T) {
+			t.Parallel()
+			runChangeShortUrlBatch(t, tc, false)
+		})
+	}
+}
+
+func runChangeShortUrlBatch(t *testing.T, tc ChangeShortUrlBatchCase, cacheEnabled bool) {
+	ctx := context.Background()
+	deps := SetupDependencies(t, ctx, cacheEnabled)
+	defer func() {
+		if err := deps.App.Server.Close(); err != nil {
+			t.Fatal(err)
+		}
+		deps.StopClickEventWorker()
+
+		if err := deps.Db.Container.Terminate(ctx); err != nil {
+			t.Fatal(err)
+		}
+
+		if cacheEnabled {
+			if err := deps.Cache.Container.Terminate(ctx); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}()
+
+	rbody, err := json.Marshal(tc.Request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	accessToken := CreateAccessToken(t, deps.App.Config.Server.Auth, 12, &tc.UserId, true)
+
+	send := func() handlers.ChangeShortUrlBatchResponse {
+		req, err := http.NewRequest(http.MethodPost, deps.TestServer.URL+"/api/v1/me/shorturl/batch", bytes.NewBuffer(rbody))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set(types.HeadersContentTypeKey, types.HeadersContentTypeJsonValue)
+		if !tc.SkipAccessToken {
+			req.Header.Add(handlers.HeaderAuthorization, fmt.Sprintf("Bearer %s", accessToken))
+		}
+
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer func() {
+			if err := res.Body.Close(); err != nil {
+				t.Fatal(err)
+			}
+		}()
+
+		if res.StatusCode != tc.ExpectedStatusCode {
+			t.Errorf("expected status %d got %d", tc.ExpectedStatusCode, res.StatusCode)
+		}
+
+		var response handlers.ChangeShortUrlBatchResponse
+		if res.StatusCode == http.StatusUnauthorized {
+			return response
+		}
+		decoder := json.NewDecoder(res.Body)
+		decoder.DisallowUnknownFields()
+		if err = decoder.Decode(&response); err != nil {
+			t.Error("failed to decode body", err.Error())
+		}
+		return response
+	}
+
+	response := send()
+	expected := handlers.ChangeShortUrlBatchResponse{Items: tc.ExpectedItems, Changed: tc.ExpectedChanged, Errors: tc.ExpectedErrors}
+	if diff := cmp.Diff(expected, response, cmpopts.EquateEmpty()); diff != "" {
+		t.Errorf("actual does not equal expected. diff: %s", diff)
+	}
+
+	// deleted short urls are in the trash, sending the same request again changes nothing
+	if tc.ExpectedStatusCode == http.StatusOK && tc.Request.Action == handlers.ShortUrlBatchActionDelete {
+		again := send()
+		if again.Changed == nil || *again.Changed != 0 {
+			t.Errorf("expected nothing to change when deleting again, got %v", again.Changed)
+		}
+	}
+}
+
+type PatchShortUrlByIdCase struct {
+	Name               string
+	ShortUrlIdToPatch  string
+	Slug               string
+	UserId             uuid.UUID
+	SkipAccessToken    bool
+	Request            handlers.PatchShortUrlRequest
+	ExpectedStatusCode int
+	ExpectedErrors     types.ErrorResponse
+}
+
+func TestPatchShortUrlById(t *testing.T) {
+	t.Parallel()
+
+	validShortUrlId := "019cc05b-d0e6-764d-a207-60cb9fd4d147"
+	validShortUrlSlug := "zzM0ofu"
+	otherUserShortUrlId := "019cbb9b-b28c-7c35-9dc0-8f3c553ca432"
+	expiredShortUrlId := "019cc05b-d0e6-764d-a207-60cb9fd4d148"
+
+	newDestinationUrl := "https://example.com/fixed-typo"
+	invalidDestinationUrl := "e"
+	newExpiresAt := time.Now().Add(48 * time.Hour)
+	pastExpiresAt := time.Now().Add(-1 * time.Hour)
+	tooFarExpiresAt := time.Now().Add(time.Duration(authenticatedMaxTtl+3600) * time.Second)
+	forcePreview := true
+	redirectType := http.StatusPermanentRedirect
+	utmSource := "newsletter"
+	routingRules := []handlers.RoutingRuleRequest{
+		{Match: "host", Value: "go.example.invalid", DestinationUrl: "https://partners.example.invalid/app"},
+	}
+
+	cases := []PatchShortUrlByIdCase{
+		{
+			Name:               "HappyPathDestinationUrl",
+			ShortUrlIdToPatch:  validShortUrlId,
+			Slug:               validShortUrlSlug,
+			UserId:             validUserUuid,
+			Request:            handlers.PatchShortUrlRequest{DestinationUrl: &newDestinationUrl},
+			ExpectedStatusCode: http.StatusOK,
+		},
+		{
+			Name:               "HappyPathExpiresAt",
+			ShortUrlIdToPatch:  validShortUrlId,
+			UserId:             validUserUuid,
+			Request:            handlers.PatchShortUrlRequest{ExpiresAt: &newExpiresAt},
+			ExpectedStatusCode: http.StatusOK,
+		},
+		{
+			Name:               "HappyPathForcePreview",
+			ShortUrlIdToPatch:  validShortUrlId,
+			Slug:               validShortUrlSlug,
+			UserId:             validUserUuid,
+			Request:            handlers.PatchShortUrlRequest{ForcePreview: &forcePreview},
+			ExpectedStatusCode: http.StatusOK,
+		},
+		{
+			Name:               "HappyPathRedirectType",
+			ShortUrlIdToPatch:  validShortUrlId,
+			Slug:               validShortUrlSlug,
+			UserId:             validUserUuid,
+			Request:            handlers.PatchShortUrlRequest{RedirectType: &redirectType},
+			ExpectedStatusCode: http.StatusOK,
+		},
+		{
+			Name:               "HappyPathUtmSource",
+			ShortUrlIdToPatch:  validShortUrlId,
+			Slug:               validShortUrlSlug,
+			UserId:             validUserUuid,
+			Request:            handlers.PatchShortUrlRequest{UtmSource: &utmSource},
+			ExpectedStatusCode: http.StatusOK,
+		},
+		{
+			Name:               "HappyPathRoutingRules",
+			ShortUrlIdToPatch:  validShortUrlId,
+			UserId:             validUserUuid,
+			Request:            handlers.PatchShortUrlRequest{RoutingRules: &routingRules},
+			ExpectedStatusCode: http.StatusOK,
+		},
+		{
+			Name:               "NotLoggedIn",
+			ShortUrlIdToPatch:  validShortUrlId,
+			UserId:             validUserUuid,
+			SkipAccessToken:    true,
+			Request:            handlers.PatchShortUrlRequest{DestinationUrl: &newDestinationUrl},
+			ExpectedStatusCode: http.StatusUnauthorized,
+		},
+		{
+			Name:               "PatchOtherUserShortUrl",
+			ShortUrlIdToPatch:  otherUserShortUrlId,
+			UserId:             validUserUuid,
+			Request:            handlers.PatchShortUrlRequest{DestinationUrl: &newDestinationUrl},
+			ExpectedStatusCode: http.StatusNotFound,
+		},
+		{
+			Name:               "PatchExpiredShortUrl",
+			ShortUrlIdToPatch:  expiredShortUrlId,
+			UserId:             validUserUuid,
+			Request:            handlers.PatchShortUrlRequest{DestinationUrl: &newDestinationUrl},
+			ExpectedStatusCode: http.StatusNotFound,
+		},
+		{
+			Name:               "EmptyRequest",
+			ShortUrlIdToPatch:  validShortUrlId,
+			UserId:             validUserUuid,
+			Request:            handlers.PatchShortUrlRequest{},
+			ExpectedStatusCode: http.StatusBadRequest,
+			ExpectedErrors: types.ErrorResponse{
+				Errors: []string{"at least one of `destination_url`, `expires_at`, `password`, `force_preview`, `redirect_type`, `query_passthrough`, `path_passthrough`, `utm_source`, `utm_medium`, `utm_campaign`, `routing_rules`, `variants`, `sticky_variants` or `sliding_ttl` must be provided"},
+			},
+		},
+		{
+			Name:               "InvalidDestinationUrl",
+			ShortUrlIdToPatch:  validShortUrlId,
+			UserId:             validUserUuid,
+			Request:            handlers.PatchShortUrlRequest{DestinationUrl: &invalidDestinationUrl},
+			ExpectedStatusCode: http.StatusBadRequest,
+			ExpectedErrors: types.ErrorResponse{
+				Errors: []string{"Key: 'PatchShortUrlRequest.DestinationUrl' Error:Field validation for 'DestinationUrl' failed on the 'url' tag"},
+			},
+		},
+		{
+			Name:               "ExpiresAtInPast",
+			ShortUrlIdToPatch:  validShortUrlId,
+			UserId:             validUserUuid,
+			Request:            handlers.PatchShortUrlRequest{ExpiresAt: &pastExpiresAt},
+			ExpectedStatusCode: http.StatusBadRequest,
+			ExpectedErrors: types.ErrorResponse{
+				Errors: []string{"`expires_at` must be in the future"},
+			},
+		},
+		{
+			Name:               "ExpiresAtTooFar",
+			ShortUrlIdToPatch:  validShortUrlId,
+			UserId:             validUserUuid,
+			Request:            handlers.PatchShortUrlRequest{ExpiresAt: &tooFarExpiresAt},
+			ExpectedStatusCode: http.StatusBadRequest,
+			ExpectedErrors: types.ErrorResponse{
+				Errors: []string{fmt.Sprintf("`expires_at` can only be up to %d seconds from now", authenticatedMaxTtl)},
+			},
+		},
+		{
+			Name:               "InvalidUuid",
+			ShortUrlIdToPatch:  "sd",
+			UserId:             validUserUuid,
+			Request:            handlers.PatchShortUrlRequest{DestinationUrl: &newDestinationUrl},
+			ExpectedStatusCode: http.StatusBadRequest,
+			ExpectedErrors: types.ErrorResponse{
+				Errors: []string{"Short url id provided is not a valid uuid"},
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.Name+"WithCache", func(t *testing.T) {
+			t.Parallel()
+			runPatchShortUrlById(t, tc, true)
+		})
+		t.Run(tc.Name+"NoCache", func(t *testing.T) {
+			t.Parallel()
+			runPatchShortUrlById(t, tc, false)
+		})
+	}
+}
+
+func runPatchShortUrlById(t *testing.T, tc PatchShortUrlByIdCase, cacheEnabled bool) {
+	ctx := context.Background()
+	deps := SetupDependencies(t, ctx, cacheEnabled)
+	defer func() {
+		if err := deps.App.Server.Close(); err != nil {
+			t.Fatal(err)
+		}
+		deps.StopClickEventWorker()
+
+		if err := deps.Db.Container.Terminate(ctx); err != nil {
+			t.Fatal(err)
+		}
+
+		if cacheEnabled {
+			if err := deps.Cache.Container.Terminate(ctx); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}()
+
+	noRedirectClient := &http.Client{
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	// resolve the slug first so that the cache, when enabled, holds the old destination
+	if tc.Slug != "" {
+		res, err := noRedirectClient.Get(deps.TestServer.URL + "/" + tc.Slug)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = res.Body.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	rbody, err := json.Marshal(tc.Request)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req, err := http.NewRequest(http.MethodPatch, deps.TestServer.URL+"/api/v1/me/shorturl/"+tc.ShortUrlIdToPatch, bytes.NewBuffer(rbody))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set(types.HeadersContentTypeKey, types.HeadersContentTypeJsonValue)
+
+	accessToken := CreateAccessToken(t, deps.App.Config.Server.Auth, 12, &tc.UserId, true)
+	if !tc.SkipAccessToken {
+		req.Header.Add(handlers.HeaderAuthorization, fmt.Sprintf("Bearer %s", accessToken))
+	}
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if res.StatusCode != tc.ExpectedStatusCode {
+		t.Errorf("expected status %d got %d", tc.ExpectedStatusCode, res.StatusCode)
+	}
+
+	if len(tc.ExpectedErrors.Errors) > 0 {
+		var response types.ErrorResponse
+		decoder := json.NewDecoder(res.Body)
+		decoder.DisallowUnknownFields()
+		if err = decoder.Decode(&response); err != nil {
+			t.Error("failed to decode body", err.Error())
+		}
+
+		if diff := cmp.Diff(tc.ExpectedErrors, response); diff != "" {
+			t.Errorf("actual does not equal expected. diff: %s", diff)
+		}
+	}
+
+	if tc.ExpectedStatusCode == http.StatusOK {
+		var response types.ShortUrlResponse
+		decoder := json.NewDecoder(res.Body)
+		decoder.DisallowUnknownFields()
+		if err = decoder.Decode(&response); err != nil {
+			t.Error("failed to decode body", err.Error())
+		}
+
+		if tc.Request.DestinationUrl != nil && (response.DestinationUrl == nil || *response.DestinationUrl != *tc.Request.DestinationUrl) {
+			t.Errorf("expected destination url %s got %v", *tc.Request.DestinationUrl, response.DestinationUrl)
+		}
+		if tc.Request.ExpiresAt != nil && (response.ExpiresAt == nil || !response.ExpiresAt.Round(time.Second).Equal(tc.Request.ExpiresAt.Round(time.Second))) {
+			t.Errorf("expected expires at %s got %v", tc.Request.ExpiresAt, response.ExpiresAt)
+		}
+		if tc.Request.ForcePreview != nil && *tc.Request.ForcePreview && (response.ForcePreview == nil || !*response.ForcePreview) {
+			t.Errorf("expected force preview to be set, got %v", response.ForcePreview)
+		}
+		if tc.Request.RedirectType != nil && (response.RedirectType == nil || *response.RedirectType != *tc.Request.RedirectType) {
+			t.Errorf("expected redirect type %d got %v", *tc.Request.RedirectType, response.RedirectType)
+		}
+		if tc.Request.UtmSource != nil && (response.UtmSource == nil || *response.UtmSource != *tc.Request.UtmSource) {
+			t.Errorf("expected utm source %s got %v", *tc.Request.UtmSource, response.UtmSource)
+		}
+		if tc.Request.RoutingRules != nil && len(response.RoutingRules) != len(*tc.Request.RoutingRules) {
+			t.Errorf("expected %d routing rules got %d", len(*tc.Request.RoutingRules), len(response.RoutingRules))
+		}
+	}
+
+	err = res.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if tc.Slug != "" && tc.Request.DestinationUrl != nil {
+		res, err := noRedirectClient.Get(deps.TestServer.URL + "/" + tc.Slug)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = res.Body.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		if location := res.Header.Get("Location"); location != *tc.Request.DestinationUrl {
+			t.Errorf("expected redirect to %s after update, got %s", *tc.Request.DestinationUrl, location)
+		}
+	}
+
+	if tc.Slug != "" && tc.Request.ForcePreview != nil && *tc.Request.ForcePreview {
+		res, err := noRedirectClient.Get(deps.TestServer.URL + "/" + tc.Slug)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = res.Body.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		if res.StatusCode != http.StatusOK {
+			t.Errorf("expected the preview page after update, got status %d", res.StatusCode)
+		}
+	}
+
+	if tc.Slug != "" && tc.Request.RedirectType != nil {
+		res, err := noRedirectClient.Get(deps.TestServer.URL + "/" + tc.Slug)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = res.Body.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		if res.StatusCode != *tc.Request.RedirectType {
+			t.Errorf("expected status %d after update, got %d", *tc.Request.RedirectType, res.StatusCode)
+		}
+	}
+
+	if tc.Slug != "" && tc.Request.UtmSource != nil {
+		res, err := noRedirectClient.Get(deps.TestServer.URL + "/" + tc.Slug)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = res.Body.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		location, err := url.Parse(res.Header.Get("Location"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if utmSource := location.Query().Get("utm_source"); utmSource != *tc.Request.UtmSource {
+			t.Errorf("expected utm_source %s after update, got %s", *tc.Request.UtmSource, utmSource)
+		}
+	}
+}
+
+type GetShortUrlStatsByIdCase struct {
+	Name               string
+	ShortUrlId         string
+	Slug               string
+	UserId             uuid.UUID
+	SkipAccessToken    bool
+	Days               string
+	ExpectedStatusCode int
+	Expected           handlers.GetShortUrlStatsResponse
+}
+
+func TestGetShortUrlStatsById(t *testing.T) {
+	t.Parallel()
+
+	shortUrlWithClicksId := uuid.MustParse("019cc05b-c45d-76f9-ab03-02af299e76ea")
+	shortUrlWithoutClicksId := uuid.MustParse("019cc05b-d0e6-764d-a207-60cb9fd4d147")
+	otherUserShortUrlId := "019cbb9b-b28c-7c35-9dc0-8f3c553ca432"
+
+	today := time.Now().UTC()
+	yesterday := today.AddDate(0, 0, -1)
+	total := 6
+	oneClick := 1
+
+	cases := []GetShortUrlStatsByIdCase{
+		{
+			Name:               "HappyPath",
+			ShortUrlId:         shortUrlWithClicksId.String(),
+			UserId:             validUserUuid,
+			Days:               "2",
+			ExpectedStatusCode: http.StatusOK,
+			Expected: handlers.GetShortUrlStatsResponse{
+				Id:       &shortUrlWithClicksId,
+				Total:    &total,
+				Timezone: types.DefaultTimezone,
+				Daily: []handlers.DailyClicksResponse{
+					{Date: yesterday.Format(time.DateOnly), Clicks: 2},
+					{Date: today.Format(time.DateOnly), Clicks: 3},
+				},
+			},
+		},
+		{
+			Name:               "RedirectIsRecorded",
+			ShortUrlId:         shortUrlWithoutClicksId.String(),
+			Slug:               "zzM0ofu",
+			UserId:             validUserUuid,
+			Days:               "1",
 			ExpectedStatusCode: http.StatusOK,
-			Expected: handlers.GetShortUrlsByUserIdResponse{
-				Items: []types.ShortUrlResponse{
-					{
-						Id:             &expect1Id,
-						DestinationUrl: &expect1Destinationurl,
-						Slug:           &expect1Slug,
-						Url:            expect1Url,
-						UserId:         &validUserUuid,
-					},
+			Expected: handlers.GetShortUrlStatsResponse{
+				Id:       &shortUrlWithoutClicksId,
+				Total:    &oneClick,
+				Timezone: types.DefaultTimezone,
+				Daily: []handlers.DailyClicksResponse{
+					{Date: today.Format(time.DateOnly), Clicks: 1},
 				},
-				Total: &expect1Total,
-				Page:  &expect1Page,
-				Size:  &expect1Size,
-				Next:  &expect1Next,
 			},
 		},
 		{
-			Name:               "ExpectNoneOffsetOvershoot",
-			Page:               3,
-			Size:               20,
-			UserUuid:           validUserUuid,
-			ExpectedStatusCode: http.StatusOK,
-			Expected: handlers.GetShortUrlsByUserIdResponse{
-				Items: []types.ShortUrlResponse{},
-				Total: &expect2Total,
-				Page:  &expect2Page,
-				Size:  &expect2Size,
-				Next:  &expect2Next,
+			Name:               "NotLoggedIn",
+			ShortUrlId:         shortUrlWithClicksId.String(),
+			UserId:             validUserUuid,
+			SkipAccessToken:    true,
+			ExpectedStatusCode: http.StatusUnauthorized,
+		},
+		{
+			Name:               "OtherUserShortUrl",
+			ShortUrlId:         otherUserShortUrlId,
+			UserId:             validUserUuid,
+			ExpectedStatusCode: http.StatusNotFound,
+		},
+		{
+			Name:               "InvalidDays",
+			ShortUrlId:         shortUrlWithClicksId.String(),
+			UserId:             validUserUuid,
+			Days:               "366",
+			ExpectedStatusCode: http.StatusBadRequest,
+			Expected: handlers.GetShortUrlStatsResponse{
+				Errors: []string{handlers.DaysQueryParamError},
 			},
 		},
 		{
-			Name:               "Expect3Normal",
-			Page:               -1,
-			SkipPage:           true,
-			Size:               -1,
-			SkipSize:           true,
-			UserUuid:           validUserUuid,
-			ExpectedStatusCode: http.StatusOK,
-			Expected: handlers.GetShortUrlsByUserIdResponse{
-				Items: []types.ShortUrlResponse{
-					{
-						Id:             &expect1Id,
-						DestinationUrl: &expect1Destinationurl,
-						Slug:           &expect1Slug,
-						Url:            expect1Url,
-						UserId:         &validUserUuid,
-					},
-					{
-						Id:             &expect2Id,
-						DestinationUrl: &expect2Destinationurl,
-						Slug:           &expect2Slug,
-						Url:            expect2Url,
-						UserId:         &validUserUuid,
-					},
-					{
-						Id:             &expect3Id,
-						DestinationUrl: &expect3Destinationurl,
-						Slug:           &expect3Slug,
-						Url:            expect3Url,
-						UserId:         &validUserUuid,
-					},
-				},
-				Total: &expect3Total,
-				Page:  &expect3Page,
-				Size:  &expect3Size,
-				Next:  &expect3Next,
+			Name:               "InvalidUuid",
+			ShortUrlId:         "sd",
+			UserId:             validUserUuid,
+			ExpectedStatusCode: http.StatusBadRequest,
+			Expected: handlers.GetShortUrlStatsResponse{
+				Errors: []string{"Short url id provided is not a valid uuid"},
 			},
 		},
 	}
@@ -820,23 +4340,23 @@ func TestGetShortUrlsByUserId(t *testing.T) {
 	for _, tc := range cases {
 		t.Run(tc.Name+"WithCache", func(t *testing.T) {
 			t.Parallel()
-			runTestGetShortUrlsById(t, tc, true)
+			runGetShortUrlStatsById(t, tc, true)
 		})
 		t.Run(tc.Name+"NoCache", func(t *testing.T) {
 			t.Parallel()
-			runTestGetShortUrlsById(t, tc, false)
+			runGetShortUrlStatsById(t, tc, false)
 		})
 	}
 }
 
-func runTestGetShortUrlsById(t *testing.T, tc GetShortUrlsByUserIdCase, cacheEnabled bool) {
+func runGetShortUrlStatsById(t *testing.T, tc GetShortUrlStatsByIdCase, cacheEnabled bool) {
 	ctx := context.Background()
 	deps := SetupDependencies(t, ctx, cacheEnabled)
-
 	defer func() {
 		if err := deps.App.Server.Close(); err != nil {
 			t.Fatal(err)
 		}
+		deps.StopClickEventWorker()
 
 		if err := deps.Db.Container.Terminate(ctx); err != nil {
 			t.Fatal(err)
@@ -849,113 +4369,172 @@ func runTestGetShortUrlsById(t *testing.T, tc GetShortUrlsByUserIdCase, cacheEna
 		}
 	}()
 
-	req, err := http.NewRequest(http.MethodGet, deps.TestServer.URL+"/api/v1/me/shorturl", nil)
-	if err != nil {
-		t.Fatal(err)
-	}
-	queryValues := req.URL.Query()
-	if !tc.SkipPage {
-		queryValues.Add("page", strconv.Itoa(tc.Page))
+	if tc.Slug != "" {
+		noRedirectClient := &http.Client{
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		}
+		res, err := noRedirectClient.Get(deps.TestServer.URL + "/" + tc.Slug)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = res.Body.Close(); err != nil {
+			t.Fatal(err)
+		}
 	}
-	if !tc.SkipSize {
-		queryValues.Add("size", strconv.Itoa(tc.Size))
+
+	url := deps.TestServer.URL + "/api/v1/me/shorturl/" + tc.ShortUrlId + "/stats"
+	if tc.Days != "" {
+		url += "?days=" + tc.Days
 	}
-	req.URL.RawQuery = queryValues.Encode()
+	accessToken := CreateAccessToken(t, deps.App.Config.Server.Auth, 12, &tc.UserId, true)
 
-	client := &http.Client{}
+	var res *http.Response
+	// click events are flushed in batches by the click event worker, give them a moment to show up
+	for attempt := 0; attempt < 20; attempt++ {
+		req, err := http.NewRequest(http.MethodGet, url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !tc.SkipAccessToken {
+			req.Header.Add(handlers.HeaderAuthorization, fmt.Sprintf("Bearer %s", accessToken))
+		}
 
-	accessToken := CreateAccessToken(t, deps.App.Config.Server.Auth, 12, &tc.UserUuid, true)
-	if !tc.SkipAccessToken {
-		req.Header.Add(handlers.HeaderAuthorization, fmt.Sprintf("Bearer %s", accessToken))
-	}
+		res, err = http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tc.Expected.Total == nil || res.StatusCode != http.StatusOK {
+			break
+		}
 
-	res, err := client.Do(req)
-	if err != nil {
-		t.Fatal(err)
+		var response handlers.GetShortUrlStatsResponse
+		decoder := json.NewDecoder(res.Body)
+		decoder.DisallowUnknownFields()
+		if err = decoder.Decode(&response); err != nil {
+			t.Error("failed to decode body", err.Error())
+		}
+		if err = res.Body.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		if response.Total != nil && *response.Total >= *tc.Expected.Total || attempt == 19 {
+			if diff := cmp.Diff(tc.Expected, response); diff != "" {
+				t.Errorf("actual does not equal expected. diff: %s", diff)
+			}
+			break
+		}
+		time.Sleep(200 * time.Millisecond)
 	}
 
 	if res.StatusCode != tc.ExpectedStatusCode {
 		t.Errorf("expected status %d got %d", tc.ExpectedStatusCode, res.StatusCode)
 	}
 
-	var response handlers.GetShortUrlsByUserIdResponse
-	decoder := json.NewDecoder(res.Body)
-	decoder.DisallowUnknownFields()
-	if err = decoder.Decode(&response); err != nil {
-		t.Error("failed to decode body", err.Error())
-	}
-
-	err = res.Body.Close()
-	if err != nil {
-		t.Fatal(err)
-	}
+	if len(tc.Expected.Errors) > 0 {
+		var response handlers.GetShortUrlStatsResponse
+		decoder := json.NewDecoder(res.Body)
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&response); err != nil {
+			t.Error("failed to decode body", err.Error())
+		}
 
-	if diff := cmp.Diff(tc.Expected, response, cmpopts.IgnoreFields(types.ShortUrlResponse{}, "CreatedAt", "ExpiresAt")); diff != "" {
-		t.Errorf("actual does not equal expected. diff: %s", diff)
+		if diff := cmp.Diff(tc.Expected, response); diff != "" {
+			t.Errorf("actual does not equal expected. diff: %s", diff)
+		}
 	}
 }
 
-type DeleteShortUrlByIdCase struct {
-	Name               string
-	ShortUrlIdToDelete string
-	UserId             uuid.UUID
-	SkipAccessToken    bool
-	ExpectedStatusCode int
-	ExpectedErrors     types.ErrorResponse
+type GetShortUrlQrCodeByIdCase struct {
+	Name                string
+	ShortUrlId          string
+	UserId              uuid.UUID
+	SkipAccessToken     bool
+	Query               string
+	ExpectedStatusCode  int
+	ExpectedContentType string
+	ExpectedSize        int // only checked for png
+	Expected            types.ErrorResponse
 }
 
-func TestDeleteShortUrlById(t *testing.T) {
+func TestGetShortUrlQrCodeById(t *testing.T) {
 	t.Parallel()
 
-	validShortUrlId := "019cc05b-d0e6-764d-a207-60cb9fd4d147"
+	shortUrlId := "019cc05b-c45d-76f9-ab03-02af299e76ea"
 	otherUserShortUrlId := "019cbb9b-b28c-7c35-9dc0-8f3c553ca432"
-	nullUserShortUrlId := "019cc1c7-d1f0-734f-a2b7-a5ee16fbad0b"
 
-	cases := []DeleteShortUrlByIdCase{
+	cases := []GetShortUrlQrCodeByIdCase{
 		{
-			Name:               "HappyPath",
-			ShortUrlIdToDelete: validShortUrlId,
-			UserId:             validUserUuid,
-			SkipAccessToken:    false,
-			ExpectedStatusCode: http.StatusNoContent,
-			ExpectedErrors:     types.ErrorResponse{},
+			Name:                "HappyPath",
+			ShortUrlId:          shortUrlId,
+			UserId:              validUserUuid,
+			ExpectedStatusCode:  http.StatusOK,
+			ExpectedContentType: "image/png",
+			ExpectedSize:        handlers.DefaultQrCodeSize,
+		},
+		{
+			Name:                "CustomSizeMarginAndErrorCorrection",
+			ShortUrlId:          shortUrlId,
+			UserId:              validUserUuid,
+			Query:               "?size=300&margin=0&error_correction=h",
+			ExpectedStatusCode:  http.StatusOK,
+			ExpectedContentType: "image/png",
+			ExpectedSize:        300,
+		},
+		{
+			Name:                "Svg",
+			ShortUrlId:          shortUrlId,
+			UserId:              validUserUuid,
+			Query:               "?format=svg",
+			ExpectedStatusCode:  http.StatusOK,
+			ExpectedContentType: "image/svg+xml",
 		},
 		{
 			Name:               "NotLoggedIn",
-			ShortUrlIdToDelete: validShortUrlId,
+			ShortUrlId:         shortUrlId,
 			UserId:             validUserUuid,
 			SkipAccessToken:    true,
 			ExpectedStatusCode: http.StatusUnauthorized,
 		},
 		{
-			Name:               "DeleteOtherUserShortUrl",
-			ShortUrlIdToDelete: otherUserShortUrlId,
+			Name:               "OtherUserShortUrl",
+			ShortUrlId:         otherUserShortUrlId,
 			UserId:             validUserUuid,
-			SkipAccessToken:    false,
 			ExpectedStatusCode: http.StatusNotFound,
 		},
 		{
-			Name:               "DeleteAnonymousShortUrl",
-			ShortUrlIdToDelete: nullUserShortUrlId,
+			Name:               "InvalidUuid",
+			ShortUrlId:         "sd",
 			UserId:             validUserUuid,
-			SkipAccessToken:    false,
-			ExpectedStatusCode: http.StatusNotFound,
+			ExpectedStatusCode: http.StatusBadRequest,
+			Expected: types.ErrorResponse{
+				Errors: []string{"Short url id provided is not a valid uuid"},
+			},
 		},
 		{
-			Name:               "DeleteNotExistentShortUrl",
-			ShortUrlIdToDelete: uuid.Nil.String(),
+			Name:               "InvalidQueryParams",
+			ShortUrlId:         shortUrlId,
 			UserId:             validUserUuid,
-			SkipAccessToken:    false,
-			ExpectedStatusCode: http.StatusNotFound,
+			Query:              "?format=gif&size=10&margin=-1&error_correction=X",
+			ExpectedStatusCode: http.StatusBadRequest,
+			Expected: types.ErrorResponse{
+				Errors: []string{
+					handlers.QrCodeFormatQueryParamError,
+					handlers.QrCodeSizeQueryParamError,
+					handlers.QrCodeMarginQueryParamError,
+					handlers.QrCodeErrorCorrectionQueryParamError,
+				},
+			},
 		},
 		{
-			Name:               "InvalidUuid",
-			ShortUrlIdToDelete: "sd",
+			Name:               "TooSmall",
+			ShortUrlId:         shortUrlId,
 			UserId:             validUserUuid,
-			SkipAccessToken:    false,
+			Query:              "?size=64&margin=16&error_correction=H",
 			ExpectedStatusCode: http.StatusBadRequest,
-			ExpectedErrors: types.ErrorResponse{
-				Errors: []string{"Short url id provided is not a valid uuid"},
+			Expected: types.ErrorResponse{
+				Errors: []string{handlers.QrCodeTooSmallError},
 			},
 		},
 	}
@@ -963,23 +4542,23 @@ func TestDeleteShortUrlById(t *testing.T) {
 	for _, tc := range cases {
 		t.Run(tc.Name+"WithCache", func(t *testing.T) {
 			t.Parallel()
-			runDeleteShortUrlById(t, tc, true)
+			runGetShortUrlQrCodeById(t, tc, true)
 		})
 		t.Run(tc.Name+"NoCache", func(t *testing.T) {
 			t.Parallel()
-			runDeleteShortUrlById(t, tc, false)
+			runGetShortUrlQrCodeById(t, tc, false)
 		})
 	}
-
 }
 
-func runDeleteShortUrlById(t *testing.T, tc DeleteShortUrlByIdCase, cacheEnabled bool) {
+func runGetShortUrlQrCodeById(t *testing.T, tc GetShortUrlQrCodeByIdCase, cacheEnabled bool) {
 	ctx := context.Background()
 	deps := SetupDependencies(t, ctx, cacheEnabled)
 	defer func() {
 		if err := deps.App.Server.Close(); err != nil {
 			t.Fatal(err)
 		}
+		deps.StopClickEventWorker()
 
 		if err := deps.Db.Container.Terminate(ctx); err != nil {
 			t.Fatal(err)
@@ -992,42 +4571,71 @@ func runDeleteShortUrlById(t *testing.T, tc DeleteShortUrlByIdCase, cacheEnabled
 		}
 	}()
 
-	req, err := http.NewRequest(http.MethodDelete, deps.TestServer.URL+"/api/v1/me/shorturl/"+tc.ShortUrlIdToDelete, nil)
+	req, err := http.NewRequest(http.MethodGet, deps.TestServer.URL+"/api/v1/me/shorturl/"+tc.ShortUrlId+"/qr"+tc.Query, nil)
 	if err != nil {
 		t.Fatal(err)
 	}
-
-	client := &http.Client{}
-	accessToken := CreateAccessToken(t, deps.App.Config.Server.Auth, 12, &tc.UserId, true)
 	if !tc.SkipAccessToken {
+		accessToken := CreateAccessToken(t, deps.App.Config.Server.Auth, 12, &tc.UserId, true)
 		req.Header.Add(handlers.HeaderAuthorization, fmt.Sprintf("Bearer %s", accessToken))
 	}
 
-	res, err := client.Do(req)
+	res, err := http.DefaultClient.Do(req)
 	if err != nil {
 		t.Fatal(err)
 	}
+	defer func() {
+		if err := res.Body.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}()
 
-	if res.StatusCode != tc.ExpectedStatusCode {
-		t.Errorf("expected status %d got %d", tc.ExpectedStatusCode, res.StatusCode)
+	checkQrCodeResponse(t, res, tc.ExpectedStatusCode, tc.ExpectedContentType, tc.ExpectedSize, tc.Expected)
+}
+
+func checkQrCodeResponse(t *testing.T, res *http.Response, expectedStatusCode int, expectedContentType string, expectedSize int, expected types.ErrorResponse) {
+	if res.StatusCode != expectedStatusCode {
+		t.Errorf("expected status %d got %d", expectedStatusCode, res.StatusCode)
 	}
 
-	if len(tc.ExpectedErrors.Errors) > 0 {
+	if len(expected.Errors) > 0 {
 		var response types.ErrorResponse
 		decoder := json.NewDecoder(res.Body)
 		decoder.DisallowUnknownFields()
-		if err = decoder.Decode(&response); err != nil {
+		if err := decoder.Decode(&response); err != nil {
 			t.Error("failed to decode body", err.Error())
 		}
 
-		err = res.Body.Close()
+		if diff := cmp.Diff(expected, response); diff != "" {
+			t.Errorf("actual does not equal expected. diff: %s", diff)
+		}
+		return
+	}
+
+	if expectedContentType == "" {
+		return
+	}
+
+	if contentType := res.Header.Get("Content-Type"); contentType != expectedContentType {
+		t.Errorf("expected content type %s got %s", expectedContentType, contentType)
+	}
+
+	switch expectedContentType {
+	case "image/png":
+		img, err := png.Decode(res.Body)
+		if err != nil {
+			t.Fatal("failed to decode png", err.Error())
+		}
+		if img.Bounds().Dx() != expectedSize || img.Bounds().Dy() != expectedSize {
+			t.Errorf("expected a %dx%d png got %dx%d", expectedSize, expectedSize, img.Bounds().Dx(), img.Bounds().Dy())
+		}
+	case "image/svg+xml":
+		body, err := io.ReadAll(res.Body)
 		if err != nil {
 			t.Fatal(err)
 		}
-
-		if diff := cmp.Diff(tc.ExpectedErrors, response); diff != "" {
-			t.Errorf("actual does not equal expected. diff: %s", diff)
+		if !bytes.HasPrefix(body, []byte("<svg")) {
+			t.Errorf("expected an svg document, got %s", body)
 		}
 	}
-
 }
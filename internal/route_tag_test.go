@@ -0,0 +1,493 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/amieldelatorre/shurl/internal/handlers"
+	"github.com/amieldelatorre/shurl/internal/types"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"github.com/google/uuid"
+)
+
+var (
+	tagOwnerUuid       = uuid.MustParse("019cbcdb-aaf4-7680-a3f7-8acef63e0151")
+	marketingTagId     = "019cc1c7-d1f0-734f-a2b7-a5ee16fbaf01"
+	unusedTagId        = "019cc1c7-d1f0-734f-a2b7-a5ee16fbaf02"
+	taggedShortUrlId   = "019cc1c7-d1f0-734f-a2b7-a5ee16fbad13"
+	untaggedShortUrlId = "019cc1c7-d1f0-734f-a2b7-a5ee16fbad14"
+)
+
+type GetTagsCase struct {
+	Name               string
+	UserId             uuid.UUID
+	SkipAccessToken    bool
+	ExpectedStatusCode int
+	Expected           handlers.GetTagsResponse
+}
+
+func TestGetTags(t *testing.T) {
+	t.Parallel()
+
+	marketingId := uuid.MustParse(marketingTagId)
+	marketingName := "Marketing"
+	unusedId := uuid.MustParse(unusedTagId)
+	unusedName := "Unused"
+
+	cases := []GetTagsCase{
+		{
+			Name:               "HappyPath",
+			UserId:             tagOwnerUuid,
+			ExpectedStatusCode: http.StatusOK,
+			Expected: handlers.GetTagsResponse{
+				Items: []handlers.TagResponse{
+					{Id: &marketingId, Name: &marketingName},
+					{Id: &unusedId, Name: &unusedName},
+				},
+			},
+		},
+		{
+			Name:               "NoTags",
+			UserId:             validUserUuid,
+			ExpectedStatusCode: http.StatusOK,
+			Expected: handlers.GetTagsResponse{
+				Items: []handlers.TagResponse{},
+			},
+		},
+		{
+			Name:               "NotLoggedIn",
+			UserId:             tagOwnerUuid,
+			SkipAccessToken:    true,
+			ExpectedStatusCode: http.StatusUnauthorized,
+			Expected: handlers.GetTagsResponse{
+				Errors: []string{"Login required"},
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.Name+"WithCache", func(t *testing.T) {
+			t.Parallel()
+			runGetTags(t, tc, true)
+		})
+		t.Run(tc.Name+"NoCache", func(t *testing.T) {
+			t.Parallel()
+			runGetTags(t, tc, false)
+		})
+	}
+}
+
+func runGetTags(t *testing.T, tc GetTagsCase, cacheEnabled bool) {
+	ctx := context.Background()
+	deps := SetupDependencies(t, ctx, cacheEnabled)
+	defer func() {
+		if err := deps.App.Server.Close(); err != nil {
+			t.Fatal(err)
+		}
+		deps.StopClickEventWorker()
+
+		if err := deps.Db.Container.Terminate(ctx); err != nil {
+			t.Fatal(err)
+		}
+
+		if cacheEnabled {
+			if err := deps.Cache.Container.Terminate(ctx); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}()
+
+	req, err := http.NewRequest(http.MethodGet, deps.TestServer.URL+"/api/v1/me/tags", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := &http.Client{}
+	accessToken := CreateAccessToken(t, deps.App.Config.Server.Auth, 12, &tc.UserId, true)
+	if !tc.SkipAccessToken {
+		req.Header.Add(handlers.HeaderAuthorization, fmt.Sprintf("Bearer %s", accessToken))
+	}
+
+	res, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if res.StatusCode != tc.ExpectedStatusCode {
+		t.Errorf("expected status %d got %d", tc.ExpectedStatusCode, res.StatusCode)
+	}
+
+	var response handlers.GetTagsResponse
+	decoder := json.NewDecoder(res.Body)
+	decoder.DisallowUnknownFields()
+	if err = decoder.Decode(&response); err != nil {
+		t.Error("failed to decode body", err.Error())
+	}
+
+	err = res.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if diff := cmp.Diff(tc.Expected, response, cmpopts.IgnoreFields(handlers.TagResponse{}, "CreatedAt")); diff != "" {
+		t.Errorf("actual does not equal expected. diff: %s", diff)
+	}
+}
+
+type PostTagCase struct {
+	Name               string
+	Request            handlers.PostTagRequest
+	UserId             uuid.UUID
+	SkipAccessToken    bool
+	ExpectedStatusCode int
+	Expected           handlers.TagResponse
+}
+
+func TestPostTag(t *testing.T) {
+	t.Parallel()
+
+	happyPathName := "Newsletters"
+	otherUsersTagName := "Marketing"
+
+	cases := []PostTagCase{
+		{
+			Name:               "HappyPath",
+			Request:            handlers.PostTagRequest{Name: "  Newsletters "},
+			UserId:             tagOwnerUuid,
+			ExpectedStatusCode: http.StatusCreated,
+			Expected:           handlers.TagResponse{Name: &happyPathName},
+		},
+		{
+			Name:               "SameNameAsOtherUsersTag",
+			Request:            handlers.PostTagRequest{Name: "Marketing"},
+			UserId:             validUserUuid,
+			ExpectedStatusCode: http.StatusCreated,
+			Expected:           handlers.TagResponse{Name: &otherUsersTagName},
+		},
+		{
+			Name:               "TagExistsDifferentCase",
+			Request:            handlers.PostTagRequest{Name: "marketing"},
+			UserId:             tagOwnerUuid,
+			ExpectedStatusCode: http.StatusConflict,
+			Expected: handlers.TagResponse{
+				Errors: []string{"tag 'marketing' already exists"},
+			},
+		},
+		{
+			Name:               "BlankName",
+			Request:            handlers.PostTagRequest{Name: "   "},
+			UserId:             tagOwnerUuid,
+			ExpectedStatusCode: http.StatusBadRequest,
+			Expected: handlers.TagResponse{
+				Errors: []string{"Key: 'PostTagRequest.Name' Error:Field validation for 'Name' failed on the 'required' tag"},
+			},
+		},
+		{
+			Name:               "NotLoggedIn",
+			Request:            handlers.PostTagRequest{Name: "Newsletters"},
+			UserId:             tagOwnerUuid,
+			SkipAccessToken:    true,
+			ExpectedStatusCode: http.StatusUnauthorized,
+			Expected: handlers.TagResponse{
+				Errors: []string{"Login required"},
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.Name+"WithCache", func(t *testing.T) {
+			t.Parallel()
+			runPostTag(t, tc, true)
+		})
+		t.Run(tc.Name+"NoCache", func(t *testing.T) {
+			t.Parallel()
+			runPostTag(t, tc, false)
+		})
+	}
+}
+
+func runPostTag(t *testing.T, tc PostTagCase, cacheEnabled bool) {
+	ctx := context.Background()
+	deps := SetupDependencies(t, ctx, cacheEnabled)
+	defer func() {
+		if err := deps.App.Server.Close(); err != nil {
+			t.Fatal(err)
+		}
+		deps.StopClickEventWorker()
+
+		if err := deps.Db.Container.Terminate(ctx); err != nil {
+			t.Fatal(err)
+		}
+
+		if cacheEnabled {
+			if err := deps.Cache.Container.Terminate(ctx); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}()
+
+	rbody, err := json.Marshal(tc.Request)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, deps.TestServer.URL+"/api/v1/me/tags", bytes.NewBuffer(rbody))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set(types.HeadersContentTypeKey, types.HeadersContentTypeJsonValue)
+
+	client := &http.Client{}
+	accessToken := CreateAccessToken(t, deps.App.Config.Server.Auth, 12, &tc.UserId, true)
+	if !tc.SkipAccessToken {
+		req.Header.Add(handlers.HeaderAuthorization, fmt.Sprintf("Bearer %s", accessToken))
+	}
+
+	res, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if res.StatusCode != tc.ExpectedStatusCode {
+		t.Errorf("expected status %d got %d", tc.ExpectedStatusCode, res.StatusCode)
+	}
+
+	var response handlers.TagResponse
+	decoder := json.NewDecoder(res.Body)
+	decoder.DisallowUnknownFields()
+	if err = decoder.Decode(&response); err != nil {
+		t.Error("failed to decode body", err.Error())
+	}
+
+	err = res.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if diff := cmp.Diff(tc.Expected, response, cmpopts.IgnoreFields(handlers.TagResponse{}, "Id", "CreatedAt")); diff != "" {
+		t.Errorf("actual does not equal expected. diff: %s", diff)
+	}
+
+	if tc.ExpectedStatusCode == http.StatusCreated && (response.Id == nil || response.CreatedAt == nil) {
+		t.Errorf("expected the created tag to have an id and created_at, got %+v", response)
+	}
+}
+
+type ChangeTagCase struct {
+	Name               string
+	Method             string
+	Path               string
+	UserId             uuid.UUID
+	SkipAccessToken    bool
+	ExpectedStatusCode int
+	ExpectedErrors     types.ErrorResponse
+	// ExpectedTaggedSlugs is what filtering the owner's short urls by the marketing tag returns afterwards, nil skips the check
+	ExpectedTaggedSlugs []string
+}
+
+func TestChangeTags(t *testing.T) {
+	t.Parallel()
+
+	cases := []ChangeTagCase{
+		{
+			Name:                "AddToShortUrl",
+			Method:              http.MethodPut,
+			Path:                "/api/v1/me/shorturl/" + untaggedShortUrlId + "/tags/" + marketingTagId,
+			UserId:              tagOwnerUuid,
+			ExpectedStatusCode:  http.StatusNoContent,
+			ExpectedTaggedSlugs: []string{"c4mpaign", "g3tApp"},
+		},
+		{
+			Name:                "AddToShortUrlAlreadyTagged",
+			Method:              http.MethodPut,
+			Path:                "/api/v1/me/shorturl/" + taggedShortUrlId + "/tags/" + marketingTagId,
+			UserId:              tagOwnerUuid,
+			ExpectedStatusCode:  http.StatusNoContent,
+			ExpectedTaggedSlugs: []string{"c4mpaign"},
+		},
+		{
+			Name:               "AddToOtherUsersShortUrl",
+			Method:             http.MethodPut,
+			Path:               "/api/v1/me/shorturl/019cc05b-d0e6-764d-a207-60cb9fd4d147/tags/" + marketingTagId,
+			UserId:             tagOwnerUuid,
+			ExpectedStatusCode: http.StatusNotFound,
+		},
+		{
+			Name:               "AddOtherUsersTag",
+			Method:             http.MethodPut,
+			Path:               "/api/v1/me/shorturl/019cc05b-d0e6-764d-a207-60cb9fd4d147/tags/" + marketingTagId,
+			UserId:             validUserUuid,
+			ExpectedStatusCode: http.StatusNotFound,
+		},
+		{
+			Name:               "AddInvalidTagUuid",
+			Method:             http.MethodPut,
+			Path:               "/api/v1/me/shorturl/" + untaggedShortUrlId + "/tags/sd",
+			UserId:             tagOwnerUuid,
+			ExpectedStatusCode: http.StatusBadRequest,
+			ExpectedErrors: types.ErrorResponse{
+				Errors: []string{"Tag id provided is not a valid uuid"},
+			},
+		},
+		{
+			Name:                "RemoveFromShortUrl",
+			Method:              http.MethodDelete,
+			Path:                "/api/v1/me/shorturl/" + taggedShortUrlId + "/tags/" + marketingTagId,
+			UserId:              tagOwnerUuid,
+			ExpectedStatusCode:  http.StatusNoContent,
+			ExpectedTaggedSlugs: []string{},
+		},
+		{
+			Name:               "RemoveFromShortUrlNotTagged",
+			Method:             http.MethodDelete,
+			Path:               "/api/v1/me/shorturl/" + untaggedShortUrlId + "/tags/" + marketingTagId,
+			UserId:             tagOwnerUuid,
+			ExpectedStatusCode: http.StatusNotFound,
+		},
+		{
+			Name:                "DeleteTag",
+			Method:              http.MethodDelete,
+			Path:                "/api/v1/me/tags/" + marketingTagId,
+			UserId:              tagOwnerUuid,
+			ExpectedStatusCode:  http.StatusNoContent,
+			ExpectedTaggedSlugs: []string{},
+		},
+		{
+			Name:               "DeleteOtherUsersTag",
+			Method:             http.MethodDelete,
+			Path:               "/api/v1/me/tags/" + unusedTagId,
+			UserId:             validUserUuid,
+			ExpectedStatusCode: http.StatusNotFound,
+		},
+		{
+			Name:               "DeleteNotExistentTag",
+			Method:             http.MethodDelete,
+			Path:               "/api/v1/me/tags/" + uuid.Nil.String(),
+			UserId:             tagOwnerUuid,
+			ExpectedStatusCode: http.StatusNotFound,
+		},
+		{
+			Name:               "NotLoggedIn",
+			Method:             http.MethodDelete,
+			Path:               "/api/v1/me/tags/" + unusedTagId,
+			UserId:             tagOwnerUuid,
+			SkipAccessToken:    true,
+			ExpectedStatusCode: http.StatusUnauthorized,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.Name+"WithCache", func(t *testing.T) {
+			t.Parallel()
+			runChangeTag(t, tc, true)
+		})
+		t.Run(tc.Name+"NoCache", func(t *testing.T) {
+			t.Parallel()
+			runChangeTag(t, tc, false)
+		})
+	}
+}
+
+func runChangeTag(t *testing.T, tc ChangeTagCase, cacheEnabled bool) {
+	ctx := context.Background()
+	deps := SetupDependencies(t, ctx, cacheEnabled)
+	defer func() {
+		if err := deps.App.Server.Close(); err != nil {
+			t.Fatal(err)
+		}
+		deps.StopClickEventWorker()
+
+		if err := deps.Db.Container.Terminate(ctx); err != nil {
+			t.Fatal(err)
+		}
+
+		if cacheEnabled {
+			if err := deps.Cache.Container.Terminate(ctx); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}()
+
+	client := &http.Client{}
+	accessToken := CreateAccessToken(t, deps.App.Config.Server.Auth, 12, &tc.UserId, true)
+
+	// Fill the cache first so a stale filtered list would show up afterwards
+	if tc.ExpectedTaggedSlugs != nil {
+		getTaggedSlugs(t, client, deps.TestServer.URL, accessToken)
+	}
+
+	req, err := http.NewRequest(tc.Method, deps.TestServer.URL+tc.Path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !tc.SkipAccessToken {
+		req.Header.Add(handlers.HeaderAuthorization, fmt.Sprintf("Bearer %s", accessToken))
+	}
+
+	res, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if res.StatusCode != tc.ExpectedStatusCode {
+		t.Errorf("expected status %d got %d", tc.ExpectedStatusCode, res.StatusCode)
+	}
+
+	if len(tc.ExpectedErrors.Errors) > 0 {
+		var response types.ErrorResponse
+		decoder := json.NewDecoder(res.Body)
+		decoder.DisallowUnknownFields()
+		if err = decoder.Decode(&response); err != nil {
+			t.Error("failed to decode body", err.Error())
+		}
+
+		if diff := cmp.Diff(tc.ExpectedErrors, response); diff != "" {
+			t.Errorf("actual does not equal expected. diff: %s", diff)
+		}
+	}
+
+	err = res.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if tc.ExpectedTaggedSlugs != nil {
+		if diff := cmp.Diff(tc.ExpectedTaggedSlugs, getTaggedSlugs(t, client, deps.TestServer.URL, accessToken), cmpopts.SortSlices(func(a, b string) bool { return a < b })); diff != "" {
+			t.Errorf("tagged short urls do not equal expected. diff: %s", diff)
+		}
+	}
+}
+
+func getTaggedSlugs(t *testing.T, client *http.Client, serverUrl string, accessToken string) []string {
+	req, err := http.NewRequest(http.MethodGet, serverUrl+"/api/v1/me/shorturl?tag=marketing", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Add(handlers.HeaderAuthorization, fmt.Sprintf("Bearer %s", accessToken))
+
+	res, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := res.Body.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	var response handlers.GetShortUrlsByUserIdResponse
+	if err = json.NewDecoder(res.Body).Decode(&response); err != nil {
+		t.Fatal("failed to decode body", err.Error())
+	}
+
+	slugs := []string{}
+	for _, item := range response.Items {
+		slugs = append(slugs, *item.Slug)
+	}
+	return slugs
+}
@@ -291,6 +291,7 @@ func runPostUserTest(t *testing.T, testCase PostUserTestCase, cacheEnabled bool)
 		if err := deps.App.Server.Close(); err != nil {
 			t.Fatal(err)
 		}
+		deps.StopClickEventWorker()
 
 		if err := deps.Db.Container.Terminate(ctx); err != nil {
 			t.Fatal(err)
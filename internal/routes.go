@@ -22,18 +22,60 @@ func RegisterRoutes(
 	apiUserHandler handlers.ApiUserHandler,
 	authHandler handlers.ApiAuthHandler,
 	apiHealthHandler handlers.ApiHealthHandler,
+	apiTagHandler handlers.ApiTagHandler,
+	apiPreferencesHandler handlers.ApiPreferencesHandler,
 	redirectionHandler handlers.RedirectionHandler,
 	templateHandler handlers.TemplateHandler,
 ) {
 	redirection := m.RecoverPanic(m.AddRequestId(http.HandlerFunc(redirectionHandler.Redirect)))
 	mux.Handle("GET /{slug}", redirection)
+	qrCode := m.RecoverPanic(m.AddRequestId(http.HandlerFunc(redirectionHandler.GetQrCode)))
+	mux.Handle("GET /{slug}/{rest...}", withSlugQrCode(redirection, qrCode))
+	unlock := m.RecoverPanic(m.AddRequestId(http.HandlerFunc(redirectionHandler.Unlock)))
+	mux.Handle("POST /{slug}/unlock", unlock)
 
 	getShortUrlsByUserId := m.RecoverPanic(m.AddRequestId(m.LoginRequired(http.HandlerFunc(apiShortUrlHandler.GetShortUrls))))
 	mux.Handle("GET /api/v1/me/shorturl", getShortUrlsByUserId)
+	exportShortUrls := m.RecoverPanic(m.AddRequestId(m.LoginRequired(http.HandlerFunc(apiShortUrlHandler.ExportShortUrls))))
+	mux.Handle("GET /api/v1/me/shorturl/export", exportShortUrls)
+	getTrash := m.RecoverPanic(m.AddRequestId(m.LoginRequired(http.HandlerFunc(apiShortUrlHandler.GetTrash))))
+	mux.Handle("GET /api/v1/me/shorturl/trash", getTrash)
 	postShortUrl := m.RecoverPanic(m.AddRequestId(m.LoginRequiredOrAllowAnonymous(m.JsonRequired(m.IdempotencyKeyRequired(http.HandlerFunc(apiShortUrlHandler.PostShortUrl))))))
 	mux.Handle("POST /api/v1/shorturl", postShortUrl)
+	postShortUrlBatch := m.RecoverPanic(m.AddRequestId(m.LoginRequired(m.JsonRequired(m.IdempotencyKeyRequired(http.HandlerFunc(apiShortUrlHandler.PostShortUrlBatch))))))
+	mux.Handle("POST /api/v1/shorturl/batch", postShortUrlBatch)
 	deleteShortUrl := m.RecoverPanic(m.AddRequestId(m.LoginRequired(http.HandlerFunc(apiShortUrlHandler.DeleteById))))
 	mux.Handle("DELETE /api/v1/me/shorturl/{shortUrlId}", deleteShortUrl)
+	changeShortUrlBatch := m.RecoverPanic(m.AddRequestId(m.LoginRequired(m.JsonRequired(http.HandlerFunc(apiShortUrlHandler.ChangeShortUrlBatch)))))
+	mux.Handle("POST /api/v1/me/shorturl/batch", changeShortUrlBatch)
+	importShortUrls := m.RecoverPanic(m.AddRequestId(m.LoginRequired(m.IdempotencyKeyRequired(http.HandlerFunc(apiShortUrlHandler.PostShortUrlImport)))))
+	mux.Handle("POST /api/v1/me/shorturl/import", importShortUrls)
+	patchShortUrl := m.RecoverPanic(m.AddRequestId(m.LoginRequired(m.JsonRequired(http.HandlerFunc(apiShortUrlHandler.PatchById)))))
+	mux.Handle("PATCH /api/v1/me/shorturl/{shortUrlId}", patchShortUrl)
+	restoreShortUrl := m.RecoverPanic(m.AddRequestId(m.LoginRequired(http.HandlerFunc(apiShortUrlHandler.RestoreById))))
+	mux.Handle("POST /api/v1/me/shorturl/{shortUrlId}/restore", restoreShortUrl)
+	renewShortUrl := m.RecoverPanic(m.AddRequestId(m.LoginRequired(http.HandlerFunc(apiShortUrlHandler.RenewById))))
+	mux.Handle("POST /api/v1/me/shorturl/{shortUrlId}/renew", renewShortUrl)
+	getShortUrlStats := m.RecoverPanic(m.AddRequestId(m.LoginRequired(http.HandlerFunc(apiShortUrlHandler.GetStatsById))))
+	mux.Handle("GET /api/v1/me/shorturl/{shortUrlId}/stats", getShortUrlStats)
+	getShortUrlQrCode := m.RecoverPanic(m.AddRequestId(m.LoginRequired(http.HandlerFunc(apiShortUrlHandler.GetQrCodeById))))
+	mux.Handle("GET /api/v1/me/shorturl/{shortUrlId}/qr", getShortUrlQrCode)
+	addShortUrlTag := m.RecoverPanic(m.AddRequestId(m.LoginRequired(http.HandlerFunc(apiTagHandler.AddToShortUrl))))
+	mux.Handle("PUT /api/v1/me/shorturl/{shortUrlId}/tags/{tagId}", addShortUrlTag)
+	removeShortUrlTag := m.RecoverPanic(m.AddRequestId(m.LoginRequired(http.HandlerFunc(apiTagHandler.RemoveFromShortUrl))))
+	mux.Handle("DELETE /api/v1/me/shorturl/{shortUrlId}/tags/{tagId}", removeShortUrlTag)
+
+	getTags := m.RecoverPanic(m.AddRequestId(m.LoginRequired(http.HandlerFunc(apiTagHandler.GetTags))))
+	mux.Handle("GET /api/v1/me/tags", getTags)
+	postTag := m.RecoverPanic(m.AddRequestId(m.LoginRequired(m.JsonRequired(http.HandlerFunc(apiTagHandler.PostTag)))))
+	mux.Handle("POST /api/v1/me/tags", postTag)
+	deleteTag := m.RecoverPanic(m.AddRequestId(m.LoginRequired(http.HandlerFunc(apiTagHandler.DeleteById))))
+	mux.Handle("DELETE /api/v1/me/tags/{tagId}", deleteTag)
+
+	getPreferences := m.RecoverPanic(m.AddRequestId(m.LoginRequired(http.HandlerFunc(apiPreferencesHandler.GetPreferences))))
+	mux.Handle("GET /api/v1/me/preferences", getPreferences)
+	patchPreferences := m.RecoverPanic(m.AddRequestId(m.LoginRequired(m.JsonRequired(http.HandlerFunc(apiPreferencesHandler.PatchPreferences)))))
+	mux.Handle("PATCH /api/v1/me/preferences", patchPreferences)
 
 	postUser := m.RecoverPanic(m.AddRequestId(m.AllowRegistration(m.JsonRequired(m.IdempotencyKeyRequired(http.HandlerFunc(apiUserHandler.PostUser))))))
 	mux.Handle("POST /api/v1/user", postUser)
@@ -65,3 +107,15 @@ func RegisterRoutes(
 	mux.Handle("GET /_/", http.StripPrefix("/_/", fileServer))
 	mux.Handle("GET /_/shared.js", http.StripPrefix("/_/", getIndexJs))
 }
+
+// withSlugQrCode serves "/{slug}/qr" from the path passthrough route, so a sub path of exactly "qr" is never passed through.
+// It can't be its own pattern on the mux because it would conflict with "GET /_/" on "/_/qr"
+func withSlugQrCode(next http.Handler, qrCode http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.PathValue("rest") == "qr" {
+			qrCode.ServeHTTP(w, r)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
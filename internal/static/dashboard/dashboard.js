@@ -1,4 +1,4 @@
-import { createSuccessBox, fetchWithRetry, createErrorBox, GENERIC_SERVER_ERROR_MESSAGE, NOTIFICATION_CONTAINER, LOGIN_URL, createShortUrl, addCookieBanner, USER_SHORT_URL_ENDPONT, isLoggedIn, logout, clearChildren, USER_SHORT_URL_ENDPONT_WITH_ID, TIMEOUT_IDS } from '../shared.js';
+import { createSuccessBox, fetchWithRetry, createErrorBox, GENERIC_SERVER_ERROR_MESSAGE, NOTIFICATION_CONTAINER, LOGIN_URL, createShortUrl, addCookieBanner, USER_SHORT_URL_ENDPONT, isLoggedIn, logout, clearChildren, USER_SHORT_URL_ENDPONT_WITH_ID, TIMEOUT_IDS, AUTHENTICATED_DEFAULT_TTL, ALLOW_NON_EXPIRING } from '../shared.js';
 
 
 let loggedIn = await isLoggedIn();
@@ -29,6 +29,25 @@ if (!loggedIn) {
 
 document.getElementById("create-short-url").addEventListener("submit", createShortUrl);
 
+// start the ttl on the server's default, in the largest unit it fits into
+const URL_TTL_INPUT = document.getElementById("url-ttl");
+const TTL_UNITS_INPUT = document.getElementById("ttl-units");
+for (const option of [...TTL_UNITS_INPUT.options].reverse()) {
+  if (AUTHENTICATED_DEFAULT_TTL % Number(option.value) === 0) {
+    TTL_UNITS_INPUT.value = option.value;
+    URL_TTL_INPUT.value = AUTHENTICATED_DEFAULT_TTL / Number(option.value);
+    break;
+  }
+}
+
+if (ALLOW_NON_EXPIRING) {
+  document.getElementById("never-expires-label").hidden = false;
+  document.getElementById("never-expires-input").addEventListener("change", (event) => {
+    URL_TTL_INPUT.disabled = event.target.checked;
+    TTL_UNITS_INPUT.disabled = event.target.checked;
+  });
+}
+
 document.addEventListener("click", function (event) {
   if (event.target.classList.contains("close-button")) {
     parent = event.target.parentElement;
@@ -59,6 +78,32 @@ function renderTableHead() {
   SHORT_URLS_TABLE_HEAD.appendChild(tableHeadersElem);
 }
 
+const QR_CODE_DIALOG = document.getElementById("qr-code-dialog");
+document.getElementById("qr-code-close").addEventListener("click", () => {
+  QR_CODE_DIALOG.close();
+});
+
+function showQrCode(shortUrl) {
+  const qrUrl = (format) => {
+    let url = new URL(`${USER_SHORT_URL_ENDPONT_WITH_ID(shortUrl.id)}/qr`);
+    url.searchParams.set("format", format);
+    url.searchParams.set("size", 512);
+    return url;
+  };
+
+  document.getElementById("qr-code-img").src = qrUrl("svg");
+  document.getElementById("qr-code-url").textContent = shortUrl.url;
+
+  const pngDownload = document.getElementById("qr-code-download-png");
+  pngDownload.href = qrUrl("png");
+  pngDownload.download = `${shortUrl.slug}.png`;
+  const svgDownload = document.getElementById("qr-code-download-svg");
+  svgDownload.href = qrUrl("svg");
+  svgDownload.download = `${shortUrl.slug}.svg`;
+
+  QR_CODE_DIALOG.showModal();
+}
+
 async function deleteShortUrl(id) {
   let url = USER_SHORT_URL_ENDPONT_WITH_ID(id);
   let result = await fetchWithRetry(
@@ -147,13 +192,26 @@ function renderShortUrls(shortUrls) {
     r.appendChild(created);
 
     let expiry = document.createElement("td");
-    let expiryValue = new Intl.DateTimeFormat(undefined, dateOptions).format(new Date(h.expires_at));
-    expiry.textContent = expiryValue;
-    expiry.title = h.expires_at;
+    if (h.never_expires) {
+      expiry.textContent = "Never";
+    } else {
+      let expiryValue = new Intl.DateTimeFormat(undefined, dateOptions).format(new Date(h.expires_at));
+      expiry.textContent = expiryValue;
+      expiry.title = h.expires_at;
+    }
     r.appendChild(expiry);
 
     let action = document.createElement("td");
     action.classList.add("table-row-actions");
+    let qrCodeActionBtn = document.createElement("button");
+    qrCodeActionBtn.title = "qr code";
+    qrCodeActionBtn.textContent = "QR";
+    qrCodeActionBtn.classList.add("qr-code-button");
+    qrCodeActionBtn.onclick = () => {
+      showQrCode(h);
+    }
+    action.appendChild(qrCodeActionBtn);
+
     let deleteActionBtn = document.createElement("button");
     deleteActionBtn.title = "delete";
     deleteActionBtn.classList.add("delete-button");
@@ -228,10 +228,202 @@
             NULL, 
             NOW() + INTERVAL '7 days'
         );
+    -- add a password protected short url, the password is password
+    INSERT INTO short_urls (id, destination_url, slug, created_at, user_id, expires_at, password_hash) VALUES
+        (
+            '019cc1c7-d1f0-734f-a2b7-a5ee16fbad0c',
+            'https://docs.example.invalid/internal',
+            'l0cked',
+            NOW(),
+            '019cbcdb-aaf4-7680-a3f7-8acef63e0151',
+            NOW() + INTERVAL '7 days',
+            '$argon2id$v=19$m=262144,t=4,p=2$zCeK/qqV7BzHmKyAKKnE1g$mZ3YJMYRn/a+evEw6L9btgKMlrYxZUn+DhXt0DBoBWU'
+        );
+
+    -- add click limited short urls, one with a single use left and one that is used up
+    INSERT INTO short_urls (id, destination_url, slug, created_at, user_id, expires_at, max_clicks, remaining_clicks, exhausted_at) VALUES
+        (
+            '019cc1c7-d1f0-734f-a2b7-a5ee16fbad0d',
+            'https://downloads.example.invalid/report.pdf',
+            'on3T1me',
+            NOW(),
+            '019cbcdb-aaf4-7680-a3f7-8acef63e0151',
+            NOW() + INTERVAL '7 days',
+            1,
+            1,
+            NULL
+        ),
+        (
+            '019cc1c7-d1f0-734f-a2b7-a5ee16fbad0e',
+            'https://downloads.example.invalid/old-report.pdf',
+            'us3dUp',
+            NOW(),
+            '019cbcdb-aaf4-7680-a3f7-8acef63e0151',
+            NOW() + INTERVAL '7 days',
+            3,
+            0,
+            NOW() - INTERVAL '1 day'
+        );
+
+    -- add a short url that only activates tomorrow
+    INSERT INTO short_urls (id, destination_url, slug, created_at, user_id, expires_at, activates_at) VALUES
+        (
+            '019cc1c7-d1f0-734f-a2b7-a5ee16fbad0f',
+            'https://launch.example.invalid',
+            's00n',
+            NOW(),
+            '019cbcdb-aaf4-7680-a3f7-8acef63e0151',
+            NOW() + INTERVAL '8 days',
+            NOW() + INTERVAL '1 day'
+        );
+
+    -- add a short url that always shows the preview page
+    INSERT INTO short_urls (id, destination_url, slug, created_at, user_id, expires_at, force_preview) VALUES
+        (
+            '019cc1c7-d1f0-734f-a2b7-a5ee16fbad10',
+            'https://news.example.invalid/article',
+            'pr3view',
+            NOW(),
+            '019cbcdb-aaf4-7680-a3f7-8acef63e0151',
+            NOW() + INTERVAL '7 days',
+            TRUE
+        );
+
+    -- add a short url with a permanent redirect
+    INSERT INTO short_urls (id, destination_url, slug, created_at, user_id, expires_at, redirect_type) VALUES
+        (
+            '019cc1c7-d1f0-734f-a2b7-a5ee16fbad11',
+            'https://blog.example.invalid/moved',
+            'p3rmLink',
+            NOW(),
+            '019cbcdb-aaf4-7680-a3f7-8acef63e0151',
+            NOW() + INTERVAL '7 days',
+            308
+        );
+
+    -- add a short url that passes the path and query through to the destination
+    INSERT INTO short_urls (id, destination_url, slug, created_at, user_id, expires_at, query_passthrough, path_passthrough) VALUES
+        (
+            '019cc1c7-d1f0-734f-a2b7-a5ee16fbad12',
+            'https://docs.example.invalid/v2?lang=en',
+            'd0csLink',
+            NOW(),
+            '019cbcdb-aaf4-7680-a3f7-8acef63e0151',
+            NOW() + INTERVAL '7 days',
+            TRUE,
+            TRUE
+        );
+
+    -- add a short url with utm parameters that are added to the destination
+    INSERT INTO short_urls (id, destination_url, slug, created_at, user_id, expires_at, query_passthrough, utm_source, utm_medium, utm_campaign) VALUES
+        (
+            '019cc1c7-d1f0-734f-a2b7-a5ee16fbad13',
+            'https://shop.example.invalid/sale?utm_source=old',
+            'c4mpaign',
+            NOW(),
+            '019cbcdb-aaf4-7680-a3f7-8acef63e0151',
+            NOW() + INTERVAL '7 days',
+            TRUE,
+            'newsletter',
+            'email',
+            'spring sale'
+        );
+
+    -- add a short url that sends visitors somewhere else depending on their platform, language or the host they used
+    INSERT INTO short_urls (id, destination_url, slug, created_at, user_id, expires_at, routing_rules) VALUES
+        (
+            '019cc1c7-d1f0-734f-a2b7-a5ee16fbad14',
+            'https://www.example.invalid',
+            'g3tApp',
+            NOW(),
+            '019cbcdb-aaf4-7680-a3f7-8acef63e0151',
+            NOW() + INTERVAL '7 days',
+            '[
+                {"match": "platform", "value": "ios", "destination_url": "https://apps.example.invalid/ios"},
+                {"match": "platform", "value": "android", "destination_url": "https://apps.example.invalid/android"},
+                {"match": "language", "value": "fr", "destination_url": "https://www.example.invalid/fr"},
+                {"match": "host", "value": "go.example.invalid", "destination_url": "https://partners.example.invalid/app"}
+            ]'
+        );
+
+    -- add a short url that splits traffic 70/30 between two landing pages and keeps visitors on the same one
+    INSERT INTO short_urls (id, destination_url, slug, created_at, user_id, expires_at, sticky_variants) VALUES
+        (
+            '019cc1c7-d1f0-734f-a2b7-a5ee16fbad15',
+            'https://landing.example.invalid',
+            'spl1tAB',
+            NOW(),
+            '019cbcdb-aaf4-7680-a3f7-8acef63e0151',
+            NOW() + INTERVAL '7 days',
+            TRUE
+        );
+    INSERT INTO short_url_variants (id, short_url_id, position, destination_url, weight, hits) VALUES
+        (
+            '019cc1c7-d1f0-734f-a2b7-a5ee16fbae01',
+            '019cc1c7-d1f0-734f-a2b7-a5ee16fbad15',
+            1,
+            'https://landing.example.invalid/a',
+            70,
+            3
+        ),
+        (
+            '019cc1c7-d1f0-734f-a2b7-a5ee16fbae02',
+            '019cc1c7-d1f0-734f-a2b7-a5ee16fbad15',
+            2,
+            'https://landing.example.invalid/b',
+            30,
+            1
+        );
+
+    -- add tags, only the marketing one is on a short url
+    INSERT INTO tags (id, user_id, name, created_at) VALUES
+        (
+            '019cc1c7-d1f0-734f-a2b7-a5ee16fbaf01',
+            '019cbcdb-aaf4-7680-a3f7-8acef63e0151',
+            'Marketing',
+            NOW()
+        ),
+        (
+            '019cc1c7-d1f0-734f-a2b7-a5ee16fbaf02',
+            '019cbcdb-aaf4-7680-a3f7-8acef63e0151',
+            'Unused',
+            NOW()
+        );
+    INSERT INTO short_url_tags (short_url_id, tag_id) VALUES
+        ('019cc1c7-d1f0-734f-a2b7-a5ee16fbad13', '019cc1c7-d1f0-734f-a2b7-a5ee16fbaf01');
+
+    -- add click events for 4kJe27   --------------------------------------------------------------
+    INSERT INTO click_events (
+        id,
+        short_url_id,
+        slug,
+        clicked_at,
+        referrer,
+        user_agent,
+        ip_address
+    )
+    SELECT
+        gen_random_uuid(),
+        '019cc05b-c45d-76f9-ab03-02af299e76ea',
+        '4kJe27',
+        c.clicked_at,
+        'https://example.invalid/',
+        'Mozilla/5.0 (X11; Linux x86_64; rv:128.0) Gecko/20100101 Firefox/128.0',
+        '203.0.113.0'
+    FROM (
+        VALUES
+            (NOW()),
+            (NOW()),
+            (NOW()),
+            (NOW() - INTERVAL '1 day'),
+            (NOW() - INTERVAL '1 day'),
+            (NOW() - INTERVAL '10 days')
+    ) AS c(clicked_at);
 -- ---------------------------------------------------------------------------------------------------------
 -- There should be 6 users
 -- There should be 607 idempotency keys
--- There should 3006 short urls
+-- There should 3009 short urls
+-- There should be 6 click events
 -- EXCEPTION WHEN OTHERS THEN
 --     RAISE NOTICE 'Error happened %, rolling back...', SQLERRM;
 --     -- automatically aborts
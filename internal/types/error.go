@@ -17,8 +17,20 @@ func (e *EmailOrUsernameExistsError) Error() string {
 	return "Username or email already exists"
 }
 
+type TagExistsError struct{}
+
+func (e *TagExistsError) Error() string {
+	return "Tag already exists"
+}
+
 type DeleteCountUnexpectedErr struct{}
 
 func (e *DeleteCountUnexpectedErr) Error() string {
 	return "Number of deleted rows unexpected"
 }
+
+type SlugExistsError struct{}
+
+func (e *SlugExistsError) Error() string {
+	return "Slug already exists"
+}
@@ -6,6 +6,9 @@ import (
 	"github.com/google/uuid"
 )
 
+// NeverExpires is the expiry stored for short urls that don't expire, the expires_at column can't be null
+var NeverExpires = time.Date(9999, time.December, 31, 0, 0, 0, 0, time.UTC)
+
 const (
 	HeadersIdempotencyKey       = "X-Idempotency-Key"
 	HeadersContentTypeKey       = "Content-Type"
@@ -13,36 +16,225 @@ const (
 )
 
 type ShortUrl struct {
-	Id             uuid.UUID  `json:"id"`
-	DestinationUrl string     `json:"destination_url"`
-	Slug           string     `json:"slug"`
-	CreatedAt      time.Time  `json:"created_at"`
-	ExpiresAt      time.Time  `json:"expires_at"`
-	UserId         *uuid.UUID `json:"user_id,omitempty"`
+	Id               uuid.UUID         `json:"id"`
+	DestinationUrl   string            `json:"destination_url"`
+	Slug             string            `json:"slug"`
+	CreatedAt        time.Time         `json:"created_at"`
+	ExpiresAt        time.Time         `json:"expires_at"`
+	UserId           *uuid.UUID        `json:"user_id,omitempty"`
+	PasswordHash     *string           `json:"password_hash,omitempty"`
+	MaxClicks        *int              `json:"max_clicks,omitempty"`
+	RemainingClicks  *int              `json:"remaining_clicks,omitempty"`
+	ActivatesAt      *time.Time        `json:"activates_at,omitempty"`
+	ForcePreview     bool              `json:"force_preview,omitempty"`
+	RedirectType     *int              `json:"redirect_type,omitempty"` // nil uses the server default
+	QueryPassthrough bool              `json:"query_passthrough,omitempty"`
+	PathPassthrough  bool              `json:"path_passthrough,omitempty"`
+	UtmSource        *string           `json:"utm_source,omitempty"`
+	UtmMedium        *string           `json:"utm_medium,omitempty"`
+	UtmCampaign      *string           `json:"utm_campaign,omitempty"`
+	RoutingRules     []RoutingRule     `json:"routing_rules,omitempty"` // checked in order, the first match replaces the destination url
+	Variants         []ShortUrlVariant `json:"variants,omitempty"`      // traffic is split between these by weight instead of going to the destination url
+	StickyVariants   bool              `json:"sticky_variants,omitempty"`
+	SlidingTtl       *int              `json:"sliding_ttl,omitempty"` // in seconds, every redirect pushes the expiry out to at least this far away
+	Tags             []Tag             `json:"tags,omitempty"`        // only loaded for the owner's api, not for redirects
+	DeletedAt        *time.Time        `json:"deleted_at,omitempty"`  // set while the short url is in the trash
+}
+
+// ShortUrlVariant doesn't carry its hit counter so that a cached short url never shows stale counts, see ShortUrlClickStats
+type ShortUrlVariant struct {
+	Id             uuid.UUID `json:"id"`
+	DestinationUrl string    `json:"destination_url"`
+	Weight         int       `json:"weight"`
+}
+
+const (
+	RoutingRuleMatchPlatform = "platform" // the platform in the User-Agent header
+	RoutingRuleMatchLanguage = "language" // any language in the Accept-Language header
+	RoutingRuleMatchHost     = "host"     // the host the short url was requested on
+)
+
+type RoutingRule struct {
+	Match          string `json:"match"`
+	Value          string `json:"value"`
+	DestinationUrl string `json:"destination_url"`
+}
+
+// IsLive is the same check the database does with excludeExpired, for short urls that didn't come straight from the database
+func (s *ShortUrl) IsLive(now time.Time) bool {
+	return !s.IsScheduled(now) && s.ExpiresAt.After(now)
+}
+
+// Expires is false for short urls created without an expiry
+func (s *ShortUrl) Expires() bool {
+	return !s.ExpiresAt.Equal(NeverExpires)
+}
+
+// IsScheduled is true when the short url has not reached its activation time yet
+func (s *ShortUrl) IsScheduled(now time.Time) bool {
+	return s.ActivatesAt != nil && s.ActivatesAt.After(now)
 }
 
 type ShortUrlResponse struct {
-	Id             *uuid.UUID `json:"id,omitempty"`
-	DestinationUrl *string    `json:"destination_url,omitempty"`
-	Slug           *string    `json:"slug,omitempty"`
-	CreatedAt      *time.Time `json:"created_at,omitempty"`
-	ExpiresAt      *time.Time `json:"expires_at,omitempty"`
-	Url            string     `json:"url,omitempty"`
-	UserId         *uuid.UUID `json:"user_id,omitempty"`
-	Errors         []string   `json:"errors,omitempty"`
+	Id                *uuid.UUID        `json:"id,omitempty"`
+	DestinationUrl    *string           `json:"destination_url,omitempty"`
+	Slug              *string           `json:"slug,omitempty"`
+	CreatedAt         *time.Time        `json:"created_at,omitempty"`
+	ExpiresAt         *time.Time        `json:"expires_at,omitempty"` // not set when the short url never expires
+	NeverExpires      *bool             `json:"never_expires,omitempty"`
+	Url               string            `json:"url,omitempty"`
+	UserId            *uuid.UUID        `json:"user_id,omitempty"`
+	PasswordProtected *bool             `json:"password_protected,omitempty"`
+	MaxClicks         *int              `json:"max_clicks,omitempty"`
+	RemainingClicks   *int              `json:"remaining_clicks,omitempty"`
+	ActivatesAt       *time.Time        `json:"activates_at,omitempty"`
+	ForcePreview      *bool             `json:"force_preview,omitempty"`
+	RedirectType      *int              `json:"redirect_type,omitempty"`
+	QueryPassthrough  *bool             `json:"query_passthrough,omitempty"`
+	PathPassthrough   *bool             `json:"path_passthrough,omitempty"`
+	UtmSource         *string           `json:"utm_source,omitempty"`
+	UtmMedium         *string           `json:"utm_medium,omitempty"`
+	UtmCampaign       *string           `json:"utm_campaign,omitempty"`
+	RoutingRules      []RoutingRule     `json:"routing_rules,omitempty"`
+	Variants          []ShortUrlVariant `json:"variants,omitempty"`
+	StickyVariants    *bool             `json:"sticky_variants,omitempty"`
+	SlidingTtl        *int              `json:"sliding_ttl,omitempty"`
+	Tags              []Tag             `json:"tags,omitempty"`
+	DeletedAt         *time.Time        `json:"deleted_at,omitempty"`
+	Errors            []string          `json:"errors,omitempty"`
 }
 
 type CreateShortUrl struct {
-	Id             uuid.UUID
-	DestinationUrl string
-	Slug           string
-	UserId         *uuid.UUID
-	ExpiresAt      time.Time
+	Id               uuid.UUID
+	DestinationUrl   string
+	Slug             string
+	UserId           *uuid.UUID
+	ExpiresAt        time.Time
+	PasswordHash     *string
+	MaxClicks        *int
+	ActivatesAt      *time.Time
+	ForcePreview     bool
+	RedirectType     *int
+	QueryPassthrough bool
+	PathPassthrough  bool
+	UtmSource        *string
+	UtmMedium        *string
+	UtmCampaign      *string
+	RoutingRules     []RoutingRule
+	Variants         []ShortUrlVariant
+	StickyVariants   bool
+	SlidingTtl       *int
+	TagIds           []uuid.UUID // tags that don't belong to the user are skipped
+}
+
+// CreateShortUrlBatch only holds the items that passed validation, Position is where each one was in the request
+type CreateShortUrlBatch struct {
+	Id    uuid.UUID
+	Items []CreateShortUrlBatchItem
+}
+
+type CreateShortUrlBatchItem struct {
+	Position int
+	ShortUrl CreateShortUrl
+}
+
+// CreateShortUrlBatchResult has one entry per batch item in the same order, ShortUrl is nil when the slug was already taken
+type CreateShortUrlBatchResult struct {
+	Position int
+	ShortUrl *ShortUrl
+}
+
+// UpdateShortUrl holds the fields that can be changed on an existing short url, nil fields are left unchanged
+type UpdateShortUrl struct {
+	DestinationUrl     *string
+	ExpiresAt          *time.Time
+	PasswordHash       *string
+	RemovePassword     bool
+	ForcePreview       *bool
+	RedirectType       *int
+	QueryPassthrough   *bool
+	PathPassthrough    *bool
+	UtmSource          *string // an empty string removes the parameter
+	UtmMedium          *string
+	UtmCampaign        *string
+	RoutingRules       []RoutingRule // replaces all of the existing rules
+	RemoveRoutingRules bool
+	Variants           []ShortUrlVariant // replaces all of the existing variants and resets their hits
+	RemoveVariants     bool
+	StickyVariants     *bool
+	SlidingTtl         *int
+	RemoveSlidingTtl   bool
+}
+
+type Tag struct {
+	Id        uuid.UUID `json:"id"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type CreateTag struct {
+	Id     uuid.UUID
+	UserId uuid.UUID
+	Name   string
+}
+
+type DeleteTagResult struct {
+	Found       bool
+	ShortUrlIds []uuid.UUID // the short urls that had the tag
+}
+
+const (
+	ShortUrlStatusActive  = "active"  // not expired yet, scheduled short urls count as active
+	ShortUrlStatusExpired = "expired" // expired but not removed by the cleanup worker yet
+	ShortUrlStatusAll     = "all"
+
+	ShortUrlSortCreatedAt = "created_at"
+	ShortUrlSortExpiresAt = "expires_at"
+	ShortUrlSortSlug      = "slug"
+	ShortUrlSortClicks    = "clicks"
+)
+
+// ShortUrlFilter narrows down and orders a user's short urls, the zero value lists the active ones newest first
+type ShortUrlFilter struct {
+	Tag           string     // tag name, case insensitive
+	Search        string     // substring of the slug or the destination url, case insensitive
+	Status        string     // one of the ShortUrlStatus values, empty is ShortUrlStatusActive
+	CreatedAfter  *time.Time // inclusive
+	CreatedBefore *time.Time // exclusive
+	Sort          string     // one of the ShortUrlSort values, empty is ShortUrlSortCreatedAt
+	Ascending     bool
+}
+
+// ShortUrlPage picks which part of the filtered list to return, After replaces Offset when it is set
+type ShortUrlPage struct {
+	Size      int
+	Offset    int
+	After     *ShortUrlCursor
+	WithTotal bool // counting every matching short url is the slow part for users with a lot of them
+}
+
+// ShortUrlCursor points at the last short url of a page, Value is its sort column as text
+type ShortUrlCursor struct {
+	Value string    `json:"value"`
+	Id    uuid.UUID `json:"id"`
 }
 
 type GetShortUrlsResult struct {
-	Items []ShortUrl
-	Total int
+	Items      []ShortUrl
+	Total      *int // nil unless ShortUrlPage.WithTotal was set
+	HasMore    bool
+	NextCursor *ShortUrlCursor // nil on the last page and when sorting by clicks, which keeps changing
+}
+
+type ShortUrlExportOptions struct {
+	IncludeExpired bool
+	WithClicks     bool
+}
+
+// ExportedShortUrl has the tags and variants filled in, Clicks is nil unless ShortUrlExportOptions.WithClicks was set
+type ExportedShortUrl struct {
+	ShortUrl ShortUrl
+	Clicks   *int
 }
 
 type CreateUserRequest struct {
@@ -61,7 +253,80 @@ type User struct {
 	UpdatedAt    time.Time `json:"updated_at"`
 }
 
+// DefaultTimezone is the timezone of users that haven't picked one
+const DefaultTimezone = "UTC"
+
+// UserPreferences fill in what a user leaves out when creating a short url, DefaultTagIds only has tags that still exist
+type UserPreferences struct {
+	UserId              uuid.UUID
+	DefaultTtl          *int // in seconds
+	DefaultRedirectType *int
+	DefaultTagIds       []uuid.UUID
+	Timezone            string
+	UpdatedAt           *time.Time // nil when the user has never changed their preferences
+}
+
+// UpdateUserPreferences leaves nil fields as they are
+type UpdateUserPreferences struct {
+	DefaultTtl                *int
+	RemoveDefaultTtl          bool
+	DefaultRedirectType       *int
+	RemoveDefaultRedirectType bool
+	DefaultTagIds             []uuid.UUID // replaces all of the default tags, an empty non nil slice removes them
+	Timezone                  *string
+}
+
 type DeleteShortUrlResult struct {
 	Found      bool
 	NumDeleted int
+	Slug       string // empty when not found
+}
+
+// ShortUrlSelection picks a user's short urls either by Ids or, when Filter is set, by everything the filter matches
+type ShortUrlSelection struct {
+	Ids    []uuid.UUID
+	Filter *ShortUrlFilter
+}
+
+// ChangeShortUrlsResult reports every requested id the way DeleteShortUrlResult does, a filter only reports the short urls it matched
+type ChangeShortUrlsResult struct {
+	Items      []ChangedShortUrl
+	NumChanged int
+}
+
+type ChangedShortUrl struct {
+	Id    uuid.UUID
+	Slug  string // empty when not found
+	Found bool
+}
+
+type ClickEvent struct {
+	Id         uuid.UUID
+	ShortUrlId uuid.UUID
+	VariantId  *uuid.UUID // the variant the visitor was sent to, if the short url has any
+	Slug       string
+	ClickedAt  time.Time
+	Referrer   *string
+	UserAgent  *string
+	IpAddress  *string
+	// the worker slides the short url's expiry once the click is written, so the redirect doesn't wait for it
+	SlideExpiry bool
+}
+
+type ShortUrlClickStats struct {
+	Total    int
+	Daily    []DailyClicks
+	Variants []VariantHits
+}
+
+type VariantHits struct {
+	Id             uuid.UUID
+	DestinationUrl string
+	Weight         int
+	Hits           int
+}
+
+type DailyClicks struct {
+	Day    time.Time
+	Clicks int
 }
@@ -2,6 +2,7 @@ package utils
 
 import (
 	"log/slog"
+	"regexp"
 	"sync"
 
 	"github.com/go-playground/validator/v10"
@@ -11,6 +12,8 @@ var (
 	validate *validator.Validate
 	err      error
 	doOnce   sync.Once
+
+	slugRegex = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
 )
 
 func ValidateLogLevel(field validator.FieldLevel) bool {
@@ -19,10 +22,19 @@ func ValidateLogLevel(field validator.FieldLevel) bool {
 	return err == nil
 }
 
+// ValidateSlug only allows characters that are safe to use as a single path segment
+func ValidateSlug(field validator.FieldLevel) bool {
+	return slugRegex.MatchString(field.Field().String())
+}
+
 func GetValidator() (*validator.Validate, error) {
 	doOnce.Do(func() {
 		validate = validator.New()
 		err = validate.RegisterValidation("loglevelvalidator", ValidateLogLevel)
+		if err != nil {
+			return
+		}
+		err = validate.RegisterValidation("slugvalidator", ValidateSlug)
 	})
 	return validate, err
 }
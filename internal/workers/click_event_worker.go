@@ -0,0 +1,86 @@
+package workers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/amieldelatorre/shurl/internal/db"
+	"github.com/amieldelatorre/shurl/internal/events"
+	"github.com/amieldelatorre/shurl/internal/types"
+	"github.com/amieldelatorre/shurl/internal/utils"
+	"github.com/google/uuid"
+)
+
+const ClickEventFlushTimeout = 10 * time.Second
+
+// ClickEventWorker batches click events from the queue and writes them to the database when the batch is full or the flush interval passes.
+// It does not stop on ctx being cancelled, it keeps going until the queue is closed so that events from in-flight redirects are not lost.
+func ClickEventWorker(ctx context.Context, logger utils.CustomJsonLogger, queue *events.ClickEventQueue, dbContext db.DbContext, batchSize int, flushIntervalMs int) {
+	ctx = context.WithValue(context.WithoutCancel(ctx), utils.RequestIdName, "clickEventWorker")
+	logger.Info(ctx, fmt.Sprintf("starting click event worker with a batch size of %d and a flush interval of %d milliseconds", batchSize, flushIntervalMs))
+	queue.SetWorkerRunning(true)
+	defer queue.MarkDrained()
+	defer queue.SetWorkerRunning(false)
+
+	ticker := time.NewTicker(time.Duration(flushIntervalMs) * time.Millisecond)
+	defer ticker.Stop()
+
+	batch := make([]types.ClickEvent, 0, batchSize)
+	for {
+		select {
+		case event, ok := <-queue.Events():
+			if !ok {
+				logger.Info(ctx, "click event queue closed, flushing remaining events and shutting down click event worker")
+				flushClickEvents(ctx, logger, dbContext, batch)
+				return
+			}
+
+			batch = append(batch, event)
+			if len(batch) >= batchSize {
+				flushClickEvents(ctx, logger, dbContext, batch)
+				batch = batch[:0]
+			}
+		case <-ticker.C:
+			if len(batch) > 0 {
+				flushClickEvents(ctx, logger, dbContext, batch)
+				batch = batch[:0]
+			}
+		}
+	}
+}
+
+// flushClickEvents logs instead of returning errors, the events can't be put back on the queue without risking blocking it
+func flushClickEvents(ctx context.Context, logger utils.CustomJsonLogger, dbContext db.DbContext, batch []types.ClickEvent) {
+	if len(batch) == 0 {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, ClickEventFlushTimeout)
+	defer cancel()
+
+	numInserted, err := dbContext.CreateClickEvents(ctx, batch)
+	if err != nil {
+		logger.Error(ctx, "could not flush click events", "error", err.Error(), "numEvents", len(batch))
+	} else {
+		logger.Debug(ctx, fmt.Sprintf("Number of click events flushed: %d", numInserted))
+	}
+
+	slideShortUrlExpiries(ctx, logger, dbContext, batch)
+}
+
+// slideShortUrlExpiries slides each short url once per batch, however many of its clicks asked for it.
+// It doesn't depend on the clicks being written, a failed flush shouldn't also let the short url expire
+func slideShortUrlExpiries(ctx context.Context, logger utils.CustomJsonLogger, dbContext db.DbContext, batch []types.ClickEvent) {
+	slid := map[uuid.UUID]bool{}
+	for _, event := range batch {
+		if !event.SlideExpiry || slid[event.ShortUrlId] {
+			continue
+		}
+		slid[event.ShortUrlId] = true
+
+		if _, err := dbContext.SlideShortUrlExpiry(ctx, event.ShortUrlId); err != nil {
+			logger.Error(ctx, "could not slide short url expiry", "slug", event.Slug, "error", err.Error())
+		}
+	}
+}
@@ -10,7 +10,7 @@ import (
 	"github.com/amieldelatorre/shurl/internal/utils"
 )
 
-func ShortUrlCleanupWorker(ctx context.Context, logger utils.CustomJsonLogger, intervalSeconds int, dbContext db.DbContext, errorsFatal bool) {
+func ShortUrlCleanupWorker(ctx context.Context, logger utils.CustomJsonLogger, intervalSeconds int, exhaustedGraceSeconds int, dbContext db.DbContext, errorsFatal bool) {
 	ctx = context.WithValue(ctx, utils.RequestIdName, "shortUrlCleanupWorker")
 	logger.Info(ctx, fmt.Sprintf("starting short url cleanup worker with interval an of %d seconds", intervalSeconds))
 	handlers.ShortUrlCleanupWorkerRunning = true
@@ -26,7 +26,7 @@ func ShortUrlCleanupWorker(ctx context.Context, logger utils.CustomJsonLogger, i
 			return
 		case <-ticker.C:
 			logger.Debug(ctx, "short url cleanup worker woken up, performing cleanup")
-			err := performShortUrlCleanup(ctx, logger, dbContext)
+			err := performShortUrlCleanup(ctx, logger, dbContext, time.Duration(exhaustedGraceSeconds)*time.Second)
 			if err != nil {
 				logger.Error(ctx, err.Error())
 				if errorsFatal {
@@ -41,12 +41,19 @@ func ShortUrlCleanupWorker(ctx context.Context, logger utils.CustomJsonLogger, i
 	}
 }
 
-func performShortUrlCleanup(ctx context.Context, logger utils.CustomJsonLogger, dbContext db.DbContext) error {
+func performShortUrlCleanup(ctx context.Context, logger utils.CustomJsonLogger, dbContext db.DbContext, exhaustedGrace time.Duration) error {
 	numCleaned, err := dbContext.DeleteExpiredShortUrls(ctx)
 	if err != nil {
 		return err
 	}
 
 	logger.Info(ctx, fmt.Sprintf("Number of short urls cleaned: %d", numCleaned))
+
+	numExhaustedCleaned, err := dbContext.DeleteExhaustedShortUrls(ctx, time.Now().Add(-exhaustedGrace))
+	if err != nil {
+		return err
+	}
+
+	logger.Info(ctx, fmt.Sprintf("Number of exhausted short urls cleaned: %d", numExhaustedCleaned))
 	return nil
 }
@@ -0,0 +1,52 @@
+package workers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/amieldelatorre/shurl/internal/db"
+	"github.com/amieldelatorre/shurl/internal/handlers"
+	"github.com/amieldelatorre/shurl/internal/utils"
+)
+
+func TrashCleanupWorker(ctx context.Context, logger utils.CustomJsonLogger, intervalSeconds int, retentionSeconds int, dbContext db.DbContext, errorsFatal bool) {
+	ctx = context.WithValue(ctx, utils.RequestIdName, "trashCleanupWorker")
+	logger.Info(ctx, fmt.Sprintf("starting trash cleanup worker with an interval of %d seconds and a retention of %d seconds", intervalSeconds, retentionSeconds))
+	handlers.TrashCleanupWorkerRunning = true
+
+	ticker := time.NewTicker(time.Duration(intervalSeconds) * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			logger.Info(ctx, "signal received, shutting down trash cleanup worker")
+			handlers.TrashCleanupWorkerRunning = false
+			return
+		case <-ticker.C:
+			logger.Debug(ctx, "trash cleanup worker woken up, performing cleanup")
+			err := performTrashCleanup(ctx, logger, dbContext, time.Duration(retentionSeconds)*time.Second)
+			if err != nil {
+				logger.Error(ctx, err.Error())
+				if errorsFatal {
+					logger.Error(ctx, "trash_cleanup_worker.errors_fatal is set to true, exiting worker")
+					handlers.TrashCleanupWorkerRunning = false
+					return
+				}
+			}
+
+			logger.Debug(ctx, fmt.Sprintf("trash cleanup worker sleeping for %d seconds", intervalSeconds))
+		}
+	}
+}
+
+func performTrashCleanup(ctx context.Context, logger utils.CustomJsonLogger, dbContext db.DbContext, retention time.Duration) error {
+	numPurged, err := dbContext.PurgeDeletedShortUrls(ctx, time.Now().Add(-retention))
+	if err != nil {
+		return err
+	}
+
+	logger.Info(ctx, fmt.Sprintf("Number of short urls purged from the trash: %d", numPurged))
+	return nil
+}